@@ -4,6 +4,9 @@ import (
 	"context"
 
 	"github.com/urfave/cli/v3"
+
+	"github.com/stupside/castor/internal/cast"
+	"github.com/stupside/castor/internal/daemon"
 )
 
 func (a *app) castEpisodeCommand() *cli.Command {
@@ -35,12 +38,15 @@ func (a *app) castEpisodeCommand() *cli.Command {
 			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			cfg, err := a.config()
-			if err != nil {
-				return err
-			}
+			job := daemon.Job{Kind: daemon.KindEpisode, Target: itemID, Season: uint(season), Episode: uint(episode)}
+			return a.castJob(ctx, cmd, job, func() error {
+				cfg, err := a.config()
+				if err != nil {
+					return err
+				}
 
-			return a.extractAndCast(ctx, cmd, cfg.AllEpisodeURLs(itemID, uint(season), uint(episode)))
+				return a.extractAndCast(ctx, cmd, cast.EpisodeKey(itemID, uint(season), uint(episode)), cfg.AllEpisodeURLs(itemID, uint(season), uint(episode)))
+			})
 		},
 	}
 }
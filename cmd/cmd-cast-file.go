@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/stupside/castor/internal/browse"
+	"github.com/stupside/castor/internal/cast"
+	"github.com/stupside/castor/internal/daemon"
+	"github.com/stupside/castor/internal/event"
+	"github.com/stupside/castor/internal/media"
+)
+
+func (a *app) castFileCommand() *cli.Command {
+	var target string
+
+	return &cli.Command{
+		Name:  "file",
+		Usage: "Cast a local file, or pick one from a directory",
+		Arguments: []cli.Argument{
+			&cli.StringArg{
+				Name:        "path",
+				Destination: &target,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if target == "" {
+				return fmt.Errorf("missing path argument")
+			}
+			// The daemon opens the file from its own working directory.
+			path, err := filepath.Abs(target)
+			if err != nil {
+				return fmt.Errorf("resolving %s: %w", target, err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				if path, err = browse.PickFile(path); err != nil {
+					return fmt.Errorf("picking file: %w", err)
+				}
+				if path == "" {
+					return nil
+				}
+			}
+
+			if cmd.Bool("dry-run") {
+				a.printf("%s\n", path)
+				event.Emit(ctx, event.CandidatesListed, event.CandidatesData{
+					Candidates: []event.Candidate{{URL: path, ContentType: media.DetectFromFileName(path)}},
+				})
+				return nil
+			}
+
+			return a.castJob(ctx, cmd, daemon.Job{Kind: daemon.KindFile, Target: path}, func() error {
+				cfg, err := a.config()
+				if err != nil {
+					return err
+				}
+				return cast.PlayFile(ctx, cfg.Playback(), path, playOptions(cmd)...)
+			})
+		},
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 
 	"github.com/urfave/cli/v3"
+
+	"github.com/stupside/castor/internal/cast"
+	"github.com/stupside/castor/internal/daemon"
 )
 
 func (a *app) castMovieCommand() *cli.Command {
@@ -19,12 +22,14 @@ func (a *app) castMovieCommand() *cli.Command {
 			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			cfg, err := a.config()
-			if err != nil {
-				return err
-			}
+			return a.castJob(ctx, cmd, daemon.Job{Kind: daemon.KindMovie, Target: itemID}, func() error {
+				cfg, err := a.config()
+				if err != nil {
+					return err
+				}
 
-			return a.extractAndCast(ctx, cmd, cfg.AllMovieURLs(itemID))
+				return a.extractAndCast(ctx, cmd, cast.MovieKey(itemID), cfg.AllMovieURLs(itemID))
+			})
 		},
 	}
 }
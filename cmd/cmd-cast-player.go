@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/urfave/cli/v3"
+
+	"github.com/stupside/castor/internal/daemon"
 )
 
 func (a *app) castPlayerCommand() *cli.Command {
@@ -19,7 +21,9 @@ func (a *app) castPlayerCommand() *cli.Command {
 			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			return a.extractAndCast(ctx, cmd, []string{pageURL})
+			return a.castJob(ctx, cmd, daemon.Job{Kind: daemon.KindPlayer, Target: pageURL}, func() error {
+				return a.extractAndCast(ctx, cmd, "", []string{pageURL})
+			})
 		},
 	}
 }
@@ -8,6 +8,8 @@ import (
 	"github.com/urfave/cli/v3"
 
 	"github.com/stupside/castor/internal/cast"
+	"github.com/stupside/castor/internal/daemon"
+	"github.com/stupside/castor/internal/event"
 	"github.com/stupside/castor/internal/media"
 )
 
@@ -30,17 +32,22 @@ func (a *app) castURLCommand() *cli.Command {
 			}
 
 			if cmd.Bool("dry-run") {
-				fmt.Println(urlObj.String())
+				a.printf("%s\n", urlObj.String())
+				event.Emit(ctx, event.CandidatesListed, event.CandidatesData{
+					Candidates: []event.Candidate{{URL: urlObj.String(), ContentType: media.DetectFromExtension(urlObj)}},
+				})
 				return nil
 			}
 
-			cfg, err := a.config()
-			if err != nil {
-				return err
-			}
+			return a.castJob(ctx, cmd, daemon.Job{Kind: daemon.KindURL, Target: urlObj.String()}, func() error {
+				cfg, err := a.config()
+				if err != nil {
+					return err
+				}
 
-			stream := &media.Stream{URL: urlObj, ContentType: media.DetectFromExtension(urlObj)}
-			return cast.Play(ctx, cfg.Playback(), stream)
+				stream := &media.Stream{URL: urlObj, ContentType: media.DetectFromExtension(urlObj)}
+				return cast.Play(ctx, cfg.Playback(), stream, playOptions(cmd)...)
+			})
 		},
 	}
 }
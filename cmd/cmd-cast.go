@@ -1,15 +1,24 @@
 package cmd
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/urfave/cli/v3"
 
 	"github.com/stupside/castor/internal/browse"
 	"github.com/stupside/castor/internal/browse/tmdb"
 	"github.com/stupside/castor/internal/cast"
+	"github.com/stupside/castor/internal/config"
+	"github.com/stupside/castor/internal/daemon"
+	"github.com/stupside/castor/internal/event"
 	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/metrics"
 	"github.com/stupside/castor/internal/source/extract"
 	"github.com/stupside/castor/internal/source/resolve"
 )
@@ -24,6 +33,34 @@ func (a *app) castCommand() *cli.Command {
 				Aliases: []string{"d"},
 				Usage:   "Print found streaming URLs instead of casting",
 			},
+			&cli.StringFlag{
+				Name:  "record",
+				Usage: "Also save the cast to this .mkv or .ts file, with whisper subtitles as a soft track (served casts only)",
+			},
+			&cli.StringFlag{
+				Name:  "bitrate",
+				Usage: "Cap the video castor serves at this bitrate, e.g. 4M or 2500k (served casts only)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "audio-lang",
+				Usage: "Play the audio in the first of these languages the source has, e.g. en,fr (default: resolver.audio_languages)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "subtitle-lang",
+				Usage: "Show the source's own subtitles in the first of these languages it has, else have whisper translate into English for en, or write what is spoken for another (default: resolver.subtitle_languages, whisper.task)",
+			},
+			&cli.StringFlag{
+				Name:  "subtitles",
+				Usage: "Burn in this SubRip, WebVTT or ASS file, a path or an http(s) URL, in place of any other subtitles (served casts only)",
+			},
+			&cli.StringFlag{
+				Name:  "save-subtitles",
+				Usage: "Also save the subtitles the cast draws to this .srt or .vtt file as it plays, to correct and pass back with --subtitles (served casts only)",
+			},
+			&cli.DurationFlag{
+				Name:  "subtitle-offset",
+				Usage: "Move the --subtitles cues by this much, later when positive, e.g. --subtitle-offset=-1.5s",
+			},
 		},
 		Action: a.castInteractive,
 		Commands: []*cli.Command{
@@ -31,6 +68,7 @@ func (a *app) castCommand() *cli.Command {
 			a.castMovieCommand(),
 			a.castEpisodeCommand(),
 			a.castPlayerCommand(),
+			a.castFileCommand(),
 		},
 	}
 }
@@ -65,22 +103,112 @@ func (a *app) castInteractive(ctx context.Context, cmd *cli.Command) error {
 		return nil
 	}
 
+	job := daemon.Job{
+		Target:     sel.TMDBID,
+		Device:     devInfo.Name,
+		DeviceType: devInfo.Type,
+		Host:       devInfo.Address,
+	}
 	var urls []string
+	var key string
 	switch sel.Kind {
 	case browse.KindMovie:
-		urls = cfg.AllMovieURLs(sel.TMDBID)
+		job.Kind = daemon.KindMovie
+		urls, key = cfg.AllMovieURLs(sel.TMDBID), cast.MovieKey(sel.TMDBID)
 	case browse.KindEpisode:
-		urls = cfg.AllEpisodeURLs(sel.TMDBID, sel.Season, sel.Episode)
+		job.Kind, job.Season, job.Episode = daemon.KindEpisode, sel.Season, sel.Episode
+		urls, key = cfg.AllEpisodeURLs(sel.TMDBID, sel.Season, sel.Episode), cast.EpisodeKey(sel.TMDBID, sel.Season, sel.Episode)
 	}
 
-	fmt.Printf("Casting: %s\n", sel.Title)
+	a.printf("Casting: %s\n", sel.Title)
+
+	return a.castJob(ctx, cmd, job, func() error { return a.extractAndCast(ctx, cmd, key, urls) })
+}
+
+// castJob hands job to a running daemon when there is one, and otherwise runs
+// local, the same cast in this process. A dry run always runs locally: it
+// prints candidates rather than casting, which a queued job cannot do. So does
+// --output json, whose events are produced by the process that casts.
+func (a *app) castJob(ctx context.Context, cmd *cli.Command, job daemon.Job, local func() error) error {
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+	// A cast in this process reads the languages from its config, a daemon job
+	// carries them.
+	if langs := cmd.StringSlice("audio-lang"); len(langs) > 0 {
+		cfg.Resolver.AudioLanguages = langs
+		job.AudioLanguages = langs
+	}
+	if langs := cmd.StringSlice("subtitle-lang"); len(langs) > 0 {
+		cfg.Resolver.SubtitleLanguages = langs
+		cfg.Whisper = cfg.Whisper.In(langs)
+		job.SubtitleLanguages = langs
+	}
+	if cmd.Bool("dry-run") {
+		return local()
+	}
+	if record := cmd.String("record"); record != "" {
+		if err := cast.CheckRecord(record); err != nil {
+			return err
+		}
+		// The daemon writes the file from its own working directory.
+		if job.Record, err = filepath.Abs(record); err != nil {
+			return fmt.Errorf("resolving record path: %w", err)
+		}
+	}
+	if save := cmd.String("save-subtitles"); save != "" {
+		if err := cast.CheckSaveSubtitles(save); err != nil {
+			return err
+		}
+		if job.SaveSubtitles, err = filepath.Abs(save); err != nil {
+			return fmt.Errorf("resolving save subtitles path: %w", err)
+		}
+	}
+	if job.Bitrate, err = maxBitrate(cmd); err != nil {
+		return err
+	}
+	subs, err := subtitleFile(cmd)
+	if err != nil {
+		return err
+	}
+	job.Subtitles, job.SubtitleOffset = subs.Location, subs.Offset.Seconds()
+	if a.noDaemon || event.Enabled(ctx) {
+		return runLocal(ctx, cfg, local)
+	}
+	socket, err := cfg.Daemon.SocketPath()
+	if err != nil {
+		return err
+	}
+	client, err := daemon.Dial(ctx, socket)
+	if err != nil {
+		slog.DebugContext(ctx, "casting locally", "reason", err)
+		return runLocal(ctx, cfg, local)
+	}
 
-	return a.extractAndCast(ctx, cmd, urls)
+	info, err := client.Submit(ctx, job)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Queued on daemon as job %s\n", info.ID)
+	info, err = client.Wait(ctx, info.ID, func(info daemon.JobInfo) {
+		fmt.Printf("Job %s: %s\n", info.ID, info.State)
+	})
+	if err != nil {
+		return err
+	}
+	if info.State == daemon.StateFailed {
+		return fmt.Errorf("daemon job %s failed: %s", info.ID, info.Error)
+	}
+	return nil
 }
 
 // extractAndCast creates an extractor, extracts streams from the given URLs,
-// and either lists them (--dry-run) or casts the best one.
-func (a *app) extractAndCast(ctx context.Context, cmd *cli.Command, urls []string) error {
+// and either lists them (--dry-run) or casts the best one, falling over to the
+// rest in rank order. key, when not empty, is the title's spool cache key (see
+// cast.WithCacheKey): a title the cache holds is cast from it, with nothing
+// extracted unless its pull has to carry on.
+func (a *app) extractAndCast(ctx context.Context, cmd *cli.Command, key string, urls []string) error {
 	cfg, err := a.config()
 	if err != nil {
 		return err
@@ -91,32 +219,163 @@ func (a *app) extractAndCast(ctx context.Context, cmd *cli.Command, urls []strin
 		return fmt.Errorf("creating extractor: %w", err)
 	}
 
+	// A pull that breaks partway is resumed from the same pages extracted
+	// again, their signed URLs minted afresh.
+	rerank := func(ctx context.Context) ([]*media.Stream, error) {
+		streams, err := ext.ExtractAll(ctx, urls)
+		if err != nil {
+			return nil, fmt.Errorf("extracting streams: %w", err)
+		}
+		return resolve.RankStreams(ctx, cfg.Resolver, streams)
+	}
+
+	opts := playOptions(cmd)
+	if key != "" && !cmd.Bool("dry-run") {
+		opts = append(opts, cast.WithCacheKey(key))
+		if ok, err := cast.PlayCached(ctx, cfg.Playback(), key, rerank, opts...); ok {
+			return err
+		}
+	}
+
 	streams, err := ext.ExtractAll(ctx, urls)
 	if err != nil {
 		return fmt.Errorf("extracting streams: %w", err)
 	}
-
-	return a.handleStreams(ctx, cmd, streams)
+	return a.handleStreams(ctx, cmd, streams, rerank, opts...)
 }
 
 // handleStreams handles the --dry-run / cast logic shared by player, movie, and episode commands.
-func (a *app) handleStreams(ctx context.Context, cmd *cli.Command, streams []*media.Stream) error {
+func (a *app) handleStreams(ctx context.Context, cmd *cli.Command, streams []*media.Stream, rerank cast.RerankFunc, opts ...cast.Option) error {
 	cfg, err := a.config()
 	if err != nil {
 		return err
 	}
 
 	if cmd.Bool("dry-run") {
-		for _, d := range resolve.ListStreams(ctx, cfg.Resolver, streams) {
-			fmt.Printf("%d\t%s\n", d.BitRate, d.URL)
+		details := resolve.ListStreams(ctx, cfg.Resolver, streams)
+		listed := event.CandidatesData{Candidates: make([]event.Candidate, len(details))}
+		for i, d := range details {
+			line := fmt.Sprintf("%d\t%s", d.BitRate, d.URL)
+			if len(d.AudioLanguages) > 0 || len(d.SubtitleLanguages) > 0 {
+				line += "\t" + languageList(d.AudioLanguages)
+			}
+			if len(d.SubtitleLanguages) > 0 {
+				line += "\tsubtitles:" + languageList(d.SubtitleLanguages)
+			}
+			a.printf("%s\n", line)
+			listed.Candidates[i] = event.Candidate{
+				URL:               d.URL,
+				BitRate:           d.BitRate,
+				AudioLanguages:    d.AudioLanguages,
+				SubtitleLanguages: d.SubtitleLanguages,
+			}
 		}
+		event.Emit(ctx, event.CandidatesListed, listed)
 		return nil
 	}
 
-	best, err := resolve.RankStreams(ctx, cfg.Resolver, streams)
+	ranked, err := resolve.RankStreams(ctx, cfg.Resolver, streams)
 	if err != nil {
 		return fmt.Errorf("ranking streams: %w", err)
 	}
 
-	return cast.Play(ctx, cfg.Playback(), best)
+	return cast.PlayRanked(ctx, cfg.Playback(), ranked, rerank, opts...)
+}
+
+// languageList renders a candidate's audio or subtitle languages for
+// --dry-run, an untagged track as "und" (ISO 639's undetermined).
+func languageList(langs []string) string {
+	shown := make([]string, len(langs))
+	for i, l := range langs {
+		shown[i] = cmp.Or(l, "und")
+	}
+	return strings.Join(shown, ",")
+}
+
+// playOptions are the per-cast options a cast command's flags ask for.
+func playOptions(cmd *cli.Command) []cast.Option {
+	var opts []cast.Option
+	if record := cmd.String("record"); record != "" {
+		opts = append(opts, cast.WithRecord(record))
+	}
+	// castJob has already rejected an invalid --bitrate and a missing
+	// --subtitles file.
+	if bits, _ := maxBitrate(cmd); bits > 0 {
+		opts = append(opts, cast.WithMaxBitrate(bits))
+	}
+	if subs, _ := subtitleFile(cmd); subs.Set() {
+		opts = append(opts, cast.WithSubtitles(subs))
+	}
+	if save := cmd.String("save-subtitles"); save != "" {
+		opts = append(opts, cast.WithSaveSubtitles(save))
+	}
+	return opts
+}
+
+// subtitleFile is --subtitles moved by --subtitle-offset, zero when unset. A
+// path is made absolute, as the daemon reads it from its own working directory,
+// and checked for here, so a typo fails before anything is extracted.
+func subtitleFile(cmd *cli.Command) (cast.Subtitles, error) {
+	subs := cast.Subtitles{Location: cmd.String("subtitles"), Offset: cmd.Duration("subtitle-offset")}
+	switch {
+	case !subs.Set():
+		if subs.Offset != 0 {
+			return cast.Subtitles{}, fmt.Errorf("--subtitle-offset needs --subtitles")
+		}
+		return subs, nil
+	case subs.Remote():
+		return subs, nil
+	}
+	path, err := filepath.Abs(subs.Location)
+	if err != nil {
+		return cast.Subtitles{}, fmt.Errorf("--subtitles: %w", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return cast.Subtitles{}, fmt.Errorf("--subtitles: %w", err)
+	}
+	subs.Location = path
+	return subs, nil
+}
+
+// maxBitrate is --bitrate in bits per second, 0 when unset.
+func maxBitrate(cmd *cli.Command) (int64, error) {
+	rate := cmd.String("bitrate")
+	if rate == "" {
+		return 0, nil
+	}
+	bits, err := cast.ParseBitrate(rate)
+	if err != nil {
+		return 0, fmt.Errorf("--bitrate: %w", err)
+	}
+	return bits, nil
+}
+
+// runLocal runs a cast in this process and closes the event stream with its
+// outcome.
+func runLocal(ctx context.Context, cfg *config.Config, cast func() error) error {
+	err := serveMetrics(ctx, cfg, cast)
+	finished := event.FinishedData{Result: "done"}
+	switch {
+	case ctx.Err() != nil:
+		finished.Result = "interrupted"
+	case err != nil:
+		finished = event.FinishedData{Result: "failed", Error: err.Error()}
+	}
+	event.Emit(ctx, event.Finished, finished)
+	return err
+}
+
+// serveMetrics runs fn with the metrics endpoint up, when it is enabled. A
+// daemon serves its own, so only a cast in this process needs one.
+func serveMetrics(ctx context.Context, cfg *config.Config, fn func() error) error {
+	if !cfg.Metrics.Enable {
+		return fn()
+	}
+	srv, err := metrics.New(cfg.Metrics)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+	slog.InfoContext(ctx, "metrics endpoint listening", "address", srv.Addr().String())
+	return fn()
 }
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/stupside/castor/internal/daemon"
+)
+
+// daemonCommand runs castor as a long-lived cast service. While it runs, the
+// cast commands submit their jobs to it instead of casting themselves.
+func (a *app) daemonCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "daemon",
+		Usage: "Run a long-lived cast service the cast commands hand their jobs to",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			cfg, err := a.config()
+			if err != nil {
+				return err
+			}
+			return daemon.Serve(ctx, cfg)
+		},
+	}
+}
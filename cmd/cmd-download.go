@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/stupside/castor/internal/cast"
+	"github.com/stupside/castor/internal/config"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/source/extract"
+	"github.com/stupside/castor/internal/source/resolve"
+)
+
+// sourceFunc finds the stream a download saves, ranking candidates under res.
+type sourceFunc func(ctx context.Context, cfg *config.Config, res resolve.Config) (*media.Stream, error)
+
+func (a *app) downloadCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "download",
+		Usage: "Save a stream to disk without a device",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "File to write: .mkv, .mp4 or .ts",
+			},
+			&cli.IntFlag{
+				Name:  "max-height",
+				Usage: "Tallest rendition to pick (default: resolver.max_height)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "audio-lang",
+				Usage: "Keep the audio in the first of these languages the source has, e.g. en,fr (default: resolver.audio_languages)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "subtitle-lang",
+				Usage: "Write the source's own subtitles in the first of these languages it has as an .srt beside the file, else whisper's with --subtitles, in English for en (default: resolver.subtitle_languages)",
+			},
+			&cli.BoolFlag{
+				Name:  "subtitles",
+				Usage: "Also transcribe with whisper and write an .srt beside the file",
+			},
+		},
+		Commands: []*cli.Command{
+			a.downloadTargetCommand("url", "Download a direct video URL", "url", func(ctx context.Context, _ *config.Config, _ resolve.Config, target string) (*media.Stream, error) {
+				u, err := url.Parse(target)
+				if err != nil {
+					return nil, fmt.Errorf("invalid URL %q: %w", target, err)
+				}
+				return &media.Stream{URL: u, ContentType: media.DetectFromExtension(u)}, nil
+			}),
+			a.downloadTargetCommand("player", "Download the video on a player page", "url", func(ctx context.Context, cfg *config.Config, res resolve.Config, target string) (*media.Stream, error) {
+				return extractBest(ctx, cfg, res, []string{target})
+			}),
+			a.downloadTargetCommand("movie", "Download a movie by item ID", "itemID", func(ctx context.Context, cfg *config.Config, res resolve.Config, target string) (*media.Stream, error) {
+				return extractBest(ctx, cfg, res, cfg.AllMovieURLs(target))
+			}),
+			a.downloadEpisodeCommand(),
+		},
+	}
+}
+
+// downloadTargetCommand is a download subcommand taking one argument, arg,
+// which find turns into the stream to save.
+func (a *app) downloadTargetCommand(name, usage, arg string, find func(context.Context, *config.Config, resolve.Config, string) (*media.Stream, error)) *cli.Command {
+	var target string
+	return &cli.Command{
+		Name:  name,
+		Usage: usage,
+		Arguments: []cli.Argument{
+			&cli.StringArg{Name: arg, Destination: &target},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if target == "" {
+				return fmt.Errorf("missing %s argument", arg)
+			}
+			return a.download(ctx, cmd, func(ctx context.Context, cfg *config.Config, res resolve.Config) (*media.Stream, error) {
+				return find(ctx, cfg, res, target)
+			})
+		},
+	}
+}
+
+func (a *app) downloadEpisodeCommand() *cli.Command {
+	var season, episode int
+	var itemID string
+	return &cli.Command{
+		Name:  "episode",
+		Usage: "Download a series episode by item ID",
+		Flags: []cli.Flag{
+			&cli.IntFlag{Name: "season", Usage: "Season number", Required: true, Destination: &season},
+			&cli.IntFlag{Name: "episode", Usage: "Episode number", Required: true, Destination: &episode},
+		},
+		Arguments: []cli.Argument{
+			&cli.StringArg{Name: "itemID", Destination: &itemID},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return a.download(ctx, cmd, func(ctx context.Context, cfg *config.Config, res resolve.Config) (*media.Stream, error) {
+				return extractBest(ctx, cfg, res, cfg.AllEpisodeURLs(itemID, uint(season), uint(episode)))
+			})
+		},
+	}
+}
+
+// download saves the stream source finds to --out. It always runs in this
+// process: the daemon's warm state is for casting, and a download's file and
+// progress belong to whoever asked for it.
+func (a *app) download(ctx context.Context, cmd *cli.Command, source sourceFunc) error {
+	out := cmd.String("out")
+	if out == "" {
+		return errors.New("--out is required")
+	}
+	if err := cast.CheckRecord(out); err != nil {
+		return err
+	}
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+
+	playback := cfg.Playback()
+	if h := cmd.Int("max-height"); h > 0 {
+		playback.Resolver.MaxHeight = h
+	}
+	if langs := cmd.StringSlice("audio-lang"); len(langs) > 0 {
+		playback.Resolver.AudioLanguages = langs
+	}
+	if langs := cmd.StringSlice("subtitle-lang"); len(langs) > 0 {
+		playback.Resolver.SubtitleLanguages = langs
+		playback.Whisper = playback.Whisper.In(langs)
+	}
+	playback.Whisper.Enable = cmd.Bool("subtitles")
+
+	return runLocal(ctx, cfg, func() error {
+		stream, err := source(ctx, cfg, playback.Resolver)
+		if err != nil {
+			return err
+		}
+		return cast.Download(ctx, playback, stream, out, func(ctx context.Context) (*media.Stream, error) {
+			return source(ctx, cfg, playback.Resolver)
+		})
+	})
+}
+
+// extractBest extracts every page and ranks what they yield under res.
+func extractBest(ctx context.Context, cfg *config.Config, res resolve.Config, pages []string) (*media.Stream, error) {
+	ext, err := extract.New(cfg.Extractor())
+	if err != nil {
+		return nil, fmt.Errorf("creating extractor: %w", err)
+	}
+	streams, err := ext.ExtractAll(ctx, pages)
+	if err != nil {
+		return nil, fmt.Errorf("extracting streams: %w", err)
+	}
+	ranked, err := resolve.RankStreams(ctx, res, streams)
+	if err != nil {
+		return nil, fmt.Errorf("ranking streams: %w", err)
+	}
+	return ranked[0], nil
+}
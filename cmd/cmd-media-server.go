@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/stupside/castor/internal/mediaserver"
+)
+
+// mediaServerCommand publishes a folder as a DLNA media server, for TVs to
+// browse from their own UI.
+func (a *app) mediaServerCommand() *cli.Command {
+	var dir string
+
+	return &cli.Command{
+		Name:  "media-server",
+		Usage: "Publish a folder of videos as a DLNA media server TVs can browse",
+		Arguments: []cli.Argument{
+			&cli.StringArg{
+				Name:        "dir",
+				Destination: &dir,
+			},
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "Name TVs list the server under (overrides media_server.name)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			cfg, err := a.config()
+			if err != nil {
+				return err
+			}
+			ms := cfg.Media
+			if dir != "" {
+				ms.Dir = dir
+			}
+			if cmd.IsSet("name") {
+				ms.Name = cmd.String("name")
+			}
+			return mediaserver.Serve(ctx, cfg.Playback().Config, ms)
+		},
+	}
+}
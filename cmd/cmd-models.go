@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/stupside/castor/internal/cast"
+)
+
+// modelsCommand manages the whisper and VAD models transcription loads. A cast
+// downloads what it needs on first use anyway; these let a model be fetched
+// ahead of a cast on a slow link, checked, swapped for another, or reclaimed.
+func (a *app) modelsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "models",
+		Usage: "Manage the whisper and VAD models subtitles are transcribed with",
+		Commands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List the model catalog, what is downloaded and what the config uses",
+				Action: a.listModels,
+			},
+			{
+				Name:      "pull",
+				Usage:     "Download models, resuming an interrupted download (the ones the config uses, by default)",
+				ArgsUsage: "[name...]",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					ms, err := a.modelArgs(cmd.Args().Slice())
+					if err != nil {
+						return err
+					}
+					for _, m := range ms {
+						path, err := cast.PullModel(ctx, m)
+						if err != nil {
+							return err
+						}
+						fmt.Printf("%s\t%s\n", m.Name, path)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "rm",
+				Usage:     "Delete downloaded models",
+				ArgsUsage: "<name...>",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if cmd.Args().Len() == 0 {
+						return fmt.Errorf("missing model name argument")
+					}
+					ms, err := lookupModels(cmd.Args().Slice())
+					if err != nil {
+						return err
+					}
+					for _, m := range ms {
+						if err := m.Remove(); err != nil {
+							return err
+						}
+						fmt.Printf("%s\tremoved\n", m.Name)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "Check downloaded models against their SHA-256 digests (all of them, by default)",
+				ArgsUsage: "[name...]",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					ms, err := lookupModels(cmd.Args().Slice())
+					if err != nil {
+						return err
+					}
+					if cmd.Args().Len() == 0 {
+						ms = nil
+						for _, m := range cast.Models() {
+							if _, ok, _ := m.Installed(); ok {
+								ms = append(ms, m)
+							}
+						}
+						if len(ms) == 0 {
+							fmt.Println("no models downloaded")
+							return nil
+						}
+					}
+					var errs []error
+					for _, m := range ms {
+						if err := m.Verify(ctx); err != nil {
+							fmt.Printf("%s\tFAILED\n", m.Name)
+							errs = append(errs, err)
+							continue
+						}
+						fmt.Printf("%s\tOK\n", m.Name)
+					}
+					return errors.Join(errs...)
+				},
+			},
+		},
+	}
+}
+
+// listModels prints the catalog, marking the models the config has a cast
+// load. Listing needs no config: without one, nothing is marked.
+func (a *app) listModels(ctx context.Context, cmd *cli.Command) error {
+	used := map[string]bool{}
+	if ms, err := a.configuredModels(); err == nil {
+		for _, m := range ms {
+			used[m.Name] = true
+		}
+	} else {
+		slog.DebugContext(ctx, "listing models without config", "error", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tLANGUAGES\tDOWNLOADED\tUSED")
+	for _, m := range cast.Models() {
+		langs := "any"
+		switch {
+		case m.Name == cast.VADModel:
+			langs = "-"
+		case m.English:
+			langs = "English"
+		}
+		_, downloaded, err := m.Installed()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t~%d MiB\t%s\t%s\t%s\n", m.Name, m.Size>>20, langs, yesNo(downloaded), yesNo(used[m.Name]))
+	}
+	return w.Flush()
+}
+
+// modelArgs is the models names picks out of the catalog, or with no names
+// the ones the config has a cast load.
+func (a *app) modelArgs(names []string) ([]cast.Model, error) {
+	if len(names) > 0 {
+		return lookupModels(names)
+	}
+	return a.configuredModels()
+}
+
+// configuredModels is what a cast under the config transcribes with: its
+// whisper model, unless whisper.model_path names a file of the user's own,
+// and the VAD model.
+func (a *app) configuredModels() ([]cast.Model, error) {
+	cfg, err := a.config()
+	if err != nil {
+		return nil, err
+	}
+	var ms []cast.Model
+	m, ok, err := cast.WhisperModel(cfg.Whisper)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		ms = append(ms, m)
+	}
+	vad, err := cast.LookupModel(cast.VADModel)
+	if err != nil {
+		return nil, err
+	}
+	return append(ms, vad), nil
+}
+
+func lookupModels(names []string) ([]cast.Model, error) {
+	ms := make([]cast.Model, 0, len(names))
+	for _, name := range names {
+		m, err := cast.LookupModel(name)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "-"
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/urfave/cli/v3"
 
 	"github.com/stupside/castor/internal/config"
+	"github.com/stupside/castor/internal/event"
 	"github.com/stupside/castor/internal/version"
 )
 
@@ -22,12 +23,22 @@ import (
 type app struct {
 	configPath string
 	debug      bool
+	noDaemon   bool
+	output     string
 
 	once sync.Once
 	cfg  *config.Config
 	err  error
 }
 
+// printf writes human-oriented output, which --output json keeps off stdout so
+// the event stream stays parseable.
+func (a *app) printf(format string, args ...any) {
+	if a.output != "json" {
+		fmt.Printf(format, args...)
+	}
+}
+
 // config loads the configuration on first use and memoizes the result.
 func (a *app) config() (*config.Config, error) {
 	a.once.Do(func() {
@@ -59,6 +70,18 @@ func Root() *cli.Command {
 				Usage:       "Enable debug logging",
 				Destination: &a.debug,
 			},
+			&cli.StringFlag{
+				Name:        "output",
+				Aliases:     []string{"o"},
+				Usage:       "Output format: text, or json for one lifecycle event per line on stdout",
+				Value:       "text",
+				Destination: &a.output,
+			},
+			&cli.BoolFlag{
+				Name:        "no-daemon",
+				Usage:       "Cast in this process even when a daemon is running",
+				Destination: &a.noDaemon,
+			},
 		},
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
 			if a.debug {
@@ -70,11 +93,22 @@ func Root() *cli.Command {
 					}),
 				))
 			}
+			switch a.output {
+			case "text":
+			case "json":
+				ctx = event.WithEmitter(ctx, event.NewEmitter(os.Stdout))
+			default:
+				return ctx, fmt.Errorf("unknown output format %q: want text or json", a.output)
+			}
 			return ctx, nil
 		},
 		Commands: []*cli.Command{
 			a.castCommand(),
 			a.scanCommand(),
+			a.daemonCommand(),
+			a.mediaServerCommand(),
+			a.downloadCommand(),
+			a.modelsCommand(),
 			infoCommand(),
 		},
 	}
@@ -0,0 +1,188 @@
+package browse
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/stupside/castor/internal/media"
+)
+
+// PickFile lists the media files under dir, recursively, and returns the one
+// the user picks, or "" when they quit without picking.
+func PickFile(dir string) (string, error) {
+	files, err := mediaFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no media files under %s", dir)
+	}
+	final, err := tea.NewProgram(newFilePickerModel(files), tea.WithAltScreen()).Run()
+	if err != nil {
+		return "", err
+	}
+	if fm, ok := final.(filePickerModel); ok {
+		return fm.selected, nil
+	}
+	return "", nil
+}
+
+// mediaFile is one castable file, named relative to the picked directory.
+type mediaFile struct {
+	path string
+	rel  string
+	size int64
+}
+
+// mediaFiles walks dir for files whose extension names a container castor
+// knows, sorted by relative path so a series lists in episode order. Hidden
+// directories are skipped, and an unreadable entry is skipped rather than
+// failing the whole listing.
+func mediaFiles(dir string) ([]mediaFile, error) {
+	var files []mediaFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		// A playlist names other files rather than holding media itself.
+		if ct := media.DetectFromFileName(path); !d.Type().IsRegular() || ct == "" || ct == media.HLS {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, mediaFile{path: path, rel: rel, size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", dir, err)
+	}
+	slices.SortFunc(files, func(a, b mediaFile) int { return strings.Compare(a.rel, b.rel) })
+	return files, nil
+}
+
+type fileItem mediaFile
+
+func (i fileItem) Title() string       { return i.rel }
+func (i fileItem) Description() string { return formatSize(i.size) }
+func (i fileItem) FilterValue() string { return i.rel }
+
+// formatSize renders a byte count the way a file listing does.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+type filePickerModel struct {
+	list     list.Model
+	selected string
+	w        int
+}
+
+func newFilePickerModel(files []mediaFile) filePickerModel {
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.NormalTitle = delegate.Styles.NormalTitle.Foreground(fgPrimary)
+	delegate.Styles.NormalDesc = delegate.Styles.NormalDesc.Foreground(fgMuted)
+	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.
+		Foreground(accent).
+		BorderForeground(accent).
+		Bold(true)
+	delegate.Styles.SelectedDesc = delegate.Styles.SelectedDesc.
+		Foreground(fgSecondary).
+		BorderForeground(accent)
+
+	items := make([]list.Item, len(files))
+	for i, f := range files {
+		items[i] = fileItem(f)
+	}
+	l := list.New(items, delegate, 0, 0)
+	l.SetShowTitle(false)
+	l.SetShowHelp(false)
+	return filePickerModel{list: l}
+}
+
+func (m filePickerModel) Init() tea.Cmd { return nil }
+
+func (m filePickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.w = msg.Width
+		m.list.SetSize(msg.Width-4, max(msg.Height-4, 5))
+		return m, nil
+
+	case tea.KeyMsg:
+		// While the filter is being typed, every key but ctrl+c is text.
+		if m.list.SettingFilter() {
+			if msg.String() == "ctrl+c" {
+				return m, tea.Quit
+			}
+			break
+		}
+		switch {
+		case key.Matches(msg, pickKeys.Quit):
+			return m, tea.Quit
+		case key.Matches(msg, pickKeys.Enter):
+			if it, ok := m.list.SelectedItem().(fileItem); ok {
+				m.selected = it.path
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m filePickerModel) View() string {
+	header := lipgloss.NewStyle().
+		Background(lipgloss.AdaptiveColor{Light: "#F4F4F5", Dark: "#27272A"}).
+		Foreground(accent).
+		Bold(true).
+		Width(m.w).
+		Padding(0, 2).
+		Render("castor  │  Select a file")
+
+	cmds := []string{
+		lipgloss.NewStyle().Foreground(accent).Bold(true).Render("↑/↓") + " " + lipgloss.NewStyle().Foreground(fgMuted).Render("nav"),
+		lipgloss.NewStyle().Foreground(accent).Bold(true).Render("/") + " " + lipgloss.NewStyle().Foreground(fgMuted).Render("filter"),
+		lipgloss.NewStyle().Foreground(accent).Bold(true).Render("↵") + " " + lipgloss.NewStyle().Foreground(fgMuted).Render("cast"),
+		lipgloss.NewStyle().Foreground(accent).Bold(true).Render("q") + " " + lipgloss.NewStyle().Foreground(fgMuted).Render("quit"),
+	}
+	cmdBar := lipgloss.NewStyle().
+		Background(lipgloss.AdaptiveColor{Light: "#E4E4E7", Dark: "#18181B"}).
+		Foreground(fgPrimary).
+		Width(m.w).
+		Padding(0, 2).
+		Render(strings.Join(cmds, lipgloss.NewStyle().Foreground(pDim).Render(" · ")))
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, m.list.View(), cmdBar)
+}
@@ -0,0 +1,60 @@
+package browse
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMediaFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"Show/S01E02.mkv",
+		"Show/S01E01.mkv",
+		"movie.mp4",
+		"recording.ts",
+		"notes.txt",
+		"index.m3u8",
+		".trash/old.mkv",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := mediaFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, filepath.ToSlash(f.rel))
+	}
+	want := []string{"Show/S01E01.mkv", "Show/S01E02.mkv", "movie.mp4", "recording.ts"}
+	if !slices.Equal(got, want) {
+		t.Errorf("mediaFiles = %v, want %v", got, want)
+	}
+
+	if _, err := mediaFiles(filepath.Join(dir, "missing")); err == nil {
+		t.Error("a missing directory should be an error")
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		512:           "512 B",
+		1536:          "1.5 KiB",
+		4 << 30:       "4.0 GiB",
+		1<<40 + 1<<39: "1.5 TiB",
+	}
+	for n, want := range tests {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
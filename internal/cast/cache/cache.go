@@ -0,0 +1,363 @@
+// Package cache keeps the spools of past casts, so casting the same title
+// again plays from local data instead of extracting, probing and pulling it
+// all over.
+//
+// An entry is one title's spool (named by a key: the title's TMDB id, season
+// and episode, or failing that its source URL) together with what a cast
+// learned about it: the source it was pulled from, whether the pull got to
+// the end, the probe, and whisper's cues. A cast holds its entry locked while
+// it runs, so two casts of one title never write the same spool, and the
+// cache is trimmed back under its size, least recently cast first, each time
+// a cast lets its entry go.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/deliver/spool"
+	"github.com/stupside/castor/internal/cast/subtitle/cue"
+	"github.com/stupside/castor/internal/media"
+)
+
+const (
+	spoolFile = "spool.ts"
+	metaFile  = "meta.json"
+	lockFile  = "lock"
+)
+
+// ErrBusy is returned by Acquire for an entry another cast holds.
+var ErrBusy = errors.New("cache entry in use by another cast")
+
+// Config is the cache section. The cache is off unless MaxSize is set: a
+// cached title costs its whole size on disk until it is trimmed.
+type Config struct {
+	// Dir is where the cached spools are kept. Empty means castor/spools
+	// under the user cache directory.
+	Dir string `yaml:"dir"`
+	// MaxSize bounds the cache in bytes, e.g. "20GiB". Zero turns it off.
+	MaxSize spool.Bytes `yaml:"max_size" validate:"min=0"`
+}
+
+// Enabled reports whether c keeps anything.
+func (c Config) Enabled() bool { return c.MaxSize > 0 }
+
+// Cache is an open spool cache.
+type Cache struct {
+	dir     string
+	maxSize int64
+}
+
+// Open opens the cache cfg configures, creating its directory. It returns nil
+// when cfg turns the cache off.
+func Open(cfg Config) (*Cache, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	dir := cfg.Dir
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("locating user cache dir: %w", err)
+		}
+		dir = filepath.Join(base, "castor", "spools")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating spool cache directory: %w", err)
+	}
+	return &Cache{dir: dir, maxSize: int64(cfg.MaxSize)}, nil
+}
+
+// MovieKey is the key of a movie, by its TMDB id.
+func MovieKey(id string) string { return "movie:" + id }
+
+// EpisodeKey is the key of an episode of a show, by the show's TMDB id.
+func EpisodeKey(id string, season, episode uint) string {
+	return fmt.Sprintf("tv:%s/s%de%d", id, season, episode)
+}
+
+// SourceKey is the key of a source no title names, by its URL: scheme, host
+// and path, without the query a signed URL carries its expiring token in.
+func SourceKey(u *url.URL) string {
+	return "url:" + (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
+
+// Source is the stream an entry was pulled from, less its request headers:
+// they hold the credentials of a session long over by the time the entry is
+// read again, and a pull carried on from the entry extracts its source afresh
+// anyway.
+type Source struct {
+	URL         string        `json:"url"`
+	AudioURL    string        `json:"audio_url,omitempty"`
+	ContentType string        `json:"content_type"`
+	Variant     media.Variant `json:"variant"`
+	AudioTrack  int           `json:"audio_track,omitempty"`
+	Subtitle    *Subtitle     `json:"subtitle,omitempty"`
+
+	// AudioLanguages, SubtitleLanguages and MaxHeight are the preferences
+	// resolution picked the variant, audio and subtitle track above by (see
+	// resolve.Config). A cast under others wants another pick, so SourceOf
+	// leaves them for the caster to record.
+	AudioLanguages    []string `json:"audio_languages,omitempty"`
+	SubtitleLanguages []string `json:"subtitle_languages,omitempty"`
+	MaxHeight         int      `json:"max_height,omitempty"`
+}
+
+// Subtitle is the source's own subtitle track an entry's cast showed (see
+// media.SubtitleTrack). Only where it is read from is kept, not its cues: a
+// cast from the entry reads the track again.
+type Subtitle struct {
+	URL      string `json:"url,omitempty"`
+	Index    int    `json:"index,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// SourceOf is the Source of stream.
+func SourceOf(stream *media.Stream) Source {
+	s := Source{URL: stream.URL.String(), ContentType: stream.ContentType, Variant: stream.Variant, AudioTrack: stream.AudioTrack}
+	if stream.AudioURL != nil {
+		s.AudioURL = stream.AudioURL.String()
+	}
+	if t := stream.Subtitle; t != nil {
+		s.Subtitle = &Subtitle{Index: t.Index, Language: t.Language}
+		if t.URL != nil {
+			s.Subtitle.URL = t.URL.String()
+		}
+	}
+	return s
+}
+
+// Stream is s as a stream to cast.
+func (s Source) Stream() (*media.Stream, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("cached source URL: %w", err)
+	}
+	stream := &media.Stream{URL: u, ContentType: s.ContentType, Variant: s.Variant, AudioTrack: s.AudioTrack}
+	if s.AudioURL != "" {
+		if stream.AudioURL, err = url.Parse(s.AudioURL); err != nil {
+			return nil, fmt.Errorf("cached audio URL: %w", err)
+		}
+	}
+	if t := s.Subtitle; t != nil {
+		stream.Subtitle = &media.SubtitleTrack{Index: t.Index, Language: t.Language}
+		if t.URL != "" {
+			if stream.Subtitle.URL, err = url.Parse(t.URL); err != nil {
+				return nil, fmt.Errorf("cached subtitle URL: %w", err)
+			}
+		}
+	}
+	return stream, nil
+}
+
+// Meta is what an entry records of its spool.
+type Meta struct {
+	Key    string `json:"key"`
+	Source Source `json:"source"`
+	// Complete is set once the pull reached the end of the source: the spool
+	// holds all of it and nothing is left to fetch.
+	Complete bool `json:"complete"`
+	// Probe is the spool's probe, zero when none succeeded.
+	Probe media.ProbeInfo `json:"probe"`
+	// Cues are whisper's, and Transcribed is set once they cover the whole
+	// of a complete spool. Whisper is what they are, the task and language
+	// whisper ran with (see subtitle.Whisper.Transcript): a cast asking for
+	// another, a translation where these are a transcription, has its own made.
+	Cues        []cue.Cue `json:"cues,omitempty"`
+	Transcribed bool      `json:"transcribed"`
+	Whisper     string    `json:"whisper,omitempty"`
+	// Used is when the entry was last cast, which trimming goes by.
+	Used time.Time `json:"used"`
+}
+
+// Entry is one cached spool, held locked by the cast using it.
+type Entry struct {
+	Meta Meta
+	// Found is set when the entry already held a spool when acquired.
+	Found bool
+
+	cache *Cache
+	dir   string
+	lock  *os.File
+}
+
+// Lookup reads the entry for key without locking it, for a cast deciding
+// whether it can be played from the cache before it has a source to play.
+func (c *Cache) Lookup(key string) (Meta, bool) {
+	dir := c.entryDir(key)
+	meta, err := readMeta(dir)
+	if err != nil || meta.Key != key {
+		return Meta{}, false
+	}
+	if info, err := os.Stat(filepath.Join(dir, spoolFile)); err != nil || info.Size() == 0 {
+		return Meta{}, false
+	}
+	return meta, true
+}
+
+// Acquire locks the entry for key, creating it if it is new, and returns
+// ErrBusy when another cast holds it. The caller ends with Release, or with
+// Discard to drop what the entry holds.
+func (c *Cache) Acquire(key string) (*Entry, error) {
+	dir := c.entryDir(key)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating cache entry: %w", err)
+	}
+	lock, ok, err := tryLock(filepath.Join(dir, lockFile))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrBusy
+	}
+	e := &Entry{Meta: Meta{Key: key}, cache: c, dir: dir, lock: lock}
+	if meta, ok := c.Lookup(key); ok {
+		e.Meta, e.Found = meta, true
+	}
+	return e, nil
+}
+
+// Reset drops what the entry recorded, for a cast that cannot use its spool
+// and pulls one anew in its place.
+func (e *Entry) Reset() error {
+	e.Meta, e.Found = Meta{Key: e.Meta.Key}, false
+	if err := os.Remove(filepath.Join(e.dir, metaFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("resetting cache entry: %w", err)
+	}
+	return nil
+}
+
+// SpoolPath is where the entry's spool lives.
+func (e *Entry) SpoolPath() string { return filepath.Join(e.dir, spoolFile) }
+
+// Save records the entry's Meta as of now. It is written whole or not at
+// all, so a cast killed midway leaves the entry as it was last saved.
+func (e *Entry) Save() error {
+	e.Meta.Used = time.Now()
+	data, err := json.Marshal(e.Meta)
+	if err != nil {
+		return fmt.Errorf("encoding cache entry: %w", err)
+	}
+	tmp := filepath.Join(e.dir, metaFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(e.dir, metaFile)); err != nil {
+		return fmt.Errorf("writing cache entry: %w", err)
+	}
+	return nil
+}
+
+// Release unlocks the entry and trims the cache back under its size.
+func (e *Entry) Release() {
+	_ = e.lock.Close()
+	e.cache.trim()
+}
+
+// Discard deletes the entry and unlocks it.
+func (e *Entry) Discard() {
+	_ = os.RemoveAll(e.dir)
+	_ = e.lock.Close()
+}
+
+// entryDir is where key's entry lives, named by a hash of key so any key
+// names a directory.
+func (c *Cache) entryDir(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:8]))
+}
+
+// trim deletes the least recently used entries no cast holds until the cache
+// fits its size. An entry a cast holds counts against the size but is kept:
+// it is being played from.
+func (c *Cache) trim() {
+	dirs, err := os.ReadDir(c.dir)
+	if err != nil {
+		slog.Warn("reading spool cache", "dir", c.dir, "error", err)
+		return
+	}
+	type held struct {
+		dir  string
+		size int64
+		used time.Time
+		lock *os.File
+	}
+	var total int64
+	var free []held
+	defer func() {
+		for _, h := range free {
+			_ = h.lock.Close()
+		}
+	}()
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(c.dir, d.Name())
+		var size int64
+		if info, err := os.Stat(filepath.Join(dir, spoolFile)); err == nil {
+			size = info.Size()
+		}
+		total += size
+		lock, ok, err := tryLock(filepath.Join(dir, lockFile))
+		if err != nil || !ok {
+			continue
+		}
+		// An entry never saved (its cast died first) has the zero Used, and
+		// goes before any other.
+		meta, _ := readMeta(dir)
+		free = append(free, held{dir: dir, size: size, used: meta.Used, lock: lock})
+	}
+	slices.SortFunc(free, func(a, b held) int { return a.used.Compare(b.used) })
+	for _, h := range free {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.RemoveAll(h.dir); err != nil {
+			slog.Warn("trimming spool cache", "dir", h.dir, "error", err)
+			continue
+		}
+		slog.Info("trimmed cached spool", "dir", h.dir, "bytes", h.size, "last_used", h.used)
+		total -= h.size
+	}
+}
+
+func readMeta(dir string) (Meta, error) {
+	var meta Meta
+	data, err := os.ReadFile(filepath.Join(dir, metaFile))
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("decoding cache entry: %w", err)
+	}
+	return meta, nil
+}
+
+// tryLock takes the exclusive lock on path without waiting, reporting false
+// when someone else holds it. The lock is released by closing the file,
+// which the kernel also does for a process that dies holding it.
+func tryLock(path string) (*os.File, bool, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, false, fmt.Errorf("opening cache lock: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("locking cache entry: %w", err)
+	}
+	return f, true, nil
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/subtitle/cue"
+	"github.com/stupside/castor/internal/media"
+)
+
+func openTest(t *testing.T, maxSize int64) *Cache {
+	t.Helper()
+	c, err := Open(Config{Dir: t.TempDir()})
+	if err != nil || c != nil {
+		t.Fatalf("Open() with no MaxSize = %v, %v, want the cache off", c, err)
+	}
+	if c, err = Open(Config{Dir: t.TempDir(), MaxSize: 1}); err != nil {
+		t.Fatal(err)
+	}
+	c.maxSize = maxSize
+	return c
+}
+
+// fill acquires key's entry, spools size bytes into it, and saves it.
+func fill(t *testing.T, c *Cache, key string, size int) *Entry {
+	t.Helper()
+	e, err := c.Acquire(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(e.SpoolPath(), make([]byte, size), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestEntryRoundTrip(t *testing.T) {
+	c := openTest(t, 1<<20)
+	key := EpisodeKey("1399", 1, 2)
+	if _, ok := c.Lookup(key); ok {
+		t.Fatal("Lookup() found an entry in an empty cache")
+	}
+
+	e, err := c.Acquire(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Found {
+		t.Error("a new entry was Found")
+	}
+	if _, err := c.Acquire(key); !errors.Is(err, ErrBusy) {
+		t.Errorf("Acquire() of a held entry error = %v, want ErrBusy", err)
+	}
+	u, _ := url.Parse("https://cdn.example/v/index.m3u8?token=abc")
+	e.Meta.Source = SourceOf(&media.Stream{URL: u, ContentType: media.HLS, Variant: media.Variant{Bandwidth: 5e6, Height: 1080}})
+	e.Meta.Complete = true
+	e.Meta.Probe = media.ProbeInfo{VideoCodec: media.CodecH264, VideoHeight: 1080, Duration: time.Hour}
+	e.Meta.Cues = []cue.Cue{{Start: 1, End: 2, Text: "Winter is coming."}}
+	e.Meta.Transcribed = true
+	if err := os.WriteFile(e.SpoolPath(), []byte("ts"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Save(); err != nil {
+		t.Fatal(err)
+	}
+	e.Release()
+
+	meta, ok := c.Lookup(key)
+	if !ok {
+		t.Fatal("Lookup() found no entry once saved")
+	}
+	if !meta.Complete || !meta.Transcribed || meta.Probe != e.Meta.Probe || len(meta.Cues) != 1 || meta.Cues[0] != e.Meta.Cues[0] {
+		t.Errorf("Lookup() = %+v, want what was saved, %+v", meta, e.Meta)
+	}
+	stream, err := meta.Source.Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream.URL.String() != u.String() || stream.Variant != (media.Variant{Bandwidth: 5e6, Height: 1080}) {
+		t.Errorf("cached source = %v %+v, want %v and its variant", stream.URL, stream.Variant, u)
+	}
+
+	e, err = c.Acquire(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Found || !e.Meta.Complete {
+		t.Errorf("Acquire() of a saved entry = %+v, want it Found as saved", e)
+	}
+	if err := e.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if e.Found || e.Meta.Complete || e.Meta.Key != key {
+		t.Errorf("Reset() left %+v, want only the key", e.Meta)
+	}
+	e.Release()
+	if _, ok := c.Lookup(key); ok {
+		t.Error("Lookup() found an entry that was reset")
+	}
+}
+
+func TestTrimDropsLeastRecentlyUsed(t *testing.T) {
+	c := openTest(t, 250)
+	fill(t, c, MovieKey("1"), 100).Release()
+	fill(t, c, MovieKey("2"), 100).Release()
+	held := fill(t, c, MovieKey("3"), 100)
+
+	// Casting 1 again makes 2 the least recently used; 3 is held.
+	fill(t, c, MovieKey("1"), 100).Release()
+	if _, ok := c.Lookup(MovieKey("2")); ok {
+		t.Error("the least recently used entry was kept over the size")
+	}
+	for _, id := range []string{"1", "3"} {
+		if _, ok := c.Lookup(MovieKey(id)); !ok {
+			t.Errorf("entry %s was trimmed", id)
+		}
+	}
+
+	// A held entry counts against the size, but only a free one goes.
+	c.maxSize = 50
+	fill(t, c, MovieKey("4"), 10).Release()
+	if _, ok := c.Lookup(MovieKey("3")); !ok {
+		t.Error("an entry a cast holds was trimmed")
+	}
+	held.Release()
+	if _, ok := c.Lookup(MovieKey("3")); ok {
+		t.Error("an entry let go over the size was kept")
+	}
+}
+
+func TestSourceKey(t *testing.T) {
+	for _, tc := range []struct{ a, b string }{
+		{"https://cdn.example/v/film.mp4?token=1", "https://cdn.example/v/film.mp4?token=2"},
+		{"https://cdn.example/v/film.mp4#t=10", "https://cdn.example/v/film.mp4"},
+	} {
+		a, _ := url.Parse(tc.a)
+		b, _ := url.Parse(tc.b)
+		if SourceKey(a) != SourceKey(b) {
+			t.Errorf("SourceKey(%s) = %q, SourceKey(%s) = %q, want the same", a, SourceKey(a), b, SourceKey(b))
+		}
+	}
+	if MovieKey("1399") == EpisodeKey("1399", 0, 0) {
+		t.Error("a movie and a show with the same id share a key")
+	}
+}
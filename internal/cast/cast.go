@@ -11,22 +11,253 @@ package cast
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 
+	"github.com/stupside/castor/internal/cast/cache"
+	"github.com/stupside/castor/internal/cast/control"
 	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/cast/ffmpeg"
 	"github.com/stupside/castor/internal/cast/pipeline"
+	"github.com/stupside/castor/internal/cast/subtitle"
 	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/metrics"
+	"github.com/stupside/castor/internal/source/resolve"
 )
 
+// Option configures one Play call.
+type Option = pipeline.Option
+
+// WithSession runs the cast under sess, which a caller uses to observe and
+// drive it (the daemon does, per job).
+func WithSession(sess *core.Session) Option { return pipeline.WithSession(sess) }
+
+// WithRecord also keeps the cast as a finished file at path.
+func WithRecord(path string) Option { return pipeline.WithRecord(path) }
+
+// WithMaxBitrate caps the video the cast is served at, in bits per second.
+func WithMaxBitrate(bits int64) Option { return pipeline.WithMaxBitrate(bits) }
+
+// Subtitles is a subtitle file the viewer brings to one cast, for
+// WithSubtitles: a path or an http(s) URL, and how far to move its cues.
+type Subtitles = subtitle.External
+
+// WithSubtitles burns the viewer's subtitle file into the cast, in place of the
+// source's own subtitles or whisper's.
+func WithSubtitles(s Subtitles) Option { return pipeline.WithSubtitles(s) }
+
+// WithSaveSubtitles also keeps the subtitles the cast draws in a .srt or .vtt
+// file at path, written as it plays: a transcript to correct and bring back
+// next time with WithSubtitles.
+func WithSaveSubtitles(path string) Option { return pipeline.WithSaveSubtitles(path) }
+
+// CheckSaveSubtitles reports whether path is a file WithSaveSubtitles can write.
+func CheckSaveSubtitles(path string) error { return pipeline.CheckSaveSubtitles(path) }
+
+// WithCacheKey names the title the cast is of in the spool cache: MovieKey or
+// EpisodeKey. Without it, a cast is cached under its source URL.
+func WithCacheKey(key string) Option { return pipeline.WithCacheKey(key) }
+
+// MovieKey is a movie's spool cache key, by its TMDB id.
+func MovieKey(id string) string { return cache.MovieKey(id) }
+
+// EpisodeKey is an episode's spool cache key, by its show's TMDB id.
+func EpisodeKey(id string, season, episode uint) string { return cache.EpisodeKey(id, season, episode) }
+
+// ParseBitrate parses a bitrate as ffmpeg takes one ("4M", "2500k") into bits
+// per second, for WithMaxBitrate.
+func ParseBitrate(rate string) (int64, error) { return ffmpeg.ParseRate(rate) }
+
+// RefreshFunc extracts a cast's source afresh, for a pull that broke partway.
+type RefreshFunc = pipeline.RefreshFunc
+
+// WithRefresh resumes a cast whose pull breaks partway (a signed URL expiring
+// mid-title) from the stream refresh extracts afresh: the page it came from,
+// read again. Without it, the source URL the cast was given is read again.
+func WithRefresh(refresh RefreshFunc) Option { return pipeline.WithRefresh(refresh) }
+
+// CheckRecord reports whether path is a recording WithRecord can write.
+func CheckRecord(path string) error { return pipeline.CheckRecord(path) }
+
+// Download resolves a stream and saves it to path instead of casting it: the
+// same single pull a served cast makes, kept as a file, with no device involved.
+// A pull that breaks partway is resumed from refresh, or when it is nil from
+// stream read again.
+func Download(ctx context.Context, cfg Config, stream *media.Stream, path string, refresh RefreshFunc) error {
+	if refresh == nil {
+		refresh = reread(stream)
+	}
+	slog.InfoContext(ctx, "resolving stream", "url", stream.URL.String())
+	resolved, err := resolve.Resolve(ctx, cfg.Resolver, stream)
+	if err != nil {
+		return metrics.Fail(ctx, "resolve", fmt.Errorf("resolving URL: %w", err))
+	}
+	return pipeline.Download(ctx, cfg.Config, resolved, path, refresh)
+}
+
+// reread is the refresh of a cast given nothing better: stream as it was
+// before resolution narrowed it, read again. An HLS master read afresh lists
+// its variants under fresh tokens.
+func reread(stream *media.Stream) RefreshFunc {
+	orig := *stream
+	return func(context.Context) (*media.Stream, error) {
+		s := orig
+		return &s, nil
+	}
+}
+
+// RerankFunc extracts a cast's candidate sources afresh and ranks them best
+// first, as resolve.RankStreams does.
+type RerankFunc func(context.Context) ([]*media.Stream, error)
+
 // Play resolves a stream and casts it to the configured device. Source resolution
 // is renderer-independent and happens here; connecting the renderer is left to the
 // pipeline, which times it against the delivery path: a non-self-fetching renderer
 // connects concurrently with the pull, so slow discovery does not age a short-lived
 // signed URL before the first byte. There is deliberately no device-type branch:
 // adding a renderer family is a device adapter plus a set of capability values.
-func Play(ctx context.Context, cfg Config, stream *media.Stream) error {
+//
+// With the control API enabled, the cast runs under a session the API observes
+// and drives. Either way, a stop requested through a session (core.ErrStopped as
+// ctx's cause) ends the cast cleanly, with a nil error.
+func Play(ctx context.Context, cfg Config, stream *media.Stream, opts ...Option) error {
+	return PlayRanked(ctx, cfg, []*media.Stream{stream}, nil, opts...)
+}
+
+// PlayRanked casts the first of candidates, ranked best first (see
+// resolve.RankStreams), as Play does, and falls over to the next one whenever
+// a cast fails on its source before playback began (core.ErrSourceFailed): the
+// runner-up that probed fine is worth more than an error when the best one's
+// pull dies up front. A failure once playing, or of anything but the source,
+// ends the cast as it would Play.
+//
+// A pull that breaks partway is resumed from the candidate in use found again
+// among what rerank extracts afresh: the one on the same host, else the new
+// best. With a nil rerank, the candidate is read again as Play does.
+func PlayRanked(ctx context.Context, cfg Config, candidates []*media.Stream, rerank RerankFunc, opts ...Option) error {
+	if len(candidates) == 0 {
+		return errors.New("no candidate streams to cast")
+	}
+	return controlled(ctx, cfg, opts, func(ctx context.Context, opts []Option) error {
+		var err error
+		for i, stream := range candidates {
+			if i > 0 {
+				slog.WarnContext(ctx, "source failed before playback, falling over to the next candidate",
+					"error", err, "rank", i+1, "of", len(candidates))
+			}
+			slog.InfoContext(ctx, "casting candidate", "rank", i+1, "of", len(candidates), "url", stream.URL.String())
+			err = playCandidate(ctx, cfg, stream, rerank, opts)
+			if ctx.Err() != nil || !errors.Is(err, core.ErrSourceFailed) {
+				return err
+			}
+		}
+		if len(candidates) > 1 {
+			return fmt.Errorf("all %d candidate streams failed before playback, the last with: %w", len(candidates), err)
+		}
+		return err
+	})
+}
+
+// playCandidate resolves one candidate and runs the pipeline on it.
+func playCandidate(ctx context.Context, cfg Config, stream *media.Stream, rerank RerankFunc, opts []Option) error {
+	refresh := reread(stream)
+	if rerank != nil {
+		refresh = refound(stream, rerank)
+	}
+	// A caller's own WithRefresh, applied later, takes precedence.
+	opts = append([]Option{WithRefresh(refresh)}, opts...)
 	resolved, localIP, err := core.ResolveSource(ctx, cfg.Config, stream)
+	if err != nil {
+		return metrics.Fail(ctx, "resolve", err)
+	}
+	return pipeline.Run(ctx, cfg.Config, core.Connect, resolved, localIP, opts...)
+}
+
+// refound is the refresh of a candidate under way: the candidates rerank
+// extracts afresh, narrowed to the one served from stream's host (its URL
+// minted again), else the best of them.
+func refound(stream *media.Stream, rerank RerankFunc) RefreshFunc {
+	return func(ctx context.Context) (*media.Stream, error) {
+		fresh, err := rerank(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(fresh) == 0 {
+			return nil, errors.New("no candidate streams extracted afresh")
+		}
+		for _, s := range fresh {
+			if s.URL.Host == stream.URL.Host {
+				return s, nil
+			}
+		}
+		slog.WarnContext(ctx, "candidate's host not extracted afresh, resuming from the new best", "host", stream.URL.Host, "url", fresh[0].URL.String())
+		return fresh[0], nil
+	}
+}
+
+// PlayCached casts the title key names (see WithCacheKey) from the spool cache,
+// when the cache holds a spool of it the configured device can be served, and
+// reports whether it did: ok false means nothing was cast, and the caller
+// extracts the title's sources and casts them as usual. It skips extraction
+// and source resolution outright, so a title cached whole starts as soon as
+// the renderer connects. One cached in part plays from disk while its pull
+// carries on from where the spool ends, from the sources rerank extracts
+// afresh; with a nil rerank, only a title cached whole is cast.
+func PlayCached(ctx context.Context, cfg Config, key string, rerank RerankFunc, opts ...Option) (ok bool, err error) {
+	stream, ok := pipeline.Cached(cfg.Config, key, rerank != nil)
+	if !ok {
+		return false, nil
+	}
+	slog.InfoContext(ctx, "casting from the spool cache", "key", key)
+	localIP, err := core.LocalIP(cfg.Config)
+	if err != nil {
+		return true, err
+	}
+	opts = append([]Option{WithCacheKey(key)}, opts...)
+	if rerank != nil {
+		opts = append([]Option{WithRefresh(refound(stream, rerank))}, opts...)
+	}
+	return true, controlled(ctx, cfg, opts, func(ctx context.Context, opts []Option) error {
+		return pipeline.Run(ctx, cfg.Config, core.Connect, stream, localIP, opts...)
+	})
+}
+
+// PlayFile casts the local file at path to the configured device, served from
+// castor's own HTTP server. The renderer is handed the file as it is, seekable,
+// when it plays the file's container and codecs, and a remux or transcode
+// otherwise (see pipeline.RunFile). It runs under the control API like Play.
+func PlayFile(ctx context.Context, cfg Config, path string, opts ...Option) error {
+	localIP, err := core.LocalIP(cfg.Config)
 	if err != nil {
 		return err
 	}
-	return pipeline.Run(ctx, cfg.Config, core.Connect, resolved, localIP)
+	return controlled(ctx, cfg, opts, func(ctx context.Context, opts []Option) error {
+		return pipeline.RunFile(ctx, cfg.Config, core.Connect, path, localIP, opts...)
+	})
+}
+
+// controlled runs a cast, under a control session when the control API is
+// enabled. A stop requested through the session ends the cast with a nil error.
+func controlled(ctx context.Context, cfg Config, opts []Option, run func(context.Context, []Option) error) error {
+	if cfg.Control.Enable {
+		var stop context.CancelCauseFunc
+		ctx, stop = context.WithCancelCause(ctx)
+		defer stop(nil)
+		sess := core.NewSession(cfg.Device, stop)
+		srv, err := control.New(cfg.Control, sess)
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+		slog.InfoContext(ctx, "control API listening", "address", srv.Addr().String())
+		opts = append(opts, pipeline.WithSession(sess))
+	}
+
+	err := run(ctx, opts)
+	if errors.Is(context.Cause(ctx), core.ErrStopped) {
+		slog.InfoContext(ctx, "cast stopped by control request")
+		return nil
+	}
+	return err
 }
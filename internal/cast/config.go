@@ -1,6 +1,8 @@
 package cast
 
 import (
+	"github.com/stupside/castor/internal/cast/cache"
+	"github.com/stupside/castor/internal/cast/control"
 	"github.com/stupside/castor/internal/cast/core"
 	"github.com/stupside/castor/internal/cast/subtitle"
 )
@@ -13,6 +15,11 @@ import (
 // separate Whisper field here to shadow it.
 type Config struct {
 	core.Config
+
+	// Control is the optional HTTP control API for the running cast. It is
+	// cast-level wiring, not a planning input, so it sits here rather than on
+	// core.Config.
+	Control ControlConfig
 }
 
 // Every config section's type is re-exported here so the application composes
@@ -24,5 +31,9 @@ type Config struct {
 type (
 	NetworkConfig   = core.NetworkConfig
 	TranscodeConfig = core.TranscodeConfig
+	SpoolConfig     = core.SpoolConfig
+	CacheConfig     = cache.Config
 	WhisperConfig   = subtitle.Whisper
+	SubtitlesConfig = subtitle.Settings
+	ControlConfig   = control.Config
 )
@@ -0,0 +1,182 @@
+// Package control serves the local HTTP API that observes and drives a running
+// cast: its status, and the renderer's pause, resume, seek, stop, and volume.
+// It is a thin HTTP face over core.Session, which holds the state and talks to
+// the renderer, so this package only maps requests and errors onto HTTP.
+//
+// The API is opt-in and loopback by default. Binding it anywhere else exposes
+// playback control to the network, so a non-loopback address requires a bearer
+// token; there is no unauthenticated LAN mode.
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/core"
+)
+
+// Config is the control section.
+type Config struct {
+	Enable bool `yaml:"enable"`
+	// Address is the host:port the API listens on. A loopback host keeps it
+	// local to this machine; any other host (including an empty one, which
+	// means every interface) requires Token.
+	Address string `yaml:"address"`
+	// Token, when set, must accompany every request as
+	// "Authorization: Bearer <token>".
+	Token string `yaml:"token"`
+}
+
+// Server is the running control API for one cast.
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// New validates cfg and starts serving sess on cfg.Address.
+func New(cfg Config, sess *core.Session) (*Server, error) {
+	if err := CheckExposure(cfg.Address, cfg.Token); err != nil {
+		return nil, fmt.Errorf("control API: %w", err)
+	}
+	ln, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("binding control API: %w", err)
+	}
+	s := &Server{
+		listener: ln,
+		server:   &http.Server{Handler: Handler(sess, cfg.Token), ReadHeaderTimeout: 5 * time.Second},
+	}
+	go func() { _ = s.server.Serve(ln) }()
+	return s, nil
+}
+
+// Addr is the address the API is listening on.
+func (s *Server) Addr() net.Addr { return s.listener.Addr() }
+
+// Close stops the API and severs open requests.
+func (s *Server) Close() error { return s.server.Close() }
+
+// CheckExposure refuses to serve on an address reachable from the network
+// without a token. The daemon applies the same rule to its TCP listener.
+func CheckExposure(address, token string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("parsing address %q: %w", address, err)
+	}
+	if !isLoopback(host) && token == "" {
+		return fmt.Errorf("address %q is reachable from the network; set a token", address)
+	}
+	return nil
+}
+
+// isLoopback reports whether host only ever resolves to this machine.
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Handler routes the control API onto sess. An empty token disables the bearer
+// check, which New allows only on a loopback address.
+//
+//	GET  /status                 the cast's core.Status as JSON
+//	POST /pause, /resume, /stop
+//	POST /seek?position=90       seconds, or a duration such as 1m30s
+//	POST /volume?level=40        percent, 0..100
+func Handler(sess *core.Session, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(sess.Status(r.Context()))
+	})
+	mux.HandleFunc("POST /pause", command(sess.Pause))
+	mux.HandleFunc("POST /resume", command(sess.Resume))
+	mux.HandleFunc("POST /stop", command(sess.Stop))
+	mux.HandleFunc("POST /seek", func(w http.ResponseWriter, r *http.Request) {
+		position, err := parsePosition(r.FormValue("position"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reply(w, r, sess.Seek(r.Context(), position))
+	})
+	mux.HandleFunc("POST /volume", func(w http.ResponseWriter, r *http.Request) {
+		level, err := strconv.Atoi(r.FormValue("level"))
+		if err != nil || level < 0 || level > 100 {
+			http.Error(w, "level must be a percentage, 0..100", http.StatusBadRequest)
+			return
+		}
+		reply(w, r, sess.SetVolume(r.Context(), level))
+	})
+	return RequireToken(token, mux)
+}
+
+// command adapts an argument-less session control to a handler.
+func command(do func(context.Context) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) { reply(w, r, do(r.Context())) }
+}
+
+// reply maps a control outcome onto a status code: a renderer that is not
+// connected yet is a conflict the client can retry, an action the renderer's
+// protocol lacks is not implemented, and any other failure came from the
+// renderer, which this API fronts as a gateway.
+func reply(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case errors.Is(err, core.ErrNotConnected):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errors.ErrUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+	slog.WarnContext(r.Context(), "control request failed", "path", r.URL.Path, "error", err)
+}
+
+// parsePosition reads a seek target as plain seconds or a Go duration. Seconds
+// past what a Duration holds (Inf among them) would overflow into a garbage
+// seek, so they are refused with NaN and anything negative.
+func parsePosition(v string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if math.IsNaN(secs) || math.IsInf(secs, 0) || secs < 0 || secs > math.MaxInt64/float64(time.Second) {
+			return 0, fmt.Errorf("position %q is out of range", v)
+		}
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("position %q is neither seconds nor a duration such as 1m30s", v)
+}
+
+// RequireToken rejects any request that does not carry the bearer token, and
+// passes everything through when token is empty. The comparison is
+// constant-time so the token cannot be guessed byte by byte.
+func RequireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,131 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/device"
+	"github.com/stupside/castor/internal/media"
+)
+
+// fakeRenderer is a connected renderer whose transport controls are recorded.
+// Seek is unsupported, like Roku's.
+type fakeRenderer struct {
+	calls  []string
+	volume int
+}
+
+func (f *fakeRenderer) Play(context.Context, *url.URL, string) error { return nil }
+func (f *fakeRenderer) Capabilities() media.Renderer                 { return media.Renderer{} }
+func (f *fakeRenderer) StreamHeaders(string, bool) map[string]string { return nil }
+func (f *fakeRenderer) Close() error                                 { return nil }
+
+func (f *fakeRenderer) Pause(context.Context) error  { f.calls = append(f.calls, "pause"); return nil }
+func (f *fakeRenderer) Resume(context.Context) error { f.calls = append(f.calls, "resume"); return nil }
+func (f *fakeRenderer) Stop(context.Context) error   { f.calls = append(f.calls, "stop"); return nil }
+func (f *fakeRenderer) Seek(context.Context, time.Duration) error {
+	return errors.ErrUnsupported
+}
+func (f *fakeRenderer) SetVolume(_ context.Context, percent int) error {
+	f.volume = percent
+	return nil
+}
+func (f *fakeRenderer) Position(context.Context) (time.Duration, error) { return 42 * time.Second, nil }
+
+var _ device.Controller = (*fakeRenderer)(nil)
+
+func do(t *testing.T, h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerControls(t *testing.T) {
+	var stopped error
+	sess := core.NewSession(core.DeviceConfig{Name: "Living Room", Type: device.TypeDLNA},
+		func(cause error) { stopped = cause })
+	h := Handler(sess, "")
+
+	if rec := do(t, h, http.MethodPost, "/pause", ""); rec.Code != http.StatusConflict {
+		t.Fatalf("pause before connect = %d, want 409", rec.Code)
+	}
+
+	dev := &fakeRenderer{}
+	sess.Attach(dev)
+
+	if rec := do(t, h, http.MethodPost, "/pause", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("pause = %d, want 204", rec.Code)
+	}
+	if rec := do(t, h, http.MethodPost, "/seek?position=1m30s", ""); rec.Code != http.StatusNotImplemented {
+		t.Errorf("unsupported seek = %d, want 501", rec.Code)
+	}
+	for _, pos := range []string{"soon", "Inf", "NaN", "-5", "1e300"} {
+		if rec := do(t, h, http.MethodPost, "/seek?position="+pos, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("seek to %s = %d, want 400", pos, rec.Code)
+		}
+	}
+	if rec := do(t, h, http.MethodPost, "/volume?level=40", ""); rec.Code != http.StatusNoContent || dev.volume != 40 {
+		t.Errorf("volume = %d (level %d), want 204 and 40", rec.Code, dev.volume)
+	}
+	if rec := do(t, h, http.MethodPost, "/volume?level=140", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("out-of-range volume = %d, want 400", rec.Code)
+	}
+
+	rec := do(t, h, http.MethodGet, "/status", "")
+	var st core.Status
+	if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+		t.Fatalf("decoding status: %v", err)
+	}
+	if st.State != "paused" || st.Device != "Living Room" {
+		t.Errorf("status = %+v, want paused on Living Room", st)
+	}
+	if st.PositionSeconds == nil || *st.PositionSeconds != 42 {
+		t.Errorf("position = %v, want 42", st.PositionSeconds)
+	}
+
+	if rec := do(t, h, http.MethodPost, "/stop", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("stop = %d, want 204", rec.Code)
+	}
+	if !errors.Is(stopped, core.ErrStopped) {
+		t.Errorf("stop cause = %v, want core.ErrStopped", stopped)
+	}
+}
+
+func TestHandlerToken(t *testing.T) {
+	sess := core.NewSession(core.DeviceConfig{}, func(error) {})
+	h := Handler(sess, "s3cret")
+
+	if rec := do(t, h, http.MethodGet, "/status", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no token = %d, want 401", rec.Code)
+	}
+	if rec := do(t, h, http.MethodGet, "/status", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token = %d, want 401", rec.Code)
+	}
+	if rec := do(t, h, http.MethodGet, "/status", "s3cret"); rec.Code != http.StatusOK {
+		t.Errorf("right token = %d, want 200", rec.Code)
+	}
+}
+
+func TestNewRequiresTokenOffLoopback(t *testing.T) {
+	sess := core.NewSession(core.DeviceConfig{}, func(error) {})
+	if _, err := New(Config{Address: "0.0.0.0:0"}, sess); err == nil {
+		t.Error("a network-reachable address without a token must be refused")
+	}
+	srv, err := New(Config{Address: "127.0.0.1:0"}, sess)
+	if err != nil {
+		t.Fatalf("loopback without a token: %v", err)
+	}
+	_ = srv.Close()
+}
@@ -0,0 +1,340 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
+	"github.com/stupside/castor/internal/cast/deliver/replay"
+	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/media"
+)
+
+// This file steps a served stream's encode down mid-cast when the renderer's
+// link cannot carry it. The replay server measures each client's delivery;
+// when one falls behind playback, the encode is restarted at a lower rung of
+// the ladder the HLS delivery offers side by side (ResolveLadder), cut at a
+// keyframe and spliced onto the stream already served, so the renderer plays
+// on without reconnecting. A cast only ever steps down: a renderer reading at
+// its playback pace shows no spare capacity to step back up by.
+
+const (
+	// adaptLead is how much stream the producer of an adaptable stream may run
+	// ahead of the renderer (see replay.Config.Lead), at the bitrate it starts
+	// at: what a step down takes to reach the renderer.
+	adaptLead = 20 * time.Second
+
+	// behindPace is the delivery pace (replay.Delivery.Pace) under which a
+	// renderer is taken to be falling behind: its link is not carrying the
+	// stream as fast as it plays, so its buffer is draining.
+	behindPace = 0.95
+
+	// linkHeadroom is the share of a measured link a stepped-down encode is
+	// sized to, leaving room for the VBV peaks above its average and for the
+	// link's own dips.
+	linkHeadroom = 0.75
+
+	// floorHeight is the lowest rung: below it a picture is not worth casting.
+	floorHeight = 360
+
+	// remeasure is how long a step waits, once what was spooled ahead of it
+	// has been delivered, before the renderer's delivery is judged again: a
+	// window of the replay server's meter.
+	remeasure = 10 * time.Second
+)
+
+// Adaptation is what lets a stream delivery step its encode down: the rung it
+// starts at, the encoder a lower one is encoded with, and how to restart the
+// encode partway through its input. NewAdaptation builds it; nil leaves the
+// encode running as started.
+type Adaptation struct {
+	// Encoder encodes every lower rung: the cast's own when it re-encodes,
+	// else the one ResolveVideo would pick.
+	Encoder ffmpeg.Encoder
+	// Height and Rate are the rung the encode starts at: its scale and VBV cap
+	// when it encodes, the source's height and bitrate when it copies.
+	Height int
+	Rate   int64
+	// Audio is the bits per second the audio takes beside the video.
+	Audio int64
+	// Resume returns the start options for opts restarted at stream time at,
+	// setting opts' input seek to match (ffmpeg.EncodeOptions.Seek). ctx ends
+	// with the restarted encode, for an input fed to it that must stop too.
+	Resume func(ctx context.Context, opts *ffmpeg.EncodeOptions, at time.Duration) ([]ffmpeg.StartOption, error)
+
+	cfg Config
+}
+
+// NewAdaptation resolves how opts, as ResolveVideo and ResolveAudio left it for
+// a source probed as src, steps down for a renderer with caps. A burn-in is
+// never stepped down: its cues are timed to a single encode's clock, not to
+// one restarted partway.
+func NewAdaptation(ctx context.Context, opts ffmpeg.EncodeOptions, caps media.Renderer, src media.ProbeInfo, cfg Config, resume func(context.Context, *ffmpeg.EncodeOptions, time.Duration) ([]ffmpeg.StartOption, error)) *Adaptation {
+	if opts.BurnsIn() {
+		return nil
+	}
+	a := &Adaptation{Audio: copiedAudioBandwidth, Resume: resume, cfg: cfg}
+	if opts.AudioCodec != ffmpeg.CodecCopy {
+		a.Audio = rate(opts.AudioBitrate)
+	}
+	top := ladderTop(&opts, src, cfg)
+	if opts.VideoEncoder != nil {
+		a.Encoder, a.Height, a.Rate = *opts.VideoEncoder, top, rate(opts.VideoMaxrate)
+		return a
+	}
+	a.Encoder = selectVideoEncoder(servable(caps, opts.OutputFormat), func(c media.Codec) (ffmpeg.Encoder, bool) {
+		return ffmpeg.SelectEncoder(ctx, cfg.Transcode.FFmpegPath, c)
+	})
+	// A copy's rate is the source's, or when unknown what ResolveLadder
+	// announces one at.
+	a.Height, a.Rate = top, src.BitRate
+	if a.Rate == 0 {
+		a.Rate = 2 * ladderRate(a.Encoder.Codec, top, cfg)
+	}
+	return a
+}
+
+// rung is one step of an adaptable encode: the height it is scaled to and the
+// VBV cap it is encoded under, in bits per second.
+type rung struct {
+	height int
+	rate   int64
+}
+
+// stepDown is the rung below cur for a renderer whose link carried link bits
+// per second while falling behind: a video rate that fits the link with
+// linkHeadroom beside audio, and never more than linkHeadroom of cur's, at the
+// tallest standard height the ladder would encode at that rate. ok is false
+// at the floor, with nothing lower to step to.
+func stepDown(cur rung, link, audio int64, codec media.Codec, cfg Config) (next rung, ok bool) {
+	floor := ladderRate(codec, floorHeight, cfg)
+	if cur.height <= floorHeight && cur.rate <= floor {
+		return rung{}, false
+	}
+	target := int64(float64(cur.rate) * linkHeadroom)
+	target = min(target, int64(float64(link)*linkHeadroom)-audio)
+	target = max(target, floor)
+
+	next = rung{height: floorHeight, rate: target}
+	for _, h := range ladderHeights {
+		if h <= cur.height && ladderRate(codec, h, cfg) <= target {
+			next.height = h
+			break
+		}
+	}
+	return next, true
+}
+
+// adaptor runs an adaptable stream's encode: the encode serving now, the rung
+// it is at, and the replacement a slow renderer asks for. Its splicer is the
+// replay server's producer, and its observe the server's delivery callback.
+type adaptor struct {
+	ctx    context.Context
+	p      OpenParams
+	splice *splicer
+
+	// lead is the replay server's Config.Lead: adaptLead of stream at the
+	// rate the encode starts at.
+	lead int64
+
+	mu       sync.Mutex
+	proc     *ffmpeg.Process
+	stop     context.CancelFunc // ends proc's input, when it is a restarted one
+	cur      rung
+	next     rung
+	link     int64     // the bits per second the link carried when next was asked for
+	settled  time.Time // deliveries before it still carry the last rung's lead
+	floored  bool      // nothing lower to step to, or no way to step
+	finished bool
+}
+
+func newAdaptor(ctx context.Context, p OpenParams, proc *ffmpeg.Process) *adaptor {
+	a := &adaptor{
+		ctx:  ctx,
+		p:    p,
+		lead: int64(adaptLead.Seconds() * float64(p.Adapt.Rate+p.Adapt.Audio) / 8),
+		proc: proc,
+		cur:  rung{height: p.Adapt.Height, rate: p.Adapt.Rate},
+	}
+	a.splice = &splicer{cur: proc.Stdout, restart: a.restart}
+	return a
+}
+
+// observe takes a client's delivery and, when the renderer is falling behind,
+// asks the splicer for a step down. The deliveries that follow a step are
+// ignored until what was spooled ahead at the old rung has been delivered.
+func (a *adaptor) observe(d replay.Delivery) {
+	if d.Pace >= behindPace {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.finished || a.floored || time.Now().Before(a.settled) || a.splice.pending.Load() {
+		return
+	}
+	next, ok := stepDown(a.cur, d.Rate, a.p.Adapt.Audio, a.p.Adapt.Encoder.Codec, a.p.Adapt.cfg)
+	if !ok {
+		a.floored = true
+		slog.WarnContext(a.ctx, "renderer falling behind at the lowest bitrate", "link_bps", d.Rate, "pace", d.Pace)
+		return
+	}
+	slog.InfoContext(a.ctx, "renderer falling behind, stepping the encode down",
+		"link_bps", d.Rate,
+		"pace", d.Pace,
+		"height", next.height,
+		"bitrate", next.rate,
+	)
+	a.next, a.link = next, d.Rate
+	a.splice.pending.Store(true)
+}
+
+// restart replaces the running encode with one at the next rung, starting at
+// stream time at. It is the splicer's, called from the replay server's
+// producer goroutine at a keyframe of the running encode. A restart that
+// fails leaves the running encode as it is, and the cast at its rung: what
+// failed (an input with no clock to resume by, say) would fail again.
+func (a *adaptor) restart(at time.Duration) (io.Reader, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.finished {
+		return nil, fmt.Errorf("stream closed")
+	}
+	r, err := a.start(at)
+	if err != nil {
+		a.floored = true
+	}
+	return r, err
+}
+
+// start starts the encode at the next rung from stream time at, and swaps it
+// in for the running one. a.mu is held.
+func (a *adaptor) start(at time.Duration) (io.Reader, error) {
+	enc := a.p.Adapt.Encoder
+	opts := a.p.Opts
+	opts.VideoEncoder, opts.VideoMaxHeight = &enc, a.next.height
+	opts.VideoBitrate, opts.VideoMaxrate = ffmpeg.FormatRate(a.next.rate), ffmpeg.FormatRate(a.next.rate)
+	opts.VideoBufsize = ffmpeg.FormatRate(2 * a.next.rate)
+	opts.OutputOffset = at
+
+	ctx, stop := context.WithCancel(a.ctx)
+	startOpts, err := a.p.Adapt.Resume(ctx, &opts, at)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	args, err := ffmpeg.EncodeArgs(opts)
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("building encode args: %w", err)
+	}
+	proc, err := ffmpeg.Start(ctx, a.p.FFmpegPath, args, startOpts...)
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("starting transcode: %w", err)
+	}
+	if a.p.OnStarted != nil {
+		a.p.OnStarted(proc)
+	}
+
+	// The replaced encode is killed, not finished: its output past the cut is
+	// not wanted. It is reaped aside, as its input may take a while to notice.
+	old, oldStop := a.proc, a.stop
+	old.Kill()
+	go func() {
+		_ = old.Wait()
+		if oldStop != nil {
+			oldStop()
+		}
+	}()
+	a.proc, a.stop, a.cur = proc, stop, a.next
+	// The renderer is served what was spooled ahead at the old rung for as
+	// long as the link takes to carry the lead.
+	drain := time.Duration(float64(a.lead*8) / float64(max(a.link, 1)) * float64(time.Second))
+	a.settled = time.Now().Add(drain + remeasure)
+	slog.InfoContext(a.ctx, "encode stepped down", "at", at, "height", a.cur.height, "bitrate", a.cur.rate)
+	return proc.Stdout, nil
+}
+
+// finish tears the running encode down, and refuses any restart after it.
+func (a *adaptor) finish() {
+	a.mu.Lock()
+	a.finished = true
+	proc, stop := a.proc, a.stop
+	a.mu.Unlock()
+	finishEncoder(a.ctx, proc)
+	if stop != nil {
+		stop()
+	}
+}
+
+// splicer is the producer an adaptable stream is served from: the running
+// encode's output, until a step down is pending; then that output is cut
+// before its next keyframe and carried on by the encode restart starts at that
+// keyframe's stream time. Stream time is measured from the stream's first
+// keyframe, by the TS clock, which each restarted encode carries on (see
+// ffmpeg.EncodeOptions.OutputOffset).
+type splicer struct {
+	cur     io.Reader
+	restart func(at time.Duration) (io.Reader, error)
+	pending atomic.Bool
+
+	buf   []byte // read from cur, not yet a whole packet
+	out   []byte // whole packets ready to return
+	first uint64
+	clock bool // first is set
+}
+
+func (s *splicer) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if err := s.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// fill reads the next chunk of the running encode into out, whole packets
+// only, splicing at the first keyframe in it when a step down is pending.
+func (s *splicer) fill() error {
+	chunk := make([]byte, 64*fileserve.TSPacketSize)
+	n, err := s.cur.Read(chunk)
+	s.buf = append(s.buf, chunk[:n]...)
+	whole := len(s.buf) - len(s.buf)%fileserve.TSPacketSize
+	for off := 0; off < whole; off += fileserve.TSPacketSize {
+		pcr, key := fileserve.KeyframePCR(s.buf[off : off+fileserve.TSPacketSize])
+		switch {
+		case !key:
+		case !s.clock:
+			s.first, s.clock = pcr, true
+		case s.pending.Load():
+			at := fileserve.PCRSince(s.first, pcr)
+			next, rerr := s.restart(at)
+			s.pending.Store(false)
+			if rerr != nil {
+				slog.Warn("stepping the encode down failed, carrying on as it was", "error", rerr)
+				continue
+			}
+			s.out = append(s.out, s.buf[:off]...)
+			s.cur, s.buf = next, nil
+			return nil
+		}
+	}
+	s.out = append(s.out, s.buf[:whole]...)
+	s.buf = slices.Clone(s.buf[whole:])
+	if err == io.EOF && len(s.buf) > 0 {
+		// A truncated last packet is still the encode's to deliver.
+		s.out, s.buf = append(s.out, s.buf...), nil
+	}
+	if len(s.out) > 0 && err == io.EOF {
+		return nil
+	}
+	return err
+}
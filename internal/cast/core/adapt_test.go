@@ -0,0 +1,119 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
+	"github.com/stupside/castor/internal/media"
+)
+
+// TestStepDown pins the rung a falling-behind renderer is stepped down to: a
+// rate sized to the link it was measured at, never more than linkHeadroom of
+// the rung it was at, at the tallest height the ladder would encode at that
+// rate, and nothing below the 360p floor.
+func TestStepDown(t *testing.T) {
+	top := rung{height: 1080, rate: 4_000_000}
+	tests := []struct {
+		name   string
+		cur    rung
+		link   int64
+		want   rung
+		wantOK bool
+	}{
+		{
+			name:   "a link short of the stream gets what fits it",
+			cur:    top,
+			link:   3_000_000,
+			want:   rung{height: 720, rate: 1_994_000},
+			wantOK: true,
+		},
+		{
+			name:   "a fast link still steps down by the headroom",
+			cur:    top,
+			link:   10_000_000,
+			want:   rung{height: 720, rate: 3_000_000},
+			wantOK: true,
+		},
+		{
+			name:   "a link too slow for any rung gets the floor",
+			cur:    top,
+			link:   200_000,
+			want:   rung{height: 360, rate: 444_444},
+			wantOK: true,
+		},
+		{
+			name:   "a copied 360p source steps down to the floor's rate",
+			cur:    rung{height: 360, rate: 1_000_000},
+			link:   500_000,
+			want:   rung{height: 360, rate: 444_444},
+			wantOK: true,
+		},
+		{
+			name: "the floor has nothing below it",
+			cur:  rung{height: 360, rate: 444_444},
+			link: 200_000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := stepDown(tt.cur, tt.link, 256_000, media.CodecH264, Config{})
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("stepDown() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// packet is a TS packet carrying PCR base pcr, flagged a keyframe when key.
+func packet(pcr uint64, key bool) []byte {
+	p := make([]byte, fileserve.TSPacketSize)
+	p[0], p[3], p[4], p[5] = 0x47, 0x30, 7, 0x10
+	if key {
+		p[5] |= 0x40
+	}
+	p[6], p[7], p[8], p[9], p[10] = byte(pcr>>25), byte(pcr>>17), byte(pcr>>9), byte(pcr>>1), byte(pcr<<7)
+	return p
+}
+
+// encode is a test encode's output: a keyframe then a plain packet for each
+// second from..to-1, on a clock starting at 10s as a muxer's does.
+func encode(from, to int) []byte {
+	var b []byte
+	for i := from; i < to; i++ {
+		pcr := uint64(10+i) * 90_000
+		b = append(b, packet(pcr, true)...)
+		b = append(b, packet(pcr+45_000, false)...)
+	}
+	return b
+}
+
+func TestSplicerCutsAtKeyframe(t *testing.T) {
+	var at time.Duration
+	s := &splicer{
+		cur: bytes.NewReader(encode(0, 4)),
+		restart: func(d time.Duration) (io.Reader, error) {
+			at = d
+			return bytes.NewReader(encode(int(d/time.Second), 6)), nil
+		},
+	}
+	// The first keyframe only starts the clock; the next one is cut at.
+	s.pending.Store(true)
+
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at != time.Second {
+		t.Errorf("restarted at %s, want 1s: the first keyframe after the stream's own", at)
+	}
+	want := append(encode(0, 1), encode(1, 6)...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("spliced %d bytes, want second 0 of the old encode then the new one from second 1 (%d bytes)", len(got), len(want))
+	}
+	if s.pending.Load() {
+		t.Error("a step is still pending after the splice")
+	}
+}
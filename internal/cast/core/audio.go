@@ -11,10 +11,12 @@ import (
 // bitrate targets here are just good audio points, not tied to any device
 // (unlike ResolveVideo's targets, which are the renderer's decode budget).
 
-// audioTarget is a surround re-encode target: the bitrate and the channel
-// ceiling the codec carries, so a source above it (a 7.1 track targeting AC-3)
-// folds down to what the codec supports instead of failing the encode.
+// audioTarget is a surround re-encode target: the ffmpeg encoder that writes
+// the codec, the bitrate and the channel ceiling the codec carries, so a source
+// above it (a 7.1 track targeting AC-3) folds down to what the codec supports
+// instead of failing the encode.
 type audioTarget struct {
+	encoder     string
 	bitrate     string
 	maxChannels int
 }
@@ -25,11 +27,18 @@ type audioTarget struct {
 // maxChannels is 6 (5.1) for both: ffmpeg's native ac3 and eac3 encoders reject
 // more than 5.1 (they don't implement E-AC-3's 7.1 dependent substreams), so a
 // 7.1 source folds to 5.1 rather than failing the encode. Stereo AAC is the
-// floor below these and is not a target here. Adding a surround codec the
-// pipeline encodes to is one entry here.
+// floor below these and is not a target here.
+//
+// The lossless and disc codecs (FLAC, TrueHD, DTS) are deliberately not
+// targets: re-encoding a lossy or lossless source to them buys nothing a Dolby
+// codec doesn't deliver, and ffmpeg's DTS and TrueHD encoders are experimental.
+// They reach a renderer only by copy. Nor is Opus: every renderer family caps
+// it at stereo (Cast by its profile, DLNA for want of a channel count in the
+// Sink), so a surround Opus target would never be chosen. Adding a surround
+// codec the pipeline encodes to is one entry here.
 var audioTargets = map[media.Codec]audioTarget{
-	media.CodecAC3:  {bitrate: "448k", maxChannels: 6},
-	media.CodecEAC3: {bitrate: "384k", maxChannels: 6},
+	media.CodecAC3:  {encoder: "ac3", bitrate: "448k", maxChannels: 6},
+	media.CodecEAC3: {encoder: "eac3", bitrate: "384k", maxChannels: 6},
 }
 
 // stereoAudioBitrate is the stereo AAC floor: the target every renderer decodes,
@@ -38,8 +47,9 @@ const stereoAudioBitrate = "256k"
 
 // audioCodecPreference ranks surround re-encode targets, most efficient first.
 // ResolveAudio consults it only for a multichannel source that can't be copied:
-// the first codec the renderer advertises wins, keeping the 5.1/7.1 layout
-// instead of downmixing. Stereo AAC is the floor below this and needs no entry.
+// the first codec the renderer decodes in surround wins, keeping the 5.1/7.1
+// layout instead of downmixing. Stereo AAC is the floor below this and needs
+// no entry.
 var audioCodecPreference = []media.Codec{media.CodecEAC3, media.CodecAC3}
 
 // ResolveAudio fills opts' audio fields from the renderer's advertised audio
@@ -48,14 +58,22 @@ var audioCodecPreference = []media.Codec{media.CodecEAC3, media.CodecAC3}
 // off a source probe):
 //
 //  1. copy — the renderer decodes the source codec (and channel count), so a
-//     5.1/7.1 track passes through untouched, no quality loss and no downmix;
+//     5.1/7.1 track passes through untouched, no quality loss and no downmix —
+//     a DTS or TrueHD track to a renderer that passes them to a receiver, a
+//     FLAC track to one that decodes it;
 //  2. surround re-encode — a multichannel source the renderer can't copy is
-//     re-encoded to a Dolby codec it advertises (E-AC-3, else AC-3), keeping the
-//     layout up to that codec's channel ceiling;
+//     re-encoded to a surround codec it advertises (E-AC-3, else AC-3),
+//     keeping the layout up to the lower of that codec's and the renderer's
+//     channel ceiling;
 //  3. stereo AAC — the floor every renderer decodes, when neither applies (also
 //     what a set advertising nothing surround-capable, or a failed probe's zero
 //     ProbeInfo, gets — the pre-surround behaviour).
+//
+// caps are first narrowed to what opts' output container carries, so a FLAC
+// track the renderer decodes is still re-encoded when it would be muxed into
+// MPEG-TS.
 func ResolveAudio(opts *ffmpeg.EncodeOptions, caps media.Renderer, src media.ProbeInfo) {
+	caps = servable(caps, opts.OutputFormat)
 	if caps.CanCopyAudio(src) {
 		opts.AudioCodec = ffmpeg.CodecCopy
 		return
@@ -63,13 +81,23 @@ func ResolveAudio(opts *ffmpeg.EncodeOptions, caps media.Renderer, src media.Pro
 	if src.AudioChannels > 2 {
 		for _, codec := range audioCodecPreference {
 			t, ok := audioTargets[codec]
-			if !ok || !caps.SupportsAudioCodec(codec) {
+			if !ok {
 				continue
 			}
-			opts.AudioCodec = string(codec)
+			// A renderer that decodes the codec in stereo only would be
+			// handed a surround track it can't play: skip to the next.
+			ceiling, ok := caps.AudioChannels(codec)
+			if !ok || (ceiling > 0 && ceiling <= 2) {
+				continue
+			}
+			channels := min(src.AudioChannels, t.maxChannels)
+			if ceiling > 0 {
+				channels = min(channels, ceiling)
+			}
+			opts.AudioCodec = t.encoder
 			opts.AudioBitrate = t.bitrate
 			opts.AudioSampleRate = 48000
-			opts.AudioChannels = min(src.AudioChannels, t.maxChannels)
+			opts.AudioChannels = channels
 			return
 		}
 	}
@@ -22,6 +22,9 @@ func TestResolveAudio(t *testing.T) {
 	aacStereo := media.AudioSupport{Codec: media.CodecAAC, MaxChannels: 2}
 	ac3 := media.AudioSupport{Codec: media.CodecAC3}
 	eac3 := media.AudioSupport{Codec: media.CodecEAC3}
+	dts := media.AudioSupport{Codec: media.CodecDTS}
+	flacStereo := media.AudioSupport{Codec: media.CodecFLAC, MaxChannels: 2}
+	opusStereo := media.AudioSupport{Codec: media.CodecOpus, MaxChannels: 2}
 	caps := func(a ...media.AudioSupport) media.Renderer { return media.Renderer{Audio: a} }
 	src := func(codec media.Codec, ch int) media.ProbeInfo {
 		return media.ProbeInfo{AudioCodec: codec, AudioChannels: ch}
@@ -30,23 +33,30 @@ func TestResolveAudio(t *testing.T) {
 	tests := []struct {
 		name         string
 		caps         media.Renderer
+		muxer        string
 		src          media.ProbeInfo
 		wantCodec    string
 		wantChannels int
 	}{
-		{"stereo aac is copied", caps(aacStereo, ac3), src(media.CodecAAC, 2), "copy", 0},
-		{"5.1 ac3 is copied intact", caps(aacStereo, ac3), src(media.CodecAC3, 6), "copy", 0},
-		{"5.1 aac re-encodes to ac3, layout kept", caps(aacStereo, ac3), src(media.CodecAAC, 6), "ac3", 6},
-		{"5.1 dts prefers eac3 when advertised", caps(eac3, ac3), src("dts", 6), "eac3", 6},
-		{"7.1 folds to the ac3 channel ceiling", caps(ac3), src("dts", 8), "ac3", 6},
-		{"7.1 folds to the eac3 5.1 ceiling (ffmpeg eac3 has no 7.1)", caps(eac3), src("dts", 8), "eac3", 6},
-		{"multichannel with no surround support downmixes to stereo aac", caps(aacStereo), src("dts", 6), "aac", 2},
-		{"stereo source the renderer can't copy downmixes to aac", caps(), src("mp3", 2), "aac", 2},
-		{"conservative caps fall to the stereo aac floor", media.Renderer{}, media.ProbeInfo{}, "aac", 2},
+		{"stereo aac is copied", caps(aacStereo, ac3), "", src(media.CodecAAC, 2), "copy", 0},
+		{"5.1 ac3 is copied intact", caps(aacStereo, ac3), "", src(media.CodecAC3, 6), "copy", 0},
+		{"5.1 aac re-encodes to ac3, layout kept", caps(aacStereo, ac3), "", src(media.CodecAAC, 6), "ac3", 6},
+		{"5.1 dts prefers eac3 when advertised", caps(eac3, ac3), "", src(media.CodecDTS, 6), "eac3", 6},
+		{"7.1 folds to the ac3 channel ceiling", caps(ac3), "", src(media.CodecDTS, 8), "ac3", 6},
+		{"7.1 folds to the eac3 5.1 ceiling (ffmpeg eac3 has no 7.1)", caps(eac3), "", src(media.CodecDTS, 8), "eac3", 6},
+		{"multichannel with no surround support downmixes to stereo aac", caps(aacStereo), "", src(media.CodecDTS, 6), "aac", 2},
+		{"stereo source the renderer can't copy downmixes to aac", caps(), "", src(media.CodecMP3, 2), "aac", 2},
+		{"5.1 dts passes through to a renderer that takes it", caps(dts, ac3), "mpegts", src(media.CodecDTS, 6), "copy", 0},
+		{"dts folds to dolby where the container can't carry it", caps(dts, ac3), "mp4", src(media.CodecDTS, 6), "ac3", 6},
+		{"stereo flac is copied into mp4", caps(flacStereo), "mp4", src(media.CodecFLAC, 2), "copy", 0},
+		{"flac is re-encoded where mpeg-ts can't carry it", caps(flacStereo), "mpegts", src(media.CodecFLAC, 2), "aac", 2},
+		{"opus is not a surround target", caps(opusStereo), "mp4", src(media.CodecTrueHD, 8), "aac", 2},
+		{"surround goes to dolby beside opus", caps(opusStereo, ac3), "mp4", src(media.CodecDTS, 6), "ac3", 6},
+		{"conservative caps fall to the stereo aac floor", media.Renderer{}, "", media.ProbeInfo{}, "aac", 2},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var opts ffmpeg.EncodeOptions
+			opts := ffmpeg.EncodeOptions{OutputFormat: tt.muxer}
 			ResolveAudio(&opts, tt.caps, tt.src)
 			if opts.AudioCodec != tt.wantCodec {
 				t.Errorf("audio codec = %q, want %q", opts.AudioCodec, tt.wantCodec)
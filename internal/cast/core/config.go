@@ -8,8 +8,12 @@
 package core
 
 import (
+	"fmt"
+	"os"
 	"time"
 
+	"github.com/stupside/castor/internal/cast/cache"
+	"github.com/stupside/castor/internal/cast/deliver/spool"
 	"github.com/stupside/castor/internal/cast/subtitle"
 	"github.com/stupside/castor/internal/device"
 	"github.com/stupside/castor/internal/source/resolve"
@@ -30,12 +34,83 @@ type Config struct {
 	// nobody configured is decided entirely from capabilities and the source.
 	Delivery DeliveryPreference
 
+	// MaxRenditions bounds the rendition ladder an HLS delivery offers (see
+	// ResolveLadder). Zero is the default small ladder; one serves the single
+	// rendition the cast would have had, with no lower ones encoded beside it.
+	MaxRenditions int
+
+	// MaxBitrate is the cast's video bitrate ceiling in bits per second (the
+	// cast commands' --bitrate), 0 for none. A re-encode runs under it in place
+	// of the codec's own target (see ResolveVideo), and a source above it is
+	// re-encoded rather than copied. It is set per cast, not read from the
+	// config file: a link's capacity is the renderer's, which the file does not
+	// name.
+	MaxBitrate int64
+
 	// Whisper is the subtitle-transcription knob NewPlan reads to choose the
 	// subtitle axis (Enable gates burn-in). Its type lives in the cgo-free
 	// subtitle package, not the whisper transcriber, so this decision core carries
 	// it without importing whisper's cgo. A device that never serves (or a disabled
 	// transcriber) simply resolves to SubtitleOff.
 	Whisper subtitle.Whisper
+
+	// Subtitles is the subtitle file the viewer brought to this cast (the cast
+	// commands' --subtitles), which ResolveSubtitle prefers to any other: it is
+	// what they asked to see. Like MaxBitrate it is set per cast, not read from
+	// the config file.
+	Subtitles subtitle.External
+
+	// SubtitleStyle is how burned-in cues are drawn, whichever mechanism
+	// they come from (the config's subtitles.style). The zero value draws
+	// in subtitle.DefaultStyle.
+	SubtitleStyle subtitle.Style
+
+	// Spool is where a cast keeps its work files and how much of a stream it
+	// keeps on disk while casting it.
+	Spool SpoolConfig
+
+	// Cache keeps a served cast's spool once it is over, so casting the same
+	// title again plays from disk and pulls only what the spool lacks.
+	Cache cache.Config
+}
+
+// SpoolConfig places a cast's work directory and bounds its spools: the
+// upstream pull's and the served encode's. Unbounded, a spool holds all of a
+// stream until the cast ends, which on a small disk a long live feed or a
+// multi-hour film can fill. Bounded, past either limit a spool evicts what
+// every reader is done with (see spool.Quota), and a renderer reconnecting or
+// seeking back is served from the oldest keyframe kept. A recording or a
+// download needs the whole stream, so it is never bounded.
+type SpoolConfig struct {
+	// Dir is where work directories are created. Empty means the system's
+	// temporary directory.
+	Dir string `yaml:"dir"`
+	// MaxSize bounds each spool in bytes, e.g. "2GiB". Zero is no bound.
+	MaxSize spool.Bytes `yaml:"max_size" validate:"min=0"`
+	// MaxAge bounds each spool in time: how long a byte is kept once spooled.
+	// At the realtime a live feed arrives at, it is the stretch of it kept.
+	// Zero is no bound.
+	MaxAge time.Duration `yaml:"max_age" validate:"min=0"`
+}
+
+// Quota is the bound SpoolConfig puts on each spool.
+func (c SpoolConfig) Quota() spool.Quota {
+	return spool.Quota{Size: c.MaxSize, Age: c.MaxAge}
+}
+
+// WorkDir creates a cast's work directory under Dir, creating Dir first if
+// need be. The caller removes it.
+func (c SpoolConfig) WorkDir() (string, error) {
+	if c.Dir != "" {
+		if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+			return "", fmt.Errorf("creating spool directory: %w", err)
+		}
+	}
+	dir, err := os.MkdirTemp(c.Dir, "castor-")
+	if err != nil {
+		return "", fmt.Errorf("creating work directory: %w", err)
+	}
+	return dir, nil
 }
 
 // DeviceConfig is the device section, owned by the device package so this
@@ -2,15 +2,38 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 
 	"github.com/stupside/castor/internal/device"
+	"github.com/stupside/castor/internal/event"
 	"github.com/stupside/castor/internal/media"
 	"github.com/stupside/castor/internal/source/resolve"
 )
 
+// ErrSourceFailed matches the error of a cast whose source failed before
+// playback began: it could not be resolved, or its pull died or stalled before
+// the gate opened. Nothing has reached the renderer yet, so the cast can be
+// retried on another candidate source without the viewer seeing a restart.
+var ErrSourceFailed = errors.New("source failed before playback")
+
+// sourceFailure marks err as ErrSourceFailed without changing its message.
+type sourceFailure struct{ error }
+
+func (e sourceFailure) Unwrap() error        { return e.error }
+func (e sourceFailure) Is(target error) bool { return target == ErrSourceFailed }
+
+// SourceFailed marks err, a cast's failure before playback that lies with its
+// source, as ErrSourceFailed. A nil err stays nil.
+func SourceFailed(err error) error {
+	if err == nil {
+		return nil
+	}
+	return sourceFailure{err}
+}
+
 // ResolveSource runs the do-or-die prelude that doesn't depend on the renderer:
 // resolve the source URL (HLS variant selection) and find our local IPv4. The
 // device is discovered separately so its latency can overlap the puller.
@@ -18,17 +41,41 @@ func ResolveSource(ctx context.Context, cfg Config, stream *media.Stream) (*medi
 	slog.InfoContext(ctx, "resolving stream", "url", stream.URL.String())
 	resolved, err := resolve.Resolve(ctx, cfg.Resolver, stream)
 	if err != nil {
-		return nil, "", fmt.Errorf("resolving URL: %w", err)
+		return nil, "", SourceFailed(fmt.Errorf("resolving URL: %w", err))
 	}
 	slog.InfoContext(ctx, "stream resolved", "url", resolved.URL.String(), "content_type", resolved.ContentType)
 
-	localIP, err := localIPv4(cfg.Network.Interface)
+	localIP, err := LocalIP(cfg)
 	if err != nil {
-		return nil, "", fmt.Errorf("resolving local IP: %w", err)
+		return nil, "", err
 	}
 	return resolved, localIP, nil
 }
 
+// RefreshSource resolves fresh, the source of a cast under way extracted
+// afresh, to the variant prev (the stream the cast has been reading) was
+// resolved to (see resolve.Refresh).
+func RefreshSource(ctx context.Context, cfg Config, fresh, prev *media.Stream) (*media.Stream, error) {
+	resolved, err := resolve.Refresh(ctx, cfg.Resolver, fresh, prev)
+	if err != nil {
+		return nil, fmt.Errorf("resolving refreshed URL: %w", err)
+	}
+	slog.InfoContext(ctx, "refreshed stream resolved", "url", resolved.URL.String())
+	return resolved, nil
+}
+
+// LocalIP returns the address castor's servers bind for a renderer to reach:
+// the configured network.interface's, or the default route's. ResolveSource
+// finds it alongside the source; a cast with no source to resolve (a local
+// file) asks for it alone.
+func LocalIP(cfg Config) (string, error) {
+	ip, err := localIPv4(cfg.Network.Interface)
+	if err != nil {
+		return "", fmt.Errorf("resolving local IP: %w", err)
+	}
+	return ip, nil
+}
+
 // Connect locates and connects the renderer named in cfg. cast.Play calls it
 // once, up front: the plan needs the renderer's advertised capabilities
 // (SelfFetch, accepted containers, decodable codecs) to fix its axes before any
@@ -47,6 +94,7 @@ func Connect(ctx context.Context, cfg Config) (device.Device, error) {
 		return nil, fmt.Errorf("connecting to device: %w", err)
 	}
 	slog.InfoContext(ctx, "connected to device", "name", info.Name)
+	event.Emit(ctx, event.DeviceConnected, event.DeviceData{Name: info.Name, Type: string(info.Type), Address: info.Address})
 	return dev, nil
 }
 
@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -31,3 +33,23 @@ func TestResolveInfoPinnedAddress(t *testing.T) {
 		t.Errorf("Name = %q, want the host as default label", info.Name)
 	}
 }
+
+// TestSourceFailed pins the marking cast.PlayRanked falls over on: it matches
+// ErrSourceFailed through further wrapping, keeps the error's own message and
+// chain, and leaves nil alone.
+func TestSourceFailed(t *testing.T) {
+	cause := errors.New("HTTP error 403")
+	err := fmt.Errorf("running pipeline: %w", SourceFailed(fmt.Errorf("upstream pull failed: %w", cause)))
+	if !errors.Is(err, ErrSourceFailed) || !errors.Is(err, cause) {
+		t.Errorf("errors.Is(%v) = false, want both ErrSourceFailed and its cause", err)
+	}
+	if got, want := err.Error(), "running pipeline: upstream pull failed: HTTP error 403"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if errors.Is(fmt.Errorf("connecting: %w", cause), ErrSourceFailed) {
+		t.Error("an unmarked error matches ErrSourceFailed")
+	}
+	if SourceFailed(nil) != nil {
+		t.Error("SourceFailed(nil) != nil")
+	}
+}
@@ -12,25 +12,29 @@ import (
 	"sync"
 	"time"
 
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
 	"github.com/stupside/castor/internal/cast/deliver/hlsserve"
 	"github.com/stupside/castor/internal/cast/deliver/replay"
+	"github.com/stupside/castor/internal/cast/deliver/spool"
 	"github.com/stupside/castor/internal/cast/ffmpeg"
 	"github.com/stupside/castor/internal/device"
+	"github.com/stupside/castor/internal/event"
 	"github.com/stupside/castor/internal/media"
 )
 
 // This file is the served-cast delivery driver. It is device-blind and carries no
 // per-delivery code path in its control flow: Serve looks the delivery mechanism
 // up from the format's DeliveryKind (data) and drives it uniformly. Each
-// mechanism is one opener behind the deliveries table, so adding a delivery (or a
-// caption sidecar, which is a second Sink at Serve's single Play step) is new data
-// plus a small impl, not another Serve* function and not a content-type branch.
+// mechanism is one opener behind the deliveries table, so adding a delivery is
+// new data plus a small impl, not another Serve* function and not a content-type
+// branch. A caption sidecar is a second file server beside whichever delivery,
+// handed over at Serve's single Play step.
 
 // Sink is a running local server fronting a produced stream for one cast: it
 // exposes the URL the renderer fetches and blocks until the stream is fully
 // delivered. Closing it is the opener's job (its teardown holds the concrete
-// server), so the driver only ever needs these two. Both replay.Server and
-// hlsserve.Server satisfy it unchanged.
+// server), so the driver only ever needs these two. replay.Server,
+// hlsserve.Server and fileserve.Server all satisfy it unchanged.
 type Sink interface {
 	URL() *url.URL
 	Wait(ctx context.Context) error
@@ -51,6 +55,24 @@ type OpenParams struct {
 	// output pipe (the spool path follows -progress on proc.Extra) without that
 	// coupling leaking into this package.
 	OnStarted func(*ffmpeg.Process)
+	// File is the finished file a DeliverFile format serves as it is; no encoder
+	// runs, so the fields above go unused.
+	File string
+	// Duration is the length of what is served, 0 if unknown or live. It is what
+	// DLNA time-seek maps onto the served bytes, and what makes a produced
+	// MPEG-TS stream seekable at all (see seekable).
+	Duration time.Duration
+	// Adapt, if set, lets a DeliverStream MPEG-TS encode step down mid-cast
+	// when the renderer cannot keep up with it (see NewAdaptation). Other
+	// deliveries ignore it: HLS offers its ladder to the client instead, and an
+	// MP4 has no clock to splice a restarted encode by.
+	Adapt *Adaptation
+	// Quota bounds a DeliverStream encode's spool on disk (see
+	// replay.Config.Quota).
+	Quota spool.Quota
+	// Captions, if set, is a finished SRT file served beside the stream and
+	// handed to a renderer that takes one (see device.Captioner) with it.
+	Captions string
 }
 
 // session is one opened delivery: the running server, an optional readiness gate
@@ -72,6 +94,7 @@ type opener func(ctx context.Context, p OpenParams, headers map[string]string) (
 var deliveries = map[media.DeliveryKind]opener{
 	media.DeliverStream:    openStream,
 	media.DeliverSegmented: openSegmented,
+	media.DeliverFile:      openFile,
 }
 
 // Serve runs one served cast end to end and is the single delivery entry point:
@@ -84,7 +107,21 @@ func Serve(ctx context.Context, dev device.Device, p OpenParams) error {
 		return fmt.Errorf("no delivery mechanism for format %q", p.Format.ContentType)
 	}
 
-	sess, err := open(ctx, p, dev.StreamHeaders(p.Format.ContentType))
+	var captions *url.URL
+	if p.Captions != "" {
+		srv, err := fileserve.New(fileserve.Config{
+			File:      fileserve.File{Path: p.Captions, ContentType: media.SRT},
+			LocalIP:   p.LocalIP,
+			Extension: ".srt",
+		})
+		if err != nil {
+			return fmt.Errorf("starting caption server: %w", err)
+		}
+		defer func() { _ = srv.Close() }()
+		captions = srv.URL()
+	}
+
+	sess, err := open(ctx, p, dev.StreamHeaders(p.Format.ContentType, seekable(p)))
 	if err != nil {
 		return err
 	}
@@ -98,18 +135,55 @@ func Serve(ctx context.Context, dev device.Device, p OpenParams) error {
 
 	streamURL := sess.sink.URL()
 	slog.InfoContext(ctx, "starting playback", "url", streamURL.String(), "content_type", p.Format.ContentType)
-	if err := dev.Play(ctx, streamURL, p.Format.ContentType); err != nil {
+	if err := play(ctx, dev, streamURL, p.Format.ContentType, captions); err != nil {
 		return fmt.Errorf("starting playback: %w", err)
 	}
+	event.Emit(ctx, event.PlaybackStarted, event.PlaybackData{URL: streamURL.String(), ContentType: p.Format.ContentType})
 	slog.InfoContext(ctx, "streaming to device, press Ctrl+C to stop")
 	return sess.sink.Wait(ctx)
 }
 
+// play hands the renderer the stream, with the caption file beside it when
+// there is one. Only a renderer that declared Captions is ever planned a
+// sidecar, and each such family implements device.Captioner, so a caption file
+// with a renderer that cannot be handed one is a planning bug, reported as one.
+func play(ctx context.Context, dev device.Device, streamURL *url.URL, contentType string, captions *url.URL) error {
+	if captions == nil {
+		return dev.Play(ctx, streamURL, contentType)
+	}
+	c, ok := dev.(device.Captioner)
+	if !ok {
+		return fmt.Errorf("renderer cannot be handed a caption file")
+	}
+	slog.InfoContext(ctx, "serving captions", "url", captions.String())
+	return c.PlayCaptioned(ctx, streamURL, contentType, captions)
+}
+
+// seekable reports whether the renderer is told it may seek in what p serves. A
+// finished file can be served from any offset. A produced stream can be only
+// when it is a VOD (it has a Duration) in MPEG-TS: the replay server answers a
+// time-seek into it by the TS clock while it is still growing, and byte ranges
+// once it is complete. A live stream, or a VOD in any other container, is
+// served from byte 0 only and advertised as unseekable.
+func seekable(p OpenParams) bool {
+	switch p.Format.Delivery {
+	case media.DeliverFile:
+		return true
+	case media.DeliverStream:
+		return p.Duration > 0 && p.Format.ContentType == media.MPEGTS
+	default:
+		return false
+	}
+}
+
 // openStream serves a single growing output over the replay-from-zero server: the
 // encoder writes pipe:1, which the server spools and replays to every client from
-// byte 0. The URL is usable immediately (no readiness gate). Teardown closes the
-// server then the encoder, so nothing is left writing when the caller removes the
-// work directory.
+// byte 0 (a seekable VOD also from a time-seek's offset, and by byte range once
+// fully spooled). The URL is usable immediately (no readiness gate). Teardown
+// closes the server then the encoder, so nothing is left writing when the caller
+// removes the work directory. With p.Adapt the encoder may be replaced partway
+// through by a lower-bitrate one (see adaptor), and teardown ends whichever
+// runs last.
 func openStream(ctx context.Context, p OpenParams, headers map[string]string) (*session, error) {
 	args, err := ffmpeg.EncodeArgs(p.Opts)
 	if err != nil {
@@ -123,31 +197,54 @@ func openStream(ctx context.Context, p OpenParams, headers map[string]string) (*
 		p.OnStarted(proc)
 	}
 
-	srv, err := replay.New(replay.Config{
+	cfg := replay.Config{
 		LocalIP:     p.LocalIP,
 		ContentType: p.Format.ContentType,
 		Extension:   p.Format.Extension,
 		Headers:     headers,
-		SpoolPath:   filepath.Join(p.WorkDir, "out"+p.Format.Extension),
-	}, proc.Stdout)
+		SpoolPath:   StreamSpool(p.WorkDir, p.Format),
+		Quota:       p.Quota,
+		Duration:    p.Duration,
+		PacketSize:  packetSize(p.Format),
+	}
+	var producer io.Reader = proc.Stdout
+	finish := func() { finishEncoder(ctx, proc) }
+	if p.Adapt != nil && cfg.PacketSize == fileserve.TSPacketSize {
+		// The producer is held to a lead over the renderer, so a step down
+		// reaches it in that lead rather than after all the encode ran ahead.
+		ad := newAdaptor(ctx, p, proc)
+		cfg.Lead, cfg.OnDelivery = ad.lead, ad.observe
+		producer, finish = ad.splice, ad.finish
+	}
+
+	srv, err := replay.New(cfg, producer)
 	if err != nil {
-		finishEncoder(ctx, proc)
+		finish()
 		return nil, fmt.Errorf("starting stream server: %w", err)
 	}
 
 	return &session{
 		sink:     srv,
-		teardown: func() { _ = srv.Close(); finishEncoder(ctx, proc) },
+		teardown: func() { _ = srv.Close(); finish() },
 	}, nil
 }
 
+// StreamSpool is where a single-file (DeliverStream) encode is spooled in
+// workDir. The spool outlives the server until the caller removes workDir, so
+// the whole served output can still be kept once the cast ends (--record).
+func StreamSpool(workDir string, f media.FormatInfo) string {
+	return filepath.Join(workDir, "out"+f.Extension)
+}
+
 // openSegmented serves a live HLS directory: the encoder writes the playlist and
 // rolling segments into the work directory, which the HLS server fronts. Because
 // the output is files (not pipe:1), this fully owns the encoder lifecycle: a
 // single goroutine drains the unused stdout to EOF and only then Waits (honoring
 // os/exec's no-Wait-before-reads contract), then signals the server and the
 // readiness gate. The device is handed the playlist only once it exists (the gate
-// fails fast if the encoder dies first). Teardown kills the encoder, joins the
+// fails fast if the encoder dies first). With a rendition ladder
+// (Opts.Renditions) the device is handed castor's master playlist instead, once
+// every variant's playlist exists. Teardown kills the encoder, joins the
 // goroutine, then closes the server, so nothing writes into the work directory
 // after the caller removes it.
 func openSegmented(ctx context.Context, p OpenParams, _ map[string]string) (*session, error) {
@@ -155,6 +252,10 @@ func openSegmented(ctx context.Context, p OpenParams, _ map[string]string) (*ses
 	if err != nil {
 		return nil, fmt.Errorf("building encode args: %w", err)
 	}
+	playlist, variants, err := prepareLadder(p.WorkDir, p.Opts.Renditions)
+	if err != nil {
+		return nil, err
+	}
 	startOpts := append(slices.Clone(p.StartOpts), ffmpeg.WithWorkDir(p.WorkDir))
 	proc, err := ffmpeg.Start(ctx, p.FFmpegPath, args, startOpts...)
 	if err != nil {
@@ -167,7 +268,7 @@ func openSegmented(ctx context.Context, p OpenParams, _ map[string]string) (*ses
 	srv, err := hlsserve.New(hlsserve.Config{
 		LocalIP:  p.LocalIP,
 		Dir:      p.WorkDir,
-		Playlist: media.HLSPlaylistName,
+		Playlist: playlist,
 	})
 	if err != nil {
 		proc.Kill()
@@ -189,11 +290,46 @@ func openSegmented(ctx context.Context, p OpenParams, _ map[string]string) (*ses
 
 	return &session{
 		sink:     srv,
-		ready:    func(ctx context.Context) error { return waitForPlaylist(ctx, p.WorkDir, exited) },
+		ready:    func(ctx context.Context) error { return waitForPlaylists(ctx, p.WorkDir, variants, exited) },
 		teardown: func() { proc.Kill(); wg.Wait(); _ = srv.Close() },
 	}, nil
 }
 
+// openFile serves a finished file as it is, through the file server's byte
+// ranges and time-seek. There is no encoder to start or tear down, and the URL
+// is usable immediately. Time-seek is offered only on MPEG-TS, whose fixed
+// 188-byte packets are what a time is mapped onto.
+func openFile(_ context.Context, p OpenParams, headers map[string]string) (*session, error) {
+	cfg := fileserve.Config{
+		File: fileserve.File{
+			Path:        p.File,
+			ContentType: p.Format.ContentType,
+			Headers:     headers,
+			Duration:    p.Duration,
+		},
+		LocalIP:   p.LocalIP,
+		Extension: p.Format.Extension,
+	}
+	cfg.PacketSize = packetSize(p.Format)
+	srv, err := fileserve.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("starting file server: %w", err)
+	}
+	return &session{
+		sink:     srv,
+		teardown: func() { _ = srv.Close() },
+	}, nil
+}
+
+// packetSize is the fixed packet size of f's container, what a time-seek is
+// aligned to: MPEG-TS's 188 bytes, 0 for a container without one.
+func packetSize(f media.FormatInfo) int64 {
+	if f.ContentType == media.MPEGTS {
+		return fileserve.TSPacketSize
+	}
+	return 0
+}
+
 // finishEncoder tears down a pipe-fed encoder: close its output (the encoder gets
 // EPIPE and exits), wait for exit, and surface stderr forensics on a failure we
 // didn't cause ourselves (a cancelled context means we killed ffmpeg, e.g.
@@ -206,26 +342,58 @@ func finishEncoder(ctx context.Context, proc *ffmpeg.Process) {
 	}
 }
 
-// waitForPlaylist blocks until the muxer has written the playlist (so the device
-// is not pointed at a 404), the encoder exits first (fail fast rather than poll
-// forever for a playlist that will never appear), or ctx ends.
-func waitForPlaylist(ctx context.Context, workDir string, producerExited <-chan struct{}) error {
-	playlist := filepath.Join(workDir, media.HLSPlaylistName)
+// prepareLadder lays out the work directory for a rendition ladder before the
+// encoder starts: a directory per variant for the muxer to write into, and the
+// master playlist over them, which castor writes itself (see ffmpeg.HLSMaster).
+// It returns the playlist to hand the device and the variant playlists the
+// encoder must have written before it is handed. Without a ladder these are the
+// encoder's single playlist.
+func prepareLadder(workDir string, renditions []ffmpeg.Rendition) (playlist string, variants []string, err error) {
+	if len(renditions) == 0 {
+		return media.HLSPlaylistName, []string{media.HLSPlaylistName}, nil
+	}
+	for i := range renditions {
+		variant := media.HLSVariantPath(i, media.HLSPlaylistName)
+		if err := os.MkdirAll(filepath.Join(workDir, filepath.Dir(variant)), 0o755); err != nil {
+			return "", nil, fmt.Errorf("creating HLS variant directory: %w", err)
+		}
+		variants = append(variants, variant)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, media.HLSMasterName), ffmpeg.HLSMaster(renditions), 0o644); err != nil {
+		return "", nil, fmt.Errorf("writing HLS master playlist: %w", err)
+	}
+	return media.HLSMasterName, variants, nil
+}
+
+// waitForPlaylists blocks until the muxer has written every playlist in
+// playlists, relative to workDir (so the device is not pointed at a 404, nor
+// handed a master whose variant it would switch to is still missing), the
+// encoder exits first (fail fast rather than poll forever for a playlist that
+// will never appear), or ctx ends.
+func waitForPlaylists(ctx context.Context, workDir string, playlists []string, producerExited <-chan struct{}) error {
+	written := func() bool {
+		for _, p := range playlists {
+			if _, err := os.Stat(filepath.Join(workDir, p)); err != nil {
+				return false
+			}
+		}
+		return true
+	}
 	tick := time.NewTicker(200 * time.Millisecond)
 	defer tick.Stop()
 	for {
-		if _, err := os.Stat(playlist); err == nil {
+		if written() {
 			return nil
 		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-producerExited:
-			// The encoder exited before a playlist appeared. Re-check once in case
-			// it finalized one as it went, else fail with a clear error (the exit
-			// reason was already logged) instead of polling for a file that will
-			// never be written.
-			if _, err := os.Stat(playlist); err == nil {
+			// The encoder exited before the playlists appeared. Re-check once in
+			// case it finalized them as it went, else fail with a clear error (the
+			// exit reason was already logged) instead of polling for files that
+			// will never be written.
+			if written() {
 				return nil
 			}
 			return fmt.Errorf("encoder exited before producing the HLS playlist")
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"cmp"
+	"context"
+
+	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/media"
+)
+
+// ladderHeights are the heights a rendition ladder steps down through, the
+// ones HLS clients and encoders are tuned for.
+var ladderHeights = []int{2160, 1440, 1080, 720, 480, 360}
+
+const (
+	// maxRenditions bounds a ladder whatever the config asks: the rendition
+	// the cast would have had, and two below it. Each is a full encode of its
+	// own, and two steps already take a 1080p cast down to 480p, as far as a
+	// link that still plays video falls.
+	maxRenditions = 3
+
+	// defaultRenditions is the ladder a config that sets none gets: the
+	// rendition the cast would have had and one step below it, so an HLS
+	// client has a variant to fall back to for the cost of a single encode.
+	defaultRenditions = 2
+
+	// targetHeight is the height the videoTargets bitrates are sized for. A
+	// rendition below it gets the target scaled by its share of the pixels.
+	targetHeight = 1080
+
+	// copiedAudioBandwidth is what a copied audio track is announced at: the
+	// most any codec a renderer takes copied carries (AC-3 at 640k), as nothing
+	// is known of the real one but that it fits.
+	copiedAudioBandwidth = 640_000
+)
+
+// ResolveLadder turns a segmented encode's single video rendition, as
+// ResolveVideo (or a remux's stream-copy) left it, into a rendition ladder: that
+// rendition on top, then up to cfg.MaxRenditions-1 more (two at most) at the
+// next standard heights down, encoded at a share of the codec's target. An HLS
+// client then steps down to a variant its link sustains instead of stalling on
+// a flaky one. Unset, the ladder is a small one, defaultRenditions: each lower
+// rendition is a realtime encode, where a remux's single rendition is a cheap
+// stream copy, so it grows only when the config asks. A config asking for one
+// leaves the encode alone.
+//
+// The lower renditions use the top's encoder when it has one, else the most
+// efficient the renderer decodes and this host can encode, as ResolveVideo
+// would pick. A rendition too short to step down from (360p) is left alone, as
+// is any encode the caller does not serve segmented; the ladder only applies
+// to an HLS output (see ffmpeg.EncodeOptions.Renditions).
+func ResolveLadder(ctx context.Context, opts *ffmpeg.EncodeOptions, caps media.Renderer, src media.ProbeInfo, cfg Config) {
+	resolveLadder(opts, caps, src, cfg, func(c media.Codec) (ffmpeg.Encoder, bool) {
+		return ffmpeg.SelectEncoder(ctx, cfg.Transcode.FFmpegPath, c)
+	})
+}
+
+// resolveLadder is ResolveLadder with the encoder lookup injected (see
+// selectVideoEncoder).
+func resolveLadder(opts *ffmpeg.EncodeOptions, caps media.Renderer, src media.ProbeInfo, cfg Config, selectEncoder func(media.Codec) (ffmpeg.Encoder, bool)) {
+	n := min(cmp.Or(cfg.MaxRenditions, defaultRenditions), maxRenditions)
+	if n <= 1 {
+		return
+	}
+	top := ladderTop(opts, src, cfg)
+	var below []int
+	for _, h := range ladderHeights {
+		// A step must be a real one: a 1088-line source does not get a 1080p
+		// rendition beneath it.
+		if h*10 < top*9 && len(below) < n-1 {
+			below = append(below, h)
+		}
+	}
+	if len(below) == 0 {
+		return
+	}
+
+	enc := opts.VideoEncoder
+	if enc == nil {
+		e := selectVideoEncoder(servable(caps, opts.OutputFormat), selectEncoder)
+		enc = &e
+	}
+	audio := int64(copiedAudioBandwidth)
+	if opts.AudioCodec != ffmpeg.CodecCopy {
+		audio = rate(opts.AudioBitrate)
+	}
+
+	// The top is announced at its VBV cap when encoded. A copy is announced at
+	// the source's own bitrate (audio included), or when that is unknown at
+	// twice what an encode of its height would be allotted, so a client never
+	// takes it for the cheaper variant.
+	topBandwidth := 2*ladderRate(enc.Codec, top, cfg) + audio
+	switch {
+	case opts.VideoEncoder != nil:
+		topBandwidth = rate(opts.VideoMaxrate) + audio
+	case src.BitRate > 0:
+		topBandwidth = src.BitRate
+	}
+	renditions := []ffmpeg.Rendition{{
+		Encoder:   opts.VideoEncoder,
+		MaxHeight: opts.VideoMaxHeight,
+		Bitrate:   opts.VideoBitrate,
+		Maxrate:   opts.VideoMaxrate,
+		Bufsize:   opts.VideoBufsize,
+		Bandwidth: topBandwidth,
+	}}
+	for _, h := range below {
+		r := ladderRate(enc.Codec, h, cfg)
+		renditions = append(renditions, ffmpeg.Rendition{
+			Encoder:   enc,
+			MaxHeight: h,
+			Bitrate:   ffmpeg.FormatRate(r),
+			Maxrate:   ffmpeg.FormatRate(r),
+			Bufsize:   ffmpeg.FormatRate(2 * r),
+			Bandwidth: r + audio,
+		})
+	}
+	opts.Renditions = renditions
+}
+
+// ladderTop is the height of the rendition the encode would have had: the
+// source's, capped by the encode's scale when it re-encodes. An unknown source
+// height is taken to be the configured ceiling, the most it is allowed to be.
+func ladderTop(opts *ffmpeg.EncodeOptions, src media.ProbeInfo, cfg Config) int {
+	h := src.VideoHeight
+	if opts.VideoEncoder != nil && opts.VideoMaxHeight > 0 && (h == 0 || h > opts.VideoMaxHeight) {
+		h = opts.VideoMaxHeight
+	}
+	if h == 0 {
+		h = cfg.Resolver.MaxHeight
+	}
+	return h
+}
+
+// ladderRate is the VBV-capped bitrate, in bits per second, a rendition of
+// height h encoded to codec gets: the codec's ceiling (videoCeiling) scaled by
+// the rendition's share of targetHeight's pixels, never above the ceiling
+// itself.
+func ladderRate(codec media.Codec, h int, cfg Config) int64 {
+	ceiling := videoCeiling(codec, cfg)
+	if h >= targetHeight {
+		return ceiling
+	}
+	return ceiling * int64(h) * int64(h) / (targetHeight * targetHeight)
+}
+
+// rate parses a bitrate the resolvers set themselves, so never an invalid one.
+func rate(r string) int64 {
+	n, _ := ffmpeg.ParseRate(r)
+	return n
+}
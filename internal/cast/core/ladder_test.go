@@ -0,0 +1,118 @@
+package core
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/source/resolve"
+)
+
+// TestResolveLadder pins the ladder a segmented encode steps down through: the
+// rendition the cast would have had on top, then up to two standard heights
+// clearly below it at the codec target scaled by pixels, each announced at what
+// a client needs to sustain it. The fake encoder lookup keeps it
+// host-independent, as in TestSelectVideoEncoder.
+func TestResolveLadder(t *testing.T) {
+	h264 := ffmpeg.Encoder{Name: "libx264", Codec: media.CodecH264}
+	lookup := func(c media.Codec) (ffmpeg.Encoder, bool) { return h264, c == media.CodecH264 }
+	caps := media.Renderer{Video: []media.VideoSupport{{Codec: media.CodecH264}}}
+	cfg := Config{Resolver: resolve.Config{MaxHeight: 1080}, MaxRenditions: 3}
+	encoded := func() ffmpeg.EncodeOptions {
+		return ffmpeg.EncodeOptions{
+			VideoEncoder:   &h264,
+			VideoMaxHeight: 1080,
+			VideoBitrate:   "4M",
+			VideoMaxrate:   "4M",
+			VideoBufsize:   "8M",
+			AudioCodec:     "aac",
+			AudioBitrate:   "256k",
+		}
+	}
+
+	tests := []struct {
+		name          string
+		opts          ffmpeg.EncodeOptions
+		src           media.ProbeInfo
+		wantHeights   []int
+		wantBandwidth []int64
+	}{
+		{
+			name:          "an encode capped at 1080p steps down to 720p and 480p",
+			opts:          encoded(),
+			src:           media.ProbeInfo{VideoHeight: 2160},
+			wantHeights:   []int{1080, 720, 480},
+			wantBandwidth: []int64{4_256_000, 1_777_777 + 256_000, 790_123 + 256_000},
+		},
+		{
+			name: "a copied source is announced at its own bitrate",
+			opts: ffmpeg.EncodeOptions{AudioCodec: ffmpeg.CodecCopy},
+			src:  media.ProbeInfo{VideoHeight: 720, BitRate: 3_000_000},
+			// The copy keeps the source's height, so the top carries no cap.
+			wantHeights:   []int{0, 480, 360},
+			wantBandwidth: []int64{3_000_000, 790_123 + copiedAudioBandwidth, 444_444 + copiedAudioBandwidth},
+		},
+		{
+			name:        "a height just over a standard one does not get that one beneath it",
+			opts:        ffmpeg.EncodeOptions{AudioCodec: ffmpeg.CodecCopy},
+			src:         media.ProbeInfo{VideoHeight: 1088, BitRate: 5_000_000},
+			wantHeights: []int{0, 720, 480},
+		},
+		{
+			name: "a 360p source has nothing to step down to",
+			opts: ffmpeg.EncodeOptions{AudioCodec: ffmpeg.CodecCopy},
+			src:  media.ProbeInfo{VideoHeight: 360},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			resolveLadder(&opts, caps, tt.src, cfg, lookup)
+
+			var heights []int
+			var bandwidth []int64
+			for i, r := range opts.Renditions {
+				heights = append(heights, r.MaxHeight)
+				bandwidth = append(bandwidth, r.Bandwidth)
+				if i > 0 && (r.Encoder == nil || r.Encoder.Name != h264.Name || r.Maxrate == "") {
+					t.Errorf("rendition %d = %+v, want a VBV-capped %s encode", i, r, h264.Name)
+				}
+			}
+			if !slices.Equal(heights, tt.wantHeights) {
+				t.Errorf("ladder heights = %v, want %v", heights, tt.wantHeights)
+			}
+			if tt.wantBandwidth != nil && !slices.Equal(bandwidth, tt.wantBandwidth) {
+				t.Errorf("ladder bandwidths = %v, want %v", bandwidth, tt.wantBandwidth)
+			}
+		})
+	}
+}
+
+// TestResolveLadderSize pins the ladder's size: by default the rendition and
+// one step below it, one alone when the config asks for one (a remux stays a
+// stream copy), and up to three when it asks for more.
+func TestResolveLadderSize(t *testing.T) {
+	h264 := ffmpeg.Encoder{Name: "libx264", Codec: media.CodecH264}
+	lookup := func(c media.Codec) (ffmpeg.Encoder, bool) { return h264, c == media.CodecH264 }
+	caps := media.Renderer{Video: []media.VideoSupport{{Codec: media.CodecH264}}}
+	src := media.ProbeInfo{VideoHeight: 1080, BitRate: 5_000_000}
+
+	tests := []struct {
+		max  int
+		want int
+	}{
+		{0, 2},
+		{1, 0},
+		{2, 2},
+		{3, 3},
+	}
+	for _, tt := range tests {
+		opts := ffmpeg.EncodeOptions{AudioCodec: ffmpeg.CodecCopy}
+		cfg := Config{Resolver: resolve.Config{MaxHeight: 1080}, MaxRenditions: tt.max}
+		resolveLadder(&opts, caps, src, cfg, lookup)
+		if got := len(opts.Renditions); got != tt.want {
+			t.Errorf("MaxRenditions %d: %d renditions, want %d", tt.max, got, tt.want)
+		}
+	}
+}
@@ -46,20 +46,27 @@ const (
 	DeliverServe
 )
 
-// SubtitleMode is the subtitle axis of a Plan. Stage 1 carries only the two modes
-// today's code produces; a future SubtitleSidecar (a separately served caption
-// track the device loads) is wired as a new enum value so the executor gains a
-// branch without any reshuffle of the existing ones.
+// SubtitleMode is the subtitle axis of a Plan: whether a cast shows subtitles
+// and how they reach the screen. Where the cues come from is the source's
+// business, not the mode's: its own subtitle track when it has one in a
+// language the viewer asked for (media.Stream.Subtitle), else whisper's
+// transcript of its audio.
 type SubtitleMode int
 
 const (
 	// SubtitleOff ships no subtitles: every pass-through cast, every served cast
-	// with the transcriber disabled, and (this stage) every self-fetching renderer.
+	// with neither a source track nor the transcriber, and every self-fetching
+	// renderer.
 	SubtitleOff SubtitleMode = iota
-	// SubtitleBurnIn transcribes the audio and draws the cues into the video
-	// frames during the encode (whisper hardsubs). It forces a video re-encode
-	// (drawtext needs decoded frames) and so is only reachable on a served cast.
+	// SubtitleBurnIn draws the cues into the video frames during the encode
+	// (hardsubs). It forces a video re-encode (drawtext needs decoded frames)
+	// and so is only reachable on a served cast.
 	SubtitleBurnIn
+	// SubtitleSidecar serves the source's own subtitle track beside the stream
+	// as an SRT file the renderer loads and shows itself, so the video is left
+	// as it is. Only a renderer that declares Captions takes one, and only a
+	// track that can be read whole before playback starts is sent this way.
+	SubtitleSidecar
 )
 
 // Plan is the pure decision record for one cast: what the executor must do,
@@ -77,7 +84,7 @@ const (
 type Plan struct {
 	// Delivery is pass-through versus locally served.
 	Delivery DeliveryMode
-	// Subtitle is off versus burned-in.
+	// Subtitle is off, burned in, or served beside the stream.
 	Subtitle SubtitleMode
 	// OutputContentType is the MIME type the device is told it is fetching: the
 	// container the local ffmpeg muxes on a served cast, taken from the renderer's
@@ -96,7 +103,7 @@ func NewPlan(source *media.Stream, caps media.Renderer, cfg Config) Plan {
 	delivery := ResolveDelivery(caps, source, cfg)
 	return Plan{
 		Delivery:          delivery,
-		Subtitle:          ResolveSubtitle(caps, cfg),
+		Subtitle:          ResolveSubtitle(caps, source, cfg),
 		OutputContentType: outputContentType(delivery, caps),
 	}
 }
@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"testing"
 
 	"github.com/stupside/castor/internal/cast/subtitle"
@@ -43,6 +44,9 @@ func TestNewPlan(t *testing.T) {
 		sourceHeaders http.Header
 		preference    DeliveryPreference
 		whisper       bool
+		track         *media.SubtitleTrack
+		live          bool
+		file          string // --subtitles
 		delivery      DeliveryMode
 		subtitle      SubtitleMode
 		outputCT      string
@@ -203,12 +207,85 @@ func TestNewPlan(t *testing.T) {
 			subtitle: SubtitleOff,
 			outputCT: mpegtsContentType,
 		},
+		{
+			// A source track needs no transcriber to be burned in.
+			name:     "served cast burns in the source's own track without whisper",
+			caps:     caps(false),
+			sourceCT: media.MKV,
+			track:    &media.SubtitleTrack{Index: 1, Language: "fr"},
+			delivery: DeliverServe,
+			subtitle: SubtitleBurnIn,
+			outputCT: mpegtsContentType,
+		},
+		{
+			// A muxed track is only read by reading the whole source, so even a
+			// renderer that takes captions has it burned in as it arrives.
+			name:     "muxed source track is burned in for a renderer that takes captions",
+			caps:     withCaptions(caps(false)),
+			sourceCT: media.MKV,
+			track:    &media.SubtitleTrack{Language: "fr"},
+			delivery: DeliverServe,
+			subtitle: SubtitleBurnIn,
+			outputCT: mpegtsContentType,
+		},
+		{
+			name:     "VOD rendition is served beside the stream to a renderer that takes captions",
+			caps:     withCaptions(caps(false)),
+			sourceCT: media.HLS,
+			track:    &media.SubtitleTrack{URL: mustParse(t, "https://cdn.example/subs/fr.m3u8"), Language: "fr"},
+			whisper:  true,
+			delivery: DeliverServe,
+			subtitle: SubtitleSidecar,
+			outputCT: mpegtsContentType,
+		},
+		{
+			// A live rendition never ends, so there is no whole file to serve.
+			name:     "live rendition is burned in even for a renderer that takes captions",
+			caps:     withCaptions(caps(false)),
+			sourceCT: media.HLS,
+			track:    &media.SubtitleTrack{URL: mustParse(t, "https://cdn.example/subs/fr.m3u8"), Language: "fr"},
+			live:     true,
+			delivery: DeliverServe,
+			subtitle: SubtitleBurnIn,
+			outputCT: mpegtsContentType,
+		},
+		{
+			// The viewer's own file wins over the source's rendition, and is
+			// burned in: it may be an ASS only the burn-in keeps styled.
+			name:     "a subtitle file is burned in over a rendition a renderer could load",
+			caps:     withCaptions(caps(false)),
+			sourceCT: media.HLS,
+			track:    &media.SubtitleTrack{URL: mustParse(t, "https://cdn.example/subs/fr.m3u8"), Language: "fr"},
+			file:     "/subs/film.ass",
+			delivery: DeliverServe,
+			subtitle: SubtitleBurnIn,
+			outputCT: mpegtsContentType,
+		},
+		{
+			// Nor does a file reach a renderer that reads the source itself.
+			name:     "self-fetching renderer shows no subtitle file",
+			caps:     caps(true, media.MKV),
+			sourceCT: media.MKV,
+			file:     "/subs/film.srt",
+			delivery: DeliverPassthrough,
+			subtitle: SubtitleOff,
+		},
+		{
+			// A self-fetching renderer has no encode to draw into and no way to
+			// be handed a caption file.
+			name:     "self-fetching renderer shows no source track",
+			caps:     caps(true, media.MKV),
+			sourceCT: media.MKV,
+			track:    &media.SubtitleTrack{Language: "fr"},
+			delivery: DeliverPassthrough,
+			subtitle: SubtitleOff,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			source := &media.Stream{ContentType: tt.sourceCT, Headers: tt.sourceHeaders}
-			cfg := Config{Whisper: subtitle.Whisper{Enable: tt.whisper}, Delivery: tt.preference}
+			source := &media.Stream{ContentType: tt.sourceCT, Headers: tt.sourceHeaders, Subtitle: tt.track, Live: tt.live}
+			cfg := Config{Whisper: subtitle.Whisper{Enable: tt.whisper}, Delivery: tt.preference, Subtitles: subtitle.External{Location: tt.file}}
 
 			plan := NewPlan(source, tt.caps, cfg)
 
@@ -225,6 +302,21 @@ func TestNewPlan(t *testing.T) {
 	}
 }
 
+// withCaptions is r declaring it shows a caption file served beside the stream.
+func withCaptions(r media.Renderer) media.Renderer {
+	r.Captions = true
+	return r
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
 func deliveryName(d DeliveryMode) string {
 	switch d {
 	case DeliverPassthrough:
@@ -241,6 +333,8 @@ func subtitleName(s SubtitleMode) string {
 		return "Off"
 	case SubtitleBurnIn:
 		return "BurnIn"
+	case SubtitleSidecar:
+		return "Sidecar"
 	}
 	return fmt.Sprintf("SubtitleMode(%d)", s)
 }
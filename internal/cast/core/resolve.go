@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/stupside/castor/internal/cast/ffmpeg"
 	"github.com/stupside/castor/internal/media"
@@ -35,16 +36,38 @@ func ResolveDelivery(caps media.Renderer, source *media.Stream, cfg Config) Deli
 	return DeliverServe
 }
 
-// ResolveSubtitle decides the subtitle axis from the renderer and config. Stage 1
-// has one active mechanism, whisper burn-in, chosen exactly when the transcriber
-// is enabled AND the renderer does not fetch its own bytes. A self-fetching
-// renderer either passes the source through or remuxes it, and in neither case is
-// there a drawtext encode to draw cues into (it takes captions as a native track
-// in Stage 2); a push-only renderer always serves a local encode, which is
-// exactly what burn-in needs. A future SubtitleSidecar will branch here on the
-// renderer's advertised caption support.
-func ResolveSubtitle(caps media.Renderer, cfg Config) SubtitleMode {
-	if cfg.Whisper.Enable && !caps.SelfFetch {
+// ResolveSubtitle decides the subtitle axis from the renderer, the source and
+// config. A self-fetching renderer shows none: it either passes the source
+// through or remuxes it, and in neither case is there a drawtext encode to draw
+// cues into or a way to hand it a caption file. A push-only renderer always
+// serves a local encode, which is exactly what burn-in needs.
+//
+// A file the viewer brought (cfg.Subtitles) comes first and is burned in: it
+// is whole before the cast starts, but a renderer's sidecar takes SubRip only,
+// and the file may be an ASS whose styling only the burn-in keeps.
+//
+// The source's own subtitle track, when resolution picked one, is preferred
+// over whisper: it is what the title's makers wrote, it costs no model, and it
+// is there in full before the cast starts. It is served beside the stream to a
+// renderer that declares Captions when the track is a rendition of a VOD,
+// which a separate small read fetches whole; a track muxed into the source
+// can only be read by reading all of the source, and a live rendition never
+// ends, so those are burned in as they arrive. Without a source track, whisper
+// is burned in when the transcriber is enabled.
+func ResolveSubtitle(caps media.Renderer, source *media.Stream, cfg Config) SubtitleMode {
+	if caps.SelfFetch {
+		return SubtitleOff
+	}
+	if cfg.Subtitles.Set() {
+		return SubtitleBurnIn
+	}
+	if t := source.Subtitle; t != nil {
+		if caps.Captions && t.Rendition() && !source.Live {
+			return SubtitleSidecar
+		}
+		return SubtitleBurnIn
+	}
+	if cfg.Whisper.Enable {
 		return SubtitleBurnIn
 	}
 	return SubtitleOff
@@ -60,16 +83,35 @@ func ResolveSubtitle(caps media.Renderer, cfg Config) SubtitleMode {
 //     the renderer decodes the source envelope natively: the bitstream passes
 //     through untouched (VideoEncoder nil), no quality loss;
 //   - re-encode: otherwise, to the most efficient codec the renderer advertises
-//     and this host can hardware-encode (HEVC at half the bitrate, else H.264),
-//     bounded by that codec's VBV-capped target.
+//     and this host can hardware-encode (AV1, HEVC or VP9 at a fraction of the
+//     bitrate, else H.264), bounded by that codec's VBV-capped target, or by
+//     the cast's MaxBitrate when it sets one.
+//
+// Both consider only the codecs opts' output container carries (see servable):
+// a renderer that decodes VP9 is still served H.264 or HEVC in MPEG-TS.
 //
-// A subtitle burn-in always forces the re-encode: drawtext needs decoded frames,
-// so a copied bitstream cannot carry cues. The signal is opts.SubtitleTextFile,
-// which the caller wires before calling this (the coupling EncodeArgs documents),
-// so the decision stays a function of opts.
+// A subtitle burn-in always forces the re-encode: drawtext and libass need
+// decoded frames, so a copied bitstream cannot carry cues. The signal is
+// opts.BurnsIn, which the caller wires before calling this (the coupling
+// EncodeArgs documents), so the decision stays a function of opts.
+//
+// An HDR source the renderer is not declared to show (see
+// media.VideoSupport.Ranges) re-encodes like any other out-of-envelope one, and
+// is tone-mapped to SDR on the way. opts.ToneMap is set even when the video is
+// copied: a rendition ladder or a mid-cast step-down encodes it later from the
+// same opts, and its SDR rungs need the tone-map as much.
 func ResolveVideo(ctx context.Context, opts *ffmpeg.EncodeOptions, caps media.Renderer, src media.ProbeInfo, cfg Config) {
-	hasSubs := opts.SubtitleTextFile != ""
-	if !hasSubs && withinMaxHeight(src, cfg.Resolver.MaxHeight) && caps.CanCopyVideo(src) {
+	opts.ToneMap = ""
+	if src.VideoRange.HDR() {
+		if ffmpeg.CanToneMap(ctx, cfg.Transcode.FFmpegPath) {
+			opts.ToneMap = src.VideoRange
+		}
+		slog.InfoContext(ctx, "HDR source", "range", string(src.VideoRange), "dv_profile", src.VideoDVProfile, "tone_map", opts.ToneMap != "")
+	}
+
+	caps = servable(caps, opts.OutputFormat)
+	hasSubs := opts.BurnsIn()
+	if !hasSubs && CanCopyVideo(caps, src, cfg) {
 		// Copy the video bitstream untouched.
 		opts.VideoEncoder = nil
 		return
@@ -87,20 +129,47 @@ func ResolveVideo(ctx context.Context, opts *ffmpeg.EncodeOptions, caps media.Re
 	opts.VideoEncoder = &enc
 	t := videoTargets[enc.Codec]
 	opts.VideoBitrate, opts.VideoMaxrate, opts.VideoBufsize = t.bitrate, t.maxrate, t.bufsize
+	if cfg.MaxBitrate > 0 {
+		// The cast's own ceiling replaces the codec's target, below or above it.
+		opts.VideoBitrate = ffmpeg.FormatRate(cfg.MaxBitrate)
+		opts.VideoMaxrate, opts.VideoBufsize = opts.VideoBitrate, ffmpeg.FormatRate(2*cfg.MaxBitrate)
+	}
+}
+
+// servable narrows caps to the media an encode written by muxer can hand the
+// renderer: the video envelopes and audio codecs the container carries. An
+// output format castor does not know (none set yet) leaves caps as they are.
+func servable(caps media.Renderer, muxer string) media.Renderer {
+	if f, ok := media.FormatForMuxer(muxer); ok {
+		return caps.ServedIn(f)
+	}
+	return caps
+}
+
+// videoCeiling is the VBV cap, in bits per second, an encode to codec runs
+// under: the cast's MaxBitrate when it has one, else the codec's target.
+func videoCeiling(codec media.Codec, cfg Config) int64 {
+	if cfg.MaxBitrate > 0 {
+		return cfg.MaxBitrate
+	}
+	return rate(videoTargets[codec].maxrate)
 }
 
 // codecPreference ranks re-encode target codecs by efficiency, most efficient
 // first. selectVideoEncoder picks the first one the renderer decodes and this
 // host can hardware-encode; H.264 is last and always resolves to at least a
-// software baseline, so selection never fails. Adding a codec is one entry here.
-var codecPreference = []media.Codec{media.CodecHEVC, media.CodecH264}
+// software baseline, so selection never fails. VP9 ranks below HEVC, which
+// matches it for quality and far more renderers decode in hardware. Adding a
+// codec is one entry here.
+var codecPreference = []media.Codec{media.CodecAV1, media.CodecHEVC, media.CodecVP9, media.CodecH264}
 
 // selectVideoEncoder chooses the encoder for a re-encode: the most efficient
 // codec both the renderer advertises and this host can produce. A codec above
-// H.264 is taken only when a hardware encoder backs it, since software HEVC
-// cannot hold realtime at 1080p; H.264 is the floor and accepts its software
-// baseline. selectEncoder resolves an encoder for a codec (ffmpeg.SelectEncoder
-// in production, a fake in tests); its ok is false for a codec with no encoder.
+// H.264 is taken only when a hardware encoder backs it, since software HEVC,
+// VP9 or AV1 cannot be counted on to hold realtime at 1080p; H.264 is the floor
+// and accepts its software baseline. selectEncoder resolves an encoder for a
+// codec (ffmpeg.SelectEncoder in production, a fake in tests); its ok is false
+// for a codec with no encoder.
 func selectVideoEncoder(caps media.Renderer, selectEncoder func(media.Codec) (ffmpeg.Encoder, bool)) ffmpeg.Encoder {
 	for _, codec := range codecPreference {
 		if !caps.SupportsCodec(codec) {
@@ -116,6 +185,14 @@ func selectVideoEncoder(caps media.Renderer, selectEncoder func(media.Codec) (ff
 	return enc
 }
 
+// CanCopyVideo reports whether ResolveVideo copies src's video to a renderer
+// with caps when no burn-in forces the re-encode: the renderer decodes its
+// envelope and it fits under the configured height and the cast's bitrate
+// ceilings.
+func CanCopyVideo(caps media.Renderer, src media.ProbeInfo, cfg Config) bool {
+	return withinMaxHeight(src, cfg.Resolver.MaxHeight) && withinMaxBitrate(src, cfg.MaxBitrate) && caps.CanCopyVideo(src)
+}
+
 // withinMaxHeight reports whether a probed source fits under the configured cast
 // height ceiling. An unknown height (0) passes: the source is trusted rather
 // than force-transcoded on missing metadata. A source above the cap is not
@@ -124,17 +201,28 @@ func withinMaxHeight(src media.ProbeInfo, maxHeight int) bool {
 	return src.VideoHeight == 0 || src.VideoHeight <= maxHeight
 }
 
+// withinMaxBitrate reports whether a probed source fits under the cast's
+// bitrate ceiling, 0 for none. It is judged on the source's overall bitrate, as
+// a container reports no video bitrate of its own; an unknown one (0) passes,
+// as an unknown height does.
+func withinMaxBitrate(src media.ProbeInfo, maxBitrate int64) bool {
+	return maxBitrate == 0 || src.BitRate <= maxBitrate
+}
+
 // videoTarget is a VBV-capped bitrate: the average, the peak cap, and the buffer
 // window the cap applies over.
 type videoTarget struct{ bitrate, maxrate, bufsize string }
 
 // videoTargets is the re-encode target per codec, bounding the transcoder's
-// output so it stays within the renderer's decode budget. HEVC needs about half
-// of H.264 for the same quality. maxrate == bitrate makes the VBV cap a true
-// ceiling rather than an average the encoder overshoots; bufsize is ~2s. They
-// apply only when ResolveVideo re-encodes; a stream-copy never reads them.
-// Adding a codec the pipeline encodes to is one entry here.
+// output so it stays within the renderer's decode budget. HEVC and VP9 need
+// about half of H.264 for the same quality, and AV1 about 30% less again.
+// maxrate == bitrate makes the VBV cap a true ceiling rather than an average
+// the encoder overshoots; bufsize is ~2s. They apply only when ResolveVideo
+// re-encodes; a stream-copy never reads them. Adding a codec the pipeline
+// encodes to is one entry here.
 var videoTargets = map[media.Codec]videoTarget{
 	media.CodecH264: {bitrate: "4M", maxrate: "4M", bufsize: "8M"},
 	media.CodecHEVC: {bitrate: "2M", maxrate: "2M", bufsize: "4M"},
+	media.CodecVP9:  {bitrate: "2M", maxrate: "2M", bufsize: "4M"},
+	media.CodecAV1:  {bitrate: "1400k", maxrate: "1400k", bufsize: "2800k"},
 }
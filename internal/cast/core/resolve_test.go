@@ -32,6 +32,8 @@ func TestSelectVideoEncoder(t *testing.T) {
 	hevcSW := ffmpeg.Encoder{Name: "libx265", Codec: media.CodecHEVC}
 	h264HW := ffmpeg.Encoder{Name: "h264_videotoolbox", Codec: media.CodecH264, Hardware: true}
 	h264SW := ffmpeg.Encoder{Name: "libx264", Codec: media.CodecH264}
+	av1HW := ffmpeg.Encoder{Name: "av1_vaapi", Codec: media.CodecAV1, Hardware: true}
+	vp9HW := ffmpeg.Encoder{Name: "vp9_vaapi", Codec: media.CodecVP9, Hardware: true}
 
 	tests := []struct {
 		name  string
@@ -57,6 +59,18 @@ func TestSelectVideoEncoder(t *testing.T) {
 			avail: map[media.Codec]ffmpeg.Encoder{media.CodecHEVC: hevcHW, media.CodecH264: h264SW},
 			want:  "libx264",
 		},
+		{
+			name:  "AV1 renderer with hardware AV1 picks AV1 over HEVC",
+			caps:  renderer(media.CodecH264, media.CodecHEVC, media.CodecAV1),
+			avail: map[media.Codec]ffmpeg.Encoder{media.CodecAV1: av1HW, media.CodecHEVC: hevcHW, media.CodecH264: h264SW},
+			want:  "av1_vaapi",
+		},
+		{
+			name:  "HEVC ranks above VP9",
+			caps:  renderer(media.CodecVP9, media.CodecHEVC, media.CodecH264),
+			avail: map[media.Codec]ffmpeg.Encoder{media.CodecVP9: vp9HW, media.CodecHEVC: hevcHW, media.CodecH264: h264SW},
+			want:  "hevc_videotoolbox",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -67,6 +81,26 @@ func TestSelectVideoEncoder(t *testing.T) {
 	}
 }
 
+// TestServable pins that a codec the renderer decodes is only copied or
+// encoded to when the output container carries it: VP9 and AV1 reach a
+// renderer in MP4, never in the MPEG-TS a DLNA spool is served as.
+func TestServable(t *testing.T) {
+	caps := media.Renderer{Video: []media.VideoSupport{{Codec: media.CodecH264}, {Codec: media.CodecAV1}, {Codec: media.CodecVP9}}}
+	vp9 := media.ProbeInfo{VideoCodec: media.CodecVP9, VideoProfile: "Profile 0", VideoBitDepth: 8}
+	if servable(caps, "mpegts").CanCopyVideo(vp9) {
+		t.Error("VP9 copies into MPEG-TS")
+	}
+	if ts := servable(caps, "mpegts"); ts.SupportsCodec(media.CodecAV1) || !ts.SupportsCodec(media.CodecH264) {
+		t.Errorf("served in MPEG-TS, caps = %v, want H.264 alone", ts.Video)
+	}
+	if !servable(caps, "mp4").CanCopyVideo(vp9) {
+		t.Error("VP9 does not copy into MP4")
+	}
+	if got := servable(caps, ""); len(got.Video) != len(caps.Video) {
+		t.Errorf("no output format narrowed caps to %v", got.Video)
+	}
+}
+
 // TestPreferredVideoCodecsHaveTargets guards the coupling between the codec
 // ladder and the bitrate map: a preferred codec with no target would transcode
 // unbounded (no -maxrate), silently reintroducing the rebuffering these fix.
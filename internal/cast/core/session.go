@@ -0,0 +1,231 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/device"
+)
+
+// ErrStopped is the cancellation cause of a cast ended through Session.Stop, so
+// the caller can tell a requested stop from a failure or an interrupt.
+var ErrStopped = errors.New("cast stopped by control request")
+
+// ErrNotConnected reports a control issued before the renderer is connected
+// (the spool path connects concurrently with the pull, so early requests land
+// here).
+var ErrNotConnected = errors.New("renderer not connected yet")
+
+// positionTimeout bounds the renderer round-trip Status makes for the playhead,
+// so a wedged renderer degrades a status read instead of hanging it.
+const positionTimeout = 2 * time.Second
+
+// Session is the live, observable state of one running cast and the handle that
+// controls it. The pipeline feeds it as stages come up (plan, device, encode
+// decision, spool, encoder progress); the control API reads it and drives the
+// renderer through it. Every method is safe on a nil *Session, so the pipeline
+// reports into it unconditionally and a cast nobody is watching pays nothing.
+type Session struct {
+	stop context.CancelCauseFunc
+
+	mu     sync.Mutex
+	status Status
+	dev    device.Device
+	spool  func() int64
+}
+
+// Status is a point-in-time snapshot of a cast, shaped for the control API.
+type Status struct {
+	// State is "starting" until the renderer is connected, then "playing" or
+	// "paused" as the control API drives it, and "stopped" once stopped.
+	State      string `json:"state"`
+	Device     string `json:"device"`
+	DeviceType string `json:"device_type"`
+
+	// Delivery names the composition the pipeline chose: "passthrough",
+	// "remux", "spool", or "file".
+	Delivery    string `json:"delivery,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Subtitles   bool   `json:"subtitles"`
+	VideoCodec  string `json:"video_codec,omitempty"`
+	AudioCodec  string `json:"audio_codec,omitempty"`
+
+	// PositionSeconds is the renderer's playhead, absent when it cannot report
+	// one. EncodedSeconds and EncoderSpeed come from the local encoder's
+	// -progress feed and are absent on a cast castor does not encode.
+	PositionSeconds *float64 `json:"position_seconds,omitempty"`
+	EncodedSeconds  float64  `json:"encoded_seconds,omitempty"`
+	EncoderSpeed    float64  `json:"encoder_speed,omitempty"`
+	SpooledBytes    int64    `json:"spooled_bytes,omitempty"`
+}
+
+// NewSession starts the session for a cast to target. stop ends the cast: Stop
+// calls it with ErrStopped after the renderer has been told to stop.
+func NewSession(target DeviceConfig, stop context.CancelCauseFunc) *Session {
+	return &Session{
+		stop: stop,
+		status: Status{
+			State:      "starting",
+			Device:     target.Name,
+			DeviceType: string(target.Type),
+		},
+	}
+}
+
+// Planned records the composition the pipeline chose and its plan.
+func (s *Session) Planned(delivery string, plan Plan, contentType string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Delivery = delivery
+	s.status.ContentType = contentType
+	s.status.Subtitles = plan.Subtitle != SubtitleOff
+}
+
+// Attach records the connected renderer, which is what the controls drive.
+func (s *Session) Attach(dev device.Device) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dev = dev
+	s.status.State = "playing"
+}
+
+// Encoding records the copy-vs-encode decision of a served cast.
+func (s *Session) Encoding(videoCodec, audioCodec string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.VideoCodec = videoCodec
+	s.status.AudioCodec = audioCodec
+}
+
+// TrackSpool registers how to read the input spool's size.
+func (s *Session) TrackSpool(size func() int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spool = size
+}
+
+// Progress records one encoder -progress report. Its signature matches what
+// ffmpeg.WatchProgress calls, so it can be handed to a progress follower as is.
+func (s *Session) Progress(p ffmpeg.Progress) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.EncodedSeconds = p.Seconds
+	s.status.EncoderSpeed = p.Speed
+}
+
+// Status snapshots the cast, asking the renderer for its playhead when it can
+// report one.
+func (s *Session) Status(ctx context.Context) Status {
+	if s == nil {
+		return Status{}
+	}
+	s.mu.Lock()
+	st := s.status
+	size := s.spool
+	s.mu.Unlock()
+
+	if size != nil {
+		st.SpooledBytes = size()
+	}
+	if ctrl, err := s.controller(); err == nil && st.State != "stopped" {
+		ctx, cancel := context.WithTimeout(ctx, positionTimeout)
+		defer cancel()
+		if pos, err := ctrl.Position(ctx); err == nil {
+			secs := pos.Seconds()
+			st.PositionSeconds = &secs
+		}
+	}
+	return st
+}
+
+// Pause pauses the renderer.
+func (s *Session) Pause(ctx context.Context) error {
+	return s.drive("paused", func(c device.Controller) error { return c.Pause(ctx) })
+}
+
+// Resume resumes a paused renderer.
+func (s *Session) Resume(ctx context.Context) error {
+	return s.drive("playing", func(c device.Controller) error { return c.Resume(ctx) })
+}
+
+// Seek moves the renderer's playback to position.
+func (s *Session) Seek(ctx context.Context, position time.Duration) error {
+	return s.drive("", func(c device.Controller) error { return c.Seek(ctx, position) })
+}
+
+// SetVolume sets the renderer volume, percent in 0..100.
+func (s *Session) SetVolume(ctx context.Context, percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("volume %d out of range 0..100", percent)
+	}
+	return s.drive("", func(c device.Controller) error { return c.SetVolume(ctx, percent) })
+}
+
+// Stop tells the renderer to stop and then ends the cast. A renderer that
+// cannot be stopped (not connected yet, or the call fails) does not keep the
+// cast alive: the local delivery is torn down regardless, which starves it.
+func (s *Session) Stop(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	err := s.drive("stopped", func(c device.Controller) error { return c.Stop(ctx) })
+	s.mu.Lock()
+	s.status.State = "stopped"
+	s.mu.Unlock()
+	s.stop(ErrStopped)
+	return err
+}
+
+// drive runs one control against the renderer and, on success, moves the
+// session to state (empty leaves it unchanged).
+func (s *Session) drive(state string, do func(device.Controller) error) error {
+	ctrl, err := s.controller()
+	if err != nil {
+		return err
+	}
+	if err := do(ctrl); err != nil {
+		return err
+	}
+	if state != "" {
+		s.mu.Lock()
+		s.status.State = state
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func (s *Session) controller() (device.Controller, error) {
+	if s == nil {
+		return nil, ErrNotConnected
+	}
+	s.mu.Lock()
+	dev := s.dev
+	s.mu.Unlock()
+	if dev == nil {
+		return nil, ErrNotConnected
+	}
+	ctrl, ok := dev.(device.Controller)
+	if !ok {
+		return nil, fmt.Errorf("renderer offers no transport control: %w", errors.ErrUnsupported)
+	}
+	return ctrl, nil
+}
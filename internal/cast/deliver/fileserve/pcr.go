@@ -0,0 +1,182 @@
+package fileserve
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	// tsSyncByte opens every MPEG-TS packet.
+	tsSyncByte = 0x47
+
+	// pcrScanLimit bounds how far past an offset SeekPCR looks for the next PCR.
+	// Muxers carry one at least every 100ms (ffmpeg every 20ms), so a megabyte
+	// spans several even at a 4K remux bitrate; a stretch without one is not a
+	// stream SeekPCR can find its way in.
+	pcrScanLimit = 1 << 20
+
+	// pcrWrap is where the PCR's 33-bit 90kHz base rolls over, about 26.5 hours.
+	pcrWrap = 1 << 33
+)
+
+// SeekPCR finds where t falls in an MPEG-TS stream of size bytes, measuring
+// time by the stream's Program Clock Reference from its first PCR. It returns
+// the offset of the first packet whose PCR is at or past t, or the
+// packet-aligned size when every PCR in r is earlier (t is past what r holds
+// yet). ok is false when r carries no PCR to measure by, which a caller takes
+// as a file to seek in some other way.
+//
+// Only the packets from from on are searched, for a stream whose start is
+// gone (a ring spool past its quota keeps the first PCR but not what follows
+// it): a t before what is left lands on the first PCR packet from there.
+//
+// Unlike seeking by proportion this is exact for a variable bitrate, which is
+// every encode. It binary-searches the packets, reading only a few near each
+// probe, so it costs the same on a two-hour film as on a clip.
+func SeekPCR(r io.ReaderAt, from, size int64, t time.Duration) (off int64, ok bool) {
+	packets := size / TSPacketSize
+	first, _, ok := nextPCR(r, 0, size)
+	if !ok {
+		return 0, false
+	}
+	lo, hi := min((from+TSPacketSize-1)/TSPacketSize, packets), packets
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		pcr, _, found := nextPCR(r, mid*TSPacketSize, size)
+		// A stretch with no PCR after mid can only be the stream's tail, so it
+		// counts as past t.
+		if !found || PCRSince(first, pcr) >= t {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	// lo is the first packet whose next PCR is at or past t; that PCR's own
+	// packet is where t begins.
+	if _, at, found := nextPCR(r, lo*TSPacketSize, size); found {
+		return at, true
+	}
+	return packets * TSPacketSize, true
+}
+
+// PCRAt is the time in an MPEG-TS stream of size bytes at offset off,
+// measured as SeekPCR measures it: the next PCR at or after the packet-aligned
+// off, from the stream's first. ok is false when either is not found.
+func PCRAt(r io.ReaderAt, off, size int64) (t time.Duration, ok bool) {
+	first, _, ok := nextPCR(r, 0, size)
+	if !ok {
+		return 0, false
+	}
+	pcr, _, ok := nextPCR(r, off-off%TSPacketSize, size)
+	if !ok {
+		return 0, false
+	}
+	return PCRSince(first, pcr), true
+}
+
+// PCRSpan returns the first and last PCR bases in an MPEG-TS stream of size
+// bytes: where its clock starts, and how far what it holds so far reaches.
+// The last is found scanning back from the end, so a long stream costs no more
+// than a short one. ok is false when r carries no PCR.
+func PCRSpan(r io.ReaderAt, size int64) (first, last uint64, ok bool) {
+	first, _, ok = nextPCR(r, 0, size)
+	if !ok {
+		return 0, 0, false
+	}
+	end := size - size%TSPacketSize
+	for end > 0 {
+		from := max(end-pcrScanLimit, 0)
+		from -= from % TSPacketSize
+		found := false
+		for off := from; ; {
+			pcr, at, ok := nextPCR(r, off, end)
+			if !ok {
+				break
+			}
+			last, found, off = pcr, true, at+TSPacketSize
+		}
+		if found {
+			return first, last, true
+		}
+		end = from
+	}
+	return first, first, true
+}
+
+// KeyframePCR reports whether the TS packet p opens a keyframe of the stream
+// that carries the clock, returning its PCR base. A muxer flags a keyframe's
+// first packet as a random access point and, on the clock's own stream,
+// stamps it with a PCR, so the pair marks where a decoder can start afresh:
+// where one encode can be cut and another spliced on.
+func KeyframePCR(p []byte) (uint64, bool) {
+	pcr, ok := packetPCR(p)
+	if !ok || p[5]&0x40 == 0 {
+		return 0, false
+	}
+	return pcr, true
+}
+
+// NextKeyframe returns the offset of the first packet at or after off that
+// opens a keyframe (see KeyframePCR), reading as far as size for it: where a
+// client joining a stream partway through can start decoding. An off inside
+// a packet starts the search at the next one.
+func NextKeyframe(r io.ReaderAt, off, size int64) (int64, bool) {
+	off = (off + TSPacketSize - 1) / TSPacketSize * TSPacketSize
+	buf := make([]byte, 64*TSPacketSize)
+	for off+TSPacketSize <= size {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), size-off)], off)
+		n -= n % TSPacketSize
+		for i := 0; i < n; i += TSPacketSize {
+			if _, ok := KeyframePCR(buf[i : i+TSPacketSize]); ok {
+				return off + int64(i), true
+			}
+		}
+		if n == 0 || (err != nil && err != io.EOF) {
+			return 0, false
+		}
+		off += int64(n)
+	}
+	return 0, false
+}
+
+// nextPCR returns the PCR base (in 90kHz ticks) of the first packet at or after
+// the packet-aligned off that carries one, and that packet's offset. It reads
+// at most pcrScanLimit bytes and stops at size.
+func nextPCR(r io.ReaderAt, off, size int64) (pcr uint64, at int64, ok bool) {
+	end := min(off+pcrScanLimit, size)
+	buf := make([]byte, 64*TSPacketSize)
+	for off+TSPacketSize <= end {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), end-off)], off)
+		n -= n % TSPacketSize
+		for i := 0; i < n; i += TSPacketSize {
+			if pcr, ok := packetPCR(buf[i : i+TSPacketSize]); ok {
+				return pcr, off + int64(i), true
+			}
+		}
+		if n == 0 || (err != nil && err != io.EOF) {
+			return 0, 0, false
+		}
+		off += int64(n)
+	}
+	return 0, 0, false
+}
+
+// packetPCR reads the PCR base out of one TS packet's adaptation field, if it
+// carries one.
+func packetPCR(p []byte) (uint64, bool) {
+	if p[0] != tsSyncByte {
+		return 0, false
+	}
+	// adaptation_field_control 2 or 3 means an adaptation field follows the
+	// header; its length must cover the flags and the six PCR bytes.
+	if p[3]&0x20 == 0 || p[4] < 7 || p[5]&0x10 == 0 {
+		return 0, false
+	}
+	return uint64(p[6])<<25 | uint64(p[7])<<17 | uint64(p[8])<<9 | uint64(p[9])<<1 | uint64(p[10])>>7, true
+}
+
+// PCRSince is the time from PCR base first to pcr, across a rollover.
+func PCRSince(first, pcr uint64) time.Duration {
+	ticks := (pcr - first) % pcrWrap
+	return time.Duration(ticks) * time.Second / 90_000
+}
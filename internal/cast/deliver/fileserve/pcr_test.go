@@ -0,0 +1,132 @@
+package fileserve
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+// pcrPacket is a TS packet whose adaptation field carries PCR base pcr.
+func pcrPacket(pcr uint64) []byte {
+	p := make([]byte, TSPacketSize)
+	p[0], p[3], p[4], p[5] = tsSyncByte, 0x30, 7, 0x10
+	p[6], p[7], p[8], p[9], p[10] = byte(pcr>>25), byte(pcr>>17), byte(pcr>>9), byte(pcr>>1), byte(pcr<<7)
+	return p
+}
+
+// plainPacket is a TS packet with no adaptation field.
+func plainPacket() []byte {
+	p := make([]byte, TSPacketSize)
+	p[0], p[3] = tsSyncByte, 0x10
+	return p
+}
+
+func TestSeekPCR(t *testing.T) {
+	// Ten seconds from a first PCR just short of the rollover, one PCR packet a
+	// second, each followed by a plain one: second n starts at packet 2n.
+	first := uint64(pcrWrap - 90_000*3)
+	var ts []byte
+	for i := range 10 {
+		ts = append(ts, pcrPacket((first+uint64(i)*90_000)%pcrWrap)...)
+		ts = append(ts, plainPacket()...)
+	}
+	size := int64(len(ts))
+
+	tests := []struct {
+		name string
+		t    time.Duration
+		want int64
+	}{
+		{"start", 0, 0},
+		{"on a PCR", 4 * time.Second, 8 * TSPacketSize},
+		{"between PCRs", 4500 * time.Millisecond, 10 * TSPacketSize},
+		{"across the rollover", 3 * time.Second, 6 * TSPacketSize},
+		{"past what is there", 30 * time.Second, size},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			off, ok := SeekPCR(bytes.NewReader(ts), 0, size, tt.t)
+			if !ok || off != tt.want {
+				t.Errorf("SeekPCR(%s) = %d, %v, want %d, true", tt.t, off, ok, tt.want)
+			}
+		})
+	}
+
+	if _, ok := SeekPCR(bytes.NewReader(bytes.Repeat(plainPacket(), 4)), 0, 4*TSPacketSize, time.Second); ok {
+		t.Error("SeekPCR found a PCR in a stream without one")
+	}
+
+	// A ring spool's eviction zeroes what follows the first PCR: time is still
+	// measured from it, and searched for only in what is left.
+	evicted := bytes.Clone(ts)
+	clear(evicted[TSPacketSize : 5*TSPacketSize+100])
+	for _, tt := range []struct {
+		t    time.Duration
+		want int64
+	}{{time.Second, 6 * TSPacketSize}, {4 * time.Second, 8 * TSPacketSize}} {
+		if off, ok := SeekPCR(bytes.NewReader(evicted), 5*TSPacketSize+100, size, tt.t); !ok || off != tt.want {
+			t.Errorf("SeekPCR(%s) after eviction = %d, %v, want %d, true", tt.t, off, ok, tt.want)
+		}
+	}
+}
+
+func TestPCRAt(t *testing.T) {
+	var ts []byte
+	for i := range 4 {
+		ts = append(ts, pcrPacket(uint64(i)*90_000)...)
+		ts = append(ts, plainPacket()...)
+	}
+	size := int64(len(ts))
+	// Mid-packet offsets round down to their packet; a plain packet reads as
+	// the time of the PCR after it.
+	for off, want := range map[int64]time.Duration{0: 0, 1: 0, TSPacketSize: time.Second, 5*TSPacketSize + 7: 3 * time.Second} {
+		if got, ok := PCRAt(bytes.NewReader(ts), off, size); !ok || got != want {
+			t.Errorf("PCRAt(%d) = %s, %v, want %s, true", off, got, ok, want)
+		}
+	}
+	if _, ok := PCRAt(bytes.NewReader(ts), 7*TSPacketSize, size); ok {
+		t.Error("PCRAt found a PCR past the last one")
+	}
+}
+
+func TestKeyframePCR(t *testing.T) {
+	key := pcrPacket(90_000)
+	key[5] |= 0x40
+	if pcr, ok := KeyframePCR(key); !ok || pcr != 90_000 {
+		t.Errorf("KeyframePCR(keyframe) = %d, %v, want 90000, true", pcr, ok)
+	}
+	if _, ok := KeyframePCR(pcrPacket(90_000)); ok {
+		t.Error("KeyframePCR took a PCR packet that is no random access point for a keyframe")
+	}
+	if _, ok := KeyframePCR(plainPacket()); ok {
+		t.Error("KeyframePCR took a packet without an adaptation field")
+	}
+
+	// NextKeyframe skips to the packet boundary, then past what is no keyframe.
+	ts := slices.Concat(key, pcrPacket(180_000), plainPacket(), key)
+	if off, ok := NextKeyframe(bytes.NewReader(ts), 1, int64(len(ts))); !ok || off != 3*TSPacketSize {
+		t.Errorf("NextKeyframe(1) = %d, %v, want %d, true", off, ok, 3*TSPacketSize)
+	}
+	if _, ok := NextKeyframe(bytes.NewReader(ts), 1, 3*TSPacketSize); ok {
+		t.Error("NextKeyframe found a keyframe in a stretch without one")
+	}
+}
+
+func TestPCRSpan(t *testing.T) {
+	var ts []byte
+	for i := range 3 {
+		ts = append(ts, pcrPacket(uint64(5+i)*90_000)...)
+	}
+	// More than a scan's reach of packets without a PCR, then a torn one: the
+	// last PCR is still found, further back.
+	ts = append(ts, bytes.Repeat(plainPacket(), pcrScanLimit/TSPacketSize+10)...)
+	ts = append(ts, plainPacket()[:100]...)
+	first, last, ok := PCRSpan(bytes.NewReader(ts), int64(len(ts)))
+	if !ok || first != 5*90_000 || last != 7*90_000 {
+		t.Errorf("PCRSpan() = %d, %d, %v, want 450000, 630000, true", first, last, ok)
+	}
+	if _, _, ok := PCRSpan(bytes.NewReader(plainPacket()), TSPacketSize); ok {
+		t.Error("PCRSpan found a PCR in a stream without one")
+	}
+}
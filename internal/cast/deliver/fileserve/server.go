@@ -0,0 +1,350 @@
+// Package fileserve serves a finished local file over HTTP the way a media
+// server does: byte ranges through http.ServeContent, plus DLNA time-seek
+// (TimeSeekRange.dlna.org) for a packetized container, so a renderer can seek
+// in it. Unlike the replay server there is no producer: the file is complete
+// before the first request, which is what makes every offset answerable.
+// URL/Wait/Close match the other delivery servers' shape so the cast path
+// composes over it.
+package fileserve
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stupside/castor/internal/metrics"
+)
+
+// TSPacketSize is an MPEG-TS packet as ffmpeg and broadcast files write it, the
+// PacketSize of a TS File. The 192-byte timestamped variant (M2TS) is not
+// time-seekable here.
+const TSPacketSize = 188
+
+const (
+	// TimeSeekHeader is the DLNA request header asking for a play range by time
+	// rather than bytes, and the response header confirming what was served.
+	TimeSeekHeader = "TimeSeekRange.dlna.org"
+
+	// endGrace is how long Wait keeps serving after the last byte went out, for
+	// a renderer that rereads the tail (an mp4 index) or restarts from the top.
+	endGrace = 10 * time.Second
+
+	// defaultIdleGrace is how long Wait keeps serving with no client connected.
+	// It is generous because a seekable renderer commonly drops its connection
+	// while paused and reopens with a Range on resume.
+	defaultIdleGrace = 5 * time.Minute
+)
+
+// File is one file to serve and what answering a request for it takes.
+type File struct {
+	Path        string
+	ContentType string
+	Headers     map[string]string
+
+	// Duration is the file's length in time, 0 if unknown. PacketSize is its
+	// container's fixed packet size (188 for MPEG-TS), 0 for a container without
+	// one. Time-seek is answered only when both are set: only a packetized
+	// stream's bytes map onto its timeline closely enough to seek by proportion,
+	// and only on packet boundaries.
+	Duration   time.Duration
+	PacketSize int64
+}
+
+// Config is what the caller fills in.
+type Config struct {
+	File
+
+	LocalIP   string
+	Extension string
+
+	// IdleGrace overrides how long Wait keeps serving with no client. Zero uses
+	// defaultIdleGrace; tests set it small.
+	IdleGrace time.Duration
+}
+
+// Server serves one file until the renderer is done with it.
+type Server struct {
+	cfg      Config
+	listener net.Listener
+	server   *http.Server
+
+	mu         sync.Mutex
+	active     int
+	reachedEnd bool // the most recent response delivered the file's last byte
+	lastActive time.Time
+}
+
+// New checks that cfg.Path is a readable file, then binds to cfg.LocalIP on an
+// ephemeral port and starts serving it.
+func New(cfg Config) (*Server, error) {
+	if cfg.IdleGrace <= 0 {
+		cfg.IdleGrace = defaultIdleGrace
+	}
+	fi, err := os.Stat(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", cfg.Path)
+	}
+
+	ln, err := net.Listen("tcp", cfg.LocalIP+":0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		cfg:        cfg,
+		listener:   ln,
+		lastActive: time.Now(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file"+cfg.Extension, s.handleFile)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() { _ = s.server.Serve(ln) }()
+	return s, nil
+}
+
+// URL is the address the renderer should fetch.
+func (s *Server) URL() *url.URL {
+	return &url.URL{Scheme: "http", Host: s.listener.Addr().String(), Path: "/file" + s.cfg.Extension}
+}
+
+// Close stops accepting connections and severs active ones.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+// Wait blocks until the renderer is done with the file: no client is connected
+// and either the last response ran to the end of the file (the movie is over)
+// and endGrace has passed, or none has connected for the idle grace. Reaching
+// the end is judged by the most recent response alone, so a renderer probing
+// the tail before it plays does not end the cast early.
+func (s *Server) Wait(ctx context.Context) error {
+	tick := time.NewTicker(500 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+
+		s.mu.Lock()
+		idle := time.Since(s.lastActive)
+		finished := s.active == 0 &&
+			((s.reachedEnd && idle > endGrace) || idle > s.cfg.IdleGrace)
+		s.mu.Unlock()
+		if finished {
+			return nil
+		}
+	}
+}
+
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	metrics.Requests.Inc("file")
+	slog.InfoContext(ctx, "file "+r.Method,
+		"from", r.RemoteAddr,
+		"user_agent", r.UserAgent(),
+		"range", r.Header.Get("Range"),
+		"time_seek", r.Header.Get(TimeSeekHeader),
+	)
+
+	s.mu.Lock()
+	s.active++
+	s.mu.Unlock()
+	metrics.Clients.Add("file", 1)
+	var sent int64
+	var end bool
+	defer func() {
+		metrics.Clients.Add("file", -1)
+		s.mu.Lock()
+		s.active--
+		s.reachedEnd = end
+		s.lastActive = time.Now()
+		s.mu.Unlock()
+		slog.InfoContext(ctx, "file response ended", "from", r.RemoteAddr, "bytes_sent", sent, "reached_end", end)
+	}()
+
+	sent, end = ServeFile(w, r, s.cfg.File)
+}
+
+// ServeFile answers one request for f: its headers, then the byte range asked
+// for (a DLNA time-seek rewritten into one), through http.ServeContent. It is
+// the request half of Server, for a caller that routes many files through its
+// own mux (the media server). It reports the body bytes sent and whether they
+// ran to the end of the file.
+func ServeFile(w http.ResponseWriter, r *http.Request, f File) (sent int64, reachedEnd bool) {
+	w.Header().Set("Content-Type", f.ContentType)
+	for k, v := range f.Headers {
+		w.Header().Set(k, v)
+	}
+
+	file, err := os.Open(f.Path)
+	if err != nil {
+		http.Error(w, "file unavailable", http.StatusServiceUnavailable)
+		return 0, false
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		http.Error(w, "file unavailable", http.StatusServiceUnavailable)
+		return 0, false
+	}
+	size := fi.Size()
+
+	if npt := r.Header.Get(TimeSeekHeader); npt != "" {
+		if status, err := timeSeek(w, r, f, file, size, npt); err != nil {
+			slog.InfoContext(r.Context(), "time-seek refused", "from", r.RemoteAddr, "time_seek", npt, "error", err)
+			http.Error(w, err.Error(), status)
+			return 0, false
+		}
+	}
+
+	cw := &countingWriter{ResponseWriter: w}
+	http.ServeContent(cw, r, "", fi.ModTime(), file)
+	start := rangeStart(r.Header.Get("Range"), size)
+	return cw.written, r.Method != http.MethodHead && cw.written > 0 && start+cw.written >= size
+}
+
+// timeSeek answers a DLNA time-seek by rewriting it into the byte range
+// ServeContent serves, and confirms the range on the response. It returns the
+// status to refuse with when it cannot: 406 for a file it cannot seek by time
+// (DLNA's answer for an unsupported operation), 400 for an unparseable range.
+func timeSeek(w http.ResponseWriter, r *http.Request, f File, file io.ReaderAt, size int64, npt string) (int, error) {
+	if f.Duration <= 0 || f.PacketSize <= 0 {
+		return http.StatusNotAcceptable, fmt.Errorf("time-seek is not supported on this file")
+	}
+	start, end, err := ParseNPTRange(npt)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if start >= f.Duration {
+		return http.StatusRequestedRangeNotSatisfiable, fmt.Errorf("seek past the end at %s", f.Duration)
+	}
+	if end <= 0 || end > f.Duration {
+		end = f.Duration
+	}
+
+	first := offset(f, file, size, start)
+	last := size - 1
+	if end < f.Duration {
+		last = max(offset(f, file, size, end)-1, first)
+	}
+	r.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+	w.Header().Set(TimeSeekHeader, fmt.Sprintf("npt=%s-%s/%s bytes=%d-%d/%d",
+		FormatNPT(start), FormatNPT(end), FormatNPT(f.Duration), first, last, size))
+	return 0, nil
+}
+
+// offset maps a time in f onto the byte offset of the packet it falls in: by
+// the stream's own clock (SeekPCR) for MPEG-TS, else in proportion to the
+// file's length. A proportion is exact only for a constant bitrate, but a
+// renderer resyncs on the next keyframe wherever it lands.
+func offset(f File, file io.ReaderAt, size int64, t time.Duration) int64 {
+	if f.PacketSize == TSPacketSize {
+		if off, ok := SeekPCR(file, 0, size, t); ok {
+			return off
+		}
+	}
+	off := int64(float64(size) * (float64(t) / float64(f.Duration)))
+	return off - off%f.PacketSize
+}
+
+// ParseNPTRange parses a TimeSeekRange.dlna.org value, "npt=start-[end]". A
+// missing end is returned as 0.
+func ParseNPTRange(v string) (start, end time.Duration, err error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(v), "npt=")
+	if !ok {
+		return 0, 0, fmt.Errorf("time-seek range %q is not npt", v)
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("time-seek range %q has no '-'", v)
+	}
+	if start, err = parseNPT(from); err != nil {
+		return 0, 0, err
+	}
+	if to = strings.TrimSpace(to); to != "" {
+		if end, err = parseNPT(to); err != nil {
+			return 0, 0, err
+		}
+		if end <= start {
+			return 0, 0, fmt.Errorf("time-seek range %q ends before it starts", v)
+		}
+	}
+	return start, end, nil
+}
+
+// parseNPT parses one npt time: seconds ("90.5") or H+:MM:SS[.fff]
+// ("0:01:30.500").
+func parseNPT(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	parts := strings.Split(v, ":")
+	if len(parts) != 1 && len(parts) != 3 {
+		return 0, fmt.Errorf("invalid npt time %q", v)
+	}
+	var secs float64
+	for _, p := range parts {
+		n, err := strconv.ParseFloat(p, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid npt time %q", v)
+		}
+		secs = secs*60 + n
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// FormatNPT renders d as npt seconds with millisecond precision.
+func FormatNPT(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// rangeStart is where a Range header's first range starts in a file of size
+// bytes, 0 when there is none. A malformed range ServeContent will refuse is
+// also 0: nothing is written for it, so where it would have started is moot.
+func rangeStart(h string, size int64) int64 {
+	spec, ok := strings.CutPrefix(h, "bytes=")
+	if !ok {
+		return 0
+	}
+	first, _, _ := strings.Cut(spec, ",")
+	from, to, _ := strings.Cut(strings.TrimSpace(first), "-")
+	if from == "" {
+		// A suffix range: the last n bytes.
+		n, err := strconv.ParseInt(to, 10, 64)
+		if err != nil {
+			return 0
+		}
+		return max(size-n, 0)
+	}
+	n, err := strconv.ParseInt(from, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// countingWriter counts the body bytes a response wrote, which is how a
+// response is known to have reached the end of the file.
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,161 @@
+package fileserve
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestServer serves a 10-packet "TS" file of 188-byte packets, each filled
+// with its own index, claimed to run 100 seconds.
+func newTestServer(t *testing.T, cfg Config) (*Server, []byte) {
+	t.Helper()
+	var data []byte
+	for i := range 10 {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, 188)...)
+	}
+	cfg.Path = filepath.Join(t.TempDir(), "movie.ts")
+	if err := os.WriteFile(cfg.Path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LocalIP = "127.0.0.1"
+	cfg.ContentType = "video/mp2t"
+	cfg.Extension = ".ts"
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	return srv, data
+}
+
+func get(t *testing.T, srv *Server, header, value string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, srv.URL().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestServeRange(t *testing.T) {
+	srv, data := newTestServer(t, Config{File: File{Headers: map[string]string{"transferMode.dlna.org": "Streaming"}}})
+
+	resp, body := get(t, srv, "", "")
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("full GET = %d with %d bytes, want 200 with the whole file", resp.StatusCode, len(body))
+	}
+	if got := resp.Header.Get("transferMode.dlna.org"); got != "Streaming" {
+		t.Errorf("device header = %q, want it passed through", got)
+	}
+
+	resp, body = get(t, srv, "Range", "bytes=376-")
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, data[376:]) {
+		t.Errorf("ranged GET = %d with %d bytes, want 206 with the tail from 376", resp.StatusCode, len(body))
+	}
+}
+
+func TestServeTimeSeek(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		npt       string
+		status    int
+		first     int
+		last      int
+		confirmed string
+	}{
+		{
+			// 25s of 100s is byte 470, aligned down to packet 2.
+			name: "open end", cfg: Config{File: File{Duration: 100 * time.Second, PacketSize: 188}},
+			npt: "npt=25-", status: http.StatusPartialContent, first: 376, last: 1879,
+			confirmed: "npt=25.000-100.000/100.000 bytes=376-1879/1880",
+		},
+		{
+			name: "clock time with an end", cfg: Config{File: File{Duration: 100 * time.Second, PacketSize: 188}},
+			npt: "npt=0:00:10.000-0:00:30", status: http.StatusPartialContent, first: 188, last: 563,
+			confirmed: "npt=10.000-30.000/100.000 bytes=188-563/1880",
+		},
+		{
+			name: "unknown duration", cfg: Config{File: File{PacketSize: 188}},
+			npt: "npt=25-", status: http.StatusNotAcceptable,
+		},
+		{
+			name: "no packets to align to", cfg: Config{File: File{Duration: 100 * time.Second}},
+			npt: "npt=25-", status: http.StatusNotAcceptable,
+		},
+		{
+			name: "past the end", cfg: Config{File: File{Duration: 100 * time.Second, PacketSize: 188}},
+			npt: "npt=100-", status: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name: "malformed", cfg: Config{File: File{Duration: 100 * time.Second, PacketSize: 188}},
+			npt: "bytes=0-", status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, data := newTestServer(t, tt.cfg)
+			resp, body := get(t, srv, TimeSeekHeader, tt.npt)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusPartialContent {
+				return
+			}
+			if !bytes.Equal(body, data[tt.first:tt.last+1]) {
+				t.Errorf("body = %d bytes, want bytes %d-%d", len(body), tt.first, tt.last)
+			}
+			if got := resp.Header.Get(TimeSeekHeader); got != tt.confirmed {
+				t.Errorf("%s = %q, want %q", TimeSeekHeader, got, tt.confirmed)
+			}
+		})
+	}
+}
+
+func TestWaitEndsAfterPlayback(t *testing.T) {
+	srv, _ := newTestServer(t, Config{IdleGrace: time.Hour})
+
+	// A tail probe alone reaches the end, but a later partial read means the
+	// renderer is still playing: only the most recent response counts.
+	get(t, srv, "Range", "bytes=1500-")
+	get(t, srv, "Range", "bytes=0-99")
+	srv.mu.Lock()
+	reached := srv.reachedEnd
+	srv.mu.Unlock()
+	if reached {
+		t.Fatal("a partial read after a tail probe must not count as the end")
+	}
+
+	get(t, srv, "Range", "bytes=1000-")
+	srv.mu.Lock()
+	reached = srv.reachedEnd
+	srv.lastActive = time.Now().Add(-endGrace - time.Second)
+	srv.mu.Unlock()
+	if !reached {
+		t.Fatal("a read to the last byte should count as the end")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	if err := srv.Wait(ctx); err != nil {
+		t.Fatalf("Wait() = %v, want it to end once playback reached the end", err)
+	}
+}
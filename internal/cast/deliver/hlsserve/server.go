@@ -1,7 +1,10 @@
-// Package hlsserve serves a live HLS directory (playlist + rolling fMP4 segments)
-// over local HTTP. There is no byte pacing: an HLS client self-paces, and ffmpeg
-// bounds the on-disk window. URL/Wait/Close match the replay server's shape so
-// the cast path composes over either.
+// Package hlsserve serves a live HLS directory (playlist + rolling fMP4
+// segments) over local HTTP. For a rendition ladder the directory holds a
+// master playlist and a subdirectory per variant, each with its own playlist
+// and segments; the whole tree is served, so the variant URIs the master names
+// resolve. There is no byte pacing: an HLS client self-paces, and ffmpeg bounds
+// the on-disk window. URL/Wait/Close match the replay server's shape so the
+// cast path composes over either.
 package hlsserve
 
 import (
@@ -14,6 +17,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/stupside/castor/internal/metrics"
 )
 
 // defaultIdleGrace is how long to keep serving after the producer finished and
@@ -24,7 +29,9 @@ const defaultIdleGrace = 30 * time.Second
 type Config struct {
 	LocalIP string // address to bind the HTTP listener
 	Dir     string // directory ffmpeg writes the playlist and segments into
-	// Playlist is the media playlist filename within Dir (media.HLSPlaylistName).
+	// Playlist is the playlist filename within Dir the device is handed: the
+	// media playlist (media.HLSPlaylistName), or the master over a ladder's
+	// variants (media.HLSMasterName).
 	Playlist string
 	// IdleGrace overrides how long Wait keeps serving after the producer is done
 	// and the client goes quiet. Zero uses defaultIdleGrace; tests set it small.
@@ -59,6 +66,9 @@ func New(cfg Config) (*Server, error) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		s.touch()
+		metrics.Requests.Inc("hls")
+		metrics.Clients.Add("hls", 1)
+		defer metrics.Clients.Add("hls", -1)
 		slog.InfoContext(r.Context(), "hls request", "from", r.RemoteAddr, "path", r.URL.Path)
 		// Go doesn't register .m3u8/.m4s, so set the type before ServeContent sniffs.
 		if ct := contentTypeFor(r.URL.Path); ct != "" {
@@ -72,7 +82,7 @@ func New(cfg Config) (*Server, error) {
 	return s, nil
 }
 
-// URL is the media-playlist address the device should play.
+// URL is the playlist address the device should play.
 func (s *Server) URL() *url.URL {
 	return &url.URL{Scheme: "http", Host: s.listener.Addr().String(), Path: "/" + s.cfg.Playlist}
 }
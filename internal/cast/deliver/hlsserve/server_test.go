@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
@@ -54,6 +55,42 @@ func TestServeServesDirWithContentType(t *testing.T) {
 	}
 }
 
+func TestServeServesLadderVariants(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range map[string]string{
+		"master.m3u8":      "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nv1/stream.m3u8\n",
+		"v1/stream.m3u8":   "#EXTM3U\n#EXT-X-MAP:URI=\"init_1.mp4\"\n",
+		"v1/seg_00001.m4s": "segment",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv, err := New(Config{LocalIP: "127.0.0.1", Dir: dir, Playlist: "master.m3u8"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer srv.Close()
+
+	// The device resolves the variant URIs against the master's URL, so each
+	// variant's playlist and segments are served from its subdirectory.
+	for _, p := range []string{"v1/stream.m3u8", "v1/seg_00001.m4s"} {
+		u := srv.URL().ResolveReference(&url.URL{Path: p})
+		resp, err := http.Get(u.String())
+		if err != nil {
+			t.Fatalf("GET %s: %v", p, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentTypeFor(p) {
+			t.Errorf("GET %s = %d %q, want 200 %q", p, resp.StatusCode, resp.Header.Get("Content-Type"), contentTypeFor(p))
+		}
+	}
+}
+
 func TestServeMissingFileIs404(t *testing.T) {
 	srv, err := New(Config{LocalIP: "127.0.0.1", Dir: t.TempDir(), Playlist: "stream.m3u8"})
 	if err != nil {
@@ -0,0 +1,87 @@
+package replay
+
+import (
+	"os"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
+)
+
+// meter measures one response's delivery for Config.OnDelivery, a window at a
+// time. A window counts only if the client read steadily from a spool ahead of
+// it: no read from the spool waited on the producer for longer than
+// producerWait, and no write to the client blocked for longer than pauseGap.
+// Its stream time is read off the spool's PCRs at the window's two ends.
+type meter struct {
+	s     *Server
+	spool *os.File // nil when nothing is measured
+
+	window    time.Duration
+	start     time.Time
+	startOff  int64
+	startTime time.Duration
+	steady    bool
+}
+
+// newMeter starts measuring a response serving the stream from off. It
+// measures nothing when no one asked for deliveries or the stream has no TS
+// clock to measure stream time by.
+func (s *Server) newMeter(off int64) *meter {
+	m := &meter{s: s, window: meterWindow}
+	if s.cfg.OnDelivery == nil || s.cfg.PacketSize != fileserve.TSPacketSize {
+		return m
+	}
+	f, err := os.Open(s.spool.Path())
+	if err != nil {
+		return m
+	}
+	m.spool = f
+	m.restart(off)
+	return m
+}
+
+// restart opens a window at off.
+func (m *meter) restart(off int64) {
+	m.start, m.startOff, m.steady = time.Now(), off, true
+	var ok bool
+	if m.startTime, ok = fileserve.PCRAt(m.spool, off, m.s.spool.Size()); !ok {
+		m.steady = false
+	}
+}
+
+// waited records a read from the spool that took d.
+func (m *meter) waited(d time.Duration) {
+	if d > producerWait {
+		m.steady = false
+	}
+}
+
+// wrote records a write to the client that took d, leaving it at off, and
+// reports the window once it has run its length.
+func (m *meter) wrote(off int64, d time.Duration) {
+	if m.spool == nil {
+		return
+	}
+	if d > pauseGap {
+		m.steady = false
+	}
+	elapsed := time.Since(m.start)
+	if elapsed < m.window {
+		return
+	}
+	if m.steady {
+		if at, ok := fileserve.PCRAt(m.spool, off, m.s.spool.Size()); ok {
+			m.s.cfg.OnDelivery(Delivery{
+				Rate: (off - m.startOff) * 8 * int64(time.Second) / int64(elapsed),
+				Pace: float64(at-m.startTime) / float64(elapsed),
+			})
+		}
+	}
+	m.restart(off)
+}
+
+func (m *meter) close() {
+	if m.spool != nil {
+		_ = m.spool.Close()
+	}
+}
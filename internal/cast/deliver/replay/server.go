@@ -15,19 +15,43 @@
 // playback rate. The producer runs ahead into the spool as fast as it
 // encodes, so a late or reconnecting client can always be served from the
 // start.
+//
+// A producer that can change what it produces mid-stream (an encode stepped
+// down to a lower bitrate) is held to a bounded lead over the clients instead
+// (Config.Lead), so a change reaches the renderer within the lead rather than
+// after everything already spooled; each client's delivery is measured for it
+// to decide by (Config.OnDelivery).
+//
+// A stream with a known duration (a VOD, not a live feed) can also be seeked
+// in. While it is still being produced a DLNA time-seek is answered from the
+// spool, located by the MPEG-TS clock (PCR), once the producer has reached
+// the time asked for; byte ranges cannot be, as the length they are measured
+// against is not known yet. Once the spool is complete it is a finished file
+// and is served as one, byte ranges and all, by fileserve.
+//
+// An MPEG-TS stream can be spooled under a quota (Config.Quota), for a live
+// feed or a long film on a small disk: past it the spool evicts what every
+// client has read, and a client that asks for what is gone, from byte 0 or by
+// time, is served from the oldest keyframe still spooled. Such a spool is no
+// longer the whole stream, so it is never served as a file.
 package replay
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"sync"
 	"time"
 
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
 	"github.com/stupside/castor/internal/cast/deliver/spool"
+	"github.com/stupside/castor/internal/metrics"
 )
 
 const (
@@ -38,6 +62,40 @@ const (
 	// fully produced and the last client dropped mid-stream — long enough
 	// for a renderer hiccup/reconnect, short enough not to hang the CLI.
 	idleGrace = 30 * time.Second
+
+	// seekIdleGrace replaces idleGrace for a seekable stream: a renderer that
+	// can seek commonly drops its connection while paused and reopens with a
+	// seek on resume.
+	seekIdleGrace = 5 * time.Minute
+
+	// seekEndGrace is how long Wait keeps a seekable stream served after a
+	// response reached its end, for a renderer that rereads the tail or seeks
+	// back. An unseekable stream reaching EOF is the movie over.
+	seekEndGrace = 10 * time.Second
+
+	// seekPoll is how often a time-seek ahead of the producer rechecks the
+	// spool for the time asked for.
+	seekPoll = 200 * time.Millisecond
+
+	// noClockLimit is how much of a growing spool a time-seek reads for a PCR
+	// before giving the stream up as one without a clock to seek by.
+	noClockLimit = 4 << 20
+
+	// meterWindow is how long a client's delivery is measured over before it
+	// is reported (Config.OnDelivery): long enough to smooth a VBV-capped
+	// encode's bitrate swings, short enough to step down before a renderer's
+	// buffer runs dry.
+	meterWindow = 10 * time.Second
+
+	// pauseGap is the longest a single write to a client may block in a window
+	// that is measured. A renderer that stops reading for longer has paused, or
+	// its buffer is full: either way its delivery says nothing of its link.
+	pauseGap = 3 * time.Second
+
+	// producerWait is the longest a read from the spool may block in a window
+	// that is measured. A client that catches up with the producer is held to
+	// the producer's pace, not its link's.
+	producerWait = 100 * time.Millisecond
 )
 
 // Config is what the planner fills in.
@@ -50,6 +108,40 @@ type Config struct {
 	// SpoolPath is where the producer's output is spooled. The caller owns
 	// the file's directory lifecycle.
 	SpoolPath string
+
+	// Quota bounds the spool on disk (see spool.Quota). It applies only when
+	// PacketSize is MPEG-TS's: a client is served what is left from a
+	// keyframe, which no other container can be joined at.
+	Quota spool.Quota
+
+	// Duration is the stream's length in time, 0 for a live one. A stream with
+	// one is a VOD a renderer may seek in: DLNA time-seek is answered when
+	// PacketSize is also MPEG-TS's (the PCR is what it is located by), and the
+	// finished spool is served with byte ranges.
+	Duration   time.Duration
+	PacketSize int64
+
+	// Lead, when set, holds the producer to at most this many bytes spooled past
+	// the furthest a client has read, so what it produces next is what the
+	// renderer plays next. The hold is lifted while a time-seek waits for the
+	// producer, and a cast no client comes back to ends after the grace, as
+	// one produced in full would.
+	Lead int64
+
+	// OnDelivery, when set on an MPEG-TS stream, is called with each client's
+	// delivery over every meterWindow in which it read steadily from a spool
+	// that was ahead of it: a measure of the renderer's link, not of the
+	// producer or of a paused renderer.
+	OnDelivery func(Delivery)
+}
+
+// Delivery is one client's delivery over a meterWindow.
+type Delivery struct {
+	// Rate is the bits per second the client read.
+	Rate int64
+	// Pace is the stream time the client read per second of it: 1 keeps up
+	// with playback, under 1 is a renderer draining its buffer.
+	Pace float64
 }
 
 // Server spools a producer's output and replays it to every HTTP client from
@@ -62,18 +154,29 @@ type Server struct {
 	cancel   context.CancelFunc
 	spool    *spool.Spool
 
-	done chan struct{} // producer fully spooled
+	done   chan struct{} // producer fully spooled
+	failed bool          // the producer stopped early; set before done closes
+
+	idleGrace time.Duration
+	endGrace  time.Duration
 
 	mu             sync.Mutex
 	active         int
-	completed      bool // some client consumed the stream to EOF
+	completed      bool // the most recent response delivered the stream's last byte
 	lastDisconnect time.Time
+	reach          int64 // the furthest offset a response has read to
+	seeking        int   // time-seeks waiting for the producer
+	held           bool  // the producer is held on Config.Lead
 }
 
 // New binds to cfg.LocalIP on an ephemeral port and starts spooling producer
 // in the background.
 func New(cfg Config, producer io.Reader) (*Server, error) {
-	sp, err := spool.New(cfg.SpoolPath)
+	var opts []spool.Option
+	if cfg.PacketSize == fileserve.TSPacketSize {
+		opts = append(opts, spool.WithQuota(cfg.Quota))
+	}
+	sp, err := spool.New(cfg.SpoolPath, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -91,12 +194,17 @@ func New(cfg Config, producer io.Reader) (*Server, error) {
 		cancel:         cancel,
 		spool:          sp,
 		done:           make(chan struct{}),
+		idleGrace:      idleGrace,
 		lastDisconnect: time.Now(),
 	}
+	if cfg.Duration > 0 {
+		s.idleGrace, s.endGrace = seekIdleGrace, seekEndGrace
+	}
 
 	go func() {
 		defer close(s.done)
-		_, copyErr := io.Copy(sp, producer)
+		copyErr := s.produce(ctx, producer)
+		s.failed = copyErr != nil
 		sp.CloseWrite(copyErr)
 		slog.Debug("stream fully spooled", "bytes", sp.Size(), "error", copyErr)
 	}()
@@ -122,11 +230,63 @@ func (s *Server) Close() error {
 	return s.server.Close()
 }
 
-// Wait blocks until the stream has been fully produced AND delivered: a
-// client has read it to EOF (movie over), or no client is left and none
-// returned within the grace window, or ctx is cancelled. The producer
+// produce spools the producer's output until it ends, holding it to
+// Config.Lead when one is set.
+func (s *Server) produce(ctx context.Context, producer io.Reader) error {
+	buf := make([]byte, sendChunkSize)
+	for {
+		if err := s.holdLead(ctx); err != nil {
+			return err
+		}
+		n, err := producer.Read(buf)
+		if n > 0 {
+			if _, werr := s.spool.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// holdLead blocks while the spool is Config.Lead past the furthest a client
+// has read and no time-seek is waiting for more.
+func (s *Server) holdLead(ctx context.Context) error {
+	if s.cfg.Lead <= 0 {
+		return nil
+	}
+	tick := time.NewTicker(seekPoll)
+	defer tick.Stop()
+	for {
+		s.mu.Lock()
+		s.held = s.seeking == 0 && s.spool.Size()-s.reach >= s.cfg.Lead
+		held := s.held
+		s.mu.Unlock()
+		if !held {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+// Wait blocks until the stream has been fully produced AND delivered: the
+// most recent response read it to EOF (movie over; for a seekable stream,
+// and no client came back within seekEndGrace), or no client is left and
+// none returned within the grace window, or ctx is cancelled. The producer
 // finishing is explicitly NOT enough — it runs faster than playback, so the
-// renderer is still mid-movie when the spool completes.
+// renderer is still mid-movie when the spool completes. Reaching the end is
+// judged by the most recent response alone, so a renderer probing the tail of
+// a seekable stream before it plays does not end the cast early. A producer
+// held on its lead (Config.Lead) is waiting on the clients, so the grace
+// applies to it as to a finished one.
 func (s *Server) Wait(ctx context.Context) error {
 	tick := time.NewTicker(500 * time.Millisecond)
 	defer tick.Stop()
@@ -137,15 +297,21 @@ func (s *Server) Wait(ctx context.Context) error {
 		case <-tick.C:
 		}
 
+		s.mu.Lock()
+		held := s.held
+		s.mu.Unlock()
 		select {
 		case <-s.done:
 		default:
-			continue // still producing
+			if !held {
+				continue // still producing
+			}
 		}
 
 		s.mu.Lock()
+		idle := time.Since(s.lastDisconnect)
 		finished := s.active == 0 &&
-			(s.completed || time.Since(s.lastDisconnect) > idleGrace)
+			((s.completed && idle >= s.endGrace) || idle > s.idleGrace)
 		s.mu.Unlock()
 		if finished {
 			return nil
@@ -153,48 +319,61 @@ func (s *Server) Wait(ctx context.Context) error {
 	}
 }
 
-// handleStream replays the spool from byte 0 to one client. srvCtx ends the
-// stream on server shutdown; the request context ends it on client disconnect.
+// handleStream serves one client: the finished spool as a file once the
+// producer is done, else the spool replayed from byte 0, or from a time-seek's
+// offset. srvCtx ends the stream on server shutdown; the request context ends
+// it on client disconnect.
 func (s *Server) handleStream(srvCtx context.Context, w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 	stop := context.AfterFunc(srvCtx, cancel)
 	defer stop()
 
+	metrics.Requests.Inc("replay")
+	slog.InfoContext(ctx, "stream "+r.Method,
+		"from", r.RemoteAddr,
+		"user_agent", r.UserAgent(),
+		"range", r.Header.Get("Range"),
+		"time_seek", r.Header.Get(fileserve.TimeSeekHeader),
+	)
+
+	if s.spooled() {
+		s.serveSpooled(ctx, w, r)
+		return
+	}
+
 	w.Header().Set("Content-Type", s.cfg.ContentType)
 	for k, v := range s.cfg.Headers {
 		w.Header().Set(k, v)
 	}
 	if r.Method == http.MethodHead {
-		slog.InfoContext(ctx, "stream HEAD", "from", r.RemoteAddr, "user_agent", r.UserAgent())
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	slog.InfoContext(ctx, "stream GET",
-		"from", r.RemoteAddr,
-		"user_agent", r.UserAgent(),
-		"range", r.Header.Get("Range"),
-	)
+	// A byte range is not answered while the stream grows: a 206 has to state
+	// where its range ends, and that is not known yet. Ignoring it is allowed,
+	// so the client gets the stream from byte 0.
+	var from int64
+	if npt := r.Header.Get(fileserve.TimeSeekHeader); npt != "" {
+		off, status, err := s.seekGrowing(ctx, w, npt)
+		if err != nil {
+			slog.InfoContext(ctx, "time-seek refused", "from", r.RemoteAddr, "time_seek", npt, "error", err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+		from = off
+	}
 
-	tail, err := s.spool.Tail(ctx)
+	tail, from, err := s.tail(ctx, from)
 	if err != nil {
 		http.Error(w, "stream unavailable", http.StatusServiceUnavailable)
 		return
 	}
 	defer tail.Close()
 
-	s.mu.Lock()
-	s.active++
-	s.mu.Unlock()
 	reachedEOF := false
-	defer func() {
-		s.mu.Lock()
-		s.active--
-		s.completed = s.completed || reachedEOF
-		s.lastDisconnect = time.Now()
-		s.mu.Unlock()
-	}()
+	defer s.track()(&reachedEOF)
 
 	w.WriteHeader(http.StatusOK)
 	flusher, _ := w.(http.Flusher)
@@ -202,19 +381,26 @@ func (s *Server) handleStream(srvCtx context.Context, w http.ResponseWriter, r *
 		flusher.Flush()
 	}
 
+	m := s.newMeter(from)
+	defer m.close()
 	buf := make([]byte, sendChunkSize)
 	var sent int64
 	for {
+		began := time.Now()
 		n, readErr := tail.Read(buf)
+		m.waited(time.Since(began))
 		if n > 0 {
+			s.advance(from + sent + int64(n))
+			began = time.Now()
 			if _, err := w.Write(buf[:n]); err != nil {
 				slog.InfoContext(ctx, "stream client disconnected", "from", r.RemoteAddr, "bytes_sent", sent, "error", err)
 				return
 			}
-			sent += int64(n)
 			if flusher != nil {
 				flusher.Flush()
 			}
+			sent += int64(n)
+			m.wrote(from+sent, time.Since(began))
 		}
 		if readErr != nil {
 			if readErr == io.EOF {
@@ -227,3 +413,158 @@ func (s *Server) handleStream(srvCtx context.Context, w http.ResponseWriter, r *
 		}
 	}
 }
+
+// tail opens a response's tail at off or, when the spool has evicted it, at
+// the oldest keyframe it still holds, returning where it opened.
+func (s *Server) tail(ctx context.Context, off int64) (io.ReadCloser, int64, error) {
+	for {
+		if start := s.spool.Start(); off < start {
+			off = s.oldestKeyframe(start)
+		}
+		tail, err := s.spool.TailAt(ctx, off)
+		// Evicted between the two: look again from the new start.
+		if !errors.Is(err, spool.ErrEvicted) {
+			return tail, off, err
+		}
+	}
+}
+
+// oldestKeyframe is the first keyframe in the spool from start, where a
+// client can join what is left of the stream, or the packet start finds
+// itself in when there is none to be found.
+func (s *Server) oldestKeyframe(start int64) int64 {
+	fallback := (start + fileserve.TSPacketSize - 1) / fileserve.TSPacketSize * fileserve.TSPacketSize
+	f, err := os.Open(s.spool.Path())
+	if err != nil {
+		return fallback
+	}
+	defer f.Close()
+	if off, ok := fileserve.NextKeyframe(f, start, s.spool.Size()); ok {
+		return off
+	}
+	return fallback
+}
+
+// spooled reports whether the producer has finished cleanly, leaving the
+// whole stream on disk. A producer that failed left a truncated spool, which
+// keeps being replayed (and reports the failure at its end) rather than being
+// passed off as a finished file; so does one past its quota, whose start is
+// gone.
+func (s *Server) spooled() bool {
+	select {
+	case <-s.done:
+		return !s.failed && s.spool.Start() == 0
+	default:
+		return false
+	}
+}
+
+// serveSpooled serves the finished spool as the file it now is: byte ranges,
+// and a time-seek rewritten into one, through fileserve.
+func (s *Server) serveSpooled(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var end bool
+	defer s.track()(&end)
+	var sent int64
+	sent, end = fileserve.ServeFile(w, r, fileserve.File{
+		Path:        s.spool.Path(),
+		ContentType: s.cfg.ContentType,
+		Headers:     s.cfg.Headers,
+		Duration:    s.cfg.Duration,
+		PacketSize:  s.cfg.PacketSize,
+	})
+	slog.InfoContext(ctx, "stream response ended", "from", r.RemoteAddr, "bytes_sent", sent, "reached_end", end)
+}
+
+// track counts a client in, returning the func that counts it out once its
+// response is over, recording whether it reached the end of the stream.
+func (s *Server) track() func(reachedEnd *bool) {
+	s.mu.Lock()
+	s.active++
+	s.mu.Unlock()
+	metrics.Clients.Add("replay", 1)
+	return func(reachedEnd *bool) {
+		metrics.Clients.Add("replay", -1)
+		s.mu.Lock()
+		s.active--
+		s.completed = *reachedEnd
+		s.lastDisconnect = time.Now()
+		s.mu.Unlock()
+	}
+}
+
+// advance records that a response has read the stream to off.
+func (s *Server) advance(off int64) {
+	s.mu.Lock()
+	s.reach = max(s.reach, off)
+	s.mu.Unlock()
+}
+
+// seekGrowing answers a DLNA time-seek while the stream is still being
+// produced: it locates the time in the spool by PCR, waiting for the producer
+// to reach it, and confirms the seek on the response. The stream is served
+// from there to its end, whatever end was asked for, as the byte range that
+// would confirm an earlier one cannot be stated yet. It returns the status to
+// refuse with when it cannot seek: 406 for a stream that is not seekable by
+// time, 400 for an unparseable range, 416 for a time past the end.
+func (s *Server) seekGrowing(ctx context.Context, w http.ResponseWriter, npt string) (int64, int, error) {
+	if s.cfg.Duration <= 0 || s.cfg.PacketSize != fileserve.TSPacketSize {
+		return 0, http.StatusNotAcceptable, fmt.Errorf("time-seek is not supported on this stream")
+	}
+	start, _, err := fileserve.ParseNPTRange(npt)
+	if err != nil {
+		return 0, http.StatusBadRequest, err
+	}
+	if start >= s.cfg.Duration {
+		return 0, http.StatusRequestedRangeNotSatisfiable, fmt.Errorf("seek past the end at %s", s.cfg.Duration)
+	}
+
+	f, err := os.Open(s.spool.Path())
+	if err != nil {
+		return 0, http.StatusServiceUnavailable, fmt.Errorf("opening spool: %w", err)
+	}
+	defer f.Close()
+
+	// The producer may be held on its lead short of the time asked for.
+	s.mu.Lock()
+	s.seeking++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.seeking--
+		s.mu.Unlock()
+	}()
+
+	tick := time.NewTicker(seekPoll)
+	defer tick.Stop()
+	for {
+		produced := false
+		select {
+		case <-s.done:
+			produced = true
+		default:
+		}
+		size := s.spool.Size()
+		off, ok := fileserve.SeekPCR(f, s.spool.Start(), size, start)
+		switch {
+		case ok && off < size-size%fileserve.TSPacketSize:
+			// A time the spool has evicted is served from what is left, and
+			// confirmed as such.
+			from := start
+			if at, found := fileserve.PCRAt(f, off, size); found {
+				from = max(from, at)
+			}
+			w.Header().Set(fileserve.TimeSeekHeader, fmt.Sprintf("npt=%s-%[2]s/%[2]s",
+				fileserve.FormatNPT(from), fileserve.FormatNPT(s.cfg.Duration)))
+			return off, 0, nil
+		case produced && ok:
+			return 0, http.StatusRequestedRangeNotSatisfiable, fmt.Errorf("seek past the end of the stream")
+		case !ok && (produced || size > noClockLimit):
+			return 0, http.StatusNotAcceptable, fmt.Errorf("stream carries no clock to seek by")
+		}
+		select {
+		case <-ctx.Done():
+			return 0, http.StatusServiceUnavailable, ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
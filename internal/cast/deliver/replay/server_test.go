@@ -0,0 +1,256 @@
+package replay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
+	"github.com/stupside/castor/internal/cast/deliver/spool"
+)
+
+// second is one second of a test TS stream: a packet carrying PCR base pcr,
+// then a plain packet.
+func second(pcr uint64) []byte {
+	p := make([]byte, 2*fileserve.TSPacketSize)
+	p[0], p[3], p[4], p[5] = 0x47, 0x30, 7, 0x10
+	p[6], p[7], p[8], p[9], p[10] = byte(pcr>>25), byte(pcr>>17), byte(pcr>>9), byte(pcr>>1), byte(pcr<<7)
+	p[fileserve.TSPacketSize], p[fileserve.TSPacketSize+3] = 0x47, 0x10
+	return p
+}
+
+func get(t *testing.T, srv *Server, header, value string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, srv.URL().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(header, value)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestSeekableStream(t *testing.T) {
+	pr, pw := io.Pipe()
+	srv, err := New(Config{
+		LocalIP:     "127.0.0.1",
+		ContentType: "video/mp2t",
+		Extension:   ".ts",
+		SpoolPath:   filepath.Join(t.TempDir(), "out.ts"),
+		Duration:    10 * time.Second,
+		PacketSize:  fileserve.TSPacketSize,
+	}, pr)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	var stream []byte
+	for i := range 10 {
+		stream = append(stream, second(uint64(i)*90_000)...)
+	}
+	// Produce the first half, then seek into it while the rest is still to come:
+	// the response runs from second 3 and follows the producer to the end.
+	half := len(stream) / 2
+	if _, err := pw.Write(stream[:half]); err != nil {
+		t.Fatal(err)
+	}
+	for srv.spool.Size() < int64(half) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = pw.Write(stream[half:])
+		_ = pw.Close()
+	}()
+	resp, body := get(t, srv, fileserve.TimeSeekHeader, "npt=3-")
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, stream[6*fileserve.TSPacketSize:]) {
+		t.Errorf("growing time-seek = %d with %d bytes, want 200 with the stream from second 3", resp.StatusCode, len(body))
+	}
+	if got, want := resp.Header.Get(fileserve.TimeSeekHeader), "npt=3.000-10.000/10.000"; got != want {
+		t.Errorf("growing %s = %q, want %q", fileserve.TimeSeekHeader, got, want)
+	}
+
+	// Fully spooled, it is a file: byte ranges, and time-seek confirmed in bytes.
+	<-srv.done
+	resp, body = get(t, srv, "Range", "bytes=376-")
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, stream[376:]) {
+		t.Errorf("ranged GET = %d with %d bytes, want 206 with the tail from 376", resp.StatusCode, len(body))
+	}
+	resp, body = get(t, srv, fileserve.TimeSeekHeader, "npt=8-")
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, stream[16*fileserve.TSPacketSize:]) {
+		t.Errorf("spooled time-seek = %d with %d bytes, want 206 with the stream from second 8", resp.StatusCode, len(body))
+	}
+	if got, want := resp.Header.Get(fileserve.TimeSeekHeader), "npt=8.000-10.000/10.000 bytes=3008-3759/3760"; got != want {
+		t.Errorf("spooled %s = %q, want %q", fileserve.TimeSeekHeader, got, want)
+	}
+}
+
+func TestLiveStreamIgnoresRange(t *testing.T) {
+	pr, pw := io.Pipe()
+	srv, err := New(Config{
+		LocalIP:     "127.0.0.1",
+		ContentType: "video/mp2t",
+		Extension:   ".ts",
+		SpoolPath:   filepath.Join(t.TempDir(), "out.ts"),
+	}, pr)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	stream := second(0)
+	go func() {
+		_, _ = pw.Write(stream)
+		time.Sleep(300 * time.Millisecond)
+		_ = pw.Close()
+	}()
+	resp, body := get(t, srv, "Range", "bytes=188-")
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, stream) {
+		t.Errorf("ranged GET while producing = %d with %d bytes, want 200 from byte 0", resp.StatusCode, len(body))
+	}
+	resp, _ = get(t, srv, fileserve.TimeSeekHeader, "npt=0-")
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("time-seek on a live stream = %d, want 406", resp.StatusCode)
+	}
+}
+
+func TestProducerHeldOnLead(t *testing.T) {
+	pr, pw := io.Pipe()
+	srv, err := New(Config{
+		LocalIP:     "127.0.0.1",
+		ContentType: "video/mp2t",
+		Extension:   ".ts",
+		SpoolPath:   filepath.Join(t.TempDir(), "out.ts"),
+		Lead:        4 * fileserve.TSPacketSize,
+	}, pr)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	var stream []byte
+	for i := range 10 {
+		stream = append(stream, second(uint64(i)*90_000)...)
+	}
+	go func() {
+		for p := range slices.Chunk(stream, fileserve.TSPacketSize) {
+			if _, err := pw.Write(p); err != nil {
+				return
+			}
+		}
+		_ = pw.Close()
+	}()
+
+	// With no client yet, the producer stops at the lead.
+	time.Sleep(5 * seekPoll)
+	if got := srv.spool.Size(); got != srv.cfg.Lead {
+		t.Fatalf("spooled %d bytes with no client, want the %d-byte lead", got, srv.cfg.Lead)
+	}
+	// A client reading on lets it through to the end.
+	resp, body := get(t, srv, "Accept", "*/*")
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, stream) {
+		t.Errorf("GET = %d with %d bytes, want 200 with the whole stream", resp.StatusCode, len(body))
+	}
+}
+
+func TestMeterReportsSteadyWindows(t *testing.T) {
+	var stream []byte
+	for i := range 10 {
+		stream = append(stream, second(uint64(i)*90_000)...)
+	}
+	sp, err := spool.New(filepath.Join(t.TempDir(), "out.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sp.Write(stream); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Delivery
+	srv := &Server{spool: sp, cfg: Config{
+		PacketSize: fileserve.TSPacketSize,
+		OnDelivery: func(d Delivery) { got = append(got, d) },
+	}}
+	m := srv.newMeter(0)
+	defer m.close()
+	m.window = 100 * time.Millisecond
+
+	// Four seconds of stream in a window: a pace far above playback.
+	time.Sleep(m.window)
+	m.wrote(8*fileserve.TSPacketSize, time.Millisecond)
+	// A read that waited on the producer leaves the next window unreported.
+	m.waited(time.Second)
+	time.Sleep(m.window)
+	m.wrote(12*fileserve.TSPacketSize, time.Millisecond)
+
+	if len(got) != 1 {
+		t.Fatalf("reported %d windows, want the one steady window", len(got))
+	}
+	if got[0].Pace < 4*float64(time.Second)/float64(2*m.window) || got[0].Rate <= 0 {
+		t.Errorf("delivery = %+v, want about 4s of stream and its bytes in the window", got[0])
+	}
+}
+
+func TestBoundedSpoolServesOldestKeyframe(t *testing.T) {
+	// Twenty seconds of a stream each opening on a keyframe, about 3.7MB,
+	// spooled under a 1MiB quota with no client to hold eviction back.
+	plain := make([]byte, fileserve.TSPacketSize)
+	plain[0], plain[3] = 0x47, 0x10
+	var stream []byte
+	for i := range 20 {
+		key := second(uint64(i) * 90_000)[:fileserve.TSPacketSize]
+		key[5] |= 0x40
+		stream = append(stream, key...)
+		stream = append(stream, bytes.Repeat(plain, 999)...)
+	}
+	pr, pw := io.Pipe()
+	srv, err := New(Config{
+		LocalIP:     "127.0.0.1",
+		ContentType: "video/mp2t",
+		Extension:   ".ts",
+		SpoolPath:   filepath.Join(t.TempDir(), "out.ts"),
+		Duration:    20 * time.Second,
+		PacketSize:  fileserve.TSPacketSize,
+		Quota:       spool.Quota{Size: 1 << 20},
+	}, pr)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	go func() {
+		_, _ = pw.Write(stream)
+		_ = pw.Close()
+	}()
+	<-srv.done
+
+	start := srv.spool.Start()
+	if start == 0 {
+		t.Fatal("nothing evicted past the quota")
+	}
+	// Not a file any more: the client gets what is left from its first keyframe.
+	resp, body := get(t, srv, "Range", "bytes=0-")
+	keyEvery := int64(1000 * fileserve.TSPacketSize)
+	from := (start + keyEvery - 1) / keyEvery * keyEvery
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, stream[from:]) {
+		t.Errorf("GET = %d with %d bytes, want 200 with the stream from the keyframe at %d", resp.StatusCode, len(body), from)
+	}
+	// A time evicted is served from the same keyframe, and confirmed as such.
+	resp, body = get(t, srv, fileserve.TimeSeekHeader, "npt=0-")
+	if want := fmt.Sprintf("npt=%s-20.000/20.000", fileserve.FormatNPT(time.Duration(from/keyEvery)*time.Second)); resp.Header.Get(fileserve.TimeSeekHeader) != want || !bytes.Equal(body, stream[from:]) {
+		t.Errorf("time-seek to 0 = %q with %d bytes, want %q with the stream from %d", resp.Header.Get(fileserve.TimeSeekHeader), len(body), want, from)
+	}
+}
@@ -0,0 +1,28 @@
+package spool
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// fPunchHole is fcntl(2)'s F_PUNCHHOLE.
+const fPunchHole = 99
+
+// fpunchhole is fcntl(2)'s struct fpunchhole.
+type fpunchhole struct {
+	flags    uint32
+	reserved uint32
+	offset   int64
+	length   int64
+}
+
+// punch frees n bytes of f at off, which then read as zeros. APFS supports
+// it; HFS+ does not, which leaves the spool unbounded.
+func punch(f *os.File, off, n int64) error {
+	arg := fpunchhole{offset: off, length: n}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), fPunchHole, uintptr(unsafe.Pointer(&arg))); errno != 0 {
+		return errno
+	}
+	return nil
+}
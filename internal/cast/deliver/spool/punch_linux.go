@@ -0,0 +1,17 @@
+package spool
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocate(2) modes: free the range, leaving the file's size as it is.
+const (
+	fallocKeepSize  = 0x01
+	fallocPunchHole = 0x02
+)
+
+// punch frees n bytes of f at off, which then read as zeros.
+func punch(f *os.File, off, n int64) error {
+	return syscall.Fallocate(int(f.Fd()), fallocKeepSize|fallocPunchHole, off, n)
+}
@@ -5,49 +5,223 @@
 // until more bytes arrive instead of reporting EOF. Once the producer
 // finishes, consumers drain the remainder and see EOF (or the producer's
 // terminal error).
+//
+// A spool given a Quota stays bounded on disk: past it, the spool turns into a
+// ring and evicts its oldest bytes, though never ones a tail has yet to read.
+// Eviction punches a hole in the backing file rather than rewriting it, so
+// offsets never move and a reader of Path still reads the stream at the
+// offsets a tail does; only what lies before Start is gone. The first headSize
+// bytes are never evicted: they hold what a reader measures the rest of the
+// stream against (an MPEG-TS clock's origin, a container's header).
 package spool
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	// headSize is how much of the start of a spool eviction always keeps.
+	headSize = 1 << 20
+
+	// evictStep is the least a spool evicts at once, so a ring past its quota
+	// frees a megabyte per hole punched instead of one per write.
+	evictStep = 1 << 20
+
+	// blockSize aligns what is evicted to filesystem blocks, the granularity
+	// a punched hole frees disk in.
+	blockSize = 4096
+
+	// markEvery is the granularity of a Quota.Age: how often the spool notes
+	// the time at which it reached its size.
+	markEvery = time.Second
 )
 
+// ErrEvicted is returned by TailAt for an offset the spool has evicted.
+var ErrEvicted = errors.New("spool offset already evicted")
+
+// Quota bounds what a spool keeps on disk. Past either limit the spool
+// evicts its oldest bytes once every tail has read them; a zero limit is no
+// limit, and the zero Quota keeps everything.
+type Quota struct {
+	// Size is the most bytes the spool keeps.
+	Size Bytes
+	// Age is how long the spool keeps a byte once written.
+	Age time.Duration
+}
+
+// Bytes is a size in bytes that reads from config as a count with an optional
+// binary unit: "512MiB", "4GiB", "4G" and "4294967296" are all sizes.
+type Bytes int64
+
+// byteUnits are the units Bytes reads, each a power of 1024.
+var byteUnits = []struct {
+	suffix string
+	shift  uint
+}{{"T", 40}, {"G", 30}, {"M", 20}, {"K", 10}}
+
+func (b *Bytes) UnmarshalText(text []byte) error {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(string(text))), "B")
+	s = strings.TrimSuffix(s, "I")
+	var shift uint
+	for _, u := range byteUnits {
+		if rest, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, shift = strings.TrimSpace(rest), u.shift
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q: want a byte count like 512MiB or 4GiB", text)
+	}
+	*b = Bytes(n * float64(int64(1)<<shift))
+	return nil
+}
+
+// bounded reports whether q limits anything.
+func (q Quota) bounded() bool { return q.Size > 0 || q.Age > 0 }
+
+// Option configures a Spool.
+type Option func(*Spool)
+
+// WithQuota bounds the spool by q.
+func WithQuota(q Quota) Option {
+	return func(s *Spool) { s.quota = q }
+}
+
 // Spool is the append-only buffer. Create one with New, feed it via Write,
 // and finish with CloseWrite.
 type Spool struct {
-	path string
-	w    *os.File
+	path  string
+	w     *os.File
+	quota Quota
 
 	mu     sync.Mutex
 	cond   *sync.Cond
 	size   int64
 	closed bool  // no more writes are coming
 	err    error // terminal write-side error, if any
+
+	start   int64                    // the first byte not evicted past the head
+	tails   map[*tailReader]struct{} // the open tails, whose offsets bound eviction
+	marks   []mark                   // when the spool reached which size, for Quota.Age
+	unpunch bool                     // eviction failed once and is off for good
+}
+
+// mark notes that the spool was size bytes long at t.
+type mark struct {
+	size int64
+	t    time.Time
 }
 
-func New(path string) (*Spool, error) {
+func New(path string, opts ...Option) (*Spool, error) {
 	f, err := os.Create(path)
 	if err != nil {
 		return nil, fmt.Errorf("creating spool file: %w", err)
 	}
-	s := &Spool{path: path, w: f}
+	return newSpool(path, f, 0, opts), nil
+}
+
+// Open reopens the spool a past producer left at path, to append to it: it
+// starts out holding every byte already there.
+func Open(path string, opts ...Option) (*Spool, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening spool file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("opening spool file: %w", err)
+	}
+	return newSpool(path, f, info.Size(), opts), nil
+}
+
+func newSpool(path string, f *os.File, size int64, opts []Option) *Spool {
+	s := &Spool{path: path, w: f, size: size, tails: make(map[*tailReader]struct{})}
 	s.cond = sync.NewCond(&s.mu)
-	return s, nil
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// Write appends to the spool and wakes any blocked tails.
+// Write appends to the spool and wakes any blocked tails. A bounded spool
+// then evicts whatever its quota no longer covers.
 func (s *Spool) Write(p []byte) (int, error) {
 	n, err := s.w.Write(p)
 	s.mu.Lock()
 	s.size += int64(n)
 	s.cond.Broadcast()
+	from, to := s.evictable()
 	s.mu.Unlock()
+	if to > from {
+		s.evict(from, to)
+	}
 	return n, err
 }
 
+// evictable returns the range past the head the quota no longer covers and
+// no tail has yet to read, once it is worth evicting, and moves start past
+// it: from then on a tail cannot be opened in it. Called with mu held.
+func (s *Spool) evictable() (from, to int64) {
+	if !s.quota.bounded() || s.unpunch {
+		return 0, 0
+	}
+	now := time.Now()
+	if s.quota.Age > 0 && (len(s.marks) == 0 || now.Sub(s.marks[len(s.marks)-1].t) >= markEvery) {
+		s.marks = append(s.marks, mark{size: s.size, t: now})
+	}
+
+	var limit int64
+	if s.quota.Size > 0 {
+		limit = s.size - int64(s.quota.Size)
+	}
+	if s.quota.Age > 0 {
+		// What the spool held at the last mark older than the age was all
+		// written before it; the marks before that one are done with.
+		cutoff := now.Add(-s.quota.Age)
+		i := 0
+		for i+1 < len(s.marks) && !s.marks[i+1].t.After(cutoff) {
+			i++
+		}
+		if !s.marks[i].t.After(cutoff) {
+			limit = max(limit, s.marks[i].size)
+		}
+		s.marks = s.marks[i:]
+	}
+	for t := range s.tails {
+		limit = min(limit, t.offset)
+	}
+
+	from = max(s.start, headSize)
+	to = limit - limit%blockSize
+	if to-from < evictStep {
+		return 0, 0
+	}
+	s.start = to
+	return from, to
+}
+
+// evict frees [from, to) on disk. A filesystem that cannot punch holes
+// leaves the spool unbounded, which is logged once.
+func (s *Spool) evict(from, to int64) {
+	if err := punch(s.w, from, to-from); err != nil {
+		slog.Warn("spool eviction unsupported here; keeping the whole spool", "path", s.path, "error", err)
+		s.mu.Lock()
+		s.unpunch = true
+		s.mu.Unlock()
+	}
+}
+
 // CloseWrite marks the write side finished. err records why the producer
 // stopped early (nil for a clean end); tails drain the remaining bytes and
 // then see EOF (or the error).
@@ -66,9 +240,19 @@ func (s *Spool) Size() int64 {
 	return s.size
 }
 
+// Start is the first offset a tail can still be opened at: 0 until the spool
+// first evicts, then the oldest byte it keeps past the head.
+func (s *Spool) Start() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.start
+}
+
 // Path returns the backing file path. A reader (e.g. ffprobe) may open it
 // concurrently with the producer: the spool is append-only, so a read sees a
-// consistent prefix of whatever has been written so far.
+// consistent prefix of whatever has been written so far. A bounded spool
+// reads as zeros where it has evicted, between the head and Start; such a
+// reader is not a tail, and eviction does not wait for it.
 func (s *Spool) Path() string { return s.path }
 
 // Tail returns a reader over the spool from byte 0 that blocks at
@@ -77,11 +261,28 @@ func (s *Spool) Path() string { return s.path }
 // os/exec waits for stdin-feeding goroutines, which would otherwise hang
 // on a parked Tail after the consumer process dies.
 func (s *Spool) Tail(ctx context.Context) (io.ReadCloser, error) {
+	return s.TailAt(ctx, 0)
+}
+
+// TailAt is Tail starting at offset rather than byte 0, for a reader resuming
+// partway through (a renderer seeking). An offset not yet written blocks the
+// first Read until it is; one before Start fails with ErrEvicted. Until the
+// tail is closed, the spool evicts nothing it has yet to read.
+func (s *Spool) TailAt(ctx context.Context, offset int64) (io.ReadCloser, error) {
 	f, err := os.Open(s.path)
 	if err != nil {
 		return nil, fmt.Errorf("opening spool for tail: %w", err)
 	}
-	t := &tailReader{spool: s, f: f, ctx: ctx}
+	t := &tailReader{spool: s, f: f, ctx: ctx, offset: offset}
+	s.mu.Lock()
+	if offset < s.start {
+		start := s.start
+		s.mu.Unlock()
+		_ = f.Close()
+		return nil, fmt.Errorf("tail at %d, before the spool's start at %d: %w", offset, start, ErrEvicted)
+	}
+	s.tails[t] = struct{}{}
+	s.mu.Unlock()
 	// Wake the cond loop when ctx dies so Read can observe cancellation.
 	context.AfterFunc(ctx, func() {
 		s.mu.Lock()
@@ -121,7 +322,9 @@ func (t *tailReader) Read(p []byte) (int, error) {
 	}
 
 	n, err := t.f.ReadAt(p, t.offset)
+	s.mu.Lock()
 	t.offset += int64(n)
+	s.mu.Unlock()
 	if err == io.EOF {
 		// More data may arrive; the next Read blocks on the cond again.
 		err = nil
@@ -133,5 +336,8 @@ func (t *tailReader) Read(p []byte) (int, error) {
 }
 
 func (t *tailReader) Close() error {
+	t.spool.mu.Lock()
+	delete(t.spool.tails, t)
+	t.spool.mu.Unlock()
 	return t.f.Close()
 }
@@ -0,0 +1,123 @@
+package spool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuotaEvictsWhatTailsRead(t *testing.T) {
+	sp, err := New(filepath.Join(t.TempDir(), "spool.ts"), WithQuota(Quota{Size: 1 << 20}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 4<<20)
+	for i := range data {
+		data[i] = byte(i%251) + 1
+	}
+	const chunk = 64 << 10
+	write := func(from, to int) {
+		t.Helper()
+		for off := from; off < to; off += chunk {
+			if _, err := sp.Write(data[off : off+chunk]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// A tail at the start holds everything past the quota until it reads on.
+	tail, err := sp.Tail(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(0, 3<<20)
+	if got := sp.Start(); got != 0 {
+		t.Fatalf("Start() = %d with a tail at 0, want nothing evicted", got)
+	}
+	if _, err := io.ReadFull(tail, make([]byte, 3<<20)); err != nil {
+		t.Fatal(err)
+	}
+	write(3<<20, 4<<20)
+	_ = tail.Close()
+	// Eviction goes by whole steps, so the spool keeps at least its quota.
+	start := sp.Start()
+	if start <= headSize || start > 3<<20 {
+		t.Fatalf("Start() = %d once read, want past the head and within the quota's %d", start, 3<<20)
+	}
+
+	if _, err := sp.TailAt(context.Background(), 0); !errors.Is(err, ErrEvicted) {
+		t.Errorf("TailAt(0) error = %v, want ErrEvicted", err)
+	}
+	onDisk, err := os.ReadFile(sp.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(onDisk[:headSize], data[:headSize]) || !bytes.Equal(onDisk[start:], data[start:]) {
+		t.Error("the head or what the quota covers is not as written")
+	}
+	if !bytes.Equal(onDisk[headSize:start], make([]byte, start-headSize)) {
+		t.Skip("this filesystem cannot punch holes; the evicted bytes are still on disk")
+	}
+}
+
+func TestBytesUnmarshalText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Bytes
+	}{
+		{"4294967296", 4 << 30},
+		{"512MiB", 512 << 20},
+		{"4GiB", 4 << 30},
+		{"4G", 4 << 30},
+		{"1.5gb", 3 << 29},
+		{"64 KiB", 64 << 10},
+	}
+	for _, tt := range tests {
+		var got Bytes
+		if err := got.UnmarshalText([]byte(tt.in)); err != nil || got != tt.want {
+			t.Errorf("UnmarshalText(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "lots", "-1G"} {
+		var b Bytes
+		if err := b.UnmarshalText([]byte(in)); err == nil {
+			t.Errorf("UnmarshalText(%q) = %d, want an error", in, b)
+		}
+	}
+}
+
+// TestOpenAppends pins reopening a spool: a tail reads what was there, then
+// what is appended after it.
+func TestOpenAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool.ts")
+	if err := os.WriteFile(path, []byte("cached "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sp, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sp.Size(); got != 7 {
+		t.Fatalf("Size() = %d, want the 7 bytes already there", got)
+	}
+	if _, err := sp.Write([]byte("and new")); err != nil {
+		t.Fatal(err)
+	}
+	sp.CloseWrite(nil)
+	tail, err := sp.Tail(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tail.Close()
+	got, err := io.ReadAll(tail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "cached and new" {
+		t.Errorf("tail read %q, want %q", got, "cached and new")
+	}
+}
@@ -2,12 +2,16 @@ package ffmpeg
 
 import (
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/stupside/castor/internal/cast/subtitle"
 	"github.com/stupside/castor/internal/media"
 )
 
@@ -45,6 +49,15 @@ type NetworkSource struct {
 	// RWTimeout is how long a single upstream read may stall before ffmpeg
 	// gives up on it and reconnects.
 	RWTimeout time.Duration
+
+	// Seek starts the read this far into the source (-ss on every input), for
+	// a pull resumed partway through a title. Zero reads it from the start.
+	Seek time.Duration
+
+	// AudioTrack is which of URL's audio tracks is read (see
+	// media.Stream.AudioTrack). Ignored for a demuxed program, whose audio is
+	// AudioURL's.
+	AudioTrack int
 }
 
 // NewNetworkSource describes a resolved stream as an upstream to read. Both
@@ -58,6 +71,7 @@ func NewNetworkSource(stream *media.Stream, rwTimeout time.Duration) NetworkSour
 		ContentType: stream.ContentType,
 		Live:        stream.Live,
 		RWTimeout:   rwTimeout,
+		AudioTrack:  stream.AudioTrack,
 	}
 }
 
@@ -72,10 +86,31 @@ type EncodeOptions struct {
 	// which is what lets ffmpeg consume a still-growing stream.
 	PipeFormat string
 
-	// Source is the network input, read when PipeFormat is empty and ignored
-	// otherwise.
+	// InputFile, when non-empty, is a local file to read instead of a network
+	// source: a finished file seeks and ends like any other, so it needs none of
+	// the network input's reconnect or header flags.
+	InputFile string
+
+	// Source is the network input, read when PipeFormat and InputFile are empty
+	// and ignored otherwise.
 	Source NetworkSource
 
+	// AudioTrack is which of InputFile's audio tracks is played, counted among
+	// its audio tracks (see media.ProbeInfo.AudioTrack). A network Source
+	// carries its own, and a pipe carries one track.
+	AudioTrack int
+
+	// Seek starts the encode this far into a pipe or file input (-ss), for an
+	// encode restarted partway through. A file is seeked in; a pipe cannot be,
+	// so what it carries up to Seek is decoded and dropped. Ignored for a network
+	// Source.
+	Seek time.Duration
+
+	// OutputOffset shifts the output's timestamps by this much
+	// (-output_ts_offset), so a restarted encode carries on the clock of the one
+	// it replaces rather than starting again from zero.
+	OutputOffset time.Duration
+
 	// OutputFormat is ffmpeg's muxer name ("mpegts", "mp4", "hls"). "hls" writes
 	// a playlist plus rolling fMP4 segments into the process working directory
 	// (see WithWorkDir) rather than a single stream on pipe:1.
@@ -83,8 +118,8 @@ type EncodeOptions struct {
 
 	// VideoEncoder re-encodes the video; nil stream-copies it. The encoder
 	// carries its own device setup, filters, and flags, so EncodeArgs never
-	// branches on the encoder kind. When SubtitleTextFile is set the planner
-	// must supply one: drawtext needs decoded frames, so copy is not possible.
+	// branches on the encoder kind. When BurnsIn the planner must supply one:
+	// drawtext and libass need decoded frames, so copy is not possible.
 	VideoEncoder *Encoder
 
 	// VideoBitrate target when re-encoding video (e.g. "4M"). Ignored when
@@ -103,6 +138,15 @@ type EncodeOptions struct {
 	// 0 keeps the source height. Ignored when VideoEncoder is nil (copy).
 	VideoMaxHeight int
 
+	// ToneMap, when an HDR range, is the range of the source video, which
+	// every encoded rendition tone-maps down to SDR: the encoders here all
+	// deliver 8-bit BT.709 (see softwareFlags), and HDR squeezed into that
+	// without a tone-map plays washed out, or with the PQ curve still tagged
+	// on. It is done on the GPU where the encoder has ToneMapFilters, and by
+	// zscale on the CPU otherwise (see CanToneMap). A copied rendition keeps
+	// the source's range; empty or RangeSDR encodes as is.
+	ToneMap media.DynamicRange
+
 	// KeyframeIntervalSec caps the GOP length in seconds via force_key_frames,
 	// so a renderer joining mid-stream resyncs within this bound regardless of
 	// source fps. 0 leaves the encoder default. Ignored when VideoEncoder is
@@ -132,6 +176,68 @@ type EncodeOptions struct {
 	// Enabling this routes -progress to fd 3: start the process
 	// WithExtraPipe and follow Process.Extra.
 	SubtitleTextFile string
+
+	// SubtitleFile, when non-empty, burns a whole subtitle file (any text
+	// format ffmpeg reads: SubRip, WebVTT, ASS) into the video through libass's
+	// subtitles filter, each cue timed by the frames' own timestamps, so an ASS
+	// file keeps its fonts, colours and placement. Unlike SubtitleTextFile it
+	// needs no pacing and no progress feed, so it suits an encode that runs
+	// ahead of realtime. It also forces a video re-encode, and needs an ffmpeg
+	// built with libass.
+	SubtitleFile string
+
+	// SubtitleStyle is how either burn-in draws its text: drawtext's line,
+	// and a SubRip or WebVTT SubtitleFile, whose cues carry no styling of
+	// their own. An ASS SubtitleFile keeps its script's. The zero value draws
+	// in subtitle.DefaultStyle.
+	SubtitleStyle subtitle.Style
+
+	// ReportProgress routes -progress to fd 3 without a burn-in, for a caller
+	// that only wants the encoder's position and speed (the control API's
+	// status). The same WithExtraPipe contract as SubtitleTextFile applies.
+	ReportProgress bool
+
+	// Renditions, when set on an HLS output, replaces the single video
+	// rendition the Video* fields describe with a ladder: rendition i is written
+	// as variant i under media.HLSVariantDir, each with its own copy of the
+	// audio, for a master playlist (HLSMaster) to offer side by side. Every
+	// encoded rendition shares one encoder, and only the first may copy.
+	// Ignored for any other output.
+	Renditions []Rendition
+}
+
+// BurnsIn reports whether the encode draws subtitles into the video, by either
+// mechanism, which a copied bitstream cannot carry.
+func (o EncodeOptions) BurnsIn() bool {
+	return o.SubtitleTextFile != "" || o.SubtitleFile != ""
+}
+
+// Rendition is one variant of a rendition ladder: the video copied (a nil
+// Encoder) or scaled to MaxHeight and encoded at a VBV-capped bitrate, the
+// same fields EncodeOptions carries for a single rendition. Bandwidth is the
+// peak bits per second the master playlist announces it at, audio included,
+// which is what a client picks a variant by.
+type Rendition struct {
+	Encoder                   *Encoder
+	MaxHeight                 int
+	Bitrate, Maxrate, Bufsize string
+	Bandwidth                 int64
+}
+
+// renditions returns the video renditions the encode writes: the ladder on an
+// HLS output that has one, else the single rendition the Video* fields
+// describe.
+func (o EncodeOptions) renditions() []Rendition {
+	if o.OutputFormat == hlsMuxer && len(o.Renditions) > 0 {
+		return o.Renditions
+	}
+	return []Rendition{{
+		Encoder:   o.VideoEncoder,
+		MaxHeight: o.VideoMaxHeight,
+		Bitrate:   o.VideoBitrate,
+		Maxrate:   o.VideoMaxrate,
+		Bufsize:   o.VideoBufsize,
+	}}
 }
 
 // EncodeReadrateBurstSeconds is how much of the stream the subtitle-burning
@@ -239,33 +345,58 @@ func (s NetworkSource) input(pace pacing, u *url.URL) []string {
 	)
 	args = append(args, media.HeaderArgs(s.Headers)...)
 	args = append(args, containerInputArgs(s.ContentType)...)
+	args = append(args, seekArgs(s.Seek)...)
 	return append(args, "-i", u.String())
 }
 
 // audioMap is the ffmpeg stream specifier for the source's audio: the second
-// input when the program is demuxed, the first input's own audio otherwise. The
-// video map is always 0:v:0, so this is the only specifier that moves.
-//
-// A pipe-fed encode leaves the source zero-valued and lands on 0:a:0, which is
-// right: the spool it reads is a single muxed stream whatever the origin looked
-// like.
+// input when the program is demuxed, the first input's chosen audio track
+// otherwise. The video map is always 0:v:0, so this is the only specifier that
+// moves.
 func (s NetworkSource) audioMap() string {
 	if s.AudioURL != nil {
 		return "1:a:0"
 	}
-	return "0:a:0"
+	return "0:a:" + strconv.Itoa(s.AudioTrack)
+}
+
+// audioMap is the stream specifier for the encode's audio: the chosen track of
+// an input file, the network source's own otherwise. A pipe-fed encode leaves
+// the source zero-valued and lands on 0:a:0, which is right: the spool it reads
+// is a single muxed stream whatever the origin looked like.
+func (o EncodeOptions) audioMap() string {
+	if o.InputFile != "" {
+		return "0:a:" + strconv.Itoa(o.AudioTrack)
+	}
+	return o.Source.audioMap()
 }
 
 // EncodeArgs assembles the encode command line. No "magic" flags: every
 // argument is either part of the standard input/output setup or comes
 // straight from a field in EncodeOptions. It enforces the one cross-field
 // contract EncodeOptions documents but can't express in its types: a
-// SubtitleTextFile burn-in needs decoded frames, so it requires a real
+// subtitle burn-in needs decoded frames, so it requires a real
 // VideoEncoder rather than failing later inside ffmpeg with an unrelated
 // "Filtering and streamcopy cannot be used together".
 func EncodeArgs(opts EncodeOptions) ([]string, error) {
-	if opts.SubtitleTextFile != "" && opts.VideoEncoder == nil {
-		return nil, fmt.Errorf("subtitle burn-in requires a video re-encode: VideoEncoder is nil with SubtitleTextFile set")
+	renditions := opts.renditions()
+	ladder := opts.OutputFormat == hlsMuxer && len(opts.Renditions) > 0
+	var enc *Encoder
+	copies := false
+	for i, r := range renditions {
+		switch {
+		case r.Encoder == nil && i > 0:
+			return nil, fmt.Errorf("rendition %d copies the video: only the first rendition may", i)
+		case r.Encoder == nil:
+			copies = true
+		case enc != nil && r.Encoder.Name != enc.Name:
+			return nil, fmt.Errorf("renditions encode with both %s and %s: a ladder shares one encoder", enc.Name, r.Encoder.Name)
+		default:
+			enc = r.Encoder
+		}
+	}
+	if opts.BurnsIn() && copies {
+		return nil, fmt.Errorf("subtitle burn-in requires a video re-encode: VideoEncoder is nil with a subtitle file set")
 	}
 
 	// -nostats: the \r-terminated progress line never completes, so it
@@ -277,7 +408,6 @@ func EncodeArgs(opts EncodeOptions) ([]string, error) {
 	// contributes its own hardware-device setup (emitted before the input, so
 	// both the upload filter and the encoder can reference it), filters, and
 	// flags, so there is no per-encoder branching below.
-	enc := opts.VideoEncoder
 	if enc != nil {
 		args = append(args, enc.InitArgs...)
 	}
@@ -296,7 +426,16 @@ func EncodeArgs(opts EncodeOptions) ([]string, error) {
 				burst:    strconv.Itoa(EncodeReadrateBurstSeconds),
 			}.args()...)
 		}
+		args = append(args, seekArgs(opts.Seek)...)
 		args = append(args, "-f", opts.PipeFormat, "-i", "pipe:0")
+	} else if opts.InputFile != "" {
+		// A local file costs nothing to read fast: only a rolling HLS output
+		// window needs it held to wall-clock speed (see below).
+		if opts.OutputFormat == hlsMuxer {
+			args = append(args, pacingHLSWindow.args()...)
+		}
+		args = append(args, seekArgs(opts.Seek)...)
+		args = append(args, "-i", opts.InputFile)
 	} else {
 		// This reader may run at wire speed, since its output is either
 		// replay-spooled from byte 0 or a rolling window, so it paces only where
@@ -318,59 +457,96 @@ func EncodeArgs(opts EncodeOptions) ([]string, error) {
 		args = append(args, opts.Source.inputArgs(pace)...)
 	}
 
-	// Map the first video and first audio track explicitly. ffmpeg's default
-	// stream selection picks the audio track with the most channels, which on a
-	// multi-track source can differ from the first track the planner probed to
+	// Map the first video and the chosen audio track (the first, unless an
+	// audio language picked another) explicitly. ffmpeg's default stream
+	// selection picks the audio track with the most channels, which on a
+	// multi-track source can differ from the track the planner probed to
 	// choose copy-vs-encode — so the encode would apply that decision to the
 	// wrong track. Pinning the pair keeps the encoded track identical to the
 	// probed one, and on a demuxed program it is what joins the two inputs back
 	// into one output. (The read-once spool is already single-audio via the
-	// puller's -map, so this only changes behaviour for the direct network remux.)
-	args = append(args, "-map", "0:v:0", "-map", opts.Source.audioMap())
+	// puller's -map, so this only changes behaviour for the direct network remux
+	// and a local file.)
+	//
+	// A ladder maps the pair once per rendition: each variant carries its
+	// own audio, which every HLS client plays, rather than an audio group
+	// some do not.
+	for range renditions {
+		args = append(args, "-map", "0:v:0", "-map", opts.audioMap())
+	}
 
 	// Video filter chain. scale= runs first so text is rendered at the final
 	// resolution (crisper than scaling rendered text); it caps height while
 	// keeping width divisible by 2 (encoder requirement) and preserving aspect
-	// ratio via -2. The encoder's own filters (e.g. the VA-API GPU upload) come
-	// last, after scale and drawtext have run on CPU frames. Copy skips all of
-	// this (enc == nil): a copied bitstream can't be filtered.
-	var vfilters []string
-	if enc != nil && opts.VideoMaxHeight > 0 {
-		vfilters = append(vfilters, fmt.Sprintf("scale=-2:'min(%d,ih)'", opts.VideoMaxHeight))
-	}
-	if opts.SubtitleTextFile != "" {
-		vfilters = append(vfilters, drawtextFilter(opts.SubtitleTextFile))
-	}
-	if enc != nil {
-		vfilters = append(vfilters, enc.Filters...)
-	}
-	if len(vfilters) > 0 {
-		args = append(args, "-vf", strings.Join(vfilters, ","))
-	}
+	// ratio via -2. The tone-map follows it, so it converts the fewest pixels,
+	// and precedes drawtext, so the text is drawn in the SDR it is shown in.
+	// The encoder's own filters (e.g. the VA-API GPU upload) come last, after
+	// scale and drawtext have run on CPU frames; its GPU tone-map replaces them
+	// only when nothing is drawn, since drawtext needs the SDR frames on the
+	// CPU. Copy skips all of this: a copied bitstream can't be filtered.
+	//
+	// A ladder qualifies every video option with its output stream (see
+	// videoFlag); a single rendition keeps the plain flags.
+	flagsDone := false
+	for i, r := range renditions {
+		if r.Encoder == nil {
+			args = append(args, videoFlag("-c:v", i, ladder), CodecCopy)
+			continue
+		}
+		var vfilters []string
+		if r.MaxHeight > 0 {
+			vfilters = append(vfilters, fmt.Sprintf("scale=-2:'min(%d,ih)'", r.MaxHeight))
+		}
+		gpuToneMap := opts.ToneMap.HDR() && len(r.Encoder.ToneMapFilters) > 0 && !opts.BurnsIn()
+		if opts.ToneMap.HDR() && !gpuToneMap {
+			vfilters = append(vfilters, toneMapFilters(opts.ToneMap)...)
+		}
+		if opts.SubtitleTextFile != "" {
+			vfilters = append(vfilters, drawtextFilter(opts.SubtitleTextFile, opts.SubtitleStyle))
+		}
+		if opts.SubtitleFile != "" {
+			vfilters = append(vfilters, subtitlesFilter(opts.SubtitleFile, opts.SubtitleStyle))
+		}
+		if gpuToneMap {
+			vfilters = append(vfilters, r.Encoder.ToneMapFilters...)
+		} else {
+			vfilters = append(vfilters, r.Encoder.Filters...)
+		}
+		if len(vfilters) > 0 {
+			args = append(args, videoFlag("-vf", i, ladder), strings.Join(vfilters, ","))
+		}
 
-	if enc == nil {
-		args = append(args, "-c:v", CodecCopy)
-	} else {
-		args = append(args, "-c:v", enc.Name)
-		args = append(args, enc.Flags...)
-		if opts.VideoBitrate != "" {
-			args = append(args, "-b:v", opts.VideoBitrate)
+		args = append(args, videoFlag("-c:v", i, ladder), r.Encoder.Name)
+		// The encoder's flags are unqualified, and every encoded rendition
+		// shares the encoder, so they are given once for all of them.
+		if !flagsDone {
+			args = append(args, r.Encoder.Flags...)
+			flagsDone = true
+		}
+		if r.Bitrate != "" {
+			args = append(args, videoFlag("-b:v", i, ladder), r.Bitrate)
 		}
 		// VBV cap: bound the instantaneous bitrate so the pacer's fixed send
 		// rate is a real ceiling. Both encoders honour this (libx264 VBV,
 		// VideoToolbox/VA-API DataRateLimits).
-		if opts.VideoMaxrate != "" {
-			args = append(args, "-maxrate", opts.VideoMaxrate)
+		if r.Maxrate != "" {
+			args = append(args, videoFlag("-maxrate", i, ladder), r.Maxrate)
 		}
-		if opts.VideoBufsize != "" {
-			args = append(args, "-bufsize", opts.VideoBufsize)
+		if r.Bufsize != "" {
+			args = append(args, videoFlag("-bufsize", i, ladder), r.Bufsize)
 		}
 		// Cap the GOP in wall-clock time, fps-independent, so a renderer that
 		// joins mid-stream resyncs within the interval. Works on every encoder
 		// family (VideoToolbox additionally needs -g in its Flags to lift its
 		// wasteful sub-second default so this expression is the real limiter).
-		if opts.KeyframeIntervalSec > 0 {
-			args = append(args, "-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", opts.KeyframeIntervalSec))
+		// A ladder beside a copied rendition takes the source's keyframes
+		// instead: variants switch only at segment boundaries, which the copied
+		// one can cut only on its own keyframes, so the rest must match them.
+		switch {
+		case ladder && copies:
+			args = append(args, videoFlag("-force_key_frames", i, ladder), "source")
+		case opts.KeyframeIntervalSec > 0:
+			args = append(args, videoFlag("-force_key_frames", i, ladder), fmt.Sprintf("expr:gte(t,n_forced*%d)", opts.KeyframeIntervalSec))
 		}
 	}
 
@@ -408,24 +584,69 @@ func EncodeArgs(opts EncodeOptions) ([]string, error) {
 		args = append(args, "-movflags", "+frag_keyframe+empty_moov+default_base_moof")
 	}
 
-	if opts.SubtitleTextFile != "" {
+	switch {
+	case opts.SubtitleTextFile != "":
 		// Progress reporting drives the live subtitle writer: it tells us
 		// the encoder's output position so the writer can swap the active
 		// cue in the textfile. fd 3 is the runner's extra pipe. With the
 		// encode paced at realtime, the period is also the cue placement
 		// granularity in video time.
 		args = append(args, "-progress", "pipe:3", "-stats_period", "0.1")
+	case opts.ReportProgress:
+		// Status reporting only: once a second is plenty for a human or a scrape.
+		args = append(args, "-progress", "pipe:3", "-stats_period", "1")
 	}
 
 	// HLS writes a playlist + segment files, not a stream on a pipe. The bare
 	// relative filenames rely on the process running WithWorkDir(the cast dir).
 	if opts.OutputFormat == hlsMuxer {
+		if ladder {
+			return append(args, hlsLadderOutputArgs(len(renditions))...), nil
+		}
 		return append(args, hlsOutputArgs()...), nil
 	}
+	if opts.OutputOffset > 0 {
+		args = append(args, "-output_ts_offset", seconds(opts.OutputOffset))
+	}
 	args = append(args, "-f", opts.OutputFormat, "pipe:1")
 	return args, nil
 }
 
+// seekArgs is the input seek for an encode starting at, none at zero.
+func seekArgs(at time.Duration) []string {
+	if at <= 0 {
+		return nil
+	}
+	return []string{"-ss", seconds(at)}
+}
+
+// seconds renders d as ffmpeg's decimal seconds, to the millisecond.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// ParseRate parses a bitrate the way ffmpeg takes one ("4M", "2500k",
+// "800000"), into bits per second.
+func ParseRate(rate string) (int64, error) {
+	digits, mult := rate, int64(1)
+	switch {
+	case strings.HasSuffix(rate, "M"):
+		digits, mult = strings.TrimSuffix(rate, "M"), 1_000_000
+	case strings.HasSuffix(rate, "k"):
+		digits, mult = strings.TrimSuffix(rate, "k"), 1_000
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid bitrate %q: want bits per second, or a number of k or M", rate)
+	}
+	return n * mult, nil
+}
+
+// FormatRate renders bits per second as an ffmpeg bitrate in kilobits.
+func FormatRate(bits int64) string {
+	return strconv.FormatInt(bits/1000, 10) + "k"
+}
+
 // HLS output tuning. A live sliding-window fMP4 tail: hlsListSize segments of
 // ~hlsSegmentSeconds each keep hlsWindowSeconds on disk, comfortably above the
 // ~30s-behind-live-edge window HLS clients conventionally buffer; hls_playlist_type
@@ -458,26 +679,113 @@ func hlsOutputArgs() []string {
 	}
 }
 
+// hlsLadderOutputArgs is hlsOutputArgs for a ladder of n renditions: the same
+// rolling window per variant, each in its own directory (HLSVariantDir, which
+// the caller creates before the start, see media.HLSVariantPath). No master
+// playlist is asked of ffmpeg: it announces a variant at its stream's bitrate,
+// which a copied one does not have, so castor writes its own (see HLSMaster).
+// The init segment names stay per directory, ffmpeg adding the variant index to
+// each.
+func hlsLadderOutputArgs(n int) []string {
+	streams := make([]string, n)
+	for i := range n {
+		streams[i] = fmt.Sprintf("v:%d,a:%d", i, i)
+	}
+	return []string{
+		"-f", hlsMuxer,
+		"-hls_time", strconv.Itoa(hlsSegmentSeconds),
+		"-hls_list_size", strconv.Itoa(hlsListSize),
+		"-hls_flags", "delete_segments+independent_segments",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", media.HLSInitName,
+		"-var_stream_map", strings.Join(streams, " "),
+		"-hls_segment_filename", path.Join(media.HLSVariantDir, media.HLSSegmentPattern),
+		path.Join(media.HLSVariantDir, media.HLSPlaylistName),
+	}
+}
+
+// HLSMaster renders the master playlist over a ladder's renditions, each
+// announced at its Bandwidth, in the order given: a client starts on the first
+// variant it can sustain and moves between them as its throughput changes.
+func HLSMaster(renditions []Rendition) []byte {
+	var b strings.Builder
+	// Version 7 is what fMP4 segments need; independent segments lets a client
+	// switch variant at any segment boundary.
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for i, r := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s\n", r.Bandwidth, media.HLSVariantPath(i, media.HLSPlaylistName))
+	}
+	return []byte(b.String())
+}
+
+// videoFlag qualifies an output video option for rendition i of a ladder
+// ("-c:v" becomes "-c:v:1", "-vf" "-filter:v:1", "-maxrate" "-maxrate:v:1"),
+// so it applies to that variant's stream alone. A single rendition keeps the
+// plain flag, which applies to its only video stream anyway.
+func videoFlag(flag string, i int, ladder bool) string {
+	switch {
+	case !ladder:
+		return flag
+	case flag == "-vf":
+		return "-filter:v:" + strconv.Itoa(i)
+	case strings.HasSuffix(flag, ":v"):
+		return flag + ":" + strconv.Itoa(i)
+	default:
+		return flag + ":v:" + strconv.Itoa(i)
+	}
+}
+
 // PullOptions configures the single upstream reader's command line.
 type PullOptions struct {
 	// Source is the upstream to download, read exactly as the served remux
 	// reads its own (same reconnect policy, headers, container flags, pacing).
 	Source NetworkSource
 
+	// Unpaced reads the source at wire speed, for a pull nothing plays from
+	// as it arrives (a download). A segmented source is paced all the same,
+	// since wire speed against a segmented CDN is a request storm (see
+	// segmented).
+	Unpaced bool
+
 	// Verbose selects -loglevel verbose (playlist/segment URLs, connection
 	// lines) instead of the default warning level.
 	Verbose bool
 
 	// PCM additionally extracts mono s16le audio on fd 3 for the
-	// transcriber; start the process WithExtraPipe.
+	// transcriber; start the process WithExtraPipes(opts.Pipes()).
 	PCM bool
 	// PCMSampleRate is the audio sample rate for the PCM output.
 	PCMSampleRate int
+
+	// Subtitles additionally reads the source's SubtitleTrack'th subtitle
+	// track (s:N) out as SubRip on the next pipe past the PCM's: pipe:4 with
+	// PCM, pipe:3 without. It is the one read of a track muxed into the
+	// stream, so a cast showing it opens the source once.
+	Subtitles     bool
+	SubtitleTrack int
+
+	// OutputOffset shifts the spooled output's timestamps by this much
+	// (-output_ts_offset), so a resumed pull carries on the clock of the spool
+	// it appends to.
+	OutputOffset time.Duration
+}
+
+// Pipes is how many extra output pipes the pull writes to (see
+// WithExtraPipes): one each for the PCM and the subtitles it is asked for.
+func (o PullOptions) Pipes() int {
+	n := 0
+	if o.PCM {
+		n++
+	}
+	if o.Subtitles {
+		n++
+	}
+	return n
 }
 
 // PullArgs assembles the upstream download command line: a codec-copy remux
 // of the source into append-only MPEG-TS on stdout, paced like a buffering
-// player, with an optional PCM tee for transcription.
+// player unless Unpaced, with optional PCM and subtitle tees.
 func PullArgs(opts PullOptions) []string {
 	// Baseline "warning" (not "error") so HLS segment failures — "Failed to open
 	// segment N", "HTTP error 404 Not Found" — reach the stderr ring tail.
@@ -494,10 +802,16 @@ func PullArgs(opts PullOptions) []string {
 
 	args := []string{"-nostats", "-loglevel", logLevel}
 
-	// The pull always paces, whatever the container: it buffers a whole title
+	// A cast's pull paces, whatever the container: it buffers a whole title
 	// into a spool the encoder tails, so running further ahead than the source's
-	// own pace buys nothing and only spends the origin's patience.
-	args = append(args, opts.Source.inputArgs(opts.Source.pacing())...)
+	// own pace buys nothing and only spends the origin's patience. A download
+	// has no encoder to stay ahead of, only a file to finish, so it reads a
+	// single file at wire speed.
+	pace := opts.Source.pacing()
+	if opts.Unpaced && !opts.Source.segmented() {
+		pace = pacing{}
+	}
+	args = append(args, opts.Source.inputArgs(pace)...)
 
 	// Output 1: codec-copy remux to MPEG-TS on stdout → spool. mpegts is the
 	// right spool format because it is strictly append-only (no trailer or
@@ -508,9 +822,13 @@ func PullArgs(opts PullOptions) []string {
 	args = append(args,
 		"-map", "0:v:0", "-map", opts.Source.audioMap(),
 		"-c", CodecCopy,
-		"-f", "mpegts", "pipe:1",
 	)
+	if opts.OutputOffset > 0 {
+		args = append(args, "-output_ts_offset", seconds(opts.OutputOffset))
+	}
+	args = append(args, "-f", "mpegts", "pipe:1")
 
+	fd := 3
 	if opts.PCM {
 		// Output 2: mono PCM for whisper on fd 3 (the runner's extra pipe).
 		args = append(args,
@@ -519,30 +837,200 @@ func PullArgs(opts PullOptions) []string {
 			"-ar", strconv.Itoa(opts.PCMSampleRate),
 			"-f", "s16le", "pipe:3",
 		)
+		fd++
+	}
+	if opts.Subtitles {
+		// Output 3: the subtitle track as SubRip, flushed cue by cue so the
+		// burn-in has each ahead of the encoder, on the spool's clock.
+		args = append(args, "-map", "0:s:"+strconv.Itoa(opts.SubtitleTrack), "-c:s", "srt")
+		if opts.OutputOffset > 0 {
+			args = append(args, "-output_ts_offset", seconds(opts.OutputOffset))
+		}
+		args = append(args, "-flush_packets", "1", "-f", "srt", "pipe:"+strconv.Itoa(fd))
 	}
 	return args
 }
 
-// drawtextFilter renders subtitle text bottom-centered with a translucent
-// box, matching how dedicated subtitle renderers style their output.
-// reload=1 makes ffmpeg re-open the textfile before every frame, which is
-// what turns a static filter into a live subtitle track.
-func drawtextFilter(textFile string) string {
-	return strings.Join([]string{
+// SubtitleArgs assembles the command line that reads one of a source's own
+// subtitle tracks out as SubRip on stdout, track being which of src's
+// subtitle tracks (s:N). ffmpeg converts whatever the track is written in
+// (WebVTT segments, an MKV's ASS or SubRip, an MP4's mov_text), so the cues
+// are parsed one way whatever the source. Only src.URL is read, on the same
+// reconnect policy and headers as the pull: a demuxed program's audio
+// rendition carries no subtitles. The read is unpaced: a subtitle rendition
+// is a few kilobytes of text wanted whole and ahead of the encoder. A track
+// muxed into the stream is read by the pull itself (PullOptions.Subtitles)
+// where there is one reading from the start; this reads it only for a cast
+// from the spool cache, whose pull starts partway or not at all.
+func SubtitleArgs(src NetworkSource, track int) []string {
+	args := []string{"-hide_banner", "-nostats", "-loglevel", "error"}
+	args = append(args, src.input(pacing{}, src.URL)...)
+	return append(args, "-map", "0:s:"+strconv.Itoa(track), "-c:s", "srt", "-f", "srt", "pipe:1")
+}
+
+// RecordOptions describes the remux that keeps a finished served cast as a file:
+// the local copy it was served from, stream-copied into the recording's muxer.
+type RecordOptions struct {
+	// Input is the local file the cast played from (the read-once spool, or the
+	// replay server's spool of a network remux).
+	Input string
+
+	// Subtitles, when non-empty, is an SRT file muxed in as a soft subtitle
+	// track. Only a muxer that carries text subtitles takes one (matroska).
+	Subtitles string
+
+	// Muxer is ffmpeg's muxer name for Output ("matroska", "mp4", "mpegts").
+	Muxer  string
+	Output string
+}
+
+// RecordArgs assembles the recording remux. Nothing is re-encoded: the file
+// holds exactly the bytes castor pulled, only re-containered, so it costs a local
+// read rather than a second fetch or an encode. The input may end mid-packet when
+// the cast was interrupted; discardcorrupt drops the torn tail instead of failing.
+func RecordArgs(opts RecordOptions) []string {
+	args := []string{
+		"-hide_banner", "-nostats", "-loglevel", "error", "-y",
+		"-fflags", "+genpts+discardcorrupt", "-i", opts.Input,
+	}
+	if opts.Subtitles != "" {
+		args = append(args, "-i", opts.Subtitles)
+	}
+	args = append(args, "-map", "0:v?", "-map", "0:a?", "-c", CodecCopy)
+	if opts.Subtitles != "" {
+		args = append(args, "-map", "1:s", "-c:s", "srt")
+	}
+	if opts.Muxer == "mp4" {
+		// A finished file, so the index can move to the front where a player
+		// reading it over a network finds it first.
+		args = append(args, "-movflags", "+faststart")
+	}
+	return append(args, "-f", opts.Muxer, opts.Output)
+}
+
+// toneMapFilters converts frames in from, an HDR range, to 8-bit BT.709 SDR
+// on the CPU: zscale linearises the transfer (the input's primaries and
+// matrix given outright, as a stream's tags are often missing) to float RGB,
+// maps the primaries to BT.709, tonemap's Hable curve rolls the highlights
+// off into SDR's range, and zscale re-applies the BT.709 transfer. A Dolby
+// Vision profile 5 source has no HDR10 base layer and is read as PQ, so it
+// comes out with its colours off: only a Dolby Vision decoder shows it right.
+func toneMapFilters(from media.DynamicRange) []string {
+	transfer := "smpte2084"
+	if from == media.RangeHLG {
+		transfer = "arib-std-b67"
+	}
+	return []string{
+		"zscale=tin=" + transfer + ":min=bt2020nc:pin=bt2020:rin=tv:t=linear:npl=100",
+		"format=gbrpf32le",
+		"zscale=p=bt709",
+		"tonemap=tonemap=hable:desat=0",
+		"zscale=t=bt709:m=bt709:r=tv",
+		"format=yuv420p",
+	}
+}
+
+// drawtextFilter renders subtitle text centred in style: sized and placed
+// relative to the frame's height, so the cue reads the same at any output
+// resolution, with its lines centred on one another. reload=1 makes drawtext
+// re-open textFile before every frame, which is how the cue writer swaps the
+// line on screen.
+func drawtextFilter(textFile string, style subtitle.Style) string {
+	style = style.OrDefault()
+	args := []string{
 		"drawtext=textfile=" + escapeFilterArg(textFile),
 		"reload=1",
-		"fontsize=h/24",
-		"fontcolor=white",
-		"borderw=2",
-		"bordercolor=black",
-		"box=1",
-		"boxcolor=black@0.45",
-		"boxborderw=10",
+	}
+	if style.FontFile() {
+		args = append(args, "fontfile="+escapeFilterArg(style.Font))
+	} else if style.Font != "" {
+		args = append(args, "font="+escapeFilterArg(style.Font))
+	}
+	args = append(args,
+		"fontsize=h*"+ratio(style.Size),
+		"fontcolor="+hexColor(style.Color),
+	)
+	if style.Outline > 0 {
+		args = append(args,
+			"borderw="+strconv.Itoa(style.Outline),
+			"bordercolor="+hexColor(style.OutlineColor),
+		)
+	}
+	if style.Box {
+		args = append(args,
+			"box=1",
+			"boxcolor="+hexColor(style.BoxColor),
+			"boxborderw=10",
+		)
+	}
+	y := "h-text_h-h*" + ratio(style.Margin)
+	if style.Position == subtitle.PositionTop {
+		y = "h*" + ratio(style.Margin)
+	}
+	return strings.Join(append(args,
 		"text_align=center",
 		"line_spacing=6",
 		"x=(w-text_w)/2",
-		"y=h-text_h-(h/20)",
-	}, ":")
+		"y="+y,
+	), ":")
+}
+
+// subtitlesFilter draws a whole subtitle file with libass. An ASS script is
+// drawn as its author styled it; a SubRip or WebVTT file, whose cues carry no
+// styling, in style, forced on through libass's force_style.
+func subtitlesFilter(path string, style subtitle.Style) string {
+	filter := "subtitles=filename=" + escapeFilterArg(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ass", ".ssa":
+		return filter
+	}
+	return filter + ":force_style=" + escapeFilterArg(assStyle(style.OrDefault()))
+}
+
+// assStyle is style as ASS style overrides, for force_style. libass lays a
+// SubRip file out on a 288-line script canvas scaled to the frame, so sizes
+// relative to the height become lines of it. ASS has no separate box colour:
+// its opaque-box border style fills the box in the outline colour, so with a
+// box the outline gives way to it, as in every ASS renderer.
+func assStyle(style subtitle.Style) string {
+	const playResY = 288
+	alignment := "2" // bottom centre, on the numeric keypad ASS counts by
+	if style.Position == subtitle.PositionTop {
+		alignment = "8"
+	}
+	fields := []string{
+		"FontSize=" + strconv.Itoa(int(math.Round(style.Size*playResY))),
+		"PrimaryColour=" + assColor(style.Color),
+		"MarginV=" + strconv.Itoa(int(math.Round(style.Margin*playResY))),
+		"Alignment=" + alignment,
+	}
+	if style.Font != "" && !style.FontFile() {
+		fields = append(fields, "FontName="+style.Font)
+	}
+	if style.Box {
+		fields = append(fields, "BorderStyle=3", "OutlineColour="+assColor(style.BoxColor), "Outline=1", "Shadow=0")
+	} else {
+		fields = append(fields, "BorderStyle=1", "OutlineColour="+assColor(style.OutlineColor), "Outline="+strconv.Itoa(style.Outline), "Shadow=0")
+	}
+	return strings.Join(fields, ",")
+}
+
+// hexColor is c in ffmpeg's colour syntax, 0xRRGGBBAA.
+func hexColor(c subtitle.Color) string {
+	r, g, b, a := c.RGBA()
+	return fmt.Sprintf("0x%02x%02x%02x%02x", r, g, b, a)
+}
+
+// assColor is c in ASS's colour syntax, &HAABBGGRR, whose alpha is
+// transparency rather than opacity.
+func assColor(c subtitle.Color) string {
+	r, g, b, a := c.RGBA()
+	return fmt.Sprintf("&H%02X%02X%02X%02X", 0xff-a, b, g, r)
+}
+
+// ratio formats a fraction of the frame for a filter expression.
+func ratio(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
 
 // escapeFilterArg escapes a value for passing through ffmpeg's two-level
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stupside/castor/internal/cast/subtitle"
 	"github.com/stupside/castor/internal/media"
 )
 
@@ -69,6 +70,84 @@ func TestEncodeArgsCopyRemux(t *testing.T) {
 	}
 }
 
+func TestEncodeArgsInputFile(t *testing.T) {
+	cases := []struct {
+		name     string
+		output   string
+		readrate string
+	}{
+		// A file read into a replayed stream runs at disk speed.
+		{name: "stream", output: "mpegts"},
+		// A rolling HLS window still needs wall-clock pacing.
+		{name: "hls", output: "hls", readrate: "1.0"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			args, err := EncodeArgs(EncodeOptions{InputFile: "/media/movie.mkv", OutputFormat: c.output, AudioCodec: "aac"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := argValue(args, "-i"); got != "/media/movie.mkv" {
+				t.Errorf("input = %q, want the file", got)
+			}
+			if got := argValue(args, "-readrate"); got != c.readrate {
+				t.Errorf("readrate = %q, want %q", got, c.readrate)
+			}
+			if hasFlag(args, "-reconnect") || hasFlag(args, "-rw_timeout") {
+				t.Error("a file input must not carry network reconnect flags")
+			}
+			if got := argValue(args, "-map"); got != "0:a:0" {
+				t.Errorf("audio map = %q, want 0:a:0", got)
+			}
+		})
+	}
+}
+
+// TestEncodeArgsRestarted pins an encode restarted partway through: the input
+// seek goes before its input, where it seeks rather than decodes up to the
+// point, and the output carries on the replaced encode's clock.
+func TestEncodeArgsRestarted(t *testing.T) {
+	for _, opts := range []EncodeOptions{
+		{InputFile: "/media/movie.mkv"},
+		{PipeFormat: "mpegts"},
+	} {
+		opts.OutputFormat, opts.AudioCodec = "mpegts", "aac"
+		opts.Seek, opts.OutputOffset = 90*time.Second+500*time.Millisecond, 95*time.Second
+		args, err := EncodeArgs(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ss, in := slices.Index(args, "-ss"), slices.Index(args, "-i")
+		if ss < 0 || ss > in || args[ss+1] != "90.500" {
+			t.Errorf("args = %v, want -ss 90.500 before -i", args)
+		}
+		if got := argValue(args, "-output_ts_offset"); got != "95.000" {
+			t.Errorf("output offset = %q, want 95.000", got)
+		}
+	}
+
+	args, err := EncodeArgs(EncodeOptions{PipeFormat: "mpegts", OutputFormat: "mpegts", AudioCodec: "aac"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasFlag(args, "-ss") || hasFlag(args, "-output_ts_offset") {
+		t.Errorf("an encode from the start must not seek or offset: %v", args)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for rate, want := range map[string]int64{"4M": 4_000_000, "2500k": 2_500_000, "800000": 800_000} {
+		if got, err := ParseRate(rate); err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", rate, got, err, want)
+		}
+	}
+	for _, rate := range []string{"", "fast", "-2M", "2G"} {
+		if _, err := ParseRate(rate); err == nil {
+			t.Errorf("ParseRate(%q) succeeded, want an error", rate)
+		}
+	}
+}
+
 func TestEncodeArgsReadrateHeadroom(t *testing.T) {
 	// Burning subtitles paces the encode with -readrate. It must be just above
 	// realtime (EncodeReadrate), not 1.0: at dead-even playback speed the
@@ -261,6 +340,175 @@ func TestEncodeArgsSubtitlesBurnIn(t *testing.T) {
 	}
 }
 
+// TestEncodeArgsSubtitleFile pins the libass burn-in of a whole file: the
+// subtitles filter joins the chain after the scale, and, with no cue writer to
+// keep up with, the encode is neither paced nor made to report progress.
+func TestEncodeArgsSubtitleFile(t *testing.T) {
+	args, err := EncodeArgs(EncodeOptions{
+		InputFile:      "/films/movie.mkv",
+		OutputFormat:   "mpegts",
+		VideoEncoder:   &libx264,
+		VideoMaxHeight: 1080,
+		SubtitleFile:   "/tmp/cast: 1/subtitles.ass",
+		AudioCodec:     "aac",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `scale=-2:'min(1080,ih)',subtitles=filename=/tmp/cast\\: 1/subtitles.ass`
+	if got := argValue(args, "-vf"); got != want {
+		t.Errorf("-vf = %q, want %q", got, want)
+	}
+	if hasFlag(args, "-readrate") || hasFlag(args, "-progress") {
+		t.Errorf("a libass burn-in must not pace the encode or report progress: %v", args)
+	}
+
+	if _, err := EncodeArgs(EncodeOptions{InputFile: "/films/movie.mkv", OutputFormat: "mpegts", SubtitleFile: "/tmp/subtitles.srt", AudioCodec: "aac"}); err == nil {
+		t.Error("want an error for SubtitleFile set with a nil VideoEncoder, got nil")
+	}
+}
+
+// TestDrawtextFilterStyle pins how a subtitle style reaches drawtext: the
+// zero style draws the defaults, sizes scale with the frame, a font is a file
+// or a family by its form, and the outline and box drop out when unset.
+func TestDrawtextFilterStyle(t *testing.T) {
+	custom := subtitle.Style{
+		Font:     "/usr/share/fonts/Inter Bold.ttf",
+		Size:     0.05,
+		Color:    "#ff0",
+		Margin:   0.1,
+		Position: subtitle.PositionTop,
+		MaxChars: 32,
+	}
+	family := subtitle.DefaultStyle
+	family.Font = "DejaVu Sans"
+	tests := []struct {
+		name  string
+		style subtitle.Style
+		want  []string
+		not   []string
+	}{
+		{
+			"zero is the default",
+			subtitle.Style{},
+			[]string{"fontsize=h*0.041666666666666664", "fontcolor=0xffffffff", "borderw=2", "bordercolor=0x000000ff", "box=1", "boxcolor=0x00000073", "y=h-text_h-h*0.05"},
+			[]string{"font="},
+		},
+		{
+			"custom",
+			custom,
+			[]string{`fontfile=/usr/share/fonts/Inter Bold.ttf`, "fontsize=h*0.05", "fontcolor=0xffff00ff", "y=h*0.1"},
+			[]string{"borderw", "box=1"},
+		},
+		{"family", family, []string{"font=DejaVu Sans"}, []string{"fontfile="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := drawtextFilter("/tmp/cue.txt", tt.style)
+			opts := strings.Split(got, ":")
+			for _, w := range tt.want {
+				if !slices.Contains(opts, w) {
+					t.Errorf("drawtext = %q, want %q", got, w)
+				}
+			}
+			for _, n := range tt.not {
+				if strings.Contains(got, n) {
+					t.Errorf("drawtext = %q, want no %q", got, n)
+				}
+			}
+		})
+	}
+}
+
+// TestSubtitlesFilterStyle pins the style forced onto a SubRip file libass
+// draws, and that an ASS script is left to its own.
+func TestSubtitlesFilterStyle(t *testing.T) {
+	top := subtitle.DefaultStyle
+	top.Position, top.Box = subtitle.PositionTop, false
+	tests := []struct {
+		name  string
+		path  string
+		style subtitle.Style
+		want  string
+	}{
+		{"ass keeps its own", "/tmp/subtitles.ass", top, "subtitles=filename=/tmp/subtitles.ass"},
+		{"srt in the default", "/tmp/subtitles.srt", subtitle.Style{}, `subtitles=filename=/tmp/subtitles.srt:force_style=FontSize=12\\,PrimaryColour=&H00FFFFFF\\,MarginV=14\\,Alignment=2\\,BorderStyle=3\\,OutlineColour=&H8C000000\\,Outline=1\\,Shadow=0`},
+		{"srt on top, outlined", "/tmp/subtitles.srt", top, `subtitles=filename=/tmp/subtitles.srt:force_style=FontSize=12\\,PrimaryColour=&H00FFFFFF\\,MarginV=14\\,Alignment=8\\,BorderStyle=1\\,OutlineColour=&H00000000\\,Outline=2\\,Shadow=0`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := subtitlesFilter(tt.path, tt.style); got != tt.want {
+				t.Errorf("subtitlesFilter = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEncodeArgsToneMap pins where the tone-map of an HDR source sits in the
+// filter chain: after the scale, before drawtext, and on the GPU only when
+// nothing is drawn on the CPU frames.
+func TestEncodeArgsToneMap(t *testing.T) {
+	cpu := strings.Join(toneMapFilters(media.RangeHDR10), ",")
+	tests := []struct {
+		name     string
+		enc      *Encoder
+		toneMap  media.DynamicRange
+		subtitle string
+		want     string
+	}{
+		{"sdr encodes as is", &libx264, media.RangeSDR, "", "scale=-2:'min(1080,ih)'"},
+		{"software", &libx264, media.RangeHDR10, "", "scale=-2:'min(1080,ih)'," + cpu},
+		{"hlg reads its own transfer", &libx264, media.RangeHLG, "", "scale=-2:'min(1080,ih)'," + strings.Join(toneMapFilters(media.RangeHLG), ",")},
+		{"vaapi on the gpu", &h264VAAPI, media.RangeHDR10, "", "scale=-2:'min(1080,ih)'," + strings.Join(vaapiToneMap, ",")},
+		{"vaapi under a burn-in", &h264VAAPI, media.RangeHDR10, "/tmp/cue.txt", "scale=-2:'min(1080,ih)'," + cpu + "," + drawtextFilter("/tmp/cue.txt", subtitle.Style{}) + ",format=nv12,hwupload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := EncodeArgs(EncodeOptions{
+				PipeFormat:       "mpegts",
+				OutputFormat:     "mpegts",
+				VideoEncoder:     tt.enc,
+				VideoMaxHeight:   1080,
+				ToneMap:          tt.toneMap,
+				SubtitleTextFile: tt.subtitle,
+				AudioCodec:       "aac",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := argValue(args, "-vf"); got != tt.want {
+				t.Errorf("-vf = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if !strings.Contains(toneMapFilters(media.RangeHLG)[0], "tin=arib-std-b67") {
+		t.Errorf("HLG tone-map = %v, want it read as HLG", toneMapFilters(media.RangeHLG))
+	}
+}
+
+// TestEncodeArgsReportProgress pins that a status-only progress feed (no
+// burn-in) still routes -progress to fd 3, unpaced, at the coarse period.
+func TestEncodeArgsReportProgress(t *testing.T) {
+	args, err := EncodeArgs(EncodeOptions{
+		PipeFormat:     "mpegts",
+		OutputFormat:   "mpegts",
+		AudioCodec:     CodecCopy,
+		ReportProgress: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := argValue(args, "-progress"); got != "pipe:3" {
+		t.Errorf("-progress = %q, want pipe:3", got)
+	}
+	if got := argValue(args, "-stats_period"); got != "1" {
+		t.Errorf("-stats_period = %q, want 1", got)
+	}
+	if hasFlag(args, "-readrate") {
+		t.Errorf("status-only progress must not pace the encode: %v", args)
+	}
+}
+
 // TestEncodeArgsSubtitlesRequireEncoder pins the guard that replaces caller
 // discipline: a copied bitstream can't carry drawtext (it needs decoded
 // frames), so this combination must fail loudly here instead of surfacing
@@ -288,6 +536,8 @@ func TestSelectEncoderFallsBackToSoftware(t *testing.T) {
 	}{
 		{media.CodecH264, "libx264"},
 		{media.CodecHEVC, "libx265"},
+		{media.CodecAV1, "libsvtav1"},
+		{media.CodecVP9, "libvpx-vp9"},
 	} {
 		enc, ok := SelectEncoder(context.Background(), "/nonexistent-ffmpeg-binary", tc.codec)
 		if !ok || enc.Name != tc.want {
@@ -298,8 +548,8 @@ func TestSelectEncoderFallsBackToSoftware(t *testing.T) {
 
 func TestSelectEncoderUnknownCodec(t *testing.T) {
 	// A codec with no registered encoder reports ok=false rather than guessing.
-	if _, ok := SelectEncoder(context.Background(), "/nonexistent-ffmpeg-binary", media.Codec("av1")); ok {
-		t.Error("SelectEncoder(av1) reported ok, but no AV1 encoder is registered")
+	if _, ok := SelectEncoder(context.Background(), "/nonexistent-ffmpeg-binary", media.Codec("vvc")); ok {
+		t.Error("SelectEncoder(vvc) reported ok, but no VVC encoder is registered")
 	}
 }
 
@@ -355,6 +605,74 @@ func TestEncodeArgsHLSOutput(t *testing.T) {
 	}
 }
 
+// TestEncodeArgsHLSLadder pins the ladder's shape: a copied top rendition and
+// encoded ones below it, each video option qualified with its own stream, one
+// audio copy per variant, and every variant in its own directory.
+func TestEncodeArgsHLSLadder(t *testing.T) {
+	src, err := url.Parse("http://example.test/in.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x264 := &Encoder{Name: "libx264", Flags: []string{"-preset", "veryfast"}}
+	args := mustEncodeArgs(t, EncodeOptions{
+		Source:       NetworkSource{URL: src, ContentType: media.MKV},
+		OutputFormat: "hls",
+		AudioCodec:   CodecCopy,
+		Renditions: []Rendition{
+			{},
+			{Encoder: x264, MaxHeight: 720, Bitrate: "1778k", Maxrate: "1778k", Bufsize: "3556k"},
+			{Encoder: x264, MaxHeight: 480, Bitrate: "790k", Maxrate: "790k", Bufsize: "1580k"},
+		},
+	})
+
+	if got := countFlag(args, "-map"); got != 6 {
+		t.Errorf("-map given %d times, want a video and audio pair per rendition", got)
+	}
+	want := map[string]string{
+		"-c:v:0":                CodecCopy,
+		"-c:v:1":                "libx264",
+		"-filter:v:1":           "scale=-2:'min(720,ih)'",
+		"-maxrate:v:2":          "790k",
+		"-force_key_frames:v:2": "source",
+		"-var_stream_map":       "v:0,a:0 v:1,a:1 v:2,a:2",
+		"-hls_segment_filename": "v%v/" + media.HLSSegmentPattern,
+	}
+	for flag, v := range want {
+		if got := argValue(args, flag); got != v {
+			t.Errorf("%s = %q, want %q", flag, got, v)
+		}
+	}
+	if got := countFlag(args, "-preset"); got != 1 {
+		t.Errorf("encoder flags given %d times, want once for the shared encoder", got)
+	}
+	if hasFlag(args, "-vf") || hasFlag(args, "-c:v") {
+		t.Error("a ladder must qualify every video option with its stream")
+	}
+	if got := args[len(args)-1]; got != "v%v/"+media.HLSPlaylistName {
+		t.Errorf("last arg = %q, want the per-variant playlist", got)
+	}
+
+	// One encoder serves every encoded rendition, and only the top may copy.
+	for name, rs := range map[string][]Rendition{
+		"two encoders": {{Encoder: x264}, {Encoder: &Encoder{Name: "h264_videotoolbox"}}},
+		"a copy below": {{Encoder: x264}, {}},
+	} {
+		if _, err := EncodeArgs(EncodeOptions{OutputFormat: "hls", AudioCodec: "aac", Renditions: rs}); err == nil {
+			t.Errorf("%s: EncodeArgs accepted the ladder", name)
+		}
+	}
+}
+
+func TestHLSMaster(t *testing.T) {
+	got := string(HLSMaster([]Rendition{{Bandwidth: 9_000_000}, {Bandwidth: 2_000_000}}))
+	want := "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=9000000\nv0/stream.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=2000000\nv1/stream.m3u8\n"
+	if got != want {
+		t.Errorf("HLSMaster =\n%s\nwant\n%s", got, want)
+	}
+}
+
 // TestEncodeArgsMP4RemuxUnpaced pins the asymmetry: a single-file network source
 // is one long GET, and its mp4 remux is fronted by the replay-from-zero server
 // (spooled), so it must NOT be paced: it should complete as fast as the link
@@ -424,6 +742,99 @@ func TestDemuxedSourceIsTwoInputs(t *testing.T) {
 	}
 }
 
+// TestPullArgsResumed pins a pull resumed partway: every input of a demuxed
+// program seeks to the resume point, and the spooled output carries on the
+// spool's clock.
+func TestPullArgsResumed(t *testing.T) {
+	video, err := url.Parse("http://example.test/video.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := url.Parse("http://example.test/audio.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := PullArgs(PullOptions{
+		Source:       NetworkSource{URL: video, AudioURL: audio, ContentType: media.HLS, Seek: time.Hour},
+		OutputOffset: time.Hour,
+	})
+	if got := countFlag(args, "-ss"); got != 2 {
+		t.Errorf("seeked %d of 2 inputs: %v", got, args)
+	}
+	if got := argValue(args, "-output_ts_offset"); got != "3600.000" {
+		t.Errorf("output offset = %q, want 3600.000", got)
+	}
+	if i := slices.Index(args, "-output_ts_offset"); i > slices.Index(args, "pipe:1") {
+		t.Errorf("the offset must apply to the spooled output: %v", args)
+	}
+}
+
+// TestPullArgsUnpaced pins a download's pull: a single file is read at wire
+// speed, a segmented source keeps its pace, and a cast's pull paces both.
+func TestPullArgsUnpaced(t *testing.T) {
+	mkv, err := url.Parse("http://example.test/movie.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hls, err := url.Parse("http://example.test/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		source  NetworkSource
+		unpaced bool
+		want    string // -readrate, "" for none
+	}{
+		{"a cast paces a file", NetworkSource{URL: mkv, ContentType: media.MKV}, false, "2.0"},
+		{"a download reads a file at wire speed", NetworkSource{URL: mkv, ContentType: media.MKV}, true, ""},
+		{"a download paces HLS", NetworkSource{URL: hls, ContentType: media.HLS}, true, "2.0"},
+		{"a download paces live", NetworkSource{URL: hls, ContentType: media.HLS, Live: true}, true, "1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := PullArgs(PullOptions{Source: tt.source, Unpaced: tt.unpaced})
+			if got := argValue(args, "-readrate"); got != tt.want {
+				t.Errorf("-readrate = %q, want %q: %v", got, tt.want, args)
+			}
+		})
+	}
+}
+
+// TestPullArgsSubtitles pins the pull's subtitle tee: the chosen track as
+// SubRip on the pipe past the PCM's, on the spool's clock when resumed.
+func TestPullArgsSubtitles(t *testing.T) {
+	src, err := url.Parse("http://example.test/movie.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		opts  PullOptions
+		pipes int
+		want  []string // the subtitle output's args
+	}{
+		{"alone", PullOptions{Subtitles: true, SubtitleTrack: 1}, 1,
+			[]string{"-map", "0:s:1", "-c:s", "srt", "-flush_packets", "1", "-f", "srt", "pipe:3"}},
+		{"beside the PCM", PullOptions{PCM: true, PCMSampleRate: 16000, Subtitles: true}, 2,
+			[]string{"-map", "0:s:0", "-c:s", "srt", "-flush_packets", "1", "-f", "srt", "pipe:4"}},
+		{"resumed", PullOptions{Subtitles: true, OutputOffset: time.Minute}, 1,
+			[]string{"-map", "0:s:0", "-c:s", "srt", "-output_ts_offset", "60.000", "-flush_packets", "1", "-f", "srt", "pipe:3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Source = NetworkSource{URL: src, ContentType: media.MKV}
+			args := PullArgs(tt.opts)
+			if got := args[len(args)-len(tt.want):]; !slices.Equal(got, tt.want) {
+				t.Errorf("subtitle output = %v, want %v", got, tt.want)
+			}
+			if got := tt.opts.Pipes(); got != tt.pipes {
+				t.Errorf("Pipes() = %d, want %d", got, tt.pipes)
+			}
+		})
+	}
+}
+
 // TestMuxedSourceStaysOneInput is the other half: an ordinary source opens once
 // and keeps mapping its own audio track.
 func TestMuxedSourceStaysOneInput(t *testing.T) {
@@ -441,6 +852,30 @@ func TestMuxedSourceStaysOneInput(t *testing.T) {
 	}
 }
 
+// TestAudioTrackMapped covers a source played in an audio track other than its
+// first: every reader maps that track, so the pull spools it, the remux and a
+// file encode serve it, and whisper hears it.
+func TestAudioTrackMapped(t *testing.T) {
+	src, err := url.Parse("http://example.test/movie.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := NetworkSource{URL: src, ContentType: media.MKV, AudioTrack: 2}
+
+	pull := PullArgs(PullOptions{Source: source, PCM: true, PCMSampleRate: 16000})
+	if got := countFlag(pull, "0:a:2"); got != 2 {
+		t.Errorf("pull mapped the chosen track into %d of 2 outputs: %v", got, pull)
+	}
+	for name, args := range map[string][]string{
+		"remux": mustEncodeArgs(t, EncodeOptions{Source: source, OutputFormat: "mp4", AudioCodec: CodecCopy}),
+		"file":  mustEncodeArgs(t, EncodeOptions{InputFile: "/media/movie.mkv", AudioTrack: 2, OutputFormat: "mp4", AudioCodec: CodecCopy}),
+	} {
+		if got := argValue(args, "-map"); got != "0:a:2" {
+			t.Errorf("%s audio map = %q, want 0:a:2", name, got)
+		}
+	}
+}
+
 // inputURLs returns the value of every -i in order.
 func inputURLs(args []string) []string {
 	var inputs []string
@@ -504,6 +939,43 @@ func TestNetworkReadersShareInputPolicy(t *testing.T) {
 	}
 }
 
+// TestSubtitleArgs pins the source-subtitle read: the chosen track of one
+// input only, fetched with the network readers' headers but unpaced, and
+// converted to SubRip on stdout.
+func TestSubtitleArgs(t *testing.T) {
+	video, err := url.Parse("http://example.test/movie.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := url.Parse("http://example.test/audio.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := SubtitleArgs(NetworkSource{
+		URL:         video,
+		AudioURL:    audio,
+		Headers:     http.Header{"Referer": {"https://player.example/"}},
+		ContentType: media.MKV,
+		RWTimeout:   30 * time.Second,
+	}, 2)
+
+	if got := inputURLs(args); !slices.Equal(got, []string{video.String()}) {
+		t.Errorf("inputs = %v, want only the stream's own URL", got)
+	}
+	if got := argValue(args, "-map"); got != "0:s:2" {
+		t.Errorf("map = %q, want 0:s:2", got)
+	}
+	if !hasFlag(args, "-headers") || !hasFlag(args, "-reconnect") {
+		t.Errorf("subtitle read must fetch like the other network readers: %v", args)
+	}
+	if hasFlag(args, "-readrate") {
+		t.Errorf("subtitle read must not be paced: %v", args)
+	}
+	if got := args[len(args)-3:]; !slices.Equal(got, []string{"-f", "srt", "pipe:1"}) {
+		t.Errorf("output = %v, want SubRip on stdout", got)
+	}
+}
+
 // TestEncodeArgsHLSSourcePaced pins the other half of that rule: an HLS source is
 // fetched segment by segment from a rate-limiting CDN, so even the replay-spooled
 // mp4 remux paces its upstream read exactly like the puller does, rather than
@@ -542,3 +1014,24 @@ func TestEncodeArgsHLSSourcePaced(t *testing.T) {
 		t.Errorf("live burst = %q, want %q", got, pacingLive.burst)
 	}
 }
+
+func TestRecordArgs(t *testing.T) {
+	args := RecordArgs(RecordOptions{Input: "spool.ts", Muxer: "mpegts", Output: "out.ts"})
+	if got := inputURLs(args); !slices.Equal(got, []string{"spool.ts"}) {
+		t.Errorf("inputs = %v, want the spool alone", got)
+	}
+	if argValue(args, "-c") != CodecCopy || hasFlag(args, "-c:s") {
+		t.Errorf("a recording without subtitles stream-copies everything: %v", args)
+	}
+	if args[len(args)-1] != "out.ts" || argValue(args, "-f") != "mpegts" {
+		t.Errorf("output = %v", args)
+	}
+
+	args = RecordArgs(RecordOptions{Input: "spool.ts", Subtitles: "subs.srt", Muxer: "matroska", Output: "out.mkv"})
+	if got := inputURLs(args); !slices.Equal(got, []string{"spool.ts", "subs.srt"}) {
+		t.Errorf("inputs = %v, want the spool then the subtitles", got)
+	}
+	if countFlag(args, "-map") != 3 || argValue(args, "-c:s") != "srt" {
+		t.Errorf("subtitles should be mapped in as an srt track: %v", args)
+	}
+}
@@ -24,6 +24,12 @@ type Encoder struct {
 	InitArgs []string    // emitted before the input: hardware device setup
 	Filters  []string    // appended to the -vf chain: e.g. the GPU upload
 	Flags    []string    // encoder-specific -c:v flags: preset, pix_fmt, GOP
+
+	// ToneMapFilters, when set, replace Filters on an encode that tone-maps
+	// an HDR source (see EncodeOptions.ToneMap), doing the tone-map on the
+	// GPU the frames are uploaded to anyway. An encoder without them, or
+	// whose GPU fails their own test encode, tone-maps on the CPU instead.
+	ToneMapFilters []string
 }
 
 const vaapiRenderNode = "/dev/dri/renderD128"
@@ -37,10 +43,17 @@ const vaapiRenderNode = "/dev/dri/renderD128"
 // it must not carry -pix_fmt (its encoder input is a GPU surface).
 var (
 	// veryfast keeps the software encoders ahead of realtime in the live pipeline.
-	softwareFlags     = []string{"-preset", "veryfast", "-pix_fmt", "yuv420p"}
+	softwareFlags = []string{"-preset", "veryfast", "-pix_fmt", "yuv420p"}
+	// SVT-AV1 and libvpx have presets of their own: SVT-AV1's 10 and libvpx's
+	// realtime deadline at cpu-used 8 are their fastest usable settings.
+	svtAV1Flags       = []string{"-preset", "10", "-pix_fmt", "yuv420p"}
+	vpxVP9Flags       = []string{"-deadline", "realtime", "-cpu-used", "8", "-row-mt", "1", "-pix_fmt", "yuv420p"}
 	videotoolboxFlags = []string{"-pix_fmt", "yuv420p", "-g", "600"}
 	vaapiInit         = []string{"-init_hw_device", "vaapi=va:" + vaapiRenderNode, "-filter_hw_device", "va"}
 	vaapiFilters      = []string{"format=nv12", "hwupload"}
+	// vaapiToneMap uploads the 10-bit frames as they are and has the GPU
+	// tone-map them to 8-bit BT.709, the surface format vaapiFilters uploads.
+	vaapiToneMap = []string{"format=p010", "hwupload", "tonemap_vaapi=format=nv12:p=bt709:t=bt709:m=bt709"}
 )
 
 // The encoders. Platform is not assumed: every backend is a candidate, and
@@ -54,8 +67,15 @@ var (
 	h264VideoToolbox = Encoder{Name: "h264_videotoolbox", Codec: media.CodecH264, Hardware: true, Flags: videotoolboxFlags}
 	hevcVideoToolbox = Encoder{Name: "hevc_videotoolbox", Codec: media.CodecHEVC, Hardware: true, Flags: videotoolboxFlags}
 
-	h264VAAPI = Encoder{Name: "h264_vaapi", Codec: media.CodecH264, Hardware: true, InitArgs: vaapiInit, Filters: vaapiFilters}
-	hevcVAAPI = Encoder{Name: "hevc_vaapi", Codec: media.CodecHEVC, Hardware: true, InitArgs: vaapiInit, Filters: vaapiFilters}
+	h264VAAPI = Encoder{Name: "h264_vaapi", Codec: media.CodecH264, Hardware: true, InitArgs: vaapiInit, Filters: vaapiFilters, ToneMapFilters: vaapiToneMap}
+	hevcVAAPI = Encoder{Name: "hevc_vaapi", Codec: media.CodecHEVC, Hardware: true, InitArgs: vaapiInit, Filters: vaapiFilters, ToneMapFilters: vaapiToneMap}
+
+	// VideoToolbox has no AV1 or VP9 encoder, so VA-API is the only hardware
+	// for them.
+	libsvtav1 = Encoder{Name: "libsvtav1", Codec: media.CodecAV1, Flags: svtAV1Flags}
+	libvpxVP9 = Encoder{Name: "libvpx-vp9", Codec: media.CodecVP9, Flags: vpxVP9Flags}
+	av1VAAPI  = Encoder{Name: "av1_vaapi", Codec: media.CodecAV1, Hardware: true, InitArgs: vaapiInit, Filters: vaapiFilters, ToneMapFilters: vaapiToneMap}
+	vp9VAAPI  = Encoder{Name: "vp9_vaapi", Codec: media.CodecVP9, Hardware: true, InitArgs: vaapiInit, Filters: vaapiFilters, ToneMapFilters: vaapiToneMap}
 )
 
 // registry lists every encoder, grouped by codec with hardware candidates ahead
@@ -64,16 +84,25 @@ var (
 var registry = []Encoder{
 	h264VideoToolbox, h264VAAPI, libx264,
 	hevcVideoToolbox, hevcVAAPI, libx265,
+	av1VAAPI, libsvtav1,
+	vp9VAAPI, libvpxVP9,
 }
 
 // SelectEncoder returns the best working encoder for codec on this host: a
 // hardware encoder whose real test encode passes, otherwise the software
-// baseline. ok is false only for a codec with no registered encoder at all;
-// availability is cached, so repeat calls are cheap.
+// baseline. A hardware encoder's GPU tone-map is proven the same way, and
+// dropped (leaving the tone-map to the CPU) when it fails: tonemap_vaapi, for
+// one, needs a driver that implements HDR-to-SDR conversion, which plenty of
+// VA-API GPUs that encode fine lack. ok is false only for a codec with no
+// registered encoder at all; availability is cached, so repeat calls are
+// cheap.
 func SelectEncoder(ctx context.Context, ffmpegPath string, codec media.Codec) (enc Encoder, ok bool) {
 	for _, e := range registry {
 		if e.Codec == codec && e.Hardware && available(ctx, ffmpegPath, e) {
-			slog.InfoContext(ctx, "hardware encoder selected", "encoder", e.Name, "codec", string(codec))
+			if len(e.ToneMapFilters) > 0 && !gpuToneMaps(ctx, ffmpegPath, e) {
+				e.ToneMapFilters = nil
+			}
+			slog.InfoContext(ctx, "hardware encoder selected", "encoder", e.Name, "codec", string(codec), "gpu_tonemap", len(e.ToneMapFilters) > 0)
 			return e, true
 		}
 	}
@@ -86,39 +115,91 @@ func SelectEncoder(ctx context.Context, ffmpegPath string, codec media.Codec) (e
 	return Encoder{}, false
 }
 
-// availability caches each encoder's test-encode result for the process: a
-// working GPU is proven once, and a wedged one isn't retried per cast.
+// WarmEncoders runs every hardware encoder's test encode now, so a
+// long-running process pays the probe once at startup instead of on its first
+// cast's copy-vs-encode decision. Results land in the same cache SelectEncoder
+// reads.
+func WarmEncoders(ctx context.Context, ffmpegPath string) {
+	for _, e := range registry {
+		if e.Hardware && available(ctx, ffmpegPath, e) && len(e.ToneMapFilters) > 0 {
+			gpuToneMaps(ctx, ffmpegPath, e)
+		}
+	}
+}
+
+// hdrTestSource tags the test pattern as the 10-bit BT.2020 PQ frames an HDR10
+// source decodes to, so a tone-map under test has HDR to convert.
+const hdrTestSource = "format=yuv420p10le,setparams=color_trc=smpte2084:color_primaries=bt2020:colorspace=bt2020nc"
+
+// CanToneMap reports whether this ffmpeg has the zscale filter the CPU
+// tone-map (see toneMapFilters) is built on: it comes from the optional zimg
+// library, which not every build links. It is proven like an encoder, by a
+// real run through the chain, and cached for the process.
+func CanToneMap(ctx context.Context, ffmpegPath string) bool {
+	return proven("zscale", func() bool {
+		ok := testEncode(ctx, ffmpegPath, nil, slices.Concat([]string{hdrTestSource}, toneMapFilters(media.RangeHDR10)), "rawvideo")
+		if !ok {
+			slog.WarnContext(ctx, "ffmpeg has no zscale filter; HDR sources will encode washed out")
+		}
+		return ok
+	})
+}
+
+// availability caches each test-encode result for the process: a working GPU
+// is proven once, and a wedged one isn't retried per cast.
 var (
 	availMu    sync.Mutex
 	availCache = map[string]bool{}
 )
 
-func available(ctx context.Context, ffmpegPath string, e Encoder) bool {
+// proven returns the cached result of the test named key, running test for it
+// the first time.
+func proven(key string, test func() bool) bool {
 	availMu.Lock()
 	defer availMu.Unlock()
-	if v, cached := availCache[e.Name]; cached {
+	if v, cached := availCache[key]; cached {
 		return v
 	}
-	ok := testEncode(ctx, ffmpegPath, e)
-	availCache[e.Name] = ok
-	if !ok {
-		slog.InfoContext(ctx, "hardware encoder unavailable; falling back to software", "encoder", e.Name)
-	}
+	ok := test()
+	availCache[key] = ok
 	return ok
 }
 
-// testEncode reports whether a one-frame encode through e exits cleanly, the
-// only reliable proof a listed encoder truly works on the hardware here
-// (h264_vaapi is listed on any VA-API build regardless of the GPU). It reuses
-// e's own device setup and filters so the probe matches the real command.
-func testEncode(ctx context.Context, ffmpegPath string, e Encoder) bool {
+func available(ctx context.Context, ffmpegPath string, e Encoder) bool {
+	return proven(e.Name, func() bool {
+		ok := testEncode(ctx, ffmpegPath, e.InitArgs, e.Filters, e.Name)
+		if !ok {
+			slog.InfoContext(ctx, "hardware encoder unavailable; falling back to software", "encoder", e.Name)
+		}
+		return ok
+	})
+}
+
+// gpuToneMaps reports whether e's ToneMapFilters run on this host's GPU, fed
+// the 10-bit PQ frames they exist for.
+func gpuToneMaps(ctx context.Context, ffmpegPath string, e Encoder) bool {
+	return proven(e.Name+"/tonemap", func() bool {
+		ok := testEncode(ctx, ffmpegPath, e.InitArgs, slices.Concat([]string{hdrTestSource}, e.ToneMapFilters), e.Name)
+		if !ok {
+			slog.InfoContext(ctx, "GPU tone-map unavailable; tone-mapping on the CPU", "encoder", e.Name)
+		}
+		return ok
+	})
+}
+
+// testEncode reports whether a one-frame encode to codec through filters exits
+// cleanly, the only reliable proof a listed encoder truly works on the
+// hardware here (h264_vaapi is listed on any VA-API build regardless of the
+// GPU). Callers pass an encoder's own device setup and filters so the probe
+// matches the real command.
+func testEncode(ctx context.Context, ffmpegPath string, initArgs, filters []string, codec string) bool {
 	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
-	args := append([]string{"-hide_banner"}, e.InitArgs...)
+	args := append([]string{"-hide_banner"}, initArgs...)
 	args = append(args, "-f", "lavfi", "-i", "testsrc2=size=256x144:rate=25:duration=0.1")
-	if len(e.Filters) > 0 {
-		args = append(args, "-vf", strings.Join(e.Filters, ","))
+	if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
 	}
-	args = append(args, "-c:v", e.Name, "-f", "null", "-")
+	args = append(args, "-c:v", codec, "-f", "null", "-")
 	return exec.CommandContext(ctx, ffmpegPath, args...).Run() == nil
 }
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/stupside/castor/internal/media"
 )
@@ -15,9 +17,21 @@ import (
 // safe to point at a still-growing spool: ffprobe reads from the start, analyses
 // the leading packets, and returns.
 func ProbeFile(ctx context.Context, ffprobePath, path string) (media.ProbeInfo, error) {
-	return probe(ctx, ffprobePath, path, nil)
+	return probe(ctx, ffprobePath, path, nil, firstTrack)
 }
 
+// ProbeFileAudio probes a local file as ProbeFile does, describing the audio
+// track pick chooses from the languages of the file's audio tracks (in order,
+// "" for an untagged one) rather than the first. pick returning an index out of
+// range describes the first.
+func ProbeFileAudio(ctx context.Context, ffprobePath, path string, pick func(languages []string) int) (media.ProbeInfo, error) {
+	return probe(ctx, ffprobePath, path, nil, pick)
+}
+
+// firstTrack is the audio pick of a probe with no preference: the first track,
+// the one ffmpeg and every renderer play by default.
+func firstTrack([]string) int { return 0 }
+
 // ProbeSource probes an upstream over the network. It opens the source exactly
 // as the reader that follows it will (same request headers, same
 // container-specific input flags), so it cannot fail where the read would
@@ -32,12 +46,16 @@ func ProbeSource(ctx context.Context, ffprobePath string, src NetworkSource) (me
 	inputArgs := media.HeaderArgs(src.Headers)
 	inputArgs = append(inputArgs, containerInputArgs(src.ContentType)...)
 
-	info, err := probe(ctx, ffprobePath, src.URL.String(), inputArgs)
+	track := func([]string) int { return src.AudioTrack }
+	if src.AudioURL != nil {
+		track = firstTrack
+	}
+	info, err := probe(ctx, ffprobePath, src.URL.String(), inputArgs, track)
 	if err != nil || src.AudioURL == nil {
 		return info, err
 	}
 
-	audio, err := probe(ctx, ffprobePath, src.AudioURL.String(), inputArgs)
+	audio, err := probe(ctx, ffprobePath, src.AudioURL.String(), inputArgs, firstTrack)
 	if err != nil {
 		// The video half still decides the video axis; the caller degrades the
 		// audio one on the zero value it is left with.
@@ -50,12 +68,14 @@ func ProbeSource(ctx context.Context, ffprobePath string, src NetworkSource) (me
 // probe runs ffprobe against input and maps its JSON to the domain ProbeInfo.
 // inputArgs are the flags an input needs to be opened at all (headers, container
 // leniency); everything the decision layer reads is in the -show_entries list.
-func probe(ctx context.Context, ffprobePath, input string, inputArgs []string) (media.ProbeInfo, error) {
+// pick chooses the audio track the info describes from the tracks' languages.
+func probe(ctx context.Context, ffprobePath, input string, inputArgs []string, pick func(languages []string) int) (media.ProbeInfo, error) {
 	args := []string{
 		"-v", "error",
 		"-print_format", "json",
 		"-show_entries",
-		"stream=codec_type,codec_name,profile,height,pix_fmt,color_transfer,channels",
+		"stream=codec_type,codec_name,profile,height,pix_fmt,color_transfer,channels:" +
+			"stream_tags=language:stream_side_data=side_data_type,dv_profile,dv_bl_signal_compatibility_id:format=duration,bit_rate",
 	}
 	args = append(args, inputArgs...)
 	args = append(args, input)
@@ -78,13 +98,39 @@ func probe(ctx context.Context, ffprobePath, input string, inputArgs []string) (
 			PixFmt        string `json:"pix_fmt"`
 			ColorTransfer string `json:"color_transfer"`
 			Channels      int    `json:"channels"`
+			SideData      []struct {
+				Type      string `json:"side_data_type"`
+				DVProfile int    `json:"dv_profile"`
+				DVCompat  int    `json:"dv_bl_signal_compatibility_id"`
+			} `json:"side_data_list"`
+			Tags struct {
+				Language string `json:"language"`
+			} `json:"tags"`
 		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+			BitRate  string `json:"bit_rate"`
+		} `json:"format"`
 	}
 	if err := json.Unmarshal(out, &result); err != nil {
 		return media.ProbeInfo{}, fmt.Errorf("parsing ffprobe output: %w", err)
 	}
 
 	var info media.ProbeInfo
+	if secs, err := strconv.ParseFloat(result.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(secs * float64(time.Second))
+	}
+	if rate, err := strconv.ParseInt(result.Format.BitRate, 10, 64); err == nil {
+		info.BitRate = rate
+	}
+	type audioTrack struct {
+		codec    media.Codec
+		channels int
+	}
+	var (
+		tracks    []audioTrack
+		languages []string
+	)
 	for _, s := range result.Streams {
 		switch s.CodecType {
 		case "video":
@@ -97,17 +143,33 @@ func probe(ctx context.Context, ffprobePath, input string, inputArgs []string) (
 			info.VideoProfile = s.Profile
 			info.VideoHeight = s.Height
 			info.VideoBitDepth = pixFmtBitDepth(s.PixFmt)
-			info.VideoHDR = isHDRTransfer(s.ColorTransfer)
-		case "audio":
-			// Keep the first audio track (the default the pull maps as 0:a:0),
-			// ignoring later alternates/commentary.
-			if info.AudioCodec != "" {
-				continue
+			info.VideoRange = transferRange(s.ColorTransfer)
+			for _, sd := range s.SideData {
+				if sd.Type != dvConfigRecord {
+					continue
+				}
+				info.VideoDVProfile = sd.DVProfile
+				// Compatibility id 0 (profile 5) has no base layer anything
+				// but a Dolby Vision decoder shows right.
+				if sd.DVCompat == 0 {
+					info.VideoRange = media.RangeDolbyVision
+				}
 			}
-			info.AudioCodec = media.Codec(s.CodecName)
-			info.AudioChannels = s.Channels
+		case "audio":
+			tracks = append(tracks, audioTrack{media.Codec(s.CodecName), s.Channels})
+			languages = append(languages, s.Tags.Language)
 		}
 	}
+	// Describe the one track the reads that follow map (the first, the
+	// default, unless pick chose another), ignoring the other alternates and
+	// commentary.
+	if len(tracks) > 0 {
+		if i := pick(languages); i > 0 && i < len(tracks) {
+			info.AudioTrack = i
+		}
+		t := tracks[info.AudioTrack]
+		info.AudioCodec, info.AudioChannels = t.codec, t.channels
+	}
 	return info, nil
 }
 
@@ -127,12 +189,20 @@ func pixFmtBitDepth(pixFmt string) int {
 	}
 }
 
-// isHDRTransfer reports whether an ffprobe color_transfer names an HDR curve.
-func isHDRTransfer(transfer string) bool {
+// dvConfigRecord is the side_data_type ffprobe reports a Dolby Vision
+// stream's configuration record under.
+const dvConfigRecord = "DOVI configuration record"
+
+// transferRange maps an ffprobe color_transfer to the dynamic range it is the
+// curve of: PQ is HDR10, HLG is HLG, and anything else (BT.709, or no tag at
+// all) is SDR.
+func transferRange(transfer string) media.DynamicRange {
 	switch transfer {
-	case "smpte2084", "arib-std-b67":
-		return true
+	case "smpte2084":
+		return media.RangeHDR10
+	case "arib-std-b67":
+		return media.RangeHLG
 	default:
-		return false
+		return media.RangeSDR
 	}
 }
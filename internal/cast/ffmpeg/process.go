@@ -11,6 +11,7 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
 	"sync"
 )
 
@@ -28,15 +29,19 @@ type Process struct {
 	// Extra is the fd-3 output (pipe:3) when started WithExtraPipe;
 	// nil otherwise.
 	Extra io.ReadCloser
+	// Extras are the outputs on fd 3 onwards (pipe:3, pipe:4, ...) when
+	// started WithExtraPipes, Extra being the first.
+	Extras []io.ReadCloser
 
 	cmd  *exec.Cmd
 	tail *ringTail
 }
 
 type startConfig struct {
-	stdin     io.Reader
-	extraPipe bool
-	workDir   string
+	stdin      io.Reader
+	extraPipes int
+	workDir    string
+	onStderr   func(line string)
 }
 
 type StartOption func(*startConfig)
@@ -54,8 +59,18 @@ func WithWorkDir(dir string) StartOption {
 
 // WithExtraPipe opens a second output pipe on fd 3 (pipe:3), exposed as
 // Process.Extra. The arg builder must route an output there.
-func WithExtraPipe() StartOption {
-	return func(c *startConfig) { c.extraPipe = true }
+func WithExtraPipe() StartOption { return WithExtraPipes(1) }
+
+// WithExtraPipes opens n output pipes past stdout, on fd 3 onwards, exposed
+// in order as Process.Extras. The arg builder must route an output to each.
+func WithExtraPipes(n int) StartOption {
+	return func(c *startConfig) { c.extraPipes = n }
+}
+
+// WithStderrWatch calls fn with every stderr line as it arrives, for a caller
+// that reacts to an event ffmpeg only reports there (a reconnect, say).
+func WithStderrWatch(fn func(line string)) StartOption {
+	return func(c *startConfig) { c.onStderr = fn }
 }
 
 // Start launches ffmpeg at path with args. The process is killed when ctx is
@@ -70,24 +85,21 @@ func Start(ctx context.Context, path string, args []string, opts ...StartOption)
 	cmd.Stdin = cfg.stdin
 	cmd.Dir = cfg.workDir
 
-	var extraRead, extraWrite *os.File
-	if cfg.extraPipe {
-		var err error
-		extraRead, extraWrite, err = os.Pipe()
-		if err != nil {
-			return nil, fmt.Errorf("extra output pipe: %w", err)
-		}
-		cmd.ExtraFiles = []*os.File{extraWrite} // fd 3 in the child
-	}
-
+	var extraRead, extraWrite []*os.File
 	closeExtra := func() {
-		if extraRead != nil {
-			_ = extraRead.Close()
+		for _, f := range slices.Concat(extraRead, extraWrite) {
+			_ = f.Close()
 		}
-		if extraWrite != nil {
-			_ = extraWrite.Close()
+	}
+	for range cfg.extraPipes {
+		r, w, err := os.Pipe()
+		if err != nil {
+			closeExtra()
+			return nil, fmt.Errorf("extra output pipe: %w", err)
 		}
+		extraRead, extraWrite = append(extraRead, r), append(extraWrite, w)
 	}
+	cmd.ExtraFiles = extraWrite // fd 3 onwards in the child
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -103,17 +115,20 @@ func Start(ctx context.Context, path string, args []string, opts ...StartOption)
 		closeExtra()
 		return nil, fmt.Errorf("starting ffmpeg: %w", err)
 	}
-	// Close our copy of the write end so Extra sees EOF on ffmpeg exit.
-	if extraWrite != nil {
-		_ = extraWrite.Close()
+	// Close our copy of the write ends so Extras see EOF on ffmpeg exit.
+	for _, w := range extraWrite {
+		_ = w.Close()
 	}
 
 	tail := newTail(stderrTailCapacity)
-	go drainStderr(ctx, stderr, tail)
+	go drainStderr(ctx, stderr, tail, cfg.onStderr)
 
 	p := &Process{Stdout: stdout, cmd: cmd, tail: tail}
-	if extraRead != nil {
-		p.Extra = extraRead
+	for _, r := range extraRead {
+		p.Extras = append(p.Extras, r)
+	}
+	if len(p.Extras) > 0 {
+		p.Extra = p.Extras[0]
 	}
 	return p, nil
 }
@@ -150,14 +165,17 @@ func (p *Process) LogStderrTail(ctx context.Context, msg string) {
 	}
 }
 
-// drainStderr reads stderr line-by-line, logging each at DEBUG and retaining
-// the tail for surfacing on failure.
-func drainStderr(ctx context.Context, r io.Reader, tail *ringTail) {
+// drainStderr reads stderr line-by-line, logging each at DEBUG, retaining the
+// tail for surfacing on failure, and handing each to watch when set.
+func drainStderr(ctx context.Context, r io.Reader, tail *ringTail, watch func(string)) {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
 		tail.push(line)
 		slog.DebugContext(ctx, "ffmpeg", "line", line)
+		if watch != nil {
+			watch(line)
+		}
 	}
 	if err := scanner.Err(); err != nil {
 		slog.WarnContext(ctx, "ffmpeg stderr scanner error", "error", err)
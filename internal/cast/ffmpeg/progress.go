@@ -7,30 +7,45 @@ import (
 	"strings"
 )
 
+// Progress is one -progress report block: the encoder's output position and
+// how fast it is running relative to realtime (1.0 is realtime, 0 means ffmpeg
+// has not reported a speed yet).
+type Progress struct {
+	Seconds float64
+	Speed   float64
+}
+
 // WatchProgress parses ffmpeg's -progress key=value stream from r and calls
-// fn with the encoder's output position in seconds after each progress
-// block. It returns when r is exhausted (ffmpeg exited).
+// fn with the accumulated report after each progress block. It returns when
+// r is exhausted (ffmpeg exited).
 //
-// Only out_time_us is trusted: out_time_ms famously also contains
-// microseconds (long-standing ffmpeg misnomer), and out_time needs string
-// parsing for no benefit.
-func WatchProgress(r io.Reader, fn func(seconds float64)) {
+// Only out_time_us is trusted for the position: out_time_ms famously also
+// contains microseconds (long-standing ffmpeg misnomer), and out_time needs
+// string parsing for no benefit. speed arrives as "1.01x", or "N/A" before the
+// first frame, which leaves the previous value in place.
+func WatchProgress(r io.Reader, fn func(Progress)) {
 	scanner := bufio.NewScanner(r)
 	var outTimeUs int64
+	var speed float64
 	for scanner.Scan() {
 		line := scanner.Text()
 		key, value, ok := strings.Cut(line, "=")
 		if !ok {
 			continue
 		}
+		value = strings.TrimSpace(value)
 		switch key {
 		case "out_time_us":
-			if v, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
 				outTimeUs = v
 			}
+		case "speed":
+			if v, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				speed = v
+			}
 		case "progress":
-			// End of one report block — emit the position we accumulated.
-			fn(float64(outTimeUs) / 1e6)
+			// End of one report block — emit what we accumulated.
+			fn(Progress{Seconds: float64(outTimeUs) / 1e6, Speed: speed})
 		}
 	}
 }
@@ -0,0 +1,38 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWatchProgress(t *testing.T) {
+	feed := strings.Join([]string{
+		"out_time_us=N/A",
+		"speed=N/A",
+		"progress=continue",
+		"out_time_us=1500000",
+		"out_time_ms=1500000",
+		"speed=1.02x",
+		"progress=continue",
+		"out_time_us=2500000",
+		"speed=N/A",
+		"progress=end",
+	}, "\n")
+
+	var got []Progress
+	WatchProgress(strings.NewReader(feed), func(p Progress) { got = append(got, p) })
+
+	want := []Progress{
+		{Seconds: 0, Speed: 0},
+		{Seconds: 1.5, Speed: 1.02},
+		{Seconds: 2.5, Speed: 1.02}, // an N/A speed keeps the last reading
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d reports, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("report %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
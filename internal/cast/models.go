@@ -0,0 +1,35 @@
+package cast
+
+import (
+	"context"
+
+	"github.com/stupside/castor/internal/cast/subtitle/models"
+)
+
+// Model is a whisper or VAD model of the catalog castor downloads, checks and
+// loads for transcription.
+type Model = models.Model
+
+// VADModel names the voice activity detection model every transcriber loads.
+const VADModel = models.VAD
+
+// Models is the model catalog, whisper's models then the VAD one.
+func Models() []Model { return models.Catalog }
+
+// LookupModel returns the catalog model called name.
+func LookupModel(name string) (Model, error) { return models.Lookup(name) }
+
+// WhisperModel is the model a transcriber under cfg loads, resolved as
+// whisper.model says, or ok false when whisper.model_path names a file of the
+// user's own in its place.
+func WhisperModel(cfg WhisperConfig) (m Model, ok bool, err error) {
+	if cfg.ModelPath != "" {
+		return Model{}, false, nil
+	}
+	m, err = models.Whisper(cfg.Model, cfg.Multilingual())
+	return m, err == nil, err
+}
+
+// PullModel downloads m into the user cache, resuming an interrupted
+// download, and verifies it. It returns the model's path.
+func PullModel(ctx context.Context, m Model) (string, error) { return models.Pull(ctx, m) }
@@ -0,0 +1,205 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/stupside/castor/internal/cast/cache"
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
+	"github.com/stupside/castor/internal/cast/deliver/spool"
+	"github.com/stupside/castor/internal/device"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/source/resolve"
+)
+
+// cacheUse is what a served cast makes of its title's cached spool.
+type cacheUse int
+
+const (
+	// cacheMiss pulls the source afresh, into the entry when there is one.
+	cacheMiss cacheUse = iota
+	// cacheComplete plays the whole title from the entry: nothing is pulled.
+	cacheComplete
+	// cachePartial plays what the entry holds while the pull carries on from
+	// where it ends.
+	cachePartial
+)
+
+func (u cacheUse) String() string {
+	switch u {
+	case cacheComplete:
+		return "complete"
+	case cachePartial:
+		return "partial"
+	}
+	return "miss"
+}
+
+// reuse decides what a cast of source under prefs makes of meta, a cached
+// entry of its title. transcript is the whisper transcript the cast burns in
+// (see wantedTranscript), "" for none. An entry pulled under other audio
+// languages, or from an HLS variant picked under another height ceiling, holds
+// a spool the cast would not have chosen, a dub in place of the original, say,
+// and is not used. Otherwise a complete spool plays as it is, unless the cast
+// burns in subtitles and the entry has no whole transcript of it, or one
+// whisper made another way. A partial one is carried on only without subtitles
+// (its cues stop where the earlier cast's transcription did, and the audio
+// before that is not fed again) and only from the same host, variant and audio
+// track: the spliced pull must continue the same encode. stale reports that
+// source is the one meta names and too old to read again, which it takes a
+// refresh to carry on past.
+func reuse(meta cache.Meta, source *media.Stream, prefs resolve.Config, stale bool, transcript string, canRefresh bool) cacheUse {
+	if !sameLanguages(meta.Source.AudioLanguages, prefs.AudioLanguages) ||
+		(meta.Source.Variant != (media.Variant{}) && meta.Source.MaxHeight != prefs.MaxHeight) {
+		return cacheMiss
+	}
+	wantCues := transcript != ""
+	if meta.Complete {
+		if !wantCues || (meta.Transcribed && meta.Whisper == transcript) {
+			return cacheComplete
+		}
+		return cacheMiss
+	}
+	if wantCues || (stale && !canRefresh) {
+		return cacheMiss
+	}
+	cached, err := meta.Source.Stream()
+	if err != nil || cached.URL.Host != source.URL.Host || cached.Variant != source.Variant || cached.AudioTrack != source.AudioTrack {
+		return cacheMiss
+	}
+	return cachePartial
+}
+
+// sameLanguages reports whether a and b list the same language preferences in
+// the same order, as written (case aside).
+func sameLanguages(a, b []string) bool {
+	return slices.EqualFunc(a, b, strings.EqualFold)
+}
+
+// sourceOf is the cache.Source of stream, resolved under cfg's preferences.
+func sourceOf(stream *media.Stream, cfg core.Config) cache.Source {
+	s := cache.SourceOf(stream)
+	s.AudioLanguages = cfg.Resolver.AudioLanguages
+	s.SubtitleLanguages = cfg.Resolver.SubtitleLanguages
+	s.MaxHeight = cfg.Resolver.MaxHeight
+	return s
+}
+
+// wantedTranscript is the whisper transcript a cast of source under plan and
+// cfg burns in (see subtitle.Whisper.Transcript), "" when it burns in none.
+// A transcript is the only kind of cues an entry keeps: a source's own
+// subtitle track is read from the source again on every cast, and a viewer's
+// file is brought to each.
+func wantedTranscript(plan core.Plan, source *media.Stream, cfg core.Config) string {
+	if plan.Subtitle != core.SubtitleBurnIn || source.Subtitle != nil || cfg.Subtitles.Set() {
+		return ""
+	}
+	return cfg.Whisper.Transcript()
+}
+
+// cacheEntry acquires source's entry in the spool cache, under key or else
+// the source URL's, nil when the cast is not to be cached: the cache is off,
+// the spool is bounded (a ring keeps no title whole), the source is live (it
+// has no end for a pull to reach), or another cast holds the entry.
+func cacheEntry(ctx context.Context, cfg core.Config, source *media.Stream, key string) *cache.Entry {
+	if !cfg.Cache.Enabled() || source.Live {
+		return nil
+	}
+	if cfg.Spool.Quota() != (spool.Quota{}) {
+		slog.InfoContext(ctx, "not caching this cast: the spool quota keeps no title whole")
+		return nil
+	}
+	c, err := cache.Open(cfg.Cache)
+	if err != nil {
+		slog.WarnContext(ctx, "spool cache unavailable; casting uncached", "error", err)
+		return nil
+	}
+	key = cmp.Or(key, cache.SourceKey(source.URL))
+	entry, err := c.Acquire(key)
+	if err != nil {
+		slog.WarnContext(ctx, "not caching this cast", "key", key, "error", err)
+		return nil
+	}
+	return entry
+}
+
+// Cached returns the source the spool cache holds key's title from, when a
+// cast of it to cfg's device would play from the cache: the device is served
+// a spool, and the entry is one reuse takes, with canRefresh reporting
+// whether the cast can extract its source afresh to carry a partial pull on.
+// A cast of the stream returned, given key, plays from the cache with no
+// source to extract or resolve first, so an entry whose source was resolved
+// under other subtitle languages is not used either: the subtitle track it
+// names is not the one cfg asks for.
+func Cached(cfg core.Config, key string, canRefresh bool) (*media.Stream, bool) {
+	if device.SelfFetches(cfg.Device.Type) || !cfg.Cache.Enabled() || cfg.Spool.Quota() != (spool.Quota{}) {
+		return nil, false
+	}
+	c, err := cache.Open(cfg.Cache)
+	if err != nil {
+		return nil, false
+	}
+	meta, ok := c.Lookup(key)
+	if !ok {
+		return nil, false
+	}
+	stream, err := meta.Source.Stream()
+	if err != nil {
+		return nil, false
+	}
+	if !sameLanguages(meta.Source.SubtitleLanguages, cfg.Resolver.SubtitleLanguages) {
+		return nil, false
+	}
+	plan := core.NewPlan(stream, media.Renderer{SelfFetch: false, ServedContainer: media.MPEGTS}, cfg)
+	if reuse(meta, stream, cfg.Resolver, true, wantedTranscript(plan, stream, cfg), canRefresh) == cacheMiss {
+		return nil, false
+	}
+	return stream, true
+}
+
+// keep records in entry what a cast left in its spool, once the cast has
+// unwound, and lets the entry go. A spool with no clock to carry a pull on by
+// (the source failed before its first frame) is not worth keeping.
+func keep(ctx context.Context, cfg core.Config, entry *cache.Entry, sp *spool.Spool, pl *pull, subs *subtitles) {
+	if sp == nil || pl == nil {
+		entry.Discard()
+		return
+	}
+	<-pl.Done()
+	if !hasClock(sp) {
+		entry.Discard()
+		return
+	}
+	entry.Meta.Complete = pl.Err() == nil
+	if pl.source != nil {
+		entry.Meta.Source = sourceOf(pl.source, cfg)
+	}
+	if subs != nil && subs.transcript() {
+		entry.Meta.Cues = subs.builder.Cues()
+		entry.Meta.Transcribed = entry.Meta.Complete && subs.transcribed
+		entry.Meta.Whisper = subs.kind
+	}
+	if err := entry.Save(); err != nil {
+		slog.WarnContext(ctx, "caching the spool failed", "error", err)
+		entry.Discard()
+		return
+	}
+	slog.InfoContext(ctx, "spool cached", "key", entry.Meta.Key, "bytes", sp.Size(), "complete", entry.Meta.Complete)
+	entry.Release()
+}
+
+// hasClock reports whether sp holds an MPEG-TS clock.
+func hasClock(sp *spool.Spool) bool {
+	f, err := os.Open(sp.Path())
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, _, ok := fileserve.PCRSpan(f, sp.Size())
+	return ok
+}
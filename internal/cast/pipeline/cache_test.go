@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"cmp"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stupside/castor/internal/cast/cache"
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/source/resolve"
+)
+
+func TestReuse(t *testing.T) {
+	mustStream := func(raw string, height int) *media.Stream {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &media.Stream{URL: u, ContentType: media.HLS, Variant: media.Variant{Bandwidth: 5e6, Height: height}}
+	}
+	// The entry holds the French dub of a 1080p variant.
+	prefs := resolve.Config{MaxHeight: 1080, AudioLanguages: []string{"fr"}}
+	pulled := sourceOf(mustStream("https://cdn.example/a/index.m3u8?t=old", 1080), core.Config{Resolver: prefs})
+	fresh := mustStream("https://cdn.example/b/index.m3u8?t=new", 1080)
+	original := resolve.Config{MaxHeight: 1080, AudioLanguages: []string{"en"}}
+
+	for _, tc := range []struct {
+		name       string
+		meta       cache.Meta
+		source     *media.Stream
+		prefs      *resolve.Config
+		stale      bool
+		transcript string
+		canRefresh bool
+		want       cacheUse
+	}{
+		{name: "complete", meta: cache.Meta{Complete: true, Source: pulled}, source: fresh, want: cacheComplete},
+		{name: "complete with its transcript", meta: cache.Meta{Complete: true, Transcribed: true, Whisper: "transcribe:en", Source: pulled}, source: fresh, transcript: "transcribe:en", want: cacheComplete},
+		{name: "complete with a transcript made another way", meta: cache.Meta{Complete: true, Transcribed: true, Whisper: "transcribe:en", Source: pulled}, source: fresh, transcript: "translate:auto", want: cacheMiss},
+		{name: "complete without a whole transcript", meta: cache.Meta{Complete: true, Whisper: "transcribe:en", Source: pulled}, source: fresh, transcript: "transcribe:en", want: cacheMiss},
+		{name: "partial from a fresh source", meta: cache.Meta{Source: pulled}, source: fresh, want: cachePartial},
+		{name: "partial from the stale source", meta: cache.Meta{Source: pulled}, source: fresh, stale: true, canRefresh: true, want: cachePartial},
+		{name: "partial with nothing to carry on from", meta: cache.Meta{Source: pulled}, source: fresh, stale: true, want: cacheMiss},
+		{name: "partial with subtitles", meta: cache.Meta{Source: pulled}, source: fresh, transcript: "transcribe:en", want: cacheMiss},
+		{name: "partial of another variant", meta: cache.Meta{Source: pulled}, source: mustStream("https://cdn.example/b/index.m3u8", 720), want: cacheMiss},
+		{name: "partial from another host", meta: cache.Meta{Source: pulled}, source: mustStream("https://mirror.example/a/index.m3u8", 1080), want: cacheMiss},
+		{name: "complete dub, recast in another language", meta: cache.Meta{Complete: true, Source: pulled}, source: fresh, prefs: &original, want: cacheMiss},
+		{name: "partial dub, recast in another language", meta: cache.Meta{Source: pulled}, source: fresh, prefs: &original, want: cacheMiss},
+		{name: "complete, recast under another height ceiling", meta: cache.Meta{Complete: true, Source: pulled}, source: fresh, prefs: &resolve.Config{MaxHeight: 720, AudioLanguages: []string{"fr"}}, want: cacheMiss},
+		{name: "complete, recast in the same language written another case", meta: cache.Meta{Complete: true, Source: pulled}, source: fresh, prefs: &resolve.Config{MaxHeight: 1080, AudioLanguages: []string{"FR"}}, want: cacheComplete},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := reuse(tc.meta, tc.source, *cmp.Or(tc.prefs, &prefs), tc.stale, tc.transcript, tc.canRefresh); got != tc.want {
+				t.Errorf("reuse() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCachedDubRecast(t *testing.T) {
+	cfg := core.Config{
+		Cache:    cache.Config{Dir: t.TempDir(), MaxSize: 1 << 30},
+		Resolver: resolve.Config{MaxHeight: 1080, AudioLanguages: []string{"fr"}},
+	}
+	c, err := cache.Open(cfg.Cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const key = "title:42"
+	e, err := c.Acquire(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://cdn.example/v/index.m3u8")
+	e.Meta.Source = sourceOf(&media.Stream{URL: u, ContentType: media.HLS, Variant: media.Variant{Bandwidth: 5e6, Height: 1080}}, cfg)
+	e.Meta.Complete = true
+	if err := os.WriteFile(e.SpoolPath(), []byte("ts"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Save(); err != nil {
+		t.Fatal(err)
+	}
+	e.Release()
+
+	if _, ok := Cached(cfg, key, false); !ok {
+		t.Error("Cached() under the preferences the dub was pulled under played nothing")
+	}
+	recast := cfg
+	recast.Resolver.AudioLanguages = []string{"en"}
+	if stream, ok := Cached(recast, key, false); ok {
+		t.Errorf("Cached() with another --audio-lang = %v, want the cached dub not played", stream.URL)
+	}
+	recast = cfg
+	recast.Resolver.SubtitleLanguages = []string{"de"}
+	if _, ok := Cached(recast, key, false); ok {
+		t.Error("Cached() with another --subtitle-lang played the entry resolved without subtitles")
+	}
+}
@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/cast/deliver/spool"
+	"github.com/stupside/castor/internal/event"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/metrics"
+)
+
+// downloadProgressInterval is how often a download reports what it has saved.
+// With no renderer to watch, it is the only sign the pull is moving.
+const downloadProgressInterval = 5 * time.Second
+
+// Download saves source to path without a renderer: the single pull a served
+// cast makes into its spool, kept as a finished file (see CheckRecord for the
+// formats) once the source has been read to its end. With no renderer to stay
+// ahead of, a single-file source is read at wire speed rather than paced; an
+// HLS one keeps its pace, as its CDN expects. A demuxed source's
+// audio rendition is pulled alongside its video exactly as on a cast. The
+// subtitles a cast would burn in are written as an .srt beside path instead:
+// the source's own track when resolution picked one, else whisper's transcript
+// when it is enabled.
+//
+// A pull that breaks partway is resumed from the source refresh extracts
+// afresh, as on a cast. Unlike a recording, an interrupted or failed download
+// leaves no file behind: a truncated one under the requested name would pass
+// for the whole title.
+func Download(ctx context.Context, cfg core.Config, source *media.Stream, path string, refresh RefreshFunc) error {
+	if err := CheckRecord(path); err != nil {
+		return err
+	}
+
+	workDir, err := cfg.Spool.WorkDir()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(workDir) }()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	g, ctx := errgroup.WithContext(runCtx)
+	defer func() { _ = g.Wait() }()
+	defer cancel()
+
+	sp, err := spool.New(filepath.Join(workDir, "spool.ts"))
+	if err != nil {
+		return err
+	}
+	defer func() { metrics.SpoolBytes.Add(-float64(sp.Size())) }()
+
+	var subs *subtitles
+	if source.Subtitle != nil {
+		subs = sourceSubtitles(*source.Subtitle, cfg.SubtitleStyle, workDir)
+	} else {
+		subs = newSubtitles(ctx, cfg, workDir)
+	}
+	pl, err := startPull(ctx, cfg, source, sp, subs, true, refresh)
+	if err != nil {
+		return err
+	}
+	rec := &recorder{path: path, ffmpegPath: cfg.Transcode.FFmpegPath, input: sp.Path(), sidecar: true}
+	if subs != nil {
+		subs.follow(ctx, g, cfg, source, pl)
+		rec.cues = subs.builder
+	}
+
+	reportDownload(ctx, pl)
+	if err := pl.Err(); err != nil {
+		return err
+	}
+	// The transcriber flushes its final cues once the PCM feed ends, and a
+	// source track's read ends with the track.
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if err := rec.save(ctx); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "download saved", "path", path, "bytes", sp.Size())
+	return nil
+}
+
+// reportDownload logs the pull's progress at INFO until it ends, and mirrors
+// each sample onto the event stream.
+func reportDownload(ctx context.Context, pl *pull) {
+	tick := time.NewTicker(downloadProgressInterval)
+	defer tick.Stop()
+	var last int64
+	for {
+		select {
+		case <-pl.Done():
+			return
+		case <-tick.C:
+			size := pl.spool.Size()
+			rate := (size - last) / int64(downloadProgressInterval.Seconds())
+			slog.InfoContext(ctx, "downloading", "saved_bytes", size, "rate_bytes_per_sec", rate)
+			event.Emit(ctx, event.DownloadProgress, event.DownloadProgressData{Bytes: size, RateBytesPerSecond: rate})
+			last = size
+		}
+	}
+}
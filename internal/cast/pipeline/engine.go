@@ -26,70 +26,191 @@ package pipeline
 import (
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"maps"
 	"os"
 	"path/filepath"
 	"slices"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/stupside/castor/internal/cast/core"
 	"github.com/stupside/castor/internal/cast/deliver/spool"
 	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/cast/subtitle"
 	"github.com/stupside/castor/internal/cast/subtitle/whisper"
 	"github.com/stupside/castor/internal/device"
+	"github.com/stupside/castor/internal/event"
 	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/metrics"
 )
 
 // ConnectFunc discovers and connects the configured renderer. Production passes
 // core.Connect; tests inject a fake so Run can be driven without a live network.
 type ConnectFunc func(context.Context, core.Config) (device.Device, error)
 
+// Option tunes a Run beyond what config expresses: per-cast wiring that only
+// the caller holds, such as the control session.
+type Option func(*runOptions)
+
+type runOptions struct {
+	session       *core.Session
+	record        string
+	maxBitrate    int64
+	refresh       RefreshFunc
+	cacheKey      string
+	subtitles     subtitle.External
+	saveSubtitles string
+}
+
+// WithSession reports the cast's live state into s and attaches the connected
+// renderer to it, so the control API can observe and drive the cast.
+func WithSession(s *core.Session) Option {
+	return func(o *runOptions) { o.session = s }
+}
+
+// WithRecord also keeps a served cast as a finished file at path (see
+// CheckRecord for the formats), with whisper's transcript as subtitles. A
+// pass-through cast cannot be recorded: castor never sees its bytes.
+func WithRecord(path string) Option {
+	return func(o *runOptions) { o.record = path }
+}
+
+// WithMaxBitrate caps the video castor serves at bits per second (see
+// core.Config.MaxBitrate); 0 leaves it uncapped.
+func WithMaxBitrate(bits int64) Option {
+	return func(o *runOptions) { o.maxBitrate = bits }
+}
+
+// WithRefresh resumes a served cast whose pull breaks partway, by extracting
+// its source afresh with refresh (see RefreshFunc).
+func WithRefresh(refresh RefreshFunc) Option {
+	return func(o *runOptions) { o.refresh = refresh }
+}
+
+// WithCacheKey names the title a served cast is of in the spool cache (see
+// core.Config.Cache), so a cast of it from any source finds what an earlier
+// one pulled. Without it, a cast is cached under its source URL.
+func WithCacheKey(key string) Option {
+	return func(o *runOptions) { o.cacheKey = key }
+}
+
+// WithSubtitles burns the viewer's subtitle file into a served cast (see
+// core.Config.Subtitles), in place of any the source or whisper would give.
+func WithSubtitles(ext subtitle.External) Option {
+	return func(o *runOptions) { o.subtitles = ext }
+}
+
+// WithSaveSubtitles also keeps the cues a served cast draws in a SubRip or
+// WebVTT file at path (see CheckSaveSubtitles), written as the cast plays and
+// whole once it ends: whisper's transcript, the source's own track, or the
+// viewer's file moved by its offset.
+func WithSaveSubtitles(path string) Option {
+	return func(o *runOptions) { o.saveSubtitles = path }
+}
+
 // Run casts source to the configured renderer. It is the single entry point that
 // replaced both per-device strategies. The only device-family influence is the
 // connect timing, keyed on the static device.SelfFetches bit: a self-fetching
 // renderer is connected up front (it may pass through, which needs its caps); a
 // non-self-fetching one always serves a spool, so it pulls immediately and
 // connects concurrently. Run owns the connected device and closes it.
-func Run(ctx context.Context, cfg core.Config, connect ConnectFunc, source *media.Stream, localIP string) error {
+func Run(ctx context.Context, cfg core.Config, connect ConnectFunc, source *media.Stream, localIP string, opts ...Option) error {
+	var o runOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cfg.MaxBitrate = cmp.Or(o.maxBitrate, cfg.MaxBitrate)
+	cfg.Subtitles = cmp.Or(o.subtitles, cfg.Subtitles)
+	if o.saveSubtitles != "" {
+		if err := CheckSaveSubtitles(o.saveSubtitles); err != nil {
+			return err
+		}
+	}
+	if o.record != "" {
+		if err := CheckRecord(o.record); err != nil {
+			return err
+		}
+		// A recording is saved from a spool, which has to hold all of it.
+		if cfg.Spool.Quota() != (spool.Quota{}) {
+			slog.InfoContext(ctx, "recording: keeping the whole stream on disk past the spool quota", "max_size", int64(cfg.Spool.MaxSize), "max_age", cfg.Spool.MaxAge)
+			cfg.Spool.MaxSize, cfg.Spool.MaxAge = 0, 0
+		}
+		// A renderer handed the source URL fetches it itself, so castor never
+		// sees the bytes it would keep: a recorded cast is served.
+		if device.SelfFetches(cfg.Device.Type) && cfg.Delivery != core.DeliveryServe {
+			slog.InfoContext(ctx, "recording: serving the cast rather than handing the device the source URL", "path", o.record)
+			cfg.Delivery = core.DeliveryServe
+		}
+	}
 	if device.SelfFetches(cfg.Device.Type) {
-		return runSelfFetch(ctx, cfg, connect, source, localIP)
+		return runSelfFetch(ctx, cfg, connect, source, localIP, o)
 	}
-	return runSpooled(ctx, cfg, connect, source, localIP)
+	return runSpooled(ctx, cfg, connect, source, localIP, o)
 }
 
 // runSelfFetch connects a smart renderer up front (its discovery is fast) and
 // then, per the plan its live capabilities produce, either hands it the source
 // URL (the source needs nothing but the URL and the renderer accepts the
 // container) or reads the source itself and serves the renderer a remux.
-func runSelfFetch(ctx context.Context, cfg core.Config, connect ConnectFunc, source *media.Stream, localIP string) error {
+func runSelfFetch(ctx context.Context, cfg core.Config, connect ConnectFunc, source *media.Stream, localIP string, o runOptions) error {
+	sess := o.session
 	dev, err := connect(ctx, cfg)
 	if err != nil {
-		return err
+		return metrics.Fail(ctx, "connect", err)
 	}
 	defer dev.Close()
+	sess.Attach(dev)
 
 	plan := core.NewPlan(source, dev.Capabilities(), cfg)
+	if cfg.MaxBitrate > 0 {
+		// Neither a pass-through nor a remux encodes the video to cap it.
+		slog.WarnContext(ctx, "not capping the bitrate: this device is cast the source's own video", "bitrate", cfg.MaxBitrate)
+	}
+	switch {
+	case cfg.Subtitles.Set():
+		// Nothing here encodes the video, so nothing can draw on it.
+		slog.WarnContext(ctx, "not showing the subtitle file: this device is cast the source's own video", "location", cfg.Subtitles.Location)
+	case source.Subtitle != nil:
+		// The renderer reads the source itself and never sees a separate track.
+		slog.WarnContext(ctx, "not showing the source's subtitles: this device is cast the source's own video", "language", source.Subtitle.Language)
+	}
+	if o.saveSubtitles != "" {
+		slog.WarnContext(ctx, "not saving subtitles: this device is cast the source's own video, so castor draws none", "path", o.saveSubtitles)
+	}
 	if plan.Delivery == core.DeliverPassthrough {
-		return passthrough(ctx, dev, source)
+		sess.Planned("passthrough", plan, source.ContentType)
+		return passthrough(ctx, dev, source, sess)
 	}
-	return runRemux(ctx, cfg, plan, dev, source, localIP)
+	sess.Planned("remux", plan, plan.OutputContentType)
+	return runRemux(ctx, cfg, plan, dev, source, localIP, o)
 }
 
 // passthrough hands the device the source URL and lets it fetch the bytes
 // directly. The renderer's own buffering handles pacing; castor touches none of
 // the media, so there is nothing to encode and no subtitles to burn (the plan
 // already forced SubtitleOff on a pass-through).
-func passthrough(ctx context.Context, dev device.Device, source *media.Stream) error {
+//
+// Castor normally exits once the renderer has the URL. With a control session
+// attached it stays up instead, so the API can keep driving the renderer; it
+// returns once the session is stopped or ctx ends.
+func passthrough(ctx context.Context, dev device.Device, source *media.Stream, sess *core.Session) error {
 	slog.InfoContext(ctx, "execution plan", "delivery", "passthrough", "content_type", source.ContentType)
+	event.Emit(ctx, event.PlanDecided, event.PlanData{Delivery: "passthrough", OutputContentType: source.ContentType})
 	slog.InfoContext(ctx, "starting playback", "url", source.URL.String(), "content_type", source.ContentType)
 	if err := dev.Play(ctx, source.URL, source.ContentType); err != nil {
 		return fmt.Errorf("starting playback: %w", err)
 	}
+	event.Emit(ctx, event.PlaybackStarted, event.PlaybackData{URL: source.URL.String(), ContentType: source.ContentType})
 	slog.InfoContext(ctx, "playback handed off to device")
-	return nil
+	if sess == nil {
+		return nil
+	}
+	<-ctx.Done()
+	return context.Cause(ctx)
 }
 
 // runRemux is the single-ffmpeg served path for a self-fetching renderer that
@@ -99,7 +220,8 @@ func passthrough(ctx context.Context, dev device.Device, source *media.Stream) e
 // input spool. A single-file remux is spooled by the replay server so the device
 // can replay from 0; a segmented (HLS) remux is packaged into a directory the HLS
 // server fronts.
-func runRemux(ctx context.Context, cfg core.Config, plan core.Plan, dev device.Device, source *media.Stream, localIP string) error {
+func runRemux(ctx context.Context, cfg core.Config, plan core.Plan, dev device.Device, source *media.Stream, localIP string, o runOptions) (err error) {
+	sess := o.session
 	// The header keys, or a configured preference, are why a renderer that accepts
 	// the source container is being served one instead.
 	slog.InfoContext(ctx, "execution plan",
@@ -110,9 +232,9 @@ func runRemux(ctx context.Context, cfg core.Config, plan core.Plan, dev device.D
 		"configured_delivery", cmp.Or(cfg.Delivery, core.DeliveryAuto),
 	)
 
-	workDir, err := os.MkdirTemp("", "castor-")
+	workDir, err := cfg.Spool.WorkDir()
 	if err != nil {
-		return fmt.Errorf("creating work directory: %w", err)
+		return err
 	}
 	defer func() { _ = os.RemoveAll(workDir) }()
 
@@ -120,6 +242,20 @@ func runRemux(ctx context.Context, cfg core.Config, plan core.Plan, dev device.D
 	if !ok {
 		return fmt.Errorf("no format for output content type %q", plan.OutputContentType)
 	}
+
+	// A single-file remux is kept from the replay server's spool once core.Serve
+	// has torn the encoder down. A segmented one cannot be: its rolling window
+	// deletes segments as playback moves on. That is refused here, before
+	// anything plays, rather than found out once the cast has ended.
+	rec := &recorder{ffmpegPath: cfg.Transcode.FFmpegPath}
+	if o.record != "" {
+		if fmtInfo.Delivery != media.DeliverStream {
+			return errors.New("cannot record this cast: the device is served live HLS, which keeps only a rolling window of the stream; castor download saves the title instead")
+		}
+		rec.path, rec.input = o.record, core.StreamSpool(workDir, fmtInfo)
+	}
+	defer func() { err = rec.finish(ctx, err) }()
+
 	opts := remuxNetworkOptions(source, cfg.Transcode.RWTimeout, fmtInfo.Muxer)
 
 	// Resolve audio from a source probe, the same decision the spool path makes
@@ -139,24 +275,71 @@ func runRemux(ctx context.Context, cfg core.Config, plan core.Plan, dev device.D
 		slog.WarnContext(ctx, "source probe failed; will re-encode audio to stereo AAC", "error", err)
 	}
 	core.ResolveAudio(&opts, dev.Capabilities(), srcInfo)
+	resolveLadder(ctx, &opts, fmtInfo, dev.Capabilities(), srcInfo, cfg)
 	slog.InfoContext(ctx, "remux audio decision",
 		"audio_codec", opts.AudioCodec,
 		"source_audio_codec", string(srcInfo.AudioCodec),
 		"source_audio_channels", srcInfo.AudioChannels,
 	)
+	sess.Encoding(ffmpeg.CodecCopy, opts.AudioCodec)
+	event.Emit(ctx, event.PlanDecided, event.PlanData{
+		Delivery:          "remux",
+		OutputContentType: plan.OutputContentType,
+		VideoCodec:        ffmpeg.CodecCopy,
+		AudioCodec:        opts.AudioCodec,
+	})
+
+	// The remux's -progress feed reports to the metrics and any watching
+	// session; no errgroup owns this path, so a plain goroutine follows it to the
+	// encoder's exit.
+	opts.ReportProgress = true
+	progress := []func(ffmpeg.Progress){reportSpeed, sess.Progress, emitProgress(ctx)}
+	defer metrics.EncoderSpeed.Set(0)
 
 	// The delivery mechanism (replay-from-zero stream vs live HLS directory) is
 	// selected by fmtInfo.Delivery inside core.Serve, not here; this path just
 	// hands it the encode and where to serve from.
-	return core.Serve(ctx, dev, core.OpenParams{
+	return metrics.Fail(ctx, "serve", core.Serve(ctx, dev, core.OpenParams{
 		FFmpegPath: cfg.Transcode.FFmpegPath,
 		Opts:       opts,
+		StartOpts:  []ffmpeg.StartOption{ffmpeg.WithExtraPipe()},
 		LocalIP:    localIP,
 		WorkDir:    workDir,
 		Format:     fmtInfo,
-	})
+		Quota:      cfg.Spool.Quota(),
+		// A VOD source's length lets the remux be served seekable; a live one
+		// probes without one.
+		Duration: srcInfo.Duration,
+		OnStarted: func(proc *ffmpeg.Process) {
+			go ffmpeg.WatchProgress(proc.Extra, func(p ffmpeg.Progress) {
+				for _, fn := range progress {
+					fn(p)
+				}
+			})
+		},
+	}))
+}
+
+// emitProgress returns the progress handler for the event stream. A burn-in
+// reports ten times a second for cue placement; the stream gets one per second.
+func emitProgress(ctx context.Context) func(ffmpeg.Progress) {
+	if !event.Enabled(ctx) {
+		return func(ffmpeg.Progress) {}
+	}
+	var last time.Time
+	return func(p ffmpeg.Progress) {
+		if time.Since(last) < time.Second {
+			return
+		}
+		last = time.Now()
+		event.Emit(ctx, event.Progress, event.ProgressData{EncodedSeconds: p.Seconds, Speed: p.Speed})
+	}
 }
 
+// reportSpeed feeds an encoder -progress report into the metrics; the serving
+// path zeroes the gauge when its encoder is done.
+func reportSpeed(p ffmpeg.Progress) { metrics.EncoderSpeed.Set(p.Speed) }
+
 // runSpooled is the read-once cast for a renderer that does not self-fetch:
 // puller into spool (+ PCM into whisper) into tail into encoder (drawtext burn-in)
 // into replay server into device. Each stage lives in its own file; this function
@@ -174,7 +357,8 @@ func runRemux(ctx context.Context, cfg core.Config, plan core.Plan, dev device.D
 // g.Wait blocks until they have unwound, a connected-but-unclaimed device is
 // closed, and only then is the work directory removed, so no goroutine is still
 // writing a cue file into a directory being deleted.
-func runSpooled(parentCtx context.Context, cfg core.Config, connect ConnectFunc, source *media.Stream, localIP string) error {
+func runSpooled(parentCtx context.Context, cfg core.Config, connect ConnectFunc, source *media.Stream, localIP string, o runOptions) (err error) {
+	sess := o.session
 	// The read-once spool serves MPEG-TS: the spool is strictly append-only so a
 	// tail can read it while it grows and the replay server can hand every client
 	// the stream from byte 0. That is a property of this delivery mechanism, not of
@@ -183,15 +367,51 @@ func runSpooled(parentCtx context.Context, cfg core.Config, connect ConnectFunc,
 	slog.InfoContext(parentCtx, "execution plan",
 		"delivery", "spool",
 		"output_content_type", plan.OutputContentType,
-		"subtitles", plan.Subtitle == core.SubtitleBurnIn,
+		"subtitles", plan.Subtitle != core.SubtitleOff,
 	)
+	sess.Planned("spool", plan, plan.OutputContentType)
 
-	workDir, err := os.MkdirTemp("", "castor-")
+	workDir, err := cfg.Spool.WorkDir()
 	if err != nil {
-		return fmt.Errorf("creating work directory: %w", err)
+		return err
 	}
 	defer func() { _ = os.RemoveAll(workDir) }() // registered first, runs last
 
+	// A cached cast's spool lives on in its cache entry, which is recorded and
+	// let go once everything reading the spool has unwound, the recording
+	// included. The entry decides what is left to pull: nothing for a title
+	// cached whole, the rest of it for one cached in part.
+	var (
+		sp   *spool.Spool
+		pl   *pull
+		subs *subtitles
+	)
+	use, stale := cacheMiss, false
+	entry := cacheEntry(parentCtx, cfg, source, o.cacheKey)
+	if entry != nil {
+		defer func() { keep(parentCtx, cfg, entry, sp, pl, subs) }()
+		if entry.Found {
+			// A cast handed the very URL the entry was pulled from is a cast
+			// from the cache: that URL is as old as the entry.
+			stale = entry.Meta.Source.URL == source.URL.String()
+			use = reuse(entry.Meta, source, cfg.Resolver, stale, wantedTranscript(plan, source, cfg), o.refresh != nil)
+		}
+		if use == cacheMiss {
+			if err := entry.Reset(); err != nil {
+				return err
+			}
+			entry.Meta.Source = sourceOf(source, cfg)
+		}
+		slog.InfoContext(parentCtx, "spool cache", "key", entry.Meta.Key, "use", use)
+	}
+
+	// The recording is saved from the spool once every stage has unwound (the
+	// defers below run first), while the work directory still exists.
+	rec := &recorder{path: o.record, ffmpegPath: cfg.Transcode.FFmpegPath}
+	defer func() { err = rec.finish(parentCtx, err) }()
+	exp := &subtitleExport{path: o.saveSubtitles}
+	defer func() { err = exp.finish(parentCtx, err) }()
+
 	dev := newDeviceFuture()
 	defer dev.closeUnclaimed()
 
@@ -205,26 +425,58 @@ func runSpooled(parentCtx context.Context, cfg core.Config, connect ConnectFunc,
 	// can take seconds, seconds the short-lived signed source URL cannot spare.
 	dev.connect(ctx, g, connect, cfg)
 
-	sp, err := spool.New(filepath.Join(workDir, "spool.ts"))
+	switch {
+	case use != cacheMiss:
+		sp, err = spool.Open(entry.SpoolPath())
+	case entry != nil:
+		sp, err = spool.New(entry.SpoolPath())
+	default:
+		sp, err = spool.New(filepath.Join(workDir, "spool.ts"), spool.WithQuota(cfg.Spool.Quota()))
+	}
 	if err != nil {
 		return err
 	}
-
-	// The subtitle decision came from the plan (SubtitleBurnIn only when whisper is
-	// enabled and this served renderer cannot take a native track); newSubtitles
-	// then still downgrades to nil if the whisper model fails to init, so wantPCM
-	// tracks the real, live stage.
-	var subs *subtitles
-	if plan.Subtitle == core.SubtitleBurnIn {
-		subs = newSubtitles(ctx, cfg.Whisper, workDir)
+	// The gauge counts what this cast spools, not what it found cached.
+	cached := sp.Size()
+	defer func() { metrics.SpoolBytes.Add(-float64(sp.Size() - cached)) }()
+	sess.TrackSpool(sp.Size)
+	rec.input = sp.Path()
+
+	// The subtitle decision came from the plan: the viewer's own file when they
+	// brought one, the source's own track when resolution picked one, else
+	// whisper when it is enabled. newSubtitles then
+	// still downgrades to nil if the whisper model fails to init, so wantPCM
+	// tracks the real, live stage. A title cached whole comes with its whole
+	// transcript (reuse sees to it), so it needs no transcriber at all.
+	switch {
+	case plan.Subtitle == core.SubtitleOff:
+	case cfg.Subtitles.Set():
+		if subs, err = externalSubtitles(ctx, cfg, workDir); err != nil {
+			return err
+		}
+	case source.Subtitle != nil:
+		subs = sourceSubtitles(*source.Subtitle, cfg.SubtitleStyle, workDir)
+	case use == cacheComplete:
+		subs = cachedSubtitles(entry.Meta, cfg.SubtitleStyle, workDir)
+	default:
+		subs = newSubtitles(ctx, cfg, workDir)
 	}
 
-	pl, err := startPull(ctx, cfg.Transcode, source, sp, subs != nil)
-	if err != nil {
-		return err
+	switch use {
+	case cacheComplete:
+		pl = finishedPull(sp)
+	case cachePartial:
+		pl = carryOnPull(ctx, cfg, source, stale, sp, o.refresh)
+	default:
+		if pl, err = startPull(ctx, cfg, source, sp, subs, false, o.refresh); err != nil {
+			return err
+		}
 	}
+	rec.done = pl.Done()
 	if subs != nil {
-		subs.transcribe(ctx, g, pl.pcm)
+		subs.follow(ctx, g, cfg, source, pl)
+		rec.cues = subs.builder
+		exp.follow(ctx, g, subs.builder)
 	}
 
 	var tr *whisper.Transcriber
@@ -244,14 +496,23 @@ func runSpooled(parentCtx context.Context, cfg core.Config, connect ConnectFunc,
 		return err
 	}
 	defer d.Close()
+	sess.Attach(d)
 
 	// The spool now holds real bytes. Probe it locally (no upstream round-trip) to
 	// decide whether the source video can be stream-copied into MPEG-TS or must be
 	// re-encoded. A failed or partial probe leaves srcInfo zero, which CanCopyVideo
-	// rejects, i.e. it falls back to a transcode.
-	srcInfo, err := ffmpeg.ProbeFile(ctx, cfg.Resolver.FFprobePath, sp.Path())
-	if err != nil {
-		slog.WarnContext(ctx, "spool probe failed; will re-encode video", "error", err)
+	// rejects, i.e. it falls back to a transcode. A cached spool was probed by the
+	// cast that cached it.
+	var srcInfo media.ProbeInfo
+	if entry != nil && entry.Meta.Probe != (media.ProbeInfo{}) {
+		srcInfo = entry.Meta.Probe
+	} else {
+		if srcInfo, err = ffmpeg.ProbeFile(ctx, cfg.Resolver.FFprobePath, sp.Path()); err != nil {
+			slog.WarnContext(ctx, "spool probe failed; will re-encode video", "error", err)
+		}
+		if entry != nil {
+			entry.Meta.Probe = srcInfo
+		}
 	}
 
 	opts := spoolEncodeOptions(cfg.Resolver.MaxHeight)
@@ -261,11 +522,30 @@ func runSpooled(parentCtx context.Context, cfg core.Config, connect ConnectFunc,
 	// (preserving 5.1/7.1) even when the video must be re-encoded, and vice versa.
 	core.ResolveAudio(&opts, caps, srcInfo)
 
+	// The plan was fixed before the renderer was known, so it could only burn
+	// subtitles in. Now its captions support is known: a source track it takes
+	// beside the stream is served to it whole instead, and the video is left
+	// alone. A track whose read ended short is still burned in, as far as it got.
+	var captions string
+	if subs != nil && core.ResolveSubtitle(caps, source, cfg) == core.SubtitleSidecar {
+		path, ok, err := subs.sidecar(ctx, workDir)
+		if err != nil {
+			return err
+		}
+		if ok {
+			captions = path
+			slog.InfoContext(ctx, "serving the source's subtitles beside the stream", "language", source.Subtitle.Language)
+		} else {
+			slog.WarnContext(ctx, "the source's subtitles could not be read whole; burning in what was read")
+		}
+	}
+	burnIn := subs != nil && captions == ""
+
 	// Wire the burn-in BEFORE ResolveVideo: attach sets opts.SubtitleTextFile,
 	// which is the signal ResolveVideo reads to force a re-encode (drawtext needs
 	// decoded frames, so a copied bitstream cannot carry cues). The cue file must
 	// also exist before ffmpeg starts or drawtext's filter init fails.
-	if subs != nil {
+	if burnIn {
 		if err := subs.attach(&opts); err != nil {
 			return err
 		}
@@ -292,6 +572,14 @@ func runSpooled(parentCtx context.Context, cfg core.Config, connect ConnectFunc,
 		"source_audio_channels", srcInfo.AudioChannels,
 		"subtitles", subs != nil,
 	)
+	sess.Encoding(videoCodec, opts.AudioCodec)
+	event.Emit(ctx, event.PlanDecided, event.PlanData{
+		Delivery:          "spool",
+		Subtitles:         subs != nil,
+		OutputContentType: plan.OutputContentType,
+		VideoCodec:        videoCodec,
+		AudioCodec:        opts.AudioCodec,
+	})
 
 	tail, err := sp.Tail(ctx)
 	if err != nil {
@@ -299,32 +587,38 @@ func runSpooled(parentCtx context.Context, cfg core.Config, connect ConnectFunc,
 	}
 	defer tail.Close()
 
-	startOpts := []ffmpeg.StartOption{ffmpeg.WithStdin(tail)}
-	if subs != nil {
-		startOpts = append(startOpts, ffmpeg.WithExtraPipe()) // -progress on fd 3
+	// The encoder's -progress feed (fd 3) drives the burn-in, the metrics, and
+	// any session's position/speed.
+	opts.ReportProgress = true
+	progress := []func(ffmpeg.Progress){reportSpeed, sess.Progress, emitProgress(ctx)}
+	defer metrics.EncoderSpeed.Set(0)
+	if burnIn {
+		progress = append(progress, subs.progress(ctx)...)
 	}
+	startOpts := []ffmpeg.StartOption{ffmpeg.WithStdin(tail), ffmpeg.WithExtraPipe()}
 
 	fmtInfo, ok := media.FormatForContentType(plan.OutputContentType)
 	if !ok {
 		return fmt.Errorf("no format for output content type %q", plan.OutputContentType)
 	}
 
-	// core.Serve owns the encoder; OnStarted wires the burn-in follower to the
+	// core.Serve owns the encoder; OnStarted wires the progress follower to the
 	// encoder's -progress pipe (fd 3) as soon as it starts, keeping the whisper
 	// errgroup coupling here in the pipeline instead of in core.
-	return core.Serve(ctx, d, core.OpenParams{
+	return metrics.Fail(ctx, "serve", core.Serve(ctx, d, core.OpenParams{
 		FFmpegPath: cfg.Transcode.FFmpegPath,
 		Opts:       opts,
 		StartOpts:  startOpts,
 		LocalIP:    localIP,
 		WorkDir:    workDir,
 		Format:     fmtInfo,
+		Quota:      cfg.Spool.Quota(),
+		Captions:   captions,
+		Adapt:      adaptation(ctx, opts, fmtInfo, caps, srcInfo, cfg, resumeSpool(sp)),
 		OnStarted: func(proc *ffmpeg.Process) {
-			if subs != nil && proc.Extra != nil {
-				subs.follow(ctx, g, proc.Extra)
-			}
+			followProgress(g, proc.Extra, progress...)
 		},
-	})
+	}))
 }
 
 // deviceFuture is the async renderer connection. The connect goroutine runs in
@@ -344,7 +638,7 @@ func (f *deviceFuture) connect(ctx context.Context, g *errgroup.Group, connect C
 	g.Go(func() error {
 		dev, err := connect(ctx, cfg)
 		if err != nil {
-			return err
+			return metrics.Fail(ctx, "connect", err)
 		}
 		select {
 		case f.ch <- dev:
@@ -75,9 +75,9 @@ func (d *fakeDevice) Play(ctx context.Context, streamURL *url.URL, contentType s
 	return err
 }
 
-func (d *fakeDevice) Capabilities() media.Renderer           { return d.caps }
-func (d *fakeDevice) StreamHeaders(string) map[string]string { return nil }
-func (d *fakeDevice) Close() error                           { return nil }
+func (d *fakeDevice) Capabilities() media.Renderer                 { return d.caps }
+func (d *fakeDevice) StreamHeaders(string, bool) map[string]string { return nil }
+func (d *fakeDevice) Close() error                                 { return nil }
 
 func (d *fakeDevice) snapshot() []playCall {
 	d.mu.Lock()
@@ -121,6 +121,42 @@ func TestRunPassthrough(t *testing.T) {
 	}
 }
 
+// TestRunPassthroughHoldsForSession pins that a controlled pass-through cast
+// stays up after the handoff (castor is the only thing serving the control API)
+// and ends when the session stops it.
+func TestRunPassthroughHoldsForSession(t *testing.T) {
+	srcURL, err := url.Parse("http://cdn.example.com/movie.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &media.Stream{URL: srcURL, ContentType: media.MP4}
+	dev := &fakeDevice{caps: media.Renderer{SelfFetch: true, Containers: []string{media.MP4}}}
+	cfg := core.Config{Device: core.DeviceConfig{Type: device.TypeChromecast}}
+
+	ctx, stop := context.WithCancelCause(context.Background())
+	defer stop(nil)
+	sess := core.NewSession(cfg.Device, stop)
+
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, cfg, connectTo(dev), source, "127.0.0.1", WithSession(sess)) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned before the session stopped: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if got := sess.Status(ctx).Delivery; got != "passthrough" {
+		t.Errorf("session delivery = %q, want passthrough", got)
+	}
+
+	// fakeDevice offers no transport control, so Stop reports that, but the
+	// cast must end regardless.
+	_ = sess.Stop(ctx)
+	if err := <-done; !errors.Is(err, core.ErrStopped) {
+		t.Fatalf("Run = %v, want core.ErrStopped", err)
+	}
+}
+
 // TestRunHeaderGatedSourceIsServed is the pass-through guard: the renderer
 // self-fetches AND accepts the source container, but the source only ever
 // answered to the request headers castor captured. Handing such a URL to the
@@ -319,6 +355,136 @@ func TestRunServeSpool(t *testing.T) {
 	assertServed(t, dev, mpegtsContentType, source.URL.String())
 }
 
+// TestRunServeSpoolRecords pins --record on the spool path: once the cast ends,
+// the spooled source is kept as a finished matroska file carrying both tracks.
+func TestRunServeSpoolRecords(t *testing.T) {
+	ffmpegPath, ffprobePath := requireFFmpegTools(t)
+
+	origin := serveFixture(t, ffmpegPath)
+	source := origin.stream()
+
+	dev := &fakeDevice{
+		caps: media.Renderer{
+			Video: []media.VideoSupport{{Codec: media.CodecH264}},
+			Audio: []media.AudioSupport{{Codec: media.CodecAAC, MaxChannels: 2}},
+		},
+		drain: true,
+	}
+	out := filepath.Join(t.TempDir(), "kept.mkv")
+	runServed(t, dev, castConfig(device.TypeDLNA, ffmpegPath, ffprobePath), source, WithRecord(out))
+
+	info, err := ffmpeg.ProbeFile(context.Background(), ffprobePath, out)
+	if err != nil {
+		t.Fatalf("probing the recording: %v", err)
+	}
+	if info.VideoCodec != media.CodecH264 || info.AudioCodec != media.CodecAAC {
+		t.Errorf("recording holds %q/%q, want the source's h264/aac stream-copied", info.VideoCodec, info.AudioCodec)
+	}
+}
+
+// TestRunRecordRefusesLiveHLS pins --record on a cast served as live HLS,
+// whose rolling window leaves nothing whole to keep: it fails before the
+// device is handed anything, rather than playing a film it will not save.
+func TestRunRecordRefusesLiveHLS(t *testing.T) {
+	srcURL, err := url.Parse("http://cdn.example.com/movie.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &media.Stream{URL: srcURL, ContentType: media.MP4}
+	dev := &fakeDevice{caps: media.Renderer{
+		SelfFetch:       true,
+		Containers:      []string{media.MP4},
+		ServedContainer: media.HLS,
+	}}
+	cfg := core.Config{Device: core.DeviceConfig{Type: device.TypeRoku}}
+
+	err = Run(t.Context(), cfg, connectTo(dev), source, "127.0.0.1", WithRecord(filepath.Join(t.TempDir(), "kept.mkv")))
+	if err == nil || !strings.Contains(err.Error(), "cannot record") {
+		t.Fatalf("Run = %v, want the recording refused", err)
+	}
+	if plays := dev.snapshot(); len(plays) != 0 {
+		t.Errorf("the device was handed %+v: a cast that cannot be recorded must not start", plays)
+	}
+}
+
+// TestDownload pins castor download: the source is pulled to its end and saved
+// as an mp4 holding both tracks, with no renderer involved.
+func TestDownload(t *testing.T) {
+	ffmpegPath, ffprobePath := requireFFmpegTools(t)
+
+	origin := serveFixture(t, ffmpegPath)
+	out := filepath.Join(t.TempDir(), "saved.mp4")
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	if err := Download(ctx, castConfig(device.TypeDLNA, ffmpegPath, ffprobePath), origin.stream(), out, nil); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	info, err := ffmpeg.ProbeFile(context.Background(), ffprobePath, out)
+	if err != nil {
+		t.Fatalf("probing the download: %v", err)
+	}
+	if info.VideoCodec != media.CodecH264 || info.AudioCodec != media.CodecAAC {
+		t.Errorf("download holds %q/%q, want the source's h264/aac", info.VideoCodec, info.AudioCodec)
+	}
+}
+
+// TestRunFile pins cast file's two outcomes: a renderer that plays the file's
+// container and codecs is handed the file itself, and one that does not is
+// served a remux into its own container.
+func TestRunFile(t *testing.T) {
+	ffmpegPath, ffprobePath := requireFFmpegTools(t)
+	path := writeFixture(t, ffmpegPath)
+
+	tests := []struct {
+		name       string
+		containers []string
+		wantCT     string
+		wantFile   bool
+	}{
+		{name: "as is", containers: []string{media.MP4}, wantCT: media.MP4, wantFile: true},
+		{name: "remuxed", containers: []string{media.MKV}, wantCT: media.MPEGTS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dev := &fakeDevice{
+				caps: media.Renderer{
+					Containers:      tt.containers,
+					ServedContainer: media.MPEGTS,
+					Video:           []media.VideoSupport{{Codec: media.CodecH264}},
+					Audio:           []media.AudioSupport{{Codec: media.CodecAAC, MaxChannels: 2}},
+				},
+				drain: true,
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+			defer cancel()
+			if err := RunFile(ctx, castConfig(device.TypeDLNA, ffmpegPath, ffprobePath), connectTo(dev), path, "127.0.0.1"); err != nil {
+				t.Fatalf("RunFile: %v", err)
+			}
+			plays := dev.snapshot()
+			if len(plays) != 1 || plays[0].contentType != tt.wantCT {
+				t.Fatalf("plays = %+v, want one of %s", plays, tt.wantCT)
+			}
+			if isFile := strings.Contains(plays[0].url, "/file."); isFile != tt.wantFile {
+				t.Errorf("served %s, want the file as is: %v", plays[0].url, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestCheckRecord(t *testing.T) {
+	for _, path := range []string{"out.mkv", "/tmp/Movie.TS"} {
+		if err := CheckRecord(path); err != nil {
+			t.Errorf("CheckRecord(%q) = %v, want ok", path, err)
+		}
+	}
+	for _, path := range []string{"out.avi", "out"} {
+		if err := CheckRecord(path); err == nil {
+			t.Errorf("CheckRecord(%q) accepted a format the recorder cannot write", path)
+		}
+	}
+}
+
 // mpegtsContentType is what the DLNA-style served path tells the device it is
 // fetching.
 const mpegtsContentType = media.MPEGTS
@@ -395,12 +561,12 @@ func castConfig(deviceType device.Type, ffmpegPath, ffprobePath string) core.Con
 
 // runServed drives Run for a served plan under a bounded context (a wedged
 // ffmpeg fails the test instead of hanging the suite) and fails on any error.
-func runServed(t *testing.T, dev *fakeDevice, cfg core.Config, source *media.Stream) {
+func runServed(t *testing.T, dev *fakeDevice, cfg core.Config, source *media.Stream, opts ...Option) {
 	t.Helper()
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	if err := Run(ctx, cfg, connectTo(dev), source, "127.0.0.1"); err != nil {
+	if err := Run(ctx, cfg, connectTo(dev), source, "127.0.0.1", opts...); err != nil {
 		t.Fatalf("Run served: %v", err)
 	}
 }
@@ -447,6 +613,17 @@ func (o fixtureOrigin) stream() *media.Stream {
 // HTTP. faststart puts the moov atom up front so ffmpeg can read it streaming,
 // and http.ServeFile still honours range requests the demuxer may issue.
 func serveFixture(t *testing.T, ffmpegPath string) fixtureOrigin {
+	t.Helper()
+	path := writeFixture(t, ffmpegPath)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, path)
+	}))
+	t.Cleanup(server.Close)
+	return fixtureOrigin{server: server, path: "/movie.mp4", contentType: media.MP4}
+}
+
+// writeFixture generates serveFixture's mp4 on disk and returns its path.
+func writeFixture(t *testing.T, ffmpegPath string) string {
 	t.Helper()
 	path := filepath.Join(t.TempDir(), "fixture.mp4")
 	args := []string{
@@ -463,12 +640,7 @@ func serveFixture(t *testing.T, ffmpegPath string) fixtureOrigin {
 	if out, err := exec.CommandContext(ctx, ffmpegPath, args...).CombinedOutput(); err != nil {
 		t.Fatalf("generating fixture: %v\n%s", err, out)
 	}
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, path)
-	}))
-	t.Cleanup(server.Close)
-	return fixtureOrigin{server: server, path: "/movie.mp4", contentType: media.MP4}
+	return path
 }
 
 // serveHLSFixture generates a short HLS stream whose MPEG-TS segments are written
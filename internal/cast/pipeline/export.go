@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/stupside/castor/internal/cast/subtitle/cue"
+)
+
+// exportInterval is how often a saved subtitle file takes the cues made since
+// the last write: often enough that a cast killed outright keeps nearly all of
+// its transcript, rarely enough to cost nothing.
+const exportInterval = 10 * time.Second
+
+// CheckSaveSubtitles reports whether path names a subtitle file castor can
+// save a cast's cues to, so a caller can reject it before casting rather than
+// after the movie.
+func CheckSaveSubtitles(path string) error {
+	if _, ok := cue.FormatOf(path); !ok {
+		return fmt.Errorf("cannot save subtitles to %q: want a .srt or .vtt file", path)
+	}
+	return nil
+}
+
+// subtitleExport keeps the cues a served cast draws in a subtitle file (the
+// cast commands' --save-subtitles), so a transcript outlives the cast to be
+// corrected and brought back with --subtitles. The file grows as the cast
+// plays, a run of cues every exportInterval, and is written again whole once
+// the cast ends: a cue whisper or a source's track places before one already
+// written is then in its place, and the file is complete. Like a recorder, an
+// export with no path saves nothing, so the served paths wire one
+// unconditionally.
+type subtitleExport struct {
+	path string
+	// cues is the cast's cue stage, nil until one starts (or on a cast with
+	// no subtitles).
+	cues *cue.Builder
+
+	format  cue.Format
+	written int // cues already in the file
+}
+
+// follow writes cues to the file in g as they are made, until ctx ends.
+func (e *subtitleExport) follow(ctx context.Context, g *errgroup.Group, cues *cue.Builder) {
+	if e.path == "" {
+		return
+	}
+	e.cues = cues
+	e.format, _ = cue.FormatOf(e.path)
+	g.Go(func() error {
+		f, err := os.Create(e.path)
+		if err != nil {
+			slog.WarnContext(ctx, "saving subtitles as they come failed; they are saved when the cast ends", "path", e.path, "error", err)
+			return nil
+		}
+		defer f.Close()
+		if _, err := f.WriteString(e.format.Header()); err != nil {
+			slog.WarnContext(ctx, "saving subtitles as they come failed; they are saved when the cast ends", "path", e.path, "error", err)
+			return nil
+		}
+		tick := time.NewTicker(exportInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-tick.C:
+			}
+			fresh := cues.Cues()[e.written:]
+			if len(fresh) == 0 {
+				continue
+			}
+			if err := e.format.Write(f, fresh, e.written); err != nil {
+				slog.WarnContext(ctx, "saving subtitles as they come failed; they are saved when the cast ends", "path", e.path, "error", err)
+				return nil
+			}
+			e.written += len(fresh)
+		}
+	})
+}
+
+// finish writes the file whole and folds the outcome into the cast's, as a
+// recorder's finish does: a stopped or failed cast keeps the cues it made,
+// and a failed save fails only an otherwise clean cast. Call it once the cue
+// stage and follow have stopped.
+func (e *subtitleExport) finish(ctx context.Context, castErr error) error {
+	if e.path == "" {
+		return castErr
+	}
+	if e.cues == nil {
+		slog.WarnContext(ctx, "no subtitles to save: the cast drew none", "path", e.path)
+		return castErr
+	}
+	cues := e.cues.Cues()
+	err := writeCues(e.path, e.format, cues)
+	switch {
+	case err == nil:
+		slog.InfoContext(ctx, "subtitles saved", "path", e.path, "cues", len(cues))
+		return castErr
+	case castErr == nil:
+		return err
+	default:
+		slog.WarnContext(ctx, "saving subtitles failed", "path", e.path, "error", err)
+		return castErr
+	}
+}
+
+// writeCues writes cues to path in format through a temporary file renamed
+// into place, so the file is never seen half rewritten.
+func writeCues(path string, format cue.Format, cues []cue.Cue) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("saving subtitles: %w", err)
+	}
+	_, err = f.WriteString(format.Header())
+	if err == nil {
+		err = format.Write(f, cues, 0)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("saving subtitles to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/stupside/castor/internal/cast/subtitle/cue"
+)
+
+// TestSubtitleExport pins the saved file: opened with its header as the cast
+// starts, written whole and in start order once it ends, and still saved when
+// the cast failed, without its failure being replaced.
+func TestSubtitleExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "film.vtt")
+	b := cue.NewBuilder(0)
+	b.Append(cue.Cue{Start: 5, End: 6, Text: "Second."})
+
+	exp := &subtitleExport{path: path}
+	ctx, cancel := context.WithCancel(t.Context())
+	var g errgroup.Group
+	exp.follow(ctx, &g, b)
+	b.Append(cue.Cue{Start: 1, End: 2, Text: "First."})
+	cancel()
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	castErr := errors.New("renderer went away")
+	if err := exp.finish(t.Context(), castErr); err != castErr {
+		t.Fatalf("finish = %v, want the cast's %v", err, castErr)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nFirst.\n\n00:00:05.000 --> 00:00:06.000\nSecond.\n\n"
+	if string(got) != want {
+		t.Errorf("saved =\n%q\nwant\n%q", got, want)
+	}
+
+	if err := CheckSaveSubtitles("film.ass"); err == nil {
+		t.Error("want an error saving to an .ass file, got nil")
+	}
+	if err := (&subtitleExport{}).finish(t.Context(), nil); err != nil {
+		t.Errorf("an export with no path must save nothing, got %v", err)
+	}
+}
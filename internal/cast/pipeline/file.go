@@ -0,0 +1,235 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/cast/subtitle/cue"
+	"github.com/stupside/castor/internal/event"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/metrics"
+)
+
+// RunFile casts the local file at path to the configured renderer, serving it
+// from castor's own HTTP server whatever the device family: no renderer can
+// fetch a path on this machine, so there is no pass-through to consider.
+//
+// The copy-vs-encode decision is the served paths' own (core.ResolveVideo and
+// core.ResolveAudio against a probe of the file). When the renderer takes the
+// file's container and both tracks copy, the file is served as it is, with
+// byte ranges and DLNA time-seek, so the renderer can seek in it. Otherwise one
+// ffmpeg reads the file and remuxes or transcodes it into the renderer's served
+// container, delivered like any other served cast: as a VOD, seekable by time
+// while it is produced and by byte once it is, when that container is MPEG-TS.
+//
+// A subtitle file the viewer brought (see WithSubtitles) is drawn by libass
+// whatever its format, not by the drawtext cue writer a network cast uses:
+// reading from disk, the encode runs well ahead of realtime, which the cue
+// writer cannot keep up with but libass, timing each cue by the frames
+// themselves, needs no pacing for. It rules out serving the file as it is.
+func RunFile(ctx context.Context, cfg core.Config, connect ConnectFunc, path, localIP string, opts ...Option) error {
+	var o runOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cfg.MaxBitrate = cmp.Or(o.maxBitrate, cfg.MaxBitrate)
+	cfg.Subtitles = cmp.Or(o.subtitles, cfg.Subtitles)
+	sess := o.session
+	if o.record != "" {
+		slog.WarnContext(ctx, "not recording: the cast is already a file on disk", "path", o.record)
+	}
+	if o.saveSubtitles != "" {
+		if err := CheckSaveSubtitles(o.saveSubtitles); err != nil {
+			return err
+		}
+	}
+	if !cfg.Subtitles.Set() && (cfg.Whisper.Enable || len(cfg.Resolver.SubtitleLanguages) > 0) {
+		slog.WarnContext(ctx, "whisper and a file's own subtitles are not applied to a local file cast; pass a subtitle file instead")
+	}
+
+	workDir, err := cfg.Spool.WorkDir()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(workDir) }()
+
+	var burn string
+	if cfg.Subtitles.Set() {
+		subs, err := externalSubtitles(ctx, cfg, workDir)
+		if err != nil {
+			return err
+		}
+		if burn, err = subs.burnFile(workDir); err != nil {
+			return err
+		}
+		if o.saveSubtitles != "" {
+			// The file is whole before the cast starts: saving it is one write.
+			format, _ := cue.FormatOf(o.saveSubtitles)
+			if err := writeCues(o.saveSubtitles, format, subs.builder.Cues()); err != nil {
+				return err
+			}
+		}
+	} else if o.saveSubtitles != "" {
+		slog.WarnContext(ctx, "no subtitles to save: a local file cast draws only a subtitle file passed to it", "path", o.saveSubtitles)
+	}
+
+	info, err := ffmpeg.ProbeFileAudio(ctx, cfg.Resolver.FFprobePath, path, preferredTrack(ctx, cfg.Resolver.AudioLanguages))
+	if err != nil {
+		return fmt.Errorf("probing %s: %w", path, err)
+	}
+	contentType := media.DetectFromFileName(path)
+
+	dev, err := connect(ctx, cfg)
+	if err != nil {
+		return metrics.Fail(ctx, "connect", err)
+	}
+	defer dev.Close()
+	sess.Attach(dev)
+	caps := dev.Capabilities()
+
+	enc, asIs := FileEncode(ctx, cfg, caps, path, info, burn)
+	videoCodec := ffmpeg.CodecCopy
+	if enc.VideoEncoder != nil {
+		videoCodec = enc.VideoEncoder.Name
+	}
+	slog.InfoContext(ctx, "file encode decision",
+		"path", path,
+		"content_type", contentType,
+		"video_codec", videoCodec,
+		"source_codec", string(info.VideoCodec),
+		"source_height", info.VideoHeight,
+		"audio_codec", enc.AudioCodec,
+		"source_audio_codec", string(info.AudioCodec),
+		"duration", info.Duration,
+	)
+
+	if asIs {
+		planFile(ctx, o, contentType, ffmpeg.CodecCopy, ffmpeg.CodecCopy, false)
+		return metrics.Fail(ctx, "serve", core.Serve(ctx, dev, core.OpenParams{
+			LocalIP: localIP,
+			Format: media.FormatInfo{
+				ContentType: contentType,
+				Extension:   strings.ToLower(filepath.Ext(path)),
+				Delivery:    media.DeliverFile,
+			},
+			File:     path,
+			Duration: info.Duration,
+		}))
+	}
+
+	// The renderer cannot play the file as it is: rewrap or re-encode it into the
+	// container it is served in. MPEG-TS is the fallback for a renderer that
+	// declares none, as on the read-once spool path.
+	fmtInfo, ok := media.FormatForContentType(cmp.Or(caps.ServedContainer, media.MPEGTS))
+	if !ok {
+		return fmt.Errorf("no format for output content type %q", caps.ServedContainer)
+	}
+	enc.OutputFormat = fmtInfo.Muxer
+	resolveLadder(ctx, &enc, fmtInfo, caps, info, cfg)
+	planFile(ctx, o, fmtInfo.ContentType, videoCodec, enc.AudioCodec, burn != "")
+
+	enc.ReportProgress = true
+	progress := []func(ffmpeg.Progress){reportSpeed, sess.Progress, emitProgress(ctx)}
+	defer metrics.EncoderSpeed.Set(0)
+	return metrics.Fail(ctx, "serve", core.Serve(ctx, dev, core.OpenParams{
+		FFmpegPath: cfg.Transcode.FFmpegPath,
+		Opts:       enc,
+		StartOpts:  []ffmpeg.StartOption{ffmpeg.WithExtraPipe()},
+		LocalIP:    localIP,
+		WorkDir:    workDir,
+		Format:     fmtInfo,
+		Quota:      cfg.Spool.Quota(),
+		Duration:   info.Duration,
+		Adapt:      adaptation(ctx, enc, fmtInfo, caps, info, cfg, resumeFile),
+		OnStarted: func(proc *ffmpeg.Process) {
+			go ffmpeg.WatchProgress(proc.Extra, func(p ffmpeg.Progress) {
+				for _, fn := range progress {
+					fn(p)
+				}
+			})
+		},
+	}))
+}
+
+// FileEncode resolves how the local file at path, probed as info, reaches a
+// renderer with caps: the served paths' copy-vs-encode decision for each track,
+// as the encode that reads the file. asIs reports that the renderer takes the
+// file unchanged, its container and both tracks, so it can be served as it is
+// and the encode is not needed. The encode writes the renderer's served
+// container, MPEG-TS when it declares none, which decides the codecs it can
+// copy or encode the video to. burn, when set, is a subtitle file drawn into
+// the video (see ffmpeg.EncodeOptions.SubtitleFile), so the video is encoded
+// and the file is never played as is.
+func FileEncode(ctx context.Context, cfg core.Config, caps media.Renderer, path string, info media.ProbeInfo, burn string) (enc ffmpeg.EncodeOptions, asIs bool) {
+	enc = ffmpeg.EncodeOptions{
+		InputFile:           path,
+		SubtitleFile:        burn,
+		SubtitleStyle:       cfg.SubtitleStyle,
+		AudioTrack:          info.AudioTrack,
+		VideoMaxHeight:      cfg.Resolver.MaxHeight,
+		KeyframeIntervalSec: keyframeSeconds,
+	}
+	if f, ok := media.FormatForContentType(cmp.Or(caps.ServedContainer, media.MPEGTS)); ok {
+		enc.OutputFormat = f.Muxer
+	}
+	core.ResolveAudio(&enc, caps, info)
+	core.ResolveVideo(ctx, &enc, caps, info, cfg)
+	return enc, burn == "" && PlaysAsIs(cfg, caps, path, info)
+}
+
+// PlaysAsIs reports whether a renderer with caps takes the local file at path,
+// probed as info, unchanged. It is FileEncode's asIs decided without selecting
+// an encoder, for a caller that only asks (the media server, listing a folder).
+// A file played in an audio track other than its first never is: served as it
+// is, the renderer would play the first.
+func PlaysAsIs(cfg core.Config, caps media.Renderer, path string, info media.ProbeInfo) bool {
+	contentType := media.DetectFromFileName(path)
+	return contentType != "" && caps.AcceptsContainer(contentType) && info.AudioTrack == 0 &&
+		core.CanCopyVideo(caps, info, cfg) && caps.CanCopyAudio(info)
+}
+
+// preferredTrack is the audio pick of a local file's probe: the track in the
+// language of prefs the viewer prefers most, else (with a warning when there
+// are preferences) the first.
+func preferredTrack(ctx context.Context, prefs []string) func(languages []string) int {
+	return func(languages []string) int {
+		if len(prefs) == 0 {
+			return 0
+		}
+		i, ok := media.PreferredLanguage(prefs, languages)
+		if !ok {
+			slog.WarnContext(ctx, "file has no audio in a preferred language, playing its first track",
+				"preferred", prefs, "available", languages)
+			return 0
+		}
+		slog.InfoContext(ctx, "playing the audio track in a preferred language", "language", languages[i], "track", i)
+		return i
+	}
+}
+
+// planFile reports a file cast's plan to the log, the session and the event
+// stream. A file is always served, never passed through; burnIn reports a
+// subtitle file drawn into it.
+func planFile(ctx context.Context, o runOptions, contentType, videoCodec, audioCodec string, burnIn bool) {
+	plan := core.Plan{Delivery: core.DeliverServe, OutputContentType: contentType}
+	if burnIn {
+		plan.Subtitle = core.SubtitleBurnIn
+	}
+	slog.InfoContext(ctx, "execution plan", "delivery", "file", "output_content_type", contentType, "subtitles", burnIn)
+	o.session.Planned("file", plan, contentType)
+	o.session.Encoding(videoCodec, audioCodec)
+	event.Emit(ctx, event.PlanDecided, event.PlanData{
+		Delivery:          "file",
+		Subtitles:         burnIn,
+		OutputContentType: contentType,
+		VideoCodec:        videoCodec,
+		AudioCodec:        audioCodec,
+	})
+}
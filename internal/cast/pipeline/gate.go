@@ -6,9 +6,11 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/stupside/castor/internal/cast/core"
 	"github.com/stupside/castor/internal/cast/deliver/spool"
 	"github.com/stupside/castor/internal/cast/ffmpeg"
 	"github.com/stupside/castor/internal/cast/subtitle/whisper"
+	"github.com/stupside/castor/internal/metrics"
 )
 
 const (
@@ -49,9 +51,11 @@ func waitForPlayable(ctx context.Context, tr *whisper.Transcriber, sp *spool.Spo
 			// whatever fragment made it into the spool would play a few
 			// seconds and stop mid-scene, which reads as a worse failure
 			// than a clear error. (After playback starts, the spool keeps
-			// serving and a pull error only truncates the tail.)
+			// serving and a pull error only truncates the tail.) A pull with a
+			// refresh has already tried resuming before it reports done. Either
+			// way the source is to blame, and another candidate may play.
 			if err := pl.Err(); err != nil {
-				return fmt.Errorf("upstream pull failed before playback (spooled %d bytes): %w", sp.Size(), err)
+				return core.SourceFailed(fmt.Errorf("upstream pull failed before playback (spooled %d bytes): %w", sp.Size(), err))
 			}
 		default:
 		}
@@ -76,10 +80,13 @@ func waitForPlayable(ctx context.Context, tr *whisper.Transcriber, sp *spool.Spo
 			} else {
 				slog.WarnContext(ctx, "puller emitted no stderr — connection accepted but zero bytes and no warnings delivered (silent upstream)")
 			}
-			return fmt.Errorf("upstream stalled before playback: no data for %s (spooled %d bytes) — the source playlist is likely expired (segments 404); try casting again to get a fresh link",
-				gateStallTimeout, size)
+			// The pull's own failure is counted by the pull; a stall is the
+			// gate's to count, since the pull never errors on one.
+			return metrics.Fail(ctx, "gate", core.SourceFailed(fmt.Errorf("upstream stalled before playback: no data for %s (spooled %d bytes) — the source playlist is likely expired (segments 404); try casting again to get a fresh link",
+				gateStallTimeout, size)))
 		}
 
+		metrics.WhisperLead.Set(leadSeconds(tr))
 		ready := false
 		if tr != nil {
 			// Spool bytes are required too: a pull that dies instantly
@@ -1,105 +1,361 @@
 package pipeline
 
 import (
+	"bytes"
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"maps"
+	"os"
 	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
 	"github.com/stupside/castor/internal/cast/deliver/spool"
 	"github.com/stupside/castor/internal/cast/ffmpeg"
 	"github.com/stupside/castor/internal/cast/subtitle/whisper"
 	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/metrics"
 )
 
+// maxPullResumes bounds how many times one cast's pull is resumed from a
+// freshly extracted source. A signed URL expiring mid-title takes one; a
+// source that breaks every time it is resumed is not worth pulling on.
+const maxPullResumes = 3
+
+// errCarryOn is the state a pull carried on from a cached spool starts in:
+// stopped short of the end, as a broken pull is.
+var errCarryOn = errors.New("cached spool stops short of the source's end")
+
+// RefreshFunc extracts a cast's source afresh, from the page or URL it first
+// came from, once its pull has broken mid-title (a token burned, a signed URL
+// expired). It returns the stream unresolved; the pull resolves it to the
+// variant it was reading (see core.RefreshSource).
+type RefreshFunc func(context.Context) (*media.Stream, error)
+
 // pull is the running upstream download. Exactly one pull touches the source
 // URL per cast: it remuxes the stream into the spool (codec copy — cheap),
 // paced like a buffering player, and, when requested, tees a PCM audio feed
-// for the transcriber. Everything downstream reads local data, so the CDN
+// for the transcriber and the source's own subtitle track as SubRip.
+// Everything downstream reads local data, so the CDN
 // sees a single well-behaved client and can never interrupt playback of
 // what's already spooled.
+//
+// A pull that breaks partway is resumed, when it has a refresh: the source is
+// extracted afresh, read again from the media time the spool reaches, and
+// spliced on at the first keyframe past it with the spool's clock carried on,
+// so everything reading the spool plays on as though nothing happened.
 type pull struct {
 	// pcm is the mono s16le audio feed, nil unless requested. The consumer
 	// must keep draining it until EOF — backpressure on this pipe throttles
-	// the whole download.
-	pcm io.ReadCloser
+	// the whole download. It carries on across a resume.
+	pcm  io.ReadCloser
+	pcmW *io.PipeWriter
+
+	// srt is the subtitle track muxed into the source, read out as SubRip,
+	// nil unless requested. Like pcm, it must be drained until EOF and
+	// carries on across a resume, a resumed puller's cues following on.
+	srt  io.ReadCloser
+	srtW *io.PipeWriter
+
+	cfg      core.Config
+	source   *media.Stream
+	refresh  RefreshFunc
+	wantPCM  bool
+	subTrack int  // the muxed subtitle track srt reads (s:N), -1 for none
+	stale    bool // source is not to be read again, only extracted afresh
+	unpaced  bool // read at wire speed: a download, which nothing plays from
 
-	proc  *ffmpeg.Process
+	mu    sync.Mutex
+	proc  *ffmpeg.Process // the running puller, replaced on a resume
 	spool *spool.Spool
 	done  chan struct{}
 	err   error
 }
 
 // startPull launches the upstream ffmpeg. Its mpegts output lands in sp; the
-// optional PCM output is exposed as pull.pcm. It is device-blind: the served
-// path spools every source this way regardless of renderer family, and only the
-// wantPCM flag (driven by the plan's subtitle mode) changes what it produces.
-func startPull(ctx context.Context, cfg core.TranscodeConfig, resolved *media.Stream, sp *spool.Spool, wantPCM bool) (*pull, error) {
-	args := ffmpeg.PullArgs(ffmpeg.PullOptions{
-		Source:        ffmpeg.NewNetworkSource(resolved, cfg.RWTimeout),
+// optional PCM output is exposed as pull.pcm, and a subtitle track muxed into
+// the source as pull.srt. It is device-blind: the served path spools every
+// source this way regardless of renderer family, and only subs (driven by the
+// plan's subtitle mode) changes what it produces. refresh, if not nil, is how
+// a broken pull is resumed. unpaced reads the source at wire speed (see
+// ffmpeg.PullOptions.Unpaced), for a download.
+func startPull(ctx context.Context, cfg core.Config, resolved *media.Stream, sp *spool.Spool, subs *subtitles, unpaced bool, refresh RefreshFunc) (*pull, error) {
+	pu := &pull{cfg: cfg, source: resolved, refresh: refresh, wantPCM: subs.transcribes(), subTrack: subs.muxedTrack(), unpaced: unpaced, spool: sp, done: make(chan struct{})}
+	proc, err := pu.start(ctx, ffmpeg.NewNetworkSource(resolved, cfg.Transcode.RWTimeout), 0)
+	if err != nil {
+		return nil, err
+	}
+	pu.proc = proc
+	if pu.wantPCM {
+		var r *io.PipeReader
+		r, pu.pcmW = io.Pipe()
+		pu.pcm = r
+	}
+	if pu.subTrack >= 0 {
+		var r *io.PipeReader
+		r, pu.srtW = io.Pipe()
+		pu.srt = r
+	}
+	go pu.logProgress(ctx)
+	go pu.run(ctx)
+	return pu, nil
+}
+
+// carryOnPull carries on the pull that filled sp, a spool kept from an earlier
+// cast that stopped short of the source's end, reading source from where sp
+// ends. A stale source (the one the earlier cast was given, its URL long since
+// expired) is not read: the pull starts as a broken one is resumed, from the
+// source extracted afresh with refresh. It has no PCM or subtitle feed: the
+// cues of what sp already holds are not transcribed again, and a source's
+// track is read whole on its own (see subtitles.read).
+func carryOnPull(ctx context.Context, cfg core.Config, source *media.Stream, stale bool, sp *spool.Spool, refresh RefreshFunc) *pull {
+	pu := &pull{cfg: cfg, source: source, refresh: refresh, subTrack: -1, spool: sp, stale: stale, done: make(chan struct{})}
+	go pu.logProgress(ctx)
+	go pu.run(ctx)
+	return pu
+}
+
+// finishedPull stands in for the pull that filled sp, a complete spool kept
+// from an earlier cast: there is nothing left to fetch.
+func finishedPull(sp *spool.Spool) *pull {
+	sp.CloseWrite(nil)
+	pu := &pull{spool: sp, subTrack: -1, done: make(chan struct{})}
+	close(pu.done)
+	return pu
+}
+
+// start runs one puller ffmpeg reading src, its output's clock shifted by
+// offset.
+func (p *pull) start(ctx context.Context, src ffmpeg.NetworkSource, offset time.Duration) (*ffmpeg.Process, error) {
+	pullOpts := ffmpeg.PullOptions{
+		Source:        src,
 		Verbose:       slog.Default().Enabled(ctx, slog.LevelDebug),
-		PCM:           wantPCM,
+		Unpaced:       p.unpaced,
+		PCM:           p.wantPCM,
 		PCMSampleRate: whisper.SampleRate,
-	})
+		Subtitles:     p.subTrack >= 0,
+		SubtitleTrack: p.subTrack,
+		OutputOffset:  offset,
+	}
+	args := ffmpeg.PullArgs(pullOpts)
 
-	var opts []ffmpeg.StartOption
-	if wantPCM {
-		opts = append(opts, ffmpeg.WithExtraPipe())
+	opts := []ffmpeg.StartOption{ffmpeg.WithStderrWatch(countReconnect)}
+	if n := pullOpts.Pipes(); n > 0 {
+		opts = append(opts, ffmpeg.WithExtraPipes(n))
 	}
-	proc, err := ffmpeg.Start(ctx, cfg.FFmpegPath, args, opts...)
+	proc, err := ffmpeg.Start(ctx, p.cfg.Transcode.FFmpegPath, args, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("starting puller ffmpeg: %w", err)
+		return nil, metrics.Fail(ctx, "pull", fmt.Errorf("starting puller ffmpeg: %w", err))
 	}
 
 	slog.InfoContext(ctx, "upstream pull started",
-		"pcm", wantPCM,
-		"source", resolved.URL.String(),
-		"header_keys", slices.Sorted(maps.Keys(resolved.Headers)),
+		"pcm", p.wantPCM,
+		"subtitles", p.subTrack >= 0,
+		"source", src.URL.String(),
+		"seek", src.Seek,
+		"header_keys", slices.Sorted(maps.Keys(src.Headers)),
 	)
 	// Full invocation at debug so the pull can be reproduced by hand
 	// (ffmpeg <args>) to isolate source/network from the rest of the pipeline.
-	slog.DebugContext(ctx, "puller ffmpeg command", "path", cfg.FFmpegPath, "args", args)
-
-	pu := &pull{pcm: proc.Extra, proc: proc, spool: sp, done: make(chan struct{})}
-	go pu.logProgress(ctx)
-	go pu.run(ctx)
-	return pu, nil
+	slog.DebugContext(ctx, "puller ffmpeg command", "path", p.cfg.Transcode.FFmpegPath, "args", args)
+	return proc, nil
 }
 
-// run copies the remuxed stream into the spool and settles the pull's
-// terminal state. The spool's write side is always closed on return.
+// run copies the remuxed stream into the spool, resuming it while it breaks
+// and may be, and settles the pull's terminal state. The spool's write side,
+// and the PCM and subtitle feeds, are always closed on return.
 func (p *pull) run(ctx context.Context) {
 	defer close(p.done)
-	_, copyErr := io.Copy(p.spool, p.proc.Stdout)
-	waitErr := p.proc.Wait()
+	var err error
+	resumes := maxPullResumes
+	switch {
+	case p.proc != nil:
+		err = p.drain(ctx, p.proc, countingWriter{p.spool})
+	case !p.stale:
+		slog.InfoContext(ctx, "carrying on the pull of a cached spool", "spooled_bytes", p.spool.Size())
+		proc, w, rerr := p.resumeFrom(ctx, p.source)
+		if err = rerr; err == nil {
+			err = p.drain(ctx, proc, w)
+		}
+	default:
+		// With no source to read, a carried-on pull's first puller is a
+		// resume, which does not count against the budget.
+		slog.InfoContext(ctx, "carrying on the pull of a cached spool from a freshly extracted source", "spooled_bytes", p.spool.Size())
+		err = errCarryOn
+		resumes++
+	}
+	for range resumes {
+		if err == nil || ctx.Err() != nil || p.refresh == nil {
+			break
+		}
+		if err != errCarryOn {
+			slog.WarnContext(ctx, "upstream pull broke, resuming it from a freshly extracted source",
+				"error", err,
+				"spooled_bytes", p.spool.Size(),
+			)
+		}
+		proc, w, rerr := p.resume(ctx)
+		if rerr != nil {
+			err = fmt.Errorf("%w (resuming: %w)", err, rerr)
+			break
+		}
+		err = p.drain(ctx, proc, w)
+	}
 
-	err := cmp.Or(copyErr, waitErr)
 	if err != nil && ctx.Err() == nil {
-		p.proc.LogStderrTail(ctx, "puller ffmpeg stderr")
-		err = fmt.Errorf("upstream pull: %w", err)
+		err = metrics.Fail(ctx, "pull", fmt.Errorf("upstream pull: %w", err))
 	} else if ctx.Err() != nil {
 		err = ctx.Err()
 	}
 	p.err = err
 	p.spool.CloseWrite(err)
+	for _, w := range []*io.PipeWriter{p.pcmW, p.srtW} {
+		if w != nil {
+			_ = w.Close()
+		}
+	}
 
 	if err == nil {
 		slog.InfoContext(ctx, "upstream pull complete", "spooled_bytes", p.spool.Size())
 	}
 }
 
+// drain copies one puller's output to w, and its PCM and subtitles into their
+// feeds, until it exits.
+func (p *pull) drain(ctx context.Context, proc *ffmpeg.Process, w io.Writer) error {
+	var feeds []*io.PipeWriter // in the order PullArgs routes them to pipes
+	if p.pcmW != nil {
+		feeds = append(feeds, p.pcmW)
+	}
+	if p.srtW != nil {
+		feeds = append(feeds, p.srtW)
+	}
+	var wg sync.WaitGroup
+	for i, feed := range feeds {
+		extra := proc.Extras[i]
+		wg.Go(func() {
+			// A consumer that stopped reading must not stall the puller on a
+			// full pipe.
+			if _, err := io.Copy(feed, extra); err != nil {
+				_, _ = io.Copy(io.Discard, extra)
+			}
+		})
+	}
+	_, copyErr := io.Copy(w, proc.Stdout)
+	wg.Wait()
+	waitErr := proc.Wait()
+
+	err := cmp.Or(copyErr, waitErr)
+	if err != nil && ctx.Err() == nil {
+		proc.LogStderrTail(ctx, "puller ffmpeg stderr")
+	}
+	return err
+}
+
+// resume starts a puller on the source extracted afresh (see resumeFrom).
+func (p *pull) resume(ctx context.Context) (*ffmpeg.Process, io.Writer, error) {
+	fresh, err := p.refresh(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("extracting the source again: %w", err)
+	}
+	resolved, err := core.RefreshSource(ctx, p.cfg, fresh, p.source)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.resumeFrom(ctx, resolved)
+}
+
+// resumeFrom starts a puller on resolved, reading from the media time the
+// spool reaches, and returns it with the writer that splices its output onto
+// the spool. A live source has no time to seek to: it is joined at its edge,
+// its clock still carried on from the spool's.
+func (p *pull) resumeFrom(ctx context.Context, resolved *media.Stream) (*ffmpeg.Process, io.Writer, error) {
+	// A puller killed mid-packet leaves a torn one; padding it out keeps the
+	// spool on the packet grid everything that seeks in it relies on.
+	if torn := p.spool.Size() % fileserve.TSPacketSize; torn != 0 {
+		pad := bytes.Repeat([]byte{0xff}, int(fileserve.TSPacketSize-torn))
+		if _, err := (countingWriter{p.spool}).Write(pad); err != nil {
+			return nil, nil, err
+		}
+	}
+	f, err := os.Open(p.spool.Path())
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening spool to resume: %w", err)
+	}
+	first, last, ok := fileserve.PCRSpan(f, p.spool.Size())
+	_ = f.Close()
+	if !ok {
+		return nil, nil, fmt.Errorf("the spool has no clock to resume by")
+	}
+	at := fileserve.PCRSince(first, last)
+
+	src := ffmpeg.NewNetworkSource(resolved, p.cfg.Transcode.RWTimeout)
+	from := at
+	if resolved.Live {
+		from = 0
+	} else {
+		src.Seek = at
+	}
+	proc, err := p.start(ctx, src, at)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.mu.Lock()
+	p.source, p.proc = resolved, proc
+	p.mu.Unlock()
+	slog.InfoContext(ctx, "upstream pull resumed", "at", at)
+	return proc, &keyframeSplice{w: countingWriter{p.spool}, first: first, from: from}, nil
+}
+
+// keyframeSplice writes a resumed puller's output on from its first keyframe
+// at or past from, by the clock of the spool whose first PCR is first. What
+// comes before is already spooled, or lies before where the old pull broke.
+// Cutting forward rather than back keeps the spool's timestamps rising, at
+// the cost of the part of a GOP the old pull did not finish.
+type keyframeSplice struct {
+	w     io.Writer
+	first uint64
+	from  time.Duration
+
+	buf []byte // output not yet a whole packet, before the cut
+	cut bool
+}
+
+func (k *keyframeSplice) Write(b []byte) (int, error) {
+	if k.cut {
+		return k.w.Write(b)
+	}
+	k.buf = append(k.buf, b...)
+	for len(k.buf) >= fileserve.TSPacketSize {
+		pcr, key := fileserve.KeyframePCR(k.buf[:fileserve.TSPacketSize])
+		if key && fileserve.PCRSince(k.first, pcr) >= k.from {
+			k.cut = true
+			if _, err := k.w.Write(k.buf); err != nil {
+				return 0, err
+			}
+			k.buf = nil
+			return len(b), nil
+		}
+		k.buf = k.buf[fileserve.TSPacketSize:]
+	}
+	return len(b), nil
+}
+
 // logProgress reports the download at INFO every few seconds — a rate of 0
 // makes a throttled or stalled CDN immediately visible instead of a silent
-// hang.
+// hang. The same sample feeds the pull-rate metric, zeroed once the pull ends.
 func (p *pull) logProgress(ctx context.Context) {
 	const interval = 10 * time.Second
 	tick := time.NewTicker(interval)
 	defer tick.Stop()
+	defer metrics.PullRate.Set(0)
 	var last int64
 	for {
 		select {
@@ -109,15 +365,36 @@ func (p *pull) logProgress(ctx context.Context) {
 			return
 		case <-tick.C:
 			size := p.spool.Size()
+			rate := (size - last) / int64(interval.Seconds())
 			slog.DebugContext(ctx, "pull progress",
 				"spooled_bytes", size,
-				"rate_bytes_per_sec", (size-last)/int64(interval.Seconds()),
+				"rate_bytes_per_sec", rate,
 			)
+			metrics.PullRate.Set(float64(rate))
 			last = size
 		}
 	}
 }
 
+// countingWriter feeds the pull's spool writes into the byte metrics.
+type countingWriter struct{ w io.Writer }
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	metrics.PullBytes.Add(int64(n))
+	metrics.SpoolBytes.Add(float64(n))
+	return n, err
+}
+
+// countReconnect counts ffmpeg's own upstream reconnects, which it reports only
+// as a stderr warning ("Will reconnect at <offset> in <n> second(s)"). A run of
+// them is the first sign of a CDN throttling the pull.
+func countReconnect(line string) {
+	if strings.Contains(line, "Will reconnect at") {
+		metrics.Reconnects.Inc()
+	}
+}
+
 // Done is closed when the download has finished (cleanly or not) and the
 // spool's write side is closed.
 func (p *pull) Done() <-chan struct{} { return p.done }
@@ -132,4 +409,11 @@ func (p *pull) Err() error { return p.err }
 // otherwise dump these lines) never runs. An empty tail means ffmpeg
 // connected but emitted nothing; lines like "Server returned 403/404" mean
 // the link is expired or blocked.
-func (p *pull) StderrTail() []string { return p.proc.StderrTail() }
+func (p *pull) StderrTail() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.proc == nil {
+		return nil
+	}
+	return p.proc.StderrTail()
+}
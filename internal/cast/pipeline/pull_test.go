@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
+)
+
+// tsPacket is a TS packet carrying PCR base pcr, flagged a keyframe when key.
+func tsPacket(pcr uint64, key bool) []byte {
+	p := make([]byte, fileserve.TSPacketSize)
+	p[0], p[3], p[4], p[5] = 0x47, 0x30, 7, 0x10
+	if key {
+		p[5] |= 0x40
+	}
+	p[6], p[7], p[8], p[9], p[10] = byte(pcr>>25), byte(pcr>>17), byte(pcr>>9), byte(pcr>>1), byte(pcr<<7)
+	return p
+}
+
+// TestKeyframeSplice pins how a resumed pull joins the spool: nothing before
+// its first keyframe at or past the resume point, everything from it on, in
+// whatever pieces the puller's output arrives.
+func TestKeyframeSplice(t *testing.T) {
+	const first = 90_000
+	var out []byte
+	for s := range 6 {
+		pcr := uint64(first + s*90_000)
+		out = append(out, tsPacket(pcr, s%2 == 0)...)
+		out = append(out, tsPacket(pcr+45_000, false)...)
+	}
+
+	var spool bytes.Buffer
+	w := &keyframeSplice{w: &spool, first: first, from: 3 * time.Second}
+	for piece := range slices.Chunk(out, 100) {
+		if n, err := w.Write(piece); err != nil || n != len(piece) {
+			t.Fatalf("Write() = %d, %v, want %d, nil", n, err, len(piece))
+		}
+	}
+	// Second 3 is no keyframe; second 4 is, and is where the splice starts.
+	if want := out[8*fileserve.TSPacketSize:]; !bytes.Equal(spool.Bytes(), want) {
+		t.Errorf("spliced %d bytes, want the %d from the keyframe at 4s", spool.Len(), len(want))
+	}
+}
@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/cast/subtitle/cue"
+)
+
+// recordMuxers maps the extensions a recording may take to their muxers. Only
+// matroska carries the transcript as a subtitle track as well as the sidecar
+// .srt every recording keeps it in beside the file.
+var recordMuxers = map[string]string{
+	".mkv": "matroska",
+	".mp4": "mp4",
+	".ts":  "mpegts",
+}
+
+// CheckRecord reports whether path names a recording castor can write, so a
+// caller can reject it before casting rather than after the movie.
+func CheckRecord(path string) error {
+	if _, ok := recordMuxers[strings.ToLower(filepath.Ext(path))]; !ok {
+		return fmt.Errorf("cannot record to %q: want a .mkv, .mp4 or .ts file", path)
+	}
+	return nil
+}
+
+// recorder keeps a served cast as a finished file once it ends. A served cast
+// already holds the whole stream locally (the read-once spool, or the replay
+// server's spool of a remux), so keeping it is a local stream-copy, never a
+// second pull. A recorder with no path records nothing, which lets the served
+// paths wire one unconditionally and fill it in as their stages come up.
+type recorder struct {
+	path       string
+	ffmpegPath string
+
+	// input is the local copy, empty until the stage producing it starts.
+	input string
+	// done is closed once input is complete; nil when it is by the time the
+	// cast returns.
+	done <-chan struct{}
+	// cues is the live transcript, nil on a cast without whisper.
+	cues *cue.Builder
+	// sidecar keeps the transcript beside path only, even when the muxer
+	// could carry it as a track.
+	sidecar bool
+}
+
+// finish saves the recording and folds its outcome into the cast's. It runs
+// whatever ended the cast, so a stopped or interrupted cast still keeps what
+// was watched; the save is detached from ctx's cancellation for that reason.
+// A failed save fails an otherwise clean cast and is only logged when the cast
+// had already failed. Call it once every stage writing input or cues has
+// stopped.
+func (r *recorder) finish(ctx context.Context, castErr error) error {
+	if r.path == "" {
+		return castErr
+	}
+	if r.done != nil {
+		<-r.done
+	}
+	ctx = context.WithoutCancel(ctx)
+	if fi, err := os.Stat(r.input); r.input == "" || err != nil || fi.Size() == 0 {
+		slog.WarnContext(ctx, "nothing to record: the cast ended before any media arrived", "path", r.path)
+		return castErr
+	}
+	err := r.save(ctx)
+	switch {
+	case err == nil:
+		slog.InfoContext(ctx, "recording saved", "path", r.path)
+		return castErr
+	case castErr == nil:
+		return err
+	default:
+		slog.WarnContext(ctx, "recording failed", "path", r.path, "error", err)
+		return castErr
+	}
+}
+
+func (r *recorder) save(ctx context.Context) error {
+	ext := filepath.Ext(r.path)
+	opts := ffmpeg.RecordOptions{
+		Input:  r.input,
+		Muxer:  recordMuxers[strings.ToLower(ext)],
+		Output: r.path,
+	}
+	if r.cues != nil {
+		if cues := r.cues.Cues(); len(cues) > 0 {
+			// The sidecar is kept even beside a recording that carries the
+			// track: it is the transcript to correct and bring back next time
+			// with --subtitles, which a track inside the file is not.
+			srt := strings.TrimSuffix(r.path, ext) + ".srt"
+			if err := writeSRT(srt, cues); err != nil {
+				return err
+			}
+			if opts.Muxer == "matroska" && !r.sidecar {
+				opts.Subtitles = srt
+			}
+		}
+	}
+
+	args := ffmpeg.RecordArgs(opts)
+	slog.DebugContext(ctx, "recording ffmpeg command", "path", r.ffmpegPath, "args", args)
+	proc, err := ffmpeg.Start(ctx, r.ffmpegPath, args)
+	if err != nil {
+		return fmt.Errorf("starting recording ffmpeg: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, proc.Stdout)
+	if err := proc.Wait(); err != nil {
+		proc.LogStderrTail(ctx, "recording ffmpeg stderr")
+		return fmt.Errorf("recording to %s: %w", r.path, err)
+	}
+	return nil
+}
+
+func writeSRT(path string, cues []cue.Cue) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating subtitle file: %w", err)
+	}
+	if err := cue.WriteSRT(f, cues); err != nil {
+		f.Close()
+		return fmt.Errorf("writing subtitle file: %w", err)
+	}
+	return f.Close()
+}
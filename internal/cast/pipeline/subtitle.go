@@ -1,19 +1,28 @@
 package pipeline
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
+	"github.com/stupside/castor/internal/cast/cache"
+	"github.com/stupside/castor/internal/cast/core"
 	"github.com/stupside/castor/internal/cast/ffmpeg"
 	"github.com/stupside/castor/internal/cast/subtitle"
 	"github.com/stupside/castor/internal/cast/subtitle/cue"
 	"github.com/stupside/castor/internal/cast/subtitle/whisper"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/metrics"
 )
 
 const (
@@ -24,41 +33,269 @@ const (
 	// accurate, so this doesn't need to be exact.
 	cueLeadBias = 1.0
 
-	// cueWrapColumns is where subtitle lines wrap. ~42 columns matches
-	// broadcast subtitle conventions and keeps two lines inside the safe
-	// area at the drawtext font size.
-	cueWrapColumns = 42
+	// subtitleFileLimit bounds a viewer's subtitle file, which is read whole. A
+	// film's SubRip is ~100 KiB and a heavily typeset ASS a few MiB; a URL
+	// answering with more is not serving subtitles.
+	subtitleFileLimit = 32 << 20
 )
 
-// subtitles is the burn-in transcription stage: an in-process whisper model
-// fed by the puller's PCM tee, whose cues are drawn into the video by the
-// encoder's drawtext filter via a live-swapped textfile. It is the mechanism
-// behind a plan's SubtitleBurnIn mode; SubtitleOff never constructs one. A
-// future SubtitleSidecar (Stage 2) is a separate stage, not a mode of this one.
+// subtitles is the cue stage: it fills a cue.Builder whose cues are drawn into
+// the video by the encoder's drawtext filter via a live-swapped textfile. It is
+// the mechanism behind a plan's SubtitleBurnIn mode, and the source of the file
+// a SubtitleSidecar serves; SubtitleOff never constructs one. The cues come
+// from one of four places:
+//
+//   - an in-process whisper model fed by the puller's PCM tee.
+//   - a transcript cached whole from an earlier cast of the title, with no
+//     transcriber: its cues are all there before playback starts.
+//   - the source's own subtitle track, read out by the pull itself when it is
+//     muxed into the stream, by an ffmpeg of its own otherwise (see read). The
+//     source's own is preferred over whisper whenever resolution picked one.
+//   - a file the viewer brought (see externalSubtitles), preferred over all
+//     the rest and whole before the cast starts. An ASS file is drawn by libass
+//     rather than drawtext, so it keeps its styling.
 type subtitles struct {
-	tr      *whisper.Transcriber
+	tr      *whisper.Transcriber // nil for a cached transcript or a source track
+	kind    string               // a transcript's task and language (see subtitle.Whisper.Transcript)
+	track   *media.SubtitleTrack // the source's own track, nil for a transcript
 	builder *cue.Builder
 	cuePath string
+
+	// style is how the cues are drawn (the config's subtitles.style), with
+	// the zero value resolved to the defaults: its MaxChars is the width the
+	// builder shapes cues for and the cue writer wraps them at.
+	style subtitle.Style
+
+	// external is set for the viewer's own file, and ass, when that file is an
+	// ASS script, to its copy in the work directory shifted by the offset,
+	// which attach has libass draw in place of drawtext.
+	external bool
+	ass      string
+
+	// transcribed is set once the transcriber has run to the end of the feed,
+	// or the source's track has been read to its end. Read it only after the
+	// errgroup running the stage has been waited, or after done is closed.
+	transcribed bool
+
+	// done is closed once a source track's read has ended, whole or not.
+	done chan struct{}
 }
 
 // newSubtitles prepares the transcription stage when whisper is enabled,
 // returning nil otherwise (a subtitle-less cast). Whisper init failure also
 // downgrades to nil rather than blocking playback: the cast proceeds without
 // burn-in instead of failing outright.
-func newSubtitles(ctx context.Context, whisperCfg subtitle.Whisper, workDir string) *subtitles {
-	if !whisperCfg.Enable {
+func newSubtitles(ctx context.Context, cfg core.Config, workDir string) *subtitles {
+	if !cfg.Whisper.Enable {
 		return nil
 	}
-	tr, err := whisper.New(ctx, whisperCfg)
+	tr, err := whisper.New(ctx, cfg.Whisper)
 	if err != nil {
 		slog.WarnContext(ctx, "whisper init failed; casting without subtitles", "error", err)
 		return nil
 	}
+	if i := slices.IndexFunc(cfg.Resolver.SubtitleLanguages, func(l string) bool { return l != "" }); i >= 0 {
+		if lang := cfg.Resolver.SubtitleLanguages[i]; !cfg.Whisper.Writes(lang) {
+			slog.WarnContext(ctx, "whisper writes what is spoken and translates only into English; subtitles are in the language asked for only if the film is", "language", lang)
+		}
+	}
+	style := cfg.SubtitleStyle.OrDefault()
 	return &subtitles{
 		tr:      tr,
-		builder: cue.NewBuilder(),
+		kind:    cfg.Whisper.Transcript(),
+		builder: cue.NewBuilder(style.MaxChars),
+		cuePath: filepath.Join(workDir, "cue.txt"),
+		style:   style,
+	}
+}
+
+// cachedSubtitles burns in the finished transcript meta kept from an earlier
+// cast of the title, drawn in style.
+func cachedSubtitles(meta cache.Meta, style subtitle.Style, workDir string) *subtitles {
+	return &subtitles{
+		kind:        meta.Whisper,
+		builder:     cue.Restore(meta.Cues),
+		cuePath:     filepath.Join(workDir, "cue.txt"),
+		style:       style.OrDefault(),
+		transcribed: true,
+	}
+}
+
+// sourceSubtitles shows track, the source's own subtitles, drawn in style
+// once read runs.
+func sourceSubtitles(track media.SubtitleTrack, style subtitle.Style, workDir string) *subtitles {
+	style = style.OrDefault()
+	return &subtitles{
+		track:   &track,
+		builder: cue.NewBuilder(style.MaxChars),
 		cuePath: filepath.Join(workDir, "cue.txt"),
+		style:   style,
+		done:    make(chan struct{}),
+	}
+}
+
+// externalSubtitles loads the viewer's subtitle file, cfg.Subtitles, whole:
+// SubRip and WebVTT into cues for drawtext, an ASS script as cues too (for a
+// recording's soft track) and as a copy libass draws with its styling. Every
+// cue is moved by the file's offset. Unlike a failed transcription, a file that
+// cannot be read fails the cast: the viewer asked for it by name, and a cast
+// without it is not the one they asked for.
+func externalSubtitles(ctx context.Context, cfg core.Config, workDir string) (*subtitles, error) {
+	ext := cfg.Subtitles
+	data, err := readSubtitleFile(ctx, ext, cfg.Network.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	style := cfg.SubtitleStyle.OrDefault()
+	s := &subtitles{
+		builder:     cue.NewBuilder(style.MaxChars),
+		cuePath:     filepath.Join(workDir, "cue.txt"),
+		style:       style,
+		transcribed: true,
+		external:    true,
+	}
+	by := ext.Offset.Seconds()
+	add := func(c cue.Cue) {
+		c.Start, c.End = max(c.Start+by, 0), c.End+by
+		if c.End > 0 {
+			s.builder.Append(c)
+		}
+	}
+	if isASS(data) {
+		if err := cue.ReadASS(bytes.NewReader(data), add); err != nil {
+			return nil, err
+		}
+		s.ass = filepath.Join(workDir, "subtitles.ass")
+		if err := writeShiftedASS(s.ass, data, by); err != nil {
+			return nil, err
+		}
+	} else if err := cue.ReadSRT(bytes.NewReader(data), add); err != nil {
+		return nil, err
+	}
+	n := len(s.builder.Cues())
+	if n == 0 {
+		return nil, fmt.Errorf("no subtitles in %s: it is not SubRip, WebVTT or ASS", ext.Location)
+	}
+	slog.InfoContext(ctx, "subtitle file loaded", "location", ext.Location, "cues", n, "offset", ext.Offset, "styled", s.ass != "")
+	return s, nil
+}
+
+// readSubtitleFile reads ext from disk or, for a URL, over HTTP within timeout.
+func readSubtitleFile(ctx context.Context, ext subtitle.External, timeout time.Duration) ([]byte, error) {
+	var r io.Reader
+	if ext.Remote() {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ext.Location, nil)
+		if err != nil {
+			return nil, fmt.Errorf("fetching subtitles: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("fetching subtitles: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching subtitles %s: HTTP %d", ext.Location, resp.StatusCode)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(ext.Location)
+		if err != nil {
+			return nil, fmt.Errorf("opening subtitles: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(io.LimitReader(r, subtitleFileLimit+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading subtitles %s: %w", ext.Location, err)
+	}
+	if len(data) > subtitleFileLimit {
+		return nil, fmt.Errorf("subtitles %s are over %d MiB: not a subtitle file", ext.Location, subtitleFileLimit>>20)
+	}
+	return data, nil
+}
+
+// isASS reports whether data is an ASS or SSA script, which opens on its
+// [Script Info] section whatever its file is named.
+func isASS(data []byte) bool {
+	head := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\ufeff")), " \t\r\n")
+	return len(head) >= len("[Script Info]") && bytes.EqualFold(head[:len("[Script Info]")], []byte("[Script Info]"))
+}
+
+// writeShiftedASS writes the ASS script data to path moved by by seconds.
+func writeShiftedASS(path string, data []byte, by float64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("writing subtitles: %w", err)
+	}
+	if err := cue.ShiftASS(bytes.NewReader(data), f, by); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing subtitles: %w", err)
+	}
+	return nil
+}
+
+// burnFile is the file an encode with no cue writer draws with libass (see
+// ffmpeg.EncodeOptions.SubtitleFile): the shifted ASS script, or for SubRip
+// and WebVTT the cues, shifted, written out as SubRip.
+func (s *subtitles) burnFile(workDir string) (string, error) {
+	if s.ass != "" {
+		return s.ass, nil
+	}
+	path := filepath.Join(workDir, "subtitles.srt")
+	if err := writeSRT(path, s.builder.Cues()); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// transcript reports whether the cues are whisper's, the one kind the spool
+// cache keeps with a title: a source's track is read again on every cast, and
+// the viewer's file is theirs to bring.
+func (s *subtitles) transcript() bool { return s.track == nil && !s.external }
+
+// transcribes reports whether the stage needs the puller's PCM tee.
+func (s *subtitles) transcribes() bool { return s != nil && s.tr != nil }
+
+// muxedTrack is the source's track the puller's subtitle tee reads (s:N): one
+// muxed into the stream, which the pull has in hand anyway. It is -1 for a
+// rendition, a playlist of its own the pull never opens, and for no track.
+func (s *subtitles) muxedTrack() int {
+	if s == nil || s.track == nil || s.track.Rendition() {
+		return -1
 	}
+	return s.track.Index
+}
+
+// follow starts filling the cues in g from wherever they come from: pl's PCM
+// feed for a transcriber, its subtitle feed or the source for the source's
+// own track. A cached transcript is already whole and needs nothing started.
+func (s *subtitles) follow(ctx context.Context, g *errgroup.Group, cfg core.Config, source *media.Stream, pl *pull) {
+	switch {
+	case s.tr != nil:
+		s.transcribe(ctx, g, pl.pcm)
+	case s.track != nil && pl.srt != nil:
+		s.readPull(ctx, g, pl)
+	case s.track != nil:
+		s.read(ctx, g, cfg, source)
+	}
+}
+
+// frontier is how far the cues reach: for a cached transcript or a source
+// track, the end of the last one in.
+func (s *subtitles) frontier() float64 {
+	if s.tr != nil {
+		return s.tr.LatestEnd()
+	}
+	if cues := s.builder.Cues(); len(cues) > 0 {
+		return cues[len(cues)-1].End
+	}
+	return 0
 }
 
 // transcribe consumes the PCM feed in g until EOF. If transcription fails,
@@ -67,19 +304,128 @@ func newSubtitles(ctx context.Context, whisperCfg subtitle.Whisper, workDir stri
 func (s *subtitles) transcribe(ctx context.Context, g *errgroup.Group, pcm io.ReadCloser) {
 	g.Go(func() error {
 		defer pcm.Close()
-		if err := s.tr.Run(ctx, pcm, s.builder); err != nil && ctx.Err() == nil {
+		err := metrics.Fail(ctx, "transcribe", s.tr.Run(ctx, pcm, s.builder))
+		if err != nil && ctx.Err() == nil {
 			slog.WarnContext(ctx, "transcription failed; subtitles stop here", "error", err)
 			_, _ = io.Copy(io.Discard, pcm)
 		}
+		s.transcribed = err == nil
+		return nil
+	})
+}
+
+// readPull reads, in g, the source's own track out of pl's subtitle feed,
+// appending each cue as it arrives. The feed runs as far as the pull does: a
+// pull that breaks for good ends it short, and the track is not whole. A
+// resumed puller reads on from a keyframe before where the last one broke,
+// so a cue it gives again is skipped (see resumedCues).
+func (s *subtitles) readPull(ctx context.Context, g *errgroup.Group, pl *pull) {
+	slog.InfoContext(ctx, "reading the source's subtitles from the pull", "language", s.track.Language)
+	g.Go(func() error {
+		defer close(s.done)
+		defer pl.srt.Close()
+		err := metrics.Fail(ctx, "subtitles", cue.ReadSRT(pl.srt, resumedCues(s.builder.Append)))
+		// Drain what a failed parse left: the feed stalls the pull otherwise.
+		_, _ = io.Copy(io.Discard, pl.srt)
+		<-pl.Done()
+		if err != nil && ctx.Err() == nil {
+			slog.WarnContext(ctx, "reading the source's subtitles failed; subtitles stop here", "error", err)
+		}
+		s.transcribed = err == nil && pl.Err() == nil
+		return nil
+	})
+}
+
+// resumedCues passes each cue on to add but one the feed has given already,
+// which a resumed puller gives again for the stretch it reads twice: the same
+// text starting within a second of where it did.
+func resumedCues(add func(cue.Cue)) func(cue.Cue) {
+	last := map[string]float64{} // each text's latest start
+	return func(c cue.Cue) {
+		if at, ok := last[c.Text]; ok && math.Abs(c.Start-at) < 1 {
+			return
+		}
+		last[c.Text] = c.Start
+		add(c)
+	}
+}
+
+// read runs, in g, the ffmpeg that reads the source's own track out as
+// SubRip, appending each cue as it arrives, so a burn-in has its cues ahead of
+// the encoder long before the whole track is read. It reads a rendition,
+// which is its own playlist, and a muxed track when there is no pull reading
+// the source from its start: a cast from the spool cache. A read that fails
+// costs the cast its subtitles from there on, not the cast, exactly as a
+// failed transcription does.
+func (s *subtitles) read(ctx context.Context, g *errgroup.Group, cfg core.Config, source *media.Stream) {
+	src := ffmpeg.NewNetworkSource(source, cfg.Transcode.RWTimeout)
+	track := s.track.Index
+	if s.track.Rendition() {
+		src.URL, src.ContentType, track = s.track.URL, media.HLS, 0
+	}
+	g.Go(func() error {
+		defer close(s.done)
+		err := metrics.Fail(ctx, "subtitles", s.readTrack(ctx, cfg.Transcode.FFmpegPath, src, track))
+		if err != nil && ctx.Err() == nil {
+			slog.WarnContext(ctx, "reading the source's subtitles failed; subtitles stop here", "error", err)
+		}
+		s.transcribed = err == nil
 		return nil
 	})
 }
 
+// readTrack runs one subtitle read to its end.
+func (s *subtitles) readTrack(ctx context.Context, ffmpegPath string, src ffmpeg.NetworkSource, track int) error {
+	args := ffmpeg.SubtitleArgs(src, track)
+	slog.InfoContext(ctx, "reading the source's subtitles", "language", s.track.Language, "source", src.URL.String())
+	slog.DebugContext(ctx, "subtitle ffmpeg command", "path", ffmpegPath, "args", args)
+	proc, err := ffmpeg.Start(ctx, ffmpegPath, args)
+	if err != nil {
+		return fmt.Errorf("starting subtitle ffmpeg: %w", err)
+	}
+	readErr := cue.ReadSRT(proc.Stdout, s.builder.Append)
+	// Drain what a failed parse left, so the process can exit before Wait.
+	_, _ = io.Copy(io.Discard, proc.Stdout)
+	if err := proc.Wait(); err != nil {
+		if ctx.Err() == nil {
+			proc.LogStderrTail(ctx, "subtitle ffmpeg stderr")
+		}
+		return fmt.Errorf("reading the source's subtitles: %w", err)
+	}
+	return readErr
+}
+
+// sidecar waits for the source's track to be read whole and writes it as an
+// SRT file in workDir, for a renderer that is served it beside the stream.
+// ok is false when the read ended short: a sidecar is loaded once, so a
+// truncated one would be missing the rest of the film for good.
+func (s *subtitles) sidecar(ctx context.Context, workDir string) (path string, ok bool, err error) {
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return "", false, context.Cause(ctx)
+	}
+	if !s.transcribed {
+		return "", false, nil
+	}
+	path = filepath.Join(workDir, "captions.srt")
+	if err := writeSRT(path, s.builder.Cues()); err != nil {
+		return "", false, err
+	}
+	return path, true, nil
+}
+
 // attach wires the burn-in into the encoder options. The cue file must exist
 // before ffmpeg starts or drawtext's filter init fails. Setting
-// opts.SubtitleTextFile is also the signal core.ResolveVideo reads to force a
-// re-encode, so this must run before the copy-vs-encode decision.
+// opts.SubtitleTextFile (or SubtitleFile, for an ASS script libass draws) is
+// also the signal core.ResolveVideo reads to force a re-encode, so this must
+// run before the copy-vs-encode decision.
 func (s *subtitles) attach(opts *ffmpeg.EncodeOptions) error {
+	opts.SubtitleStyle = s.style
+	if s.ass != "" {
+		opts.SubtitleFile = s.ass
+		return nil
+	}
 	if err := os.WriteFile(s.cuePath, nil, 0o644); err != nil {
 		return fmt.Errorf("creating subtitle cue file: %w", err)
 	}
@@ -87,33 +433,47 @@ func (s *subtitles) attach(opts *ffmpeg.EncodeOptions) error {
 	return nil
 }
 
-// follow runs the cue writer in g against the encoder's -progress feed,
-// keeping the textfile holding the line for the frame currently being
-// encoded. It returns when the feed ends (encoder exited). The writer reads
-// cues from the builder and transcription progress through frontier.
-func (s *subtitles) follow(ctx context.Context, g *errgroup.Group, progress io.Reader) {
-	g.Go(func() error {
-		runCueWriter(ctx, progress, s.cuePath, s.builder, s.tr.LatestEnd)
+// progress returns the encoder progress handlers the burn-in lives on: the
+// cue writer and the lead watcher for drawtext, none for libass, which times
+// every cue by the frames themselves.
+func (s *subtitles) progress(ctx context.Context) []func(ffmpeg.Progress) {
+	if s.ass != "" {
 		return nil
-	})
+	}
+	return []func(ffmpeg.Progress){s.cueWriter(ctx), s.leadWatcher()}
 }
 
-// runCueWriter follows the encoder's -progress feed and keeps the cue file
-// holding the subtitle line for the frame currently being encoded. Updates
-// are written to a temp file in the same directory and renamed into place:
-// drawtext re-opens the path before every frame and a partially-written or
-// missing file would kill ffmpeg, so atomic replacement is mandatory. frontier
-// reports how far transcription has committed, logged until the first cue
-// lands so a silent gap is visible in --debug.
-func runCueWriter(ctx context.Context, progress io.Reader, cuePath string, cues *cue.Builder, frontier func() float64) {
+// leadWatcher returns the progress handler that reports how far transcription
+// runs ahead of the encoder, the margin the burn-in lives on.
+func (s *subtitles) leadWatcher() func(ffmpeg.Progress) {
+	return func(p ffmpeg.Progress) { metrics.WhisperLead.Set(s.frontier() - p.Seconds) }
+}
+
+// cueWriter returns the progress handler that keeps the cue textfile holding
+// the line for the frame currently being encoded. It reads cues from the
+// builder and transcription progress through the transcriber's frontier.
+func (s *subtitles) cueWriter(ctx context.Context) func(ffmpeg.Progress) {
+	return newCueWriter(ctx, s.cuePath, s.style.MaxChars, s.builder, s.frontier)
+}
+
+// newCueWriter builds a handler for the encoder's -progress reports that keeps
+// the cue file holding the subtitle line for the frame currently being encoded,
+// wrapped at width columns. Updates are written to a temp file in the same
+// directory and renamed into place: drawtext re-opens the path before every
+// frame and a partially-written or missing file would kill ffmpeg, so atomic
+// replacement is mandatory. frontier reports how far transcription has
+// committed, logged until the first cue lands so a silent gap is visible in
+// --debug.
+func newCueWriter(ctx context.Context, cuePath string, width int, cues *cue.Builder, frontier func() float64) func(ffmpeg.Progress) {
 	tmpPath := cuePath + ".tmp"
 	last := ""
 	calls := 0
 	wroteCue := false
-	ffmpeg.WatchProgress(progress, func(seconds float64) {
+	return func(p ffmpeg.Progress) {
+		seconds := p.Seconds
 		calls++
 		lookup := seconds + cueLeadBias
-		text := cue.Wrap(cues.CueAt(lookup), cueWrapColumns)
+		text := cue.Wrap(cues.CueAt(lookup), width)
 		// Surface the encoder position against how far transcription has
 		// reached until the first cue lands, so a silent gap (encoder ahead
 		// of the commit frontier, or out_time stuck) is visible in --debug.
@@ -143,5 +503,20 @@ func runCueWriter(ctx context.Context, progress io.Reader, cuePath string, cues
 		}
 		slog.DebugContext(ctx, "subtitle cue swapped", "out_time", seconds, "text", text)
 		last = text
+	}
+}
+
+// followProgress runs one reader of the encoder's -progress feed in g and fans
+// each report out to every handler (the cue writer, the control session). There
+// is a single feed per encoder, so its consumers share one follower rather than
+// each owning the pipe. It returns when the feed ends (encoder exited).
+func followProgress(g *errgroup.Group, progress io.Reader, handlers ...func(ffmpeg.Progress)) {
+	g.Go(func() error {
+		ffmpeg.WatchProgress(progress, func(p ffmpeg.Progress) {
+			for _, h := range handlers {
+				h(p)
+			}
+		})
+		return nil
 	})
 }
@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/cast/subtitle"
+	"github.com/stupside/castor/internal/cast/subtitle/cue"
+)
+
+// TestExternalSubtitles covers the viewer's own file: SubRip read into cues for
+// drawtext, moved by the offset with what it moves before zero dropped, and an
+// ASS script, fetched over HTTP, kept as a shifted copy libass draws instead.
+func TestExternalSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	srt := filepath.Join(dir, "film.srt")
+	body := "1\n00:00:01,000 --> 00:00:02,000\nToo early.\n\n2\n00:00:05,000 --> 00:00:07,000\nKept.\n"
+	if err := os.WriteFile(srt, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := core.Config{Subtitles: subtitle.External{Location: srt, Offset: -3 * time.Second}}
+	cfg.Network.Timeout = 5 * time.Second
+
+	subs, err := externalSubtitles(t.Context(), cfg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []cue.Cue{{Start: 2, End: 4, Text: "Kept."}}; !slices.Equal(subs.builder.Cues(), want) {
+		t.Errorf("cues = %+v, want %+v", subs.builder.Cues(), want)
+	}
+	if subs.transcript() {
+		t.Error("the viewer's file must not be cached as a transcript")
+	}
+	var opts ffmpeg.EncodeOptions
+	if err := subs.attach(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.SubtitleTextFile == "" || opts.SubtitleFile != "" {
+		t.Errorf("a SubRip file should be drawn by drawtext, got %+v", opts)
+	}
+
+	ass := "[Script Info]\nScriptType: v4.00+\n\n[Events]\n" +
+		"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n" +
+		"Dialogue: 0,0:00:10.00,0:00:12.00,Default,,0,0,0,,{\\b1}Styled{\\b0}\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(ass))
+	}))
+	defer srv.Close()
+	cfg.Subtitles = subtitle.External{Location: srv.URL + "/subs", Offset: time.Second}
+
+	subs, err = externalSubtitles(t.Context(), cfg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = ffmpeg.EncodeOptions{}
+	if err := subs.attach(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.SubtitleFile == "" || opts.SubtitleTextFile != "" {
+		t.Fatalf("an ASS script should be drawn by libass, got %+v", opts)
+	}
+	shifted, err := os.ReadFile(opts.SubtitleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(shifted), "Dialogue: 0,0:00:11.00,0:00:13.00,Default,,0,0,0,,{\\b1}Styled{\\b0}") {
+		t.Errorf("shifted script keeps its styling and moves its timing, got:\n%s", shifted)
+	}
+	if got := subs.progress(t.Context()); got != nil {
+		t.Error("libass needs no cue writer")
+	}
+
+	cfg.Subtitles = subtitle.External{Location: filepath.Join(dir, "missing.srt")}
+	if _, err := externalSubtitles(t.Context(), cfg, dir); err == nil {
+		t.Error("a missing file must fail the cast")
+	}
+}
+
+// TestResumedCues pins how a resumed pull's subtitle feed joins on: the cues
+// it gives again are skipped, a line said again later is not.
+func TestResumedCues(t *testing.T) {
+	feed := []cue.Cue{
+		{Start: 10, End: 12, Text: "Where were you?"},
+		{Start: 13, End: 14, Text: "Out."},
+		// The puller broke and was resumed from a keyframe at 12.5s.
+		{Start: 13.04, End: 14.04, Text: "Out."},
+		{Start: 15, End: 16, Text: "Where?"},
+		{Start: 40, End: 41, Text: "Out."},
+	}
+	var got []cue.Cue
+	add := resumedCues(func(c cue.Cue) { got = append(got, c) })
+	for _, c := range feed {
+		add(c)
+	}
+	want := slices.Delete(slices.Clone(feed), 2, 3)
+	if !slices.Equal(got, want) {
+		t.Errorf("cues = %v, want %v", got, want)
+	}
+}
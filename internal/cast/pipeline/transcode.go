@@ -1,8 +1,16 @@
 package pipeline
 
 import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
 	"time"
 
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
+	"github.com/stupside/castor/internal/cast/deliver/spool"
 	"github.com/stupside/castor/internal/cast/ffmpeg"
 	"github.com/stupside/castor/internal/media"
 )
@@ -12,6 +20,11 @@ import (
 // network remux stream-copies video and keeps the source's own keyframes.
 const keyframeSeconds = 2
 
+// resumeLookback is how far before a restart point a restarted spool encode
+// starts reading its input: comfortably more than a source's GOP, so the
+// decoder has a keyframe to start from before the point it seeks to.
+const resumeLookback = 10 * time.Second
+
 // spoolEncodeOptions is the base encode invocation for the served spool path:
 // MPEG-TS out, read from the local spool over stdin (PipeFormat), height-capped,
 // and GOP-bounded. ResolveVideo/ResolveAudio and the burn-in attach fill in the
@@ -39,3 +52,66 @@ func remuxNetworkOptions(source *media.Stream, rwTimeout time.Duration, muxer st
 		Source:       ffmpeg.NewNetworkSource(source, rwTimeout),
 	}
 }
+
+// resolveLadder gives an encode served as segmented HLS its rendition ladder
+// (core.ResolveLadder), after ResolveVideo or the remux's stream-copy decided
+// its top rendition, and logs the ladder. An encode delivered any other way
+// keeps its single rendition: only an HLS client switches variants.
+func resolveLadder(ctx context.Context, opts *ffmpeg.EncodeOptions, f media.FormatInfo, caps media.Renderer, src media.ProbeInfo, cfg core.Config) {
+	if f.Delivery != media.DeliverSegmented {
+		return
+	}
+	core.ResolveLadder(ctx, opts, caps, src, cfg)
+	heights := make([]int, len(opts.Renditions))
+	bandwidths := make([]int64, len(opts.Renditions))
+	for i, r := range opts.Renditions {
+		// A copied top rendition keeps the source's height.
+		heights[i], bandwidths[i] = cmp.Or(r.MaxHeight, src.VideoHeight), r.Bandwidth
+	}
+	slog.InfoContext(ctx, "hls rendition ladder", "heights", heights, "bandwidths", bandwidths)
+}
+
+// adaptation lets an encode served as a single MPEG-TS stream step down
+// mid-cast (core.NewAdaptation), resuming it with resume. An encode delivered
+// any other way has none: an HLS client steps down its ladder itself, and an
+// MP4 stream has no clock to splice a restarted encode onto.
+func adaptation(ctx context.Context, opts ffmpeg.EncodeOptions, f media.FormatInfo, caps media.Renderer, src media.ProbeInfo, cfg core.Config, resume func(context.Context, *ffmpeg.EncodeOptions, time.Duration) ([]ffmpeg.StartOption, error)) *core.Adaptation {
+	if f.Delivery != media.DeliverStream || f.ContentType != media.MPEGTS {
+		return nil
+	}
+	return core.NewAdaptation(ctx, opts, caps, src, cfg, resume)
+}
+
+// resumeSpool is the core.Adaptation.Resume of an encode reading sp: it tails
+// the spool from the packet resumeLookback before at, found by the spool's own
+// TS clock, and seeks the rest of the way in the decoder. The tail closes when
+// the restarted encode ends.
+func resumeSpool(sp *spool.Spool) func(context.Context, *ffmpeg.EncodeOptions, time.Duration) ([]ffmpeg.StartOption, error) {
+	return func(ctx context.Context, opts *ffmpeg.EncodeOptions, at time.Duration) ([]ffmpeg.StartOption, error) {
+		f, err := os.Open(sp.Path())
+		if err != nil {
+			return nil, fmt.Errorf("opening spool to resume: %w", err)
+		}
+		size := sp.Size()
+		off, ok := fileserve.SeekPCR(f, sp.Start(), size, max(at-resumeLookback, 0))
+		start, found := fileserve.PCRAt(f, off, size)
+		_ = f.Close()
+		if !ok || !found {
+			return nil, fmt.Errorf("no clock in the spool to resume at %s", at)
+		}
+		tail, err := sp.TailAt(ctx, off)
+		if err != nil {
+			return nil, err
+		}
+		context.AfterFunc(ctx, func() { _ = tail.Close() })
+		opts.Seek = max(at-start, 0)
+		return []ffmpeg.StartOption{ffmpeg.WithStdin(tail), ffmpeg.WithExtraPipe()}, nil
+	}
+}
+
+// resumeFile is the core.Adaptation.Resume of an encode reading a local file,
+// which ffmpeg seeks in itself.
+func resumeFile(_ context.Context, opts *ffmpeg.EncodeOptions, at time.Duration) ([]ffmpeg.StartOption, error) {
+	opts.Seek = at
+	return []ffmpeg.StartOption{ffmpeg.WithExtraPipe()}, nil
+}
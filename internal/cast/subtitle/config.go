@@ -3,18 +3,118 @@
 // planner in core can read it without importing the whisper transcriber.
 package subtitle
 
+import (
+	"cmp"
+	"strings"
+	"time"
+
+	"github.com/stupside/castor/internal/media"
+)
+
 // Whisper holds settings for the in-process whisper.cpp transcriber. It lives
 // here, not in the whisper package, so core.Config can carry it (the planner
 // reads Enable to choose the subtitle axis) without pulling whisper's cgo into
 // the decision core. It is the sole mechanism for enabling subtitle generation;
 // there is no CLI override. Set Enable: true in config.yaml (or
 // CASTOR_WHISPER__ENABLE=true) to opt in. Everything else is self-managed: the
-// transcription and VAD models auto-download to the user cache, and the streaming
-// pipeline needs no tuning.
+// transcription and VAD models auto-download to the user cache (`castor models`
+// lists, fetches and checks them), and the streaming pipeline needs no tuning.
 type Whisper struct {
-	Enable    bool     `yaml:"enable"`
-	ModelPath string   `yaml:"model_path"` // override the auto-downloaded tiny.en model
-	Language  Language `yaml:"language"`   // pin a BCP-47 code, or LanguageAuto to detect
+	Enable bool `yaml:"enable"`
+	// Model names the catalog model to transcribe with (see models.Catalog):
+	// a size, "small" or "medium", taken as its English-only variant when
+	// whisper hears English and translates nothing, or a variant by its own
+	// name, "small.en". Unset is the tiny model.
+	Model     string `yaml:"model" validate:"omitempty,oneof=tiny tiny.en base base.en small small.en medium medium.en large-v3-turbo large-v3"`
+	ModelPath string `yaml:"model_path"` // a model file of your own, in place of Model
+	// Language is the language spoken: a BCP-47 code to pin recognition to, or
+	// LanguageAuto to detect it.
+	Language Language `yaml:"language"`
+	// Task is what the subtitles say: the words in the language spoken, or
+	// their English translation. Unset transcribes.
+	Task Task `yaml:"task" validate:"omitempty,oneof=transcribe translate"`
+}
+
+// Task is what whisper writes. whisper.cpp translates into English only.
+type Task string
+
+const (
+	// TaskTranscribe writes what is said, in the language it is said in.
+	TaskTranscribe Task = "transcribe"
+	// TaskTranslate writes what is said in English, whatever is spoken: the
+	// subtitles a foreign film without any of its own wants.
+	TaskTranslate Task = "translate"
+)
+
+// Translates reports whether whisper writes English whatever is spoken.
+func (w Whisper) Translates() bool { return w.Task == TaskTranslate }
+
+// Spoken is the language whisper hears the audio as. Translating, an English
+// pin is dropped for detection: English needs no translating, and English is
+// the pin the config ships with, which would have the model hear a foreign
+// film as English.
+func (w Whisper) Spoken() Language {
+	if w.Translates() && media.LanguageCode(string(w.Language)) == "en" {
+		return LanguageAuto
+	}
+	return w.Language
+}
+
+// Multilingual reports whether w needs a multilingual model: it translates, or
+// hears anything but English. The English-only models are smaller and more
+// accurate for English, and only for English.
+func (w Whisper) Multilingual() bool {
+	return w.Translates() || media.LanguageCode(string(w.Spoken())) != "en"
+}
+
+// In returns w writing subtitles in the first of langs, a cast's
+// --subtitle-lang, most preferred first. Whisper writes either the language
+// spoken or English, so English has it translate whatever is spoken. Any other
+// language it cannot translate into, and is not pinned to either: a film
+// spoken in another would be heard as that one and come out garbled. It
+// transcribes, hearing the audio as configured, but for an English pin (the
+// one the config ships with), which is dropped for detection so a film spoken
+// in the language asked for comes out in it (see Writes). No langs leaves w as
+// configured.
+func (w Whisper) In(langs []string) Whisper {
+	for _, l := range langs {
+		switch code := media.LanguageCode(l); code {
+		case "":
+			continue
+		case "en":
+			w.Task = TaskTranslate
+		default:
+			w.Task = TaskTranscribe
+			if media.LanguageCode(string(w.Language)) == "en" {
+				w.Language = LanguageAuto
+			}
+		}
+		return w
+	}
+	return w
+}
+
+// Writes reports whether the subtitles w writes are sure to be in lang:
+// translating, when lang is English, and transcribing, when lang is the
+// language recognition is pinned to. Detecting, they are in whatever is
+// spoken.
+func (w Whisper) Writes(lang string) bool {
+	code := media.LanguageCode(lang)
+	if w.Translates() {
+		return code == "en"
+	}
+	return code != "" && media.LanguageCode(string(w.Language)) == code
+}
+
+// Transcript names what a transcript made under w is, for a cache that keeps
+// one to tell whether a later cast wants the same: its task and the language
+// heard, e.g. "transcribe:en" or "translate:auto".
+func (w Whisper) Transcript() string {
+	spoken := w.Spoken()
+	if spoken.AutoDetect() {
+		spoken = LanguageAuto
+	}
+	return string(cmp.Or(w.Task, TaskTranscribe)) + ":" + string(spoken)
 }
 
 // Language is a subtitle language: a BCP-47 code (e.g. "en", "fr") the transcriber
@@ -33,3 +133,24 @@ const LanguageAuto Language = "auto"
 func (l Language) AutoDetect() bool {
 	return l == "" || l == LanguageAuto
 }
+
+// External is a subtitle file the viewer brings to one cast (the cast
+// commands' --subtitles): SubRip, WebVTT or ASS, on this machine or at an
+// http(s) URL. Like the cast's bitrate cap it is set per cast, never read from
+// the config file: it belongs to the title being cast, not to the setup.
+type External struct {
+	// Location is the file's path, or its http(s) URL. Empty means none.
+	Location string
+	// Offset shifts every cue by this much: positive shows them later, for a
+	// file timed to a release whose film starts sooner than the one cast.
+	Offset time.Duration
+}
+
+// Set reports whether the cast was given a file.
+func (e External) Set() bool { return e.Location != "" }
+
+// Remote reports whether the file is fetched over HTTP rather than read from
+// this machine.
+func (e External) Remote() bool {
+	return strings.HasPrefix(e.Location, "http://") || strings.HasPrefix(e.Location, "https://")
+}
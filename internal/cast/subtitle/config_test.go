@@ -0,0 +1,85 @@
+package subtitle
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stupside/castor/internal/cast/subtitle/models"
+)
+
+// TestWhisperIn pins how a cast's --subtitle-lang reaches whisper, which
+// writes only the language spoken or English, and what the transcript it then
+// makes is called in the cache.
+func TestWhisperIn(t *testing.T) {
+	english := Whisper{Enable: true, Language: "en"}
+	tests := []struct {
+		name         string
+		cfg          Whisper
+		langs        []string
+		want         Whisper
+		transcript   string
+		multilingual bool
+	}{
+		{"none keeps the config", english, nil, english, "transcribe:en", false},
+		{"english translates what is heard", english, []string{"en"}, Whisper{Enable: true, Language: "en", Task: TaskTranslate}, "translate:auto", true},
+		{"english keeps a foreign pin", Whisper{Language: "ja"}, []string{"eng"}, Whisper{Language: "ja", Task: TaskTranslate}, "translate:ja", true},
+		{"another language detects what is heard", english, []string{"fre", "en"}, Whisper{Enable: true, Language: LanguageAuto, Task: TaskTranscribe}, "transcribe:auto", true},
+		{"another language keeps a foreign pin", Whisper{Language: "ja", Task: TaskTranslate}, []string{"pt-BR"}, Whisper{Language: "ja", Task: TaskTranscribe}, "transcribe:ja", true},
+		{"blanks are skipped", Whisper{Language: LanguageAuto, Task: TaskTranslate}, []string{"", "de"}, Whisper{Language: LanguageAuto, Task: TaskTranscribe}, "transcribe:auto", true},
+		{"unset detects", Whisper{}, nil, Whisper{}, "transcribe:auto", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cfg.In(tt.langs)
+			if got != tt.want {
+				t.Errorf("In(%q) = %+v, want %+v", tt.langs, got, tt.want)
+			}
+			if k := got.Transcript(); k != tt.transcript {
+				t.Errorf("Transcript() = %q, want %q", k, tt.transcript)
+			}
+			if m := got.Multilingual(); m != tt.multilingual {
+				t.Errorf("Multilingual() = %v, want %v", m, tt.multilingual)
+			}
+		})
+	}
+}
+
+// TestWhisperWrites pins when whisper's subtitles are in the language a cast
+// asked for: English translating, the pinned language transcribing.
+func TestWhisperWrites(t *testing.T) {
+	tests := []struct {
+		cfg  Whisper
+		lang string
+		want bool
+	}{
+		{Whisper{Task: TaskTranslate}, "eng", true},
+		{Whisper{Task: TaskTranslate, Language: "fr"}, "fr", false},
+		{Whisper{Language: "fr"}, "fre", true},
+		{Whisper{Language: "fr"}, "de", false},
+		{Whisper{Language: LanguageAuto}, "de", false},
+		{Whisper{Language: LanguageAuto}, "", false},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.Writes(tt.lang); got != tt.want {
+			t.Errorf("%+v.Writes(%q) = %v, want %v", tt.cfg, tt.lang, got, tt.want)
+		}
+	}
+}
+
+// TestWhisperModelNames keeps whisper.model's validation in step with the
+// model catalog: every whisper model in it can be named, and only those.
+func TestWhisperModelNames(t *testing.T) {
+	f, _ := reflect.TypeFor[Whisper]().FieldByName("Model")
+	_, oneof, _ := strings.Cut(f.Tag.Get("validate"), "oneof=")
+	var want []string
+	for _, m := range models.Catalog {
+		if m.Name != models.VAD {
+			want = append(want, m.Name)
+		}
+	}
+	if got := strings.Fields(oneof); !slices.Equal(got, want) {
+		t.Errorf("whisper.model takes %q, want the catalog's %q", got, want)
+	}
+}
@@ -0,0 +1,186 @@
+package cue
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// assLineLimit bounds one line of an ASS script. A styled line of karaoke or
+// positioned signs runs far past bufio.Scanner's 64 KiB default.
+const assLineLimit = 1 << 20
+
+// assFormat is where an [Events] section's Format line puts the fields a cue
+// needs, and how many fields a line has: the last, Text, may itself hold
+// commas.
+type assFormat struct {
+	fields, start, end, text int
+}
+
+// defaultASSFormat is the Format every ASS and SSA writer emits, for a script
+// whose [Events] section states none.
+var defaultASSFormat = assFormat{fields: 10, start: 1, end: 2, text: 9}
+
+// assEvent is one Dialogue or Comment line of an [Events] section, split by
+// the section's Format.
+type assEvent struct {
+	kind       string // "Dialogue" or "Comment"
+	parts      []string
+	start, end float64
+	format     assFormat
+}
+
+// ReadASS reads the Dialogue lines of an ASS (or SSA) script from r, calling
+// each with every one as a cue, in the order the script lists them. A cue is
+// drawn as plain text, so what carries the script's styling is dropped: its
+// override blocks, and any line that is a vector drawing rather than text.
+// \N breaks are kept as line breaks. A line that cannot be read is skipped,
+// as ReadSRT skips a malformed block.
+func ReadASS(r io.Reader, each func(Cue)) error {
+	return scanASS(r, func(_ string, ev *assEvent) {
+		if ev == nil || ev.kind != "Dialogue" || ev.end <= ev.start {
+			return
+		}
+		if text, ok := assText(ev.parts[ev.format.text]); ok {
+			each(Cue{Start: ev.start, End: ev.end, Text: text})
+		}
+	})
+}
+
+// ShiftASS copies the ASS script in r to w with every event moved by by
+// seconds, later when positive, and everything else (styles, fonts, each
+// line's own styling) untouched, so a script timed to another release still
+// draws as its author styled it. An event moved wholly before zero is dropped,
+// and one moved partly before it starts at zero.
+func ShiftASS(r io.Reader, w io.Writer, by float64) error {
+	bw := bufio.NewWriter(w)
+	err := scanASS(r, func(line string, ev *assEvent) {
+		if ev != nil {
+			end := ev.end + by
+			if end <= 0 {
+				return
+			}
+			ev.parts[ev.format.start] = assTime(max(ev.start+by, 0))
+			ev.parts[ev.format.end] = assTime(end)
+			line = ev.kind + ": " + strings.Join(ev.parts, ",")
+		}
+		bw.WriteString(line)
+		bw.WriteByte('\n')
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// scanASS calls each with every line of the ASS script in r, and with the
+// line read as an event when it is a timed one of the [Events] section.
+func scanASS(r io.Reader, each func(line string, ev *assEvent)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, assLineLimit)
+	format := defaultASSFormat
+	events := false
+	first := true
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		if first {
+			trimmed = strings.TrimPrefix(trimmed, "\ufeff")
+			first = false
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			events = strings.EqualFold(trimmed, "[Events]")
+			each(line, nil)
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !events || !ok {
+			each(line, nil)
+			continue
+		}
+		switch key = strings.TrimSpace(key); key {
+		case "Format":
+			format = parseASSFormat(value)
+			each(line, nil)
+		case "Dialogue", "Comment":
+			ev, ok := parseASSEvent(key, value, format)
+			if !ok {
+				each(line, nil)
+				continue
+			}
+			each(line, &ev)
+		default:
+			each(line, nil)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading ASS: %w", err)
+	}
+	return nil
+}
+
+// parseASSFormat reads an [Events] Format line, falling back on the default
+// for one that names no Start, End or Text.
+func parseASSFormat(value string) assFormat {
+	f := assFormat{start: -1, end: -1, text: -1}
+	for i, name := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "start":
+			f.start = i
+		case "end":
+			f.end = i
+		case "text":
+			f.text = i
+		}
+		f.fields = i + 1
+	}
+	if f.start < 0 || f.end < 0 || f.text != f.fields-1 {
+		return defaultASSFormat
+	}
+	return f
+}
+
+// parseASSEvent splits an event line's value by format and reads its timing.
+func parseASSEvent(kind, value string, format assFormat) (assEvent, bool) {
+	parts := strings.SplitN(strings.TrimLeft(value, " "), ",", format.fields)
+	if len(parts) < format.fields {
+		return assEvent{}, false
+	}
+	start, okStart := parseSRTTime(parts[format.start])
+	end, okEnd := parseSRTTime(parts[format.end])
+	if !okStart || !okEnd {
+		return assEvent{}, false
+	}
+	return assEvent{kind: kind, parts: parts, start: start, end: end, format: format}, true
+}
+
+var (
+	// assOverride matches a line's override blocks: {\i1}, {\pos(10,20)}, and
+	// the {comments} authors leave, which a renderer never shows either.
+	assOverride = regexp.MustCompile(`\{[^}]*\}`)
+	// assDrawing matches an override that turns drawing mode on: what follows
+	// is a vector shape, not words.
+	assDrawing = regexp.MustCompile(`\{[^}]*\\p[1-9]`)
+	// assBreaks turns ASS's escaped breaks into text: \N and \n are line breaks,
+	// \h a space that does not break.
+	assBreaks = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ")
+)
+
+// assText is an event's text as plain text, ok false for a drawing or a line
+// with no words.
+func assText(s string) (string, bool) {
+	if assDrawing.MatchString(s) {
+		return "", false
+	}
+	s = strings.TrimSpace(assBreaks.Replace(assOverride.ReplaceAllString(s, "")))
+	return s, s != ""
+}
+
+// assTime formats seconds as ASS's H:MM:SS.cc.
+func assTime(sec float64) string {
+	cs := int64(math.Round(sec * 100))
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360_000, cs/6000%60, cs/100%60, cs%100)
+}
@@ -0,0 +1,65 @@
+package cue
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const assScript = "\ufeff[Script Info]\r\n" +
+	"ScriptType: v4.00+\r\n" +
+	"\r\n" +
+	"[V4+ Styles]\r\n" +
+	"Format: Name, Fontname, Fontsize\r\n" +
+	"Style: Default,Arial,20\r\n" +
+	"\r\n" +
+	"[Events]\r\n" +
+	"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\r\n" +
+	"Dialogue: 0,0:00:01.50,0:00:03.00,Default,,0,0,0,,{\\i1}Hello{\\i0}, there.\r\n" +
+	"Comment: 0,0:00:02.00,0:00:04.00,Default,,0,0,0,,A note to the typesetter\r\n" +
+	"Dialogue: 0,0:00:04.00,0:00:06.00,Default,,0,0,0,,Two\\Nlines, one comma\r\n" +
+	"Dialogue: 0,0:00:05.00,0:00:07.00,Sign,,0,0,0,,{\\p1}m 0 0 l 100 0 100 100{\\p0}\r\n" +
+	"Dialogue: 0,0:01:00.00,1:00:00.00,Default,,0,0,0,,An hour\r\n"
+
+func TestReadASS(t *testing.T) {
+	var got []Cue
+	if err := ReadASS(strings.NewReader(assScript), func(c Cue) { got = append(got, c) }); err != nil {
+		t.Fatal(err)
+	}
+	want := []Cue{
+		{Start: 1.5, End: 3, Text: "Hello, there."},
+		{Start: 4, End: 6, Text: "Two\nlines, one comma"},
+		{Start: 60, End: 3600, Text: "An hour"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ReadASS =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestShiftASS(t *testing.T) {
+	var out strings.Builder
+	if err := ShiftASS(strings.NewReader(assScript), &out, -2); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"\ufeff[Script Info]\n",
+		"Style: Default,Arial,20\n",
+		"Dialogue: 0,0:00:00.00,0:00:01.00,Default,,0,0,0,,{\\i1}Hello{\\i0}, there.\n",
+		"Comment: 0,0:00:00.00,0:00:02.00,Default,,0,0,0,,A note to the typesetter\n",
+		"Dialogue: 0,0:00:58.00,0:59:58.00,Default,,0,0,0,,An hour\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("shifted script is missing %q:\n%s", want, got)
+		}
+	}
+
+	// An event moved wholly before zero is gone.
+	out.Reset()
+	if err := ShiftASS(strings.NewReader(assScript), &out, -3.5); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "Hello") {
+		t.Errorf("an event ending before zero should be dropped:\n%s", out.String())
+	}
+}
@@ -6,30 +6,45 @@
 // screen at time t" via CueAt.
 //
 // It knows nothing about whisper, ffmpeg, or files: a backend feeds words in
-// through Builder.Commit, and a renderer pulls lines out through CueAt. That
+// through Builder.Commit, and a renderer pulls lines out through CueAt (or a
+// whole track through WriteSRT, for a recording's soft subtitles). That
 // keeps all the timing and line-shaping policy here, testable without the
-// cgo-linked recognizer.
+// cgo-linked recognizer. A track someone already shaped (a source's own
+// subtitles or the viewer's file, read through ReadSRT or ReadASS) skips the
+// shaping and goes in whole through Builder.Append.
 package cue
 
 import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"unicode/utf8"
+
+	"github.com/stupside/castor/internal/cast/subtitle"
 )
 
 const (
 	// Cue shaping: a cue closes at a silence gap of cueGapSeconds, after
 	// sentence-final punctuation once it has been on screen at least
-	// cueMinSeconds, or — when it would otherwise overrun the cueMaxChars or
-	// cueMaxSeconds budget — at the most recent natural boundary so the line
-	// never splits mid-phrase. The cueMinSeconds floor also coalesces staccato
-	// one-word sentences ("Yeah." "OK.") that would each otherwise flash for a
-	// few frames, which reads as a burst.
+	// cueMinSeconds, or — when it would otherwise overrun two lines of the
+	// Builder's width or the cueMaxSeconds budget — at the most recent
+	// natural boundary so the line never splits mid-phrase. The cueMinSeconds
+	// floor also coalesces staccato one-word sentences ("Yeah." "OK.") that
+	// would each otherwise flash for a few frames, which reads as a burst.
 	cueGapSeconds = 1.0
 	cueMinSeconds = 1.2
 	cueMaxSeconds = 6.0
-	cueMaxChars   = 84 // two 42-column broadcast lines
+	cueLines      = 2
 
 	// cuePauseSeconds is the inter-word gap that marks a soft phrase boundary:
 	// long enough to read as a natural break, short of the cueGapSeconds
@@ -70,10 +85,28 @@ type Builder struct {
 	cues []Cue
 
 	pending []Word // committed words not yet closed into a cue (Commit-only)
+	width   int    // columns a cue's lines wrap at; 0 means the default style's
 }
 
-// NewBuilder returns an empty Builder.
-func NewBuilder() *Builder { return &Builder{} }
+// NewBuilder returns an empty Builder that shapes cues for lines of width
+// columns: a cue folded from words is cut before it would wrap onto a third.
+// A width of 0 means subtitle.DefaultStyle's MaxChars.
+func NewBuilder(width int) *Builder { return &Builder{width: width} }
+
+// Restore returns a Builder holding cues, a finished track kept from an
+// earlier transcription (see Cues). No more words are fed to it.
+func Restore(cues []Cue) *Builder { return &Builder{cues: slices.Clone(cues)} }
+
+// Append adds c as it is: a cue shaped by whoever wrote it, as a source's own
+// subtitles are, rather than folded from words. Cues may arrive in any order
+// (a track's cues are written in start order, but two overlapping speakers
+// need not be); each is kept at its place by start time, as CueAt expects.
+func (b *Builder) Append(c Cue) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := sort.Search(len(b.cues), func(i int) bool { return b.cues[i].Start > c.Start })
+	b.cues = slices.Insert(b.cues, i, c)
+}
 
 // Commit folds newly committed words into cues. settledTo is the time up to
 // which the audio has been fully decided: a gap between the last pending word
@@ -118,7 +151,7 @@ func (b *Builder) Cues() []Cue {
 // unconditionally. It returns the words still waiting to close.
 func (b *Builder) closeCues(pending []Word, final bool) []Word {
 	for len(pending) > 0 {
-		cut := cueCut(pending)
+		cut := cueCut(pending, cueLines*cmp.Or(b.width, subtitle.DefaultStyle.MaxChars))
 		if cut == 0 {
 			if !final {
 				break
@@ -148,8 +181,8 @@ func (b *Builder) appendCue(words []Word) {
 }
 
 // cueCut returns how many leading words of pending form a complete cue, or 0
-// if no closing signal has arrived yet.
-func cueCut(pending []Word) int {
+// if no closing signal has arrived yet. maxChars is the cue's character budget.
+func cueCut(pending []Word, maxChars int) int {
 	chars := 0
 	lastBreak := 0 // words up to the most recent clause break or pause
 	for i, w := range pending {
@@ -163,8 +196,8 @@ func cueCut(pending []Word) int {
 		span := w.End - pending[0].Start
 
 		// Over budget: end the line at a natural boundary, not mid-phrase.
-		if (chars > cueMaxChars || span >= cueMaxSeconds) && i > 0 {
-			if chars <= cueMaxChars && clauseEnd(w.Text) {
+		if (chars > maxChars || span >= cueMaxSeconds) && i > 0 {
+			if chars <= maxChars && clauseEnd(w.Text) {
 				return i + 1
 			}
 			// Fall back to the last boundary already passed; failing that,
@@ -173,7 +206,7 @@ func cueCut(pending []Word) int {
 			if lastBreak > 0 {
 				return lastBreak
 			}
-			if chars > cueMaxChars {
+			if chars > maxChars {
 				return i
 			}
 			return i + 1
@@ -249,3 +282,154 @@ func Wrap(text string, width int) string {
 	}
 	return b.String()
 }
+
+// WriteSRT writes cues to w as SubRip, the text subtitle format every muxer and
+// player takes.
+func WriteSRT(w io.Writer, cues []Cue) error {
+	return SRT.Write(w, cues, 0)
+}
+
+// Format is a text subtitle format cues are written out in.
+type Format string
+
+const (
+	// SRT is SubRip.
+	SRT Format = "srt"
+	// VTT is WebVTT, the format browsers and HLS players take.
+	VTT Format = "vtt"
+)
+
+// FormatOf returns the format a file named path is written in, by its
+// extension: .srt or .vtt.
+func FormatOf(path string) (Format, bool) {
+	switch f := Format(strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")); f {
+	case SRT, VTT:
+		return f, true
+	}
+	return "", false
+}
+
+// Header is what a file in f opens with, before its first cue: WebVTT's
+// signature, nothing for SubRip.
+func (f Format) Header() string {
+	if f == VTT {
+		return "WEBVTT\n\n"
+	}
+	return ""
+}
+
+// Write writes cues to w in f, after the Header and numbered on from first,
+// the count of cues written before them: a file written a run of cues at a
+// time reads as one written whole.
+func (f Format) Write(w io.Writer, cues []Cue, first int) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range cues {
+		if f == VTT {
+			fmt.Fprintf(bw, "%s --> %s\n%s\n\n", vttTime(c.Start), vttTime(c.End), vttEscaper.Replace(c.Text))
+			continue
+		}
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n\n", first+i+1, srtTime(c.Start), srtTime(c.End), c.Text)
+	}
+	return bw.Flush()
+}
+
+// vttEscaper escapes the characters WebVTT cue text reserves for its markup,
+// which ReadSRT unescapes again.
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// ReadSRT reads SubRip from r, calling each with every cue as soon as the
+// blank line that ends it arrives, so a track read from a pipe is usable while
+// it is still being written. Markup is stripped (SubRip's <i> and <font> tags,
+// ASS override blocks such as {\an8} that a converted track keeps), as a cue is
+// drawn as plain text. A malformed block is skipped rather than ending the read:
+// one bad cue is no reason to lose the rest of a film's subtitles.
+//
+// WebVTT reads the same way, being SubRip's block layout with a header: the
+// header, NOTE and STYLE blocks have no timing line and are skipped as
+// malformed, cue settings after a timestamp are ignored, and its voice and
+// class spans are markup like any other, its character references unescaped.
+func ReadSRT(r io.Reader, each func(Cue)) error {
+	sc := bufio.NewScanner(r)
+	var block []string
+	flush := func() {
+		if c, ok := parseSRTBlock(block); ok {
+			each(c)
+		}
+		block = block[:0]
+	}
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(block) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		block = append(block, line)
+	}
+	flush()
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading SRT: %w", err)
+	}
+	return nil
+}
+
+// parseSRTBlock reads one SubRip block: an optional counter, the timing line,
+// then the text. ok is false for a block with no timing line, a timing it
+// cannot read, or no text.
+func parseSRTBlock(lines []string) (c Cue, ok bool) {
+	i := slices.IndexFunc(lines, func(l string) bool { return strings.Contains(l, "-->") })
+	if i < 0 {
+		return Cue{}, false
+	}
+	from, to, _ := strings.Cut(lines[i], "-->")
+	start, okStart := parseSRTTime(from)
+	end, okEnd := parseSRTTime(to)
+	if !okStart || !okEnd || end <= start {
+		return Cue{}, false
+	}
+	text := strings.TrimSpace(html.UnescapeString(srtMarkup.ReplaceAllString(strings.Join(lines[i+1:], "\n"), "")))
+	if text == "" {
+		return Cue{}, false
+	}
+	return Cue{Start: start, End: end, Text: text}, true
+}
+
+// srtMarkup matches the styling a SubRip cue may carry: HTML-like tags, and
+// the ASS override blocks a track converted from ASS keeps.
+var srtMarkup = regexp.MustCompile(`<[^>]*>|\{\\[^}]*\}`)
+
+// parseSRTTime reads a SubRip timestamp, HH:MM:SS,mmm, into seconds. It also
+// takes WebVTT's "." before the milliseconds and its hourless MM:SS.mmm, and
+// ignores anything after the timestamp (the coordinates some writers append).
+func parseSRTTime(s string) (float64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	parts := strings.Split(strings.Replace(fields[0], ",", ".", 1), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var sec float64
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 {
+			return 0, false
+		}
+		sec = sec*60 + v
+	}
+	return sec, true
+}
+
+// srtTime formats seconds as SubRip's HH:MM:SS,mmm.
+func srtTime(sec float64) string {
+	ms := int64(math.Round(max(sec, 0) * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
+
+// vttTime is srtTime with WebVTT's decimal point.
+func vttTime(sec float64) string {
+	return strings.Replace(srtTime(sec), ",", ".", 1)
+}
@@ -1,6 +1,13 @@
 package cue
 
-import "testing"
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stupside/castor/internal/cast/subtitle"
+)
 
 func TestCueCut(t *testing.T) {
 	// A sentence long enough to read closes on its final punctuation.
@@ -9,7 +16,7 @@ func TestCueCut(t *testing.T) {
 		{Start: 0.7, End: 1.3, Text: "not."}, // span 1.3s ≥ cueMinSeconds
 		{Start: 1.4, End: 1.7, Text: "What"},
 	}
-	if cut := cueCut(sentence); cut != 2 {
+	if cut := cueCut(sentence, cueLines*subtitle.DefaultStyle.MaxChars); cut != 2 {
 		t.Errorf("a readable sentence should close after its period, got %d", cut)
 	}
 
@@ -19,7 +26,7 @@ func TestCueCut(t *testing.T) {
 		{Start: 0.0, End: 0.2, Text: "OK."},
 		{Start: 0.3, End: 0.6, Text: "So"},
 	}
-	if cut := cueCut(staccato); cut != 0 {
+	if cut := cueCut(staccato, cueLines*subtitle.DefaultStyle.MaxChars); cut != 0 {
 		t.Errorf("a sub-minimum sentence should stay open to coalesce, got %d", cut)
 	}
 
@@ -27,12 +34,12 @@ func TestCueCut(t *testing.T) {
 		{Start: 0.0, End: 0.3, Text: "before"},
 		{Start: 2.0, End: 2.3, Text: "after"},
 	}
-	if cut := cueCut(gap); cut != 1 {
+	if cut := cueCut(gap, cueLines*subtitle.DefaultStyle.MaxChars); cut != 1 {
 		t.Errorf("a silence gap should close before it, got %d", cut)
 	}
 
 	open := []Word{{Start: 0.0, End: 0.3, Text: "still"}, {Start: 0.4, End: 0.7, Text: "going"}}
-	if cut := cueCut(open); cut != 0 {
+	if cut := cueCut(open, cueLines*subtitle.DefaultStyle.MaxChars); cut != 0 {
 		t.Errorf("no closing signal should leave the cue open, got %d", cut)
 	}
 }
@@ -48,7 +55,7 @@ func TestCueCutPrefersNaturalBreaks(t *testing.T) {
 		{Start: 3.6, End: 4.5, Text: "keep"},
 		{Start: 4.6, End: 6.2, Text: "going"}, // span 6.2s ≥ cueMaxSeconds
 	}
-	if cut := cueCut(pause); cut != 3 {
+	if cut := cueCut(pause, cueLines*subtitle.DefaultStyle.MaxChars); cut != 3 {
 		t.Errorf("forced cut should fall back to the pause after 3 words, got %d", cut)
 	}
 
@@ -62,13 +69,39 @@ func TestCueCutPrefersNaturalBreaks(t *testing.T) {
 		{Start: 4.1, End: 5.0, Text: "be"},
 		{Start: 5.1, End: 6.3, Text: "self-evident"}, // span 6.3s ≥ cueMaxSeconds
 	}
-	if cut := cueCut(comma); cut != 4 {
+	if cut := cueCut(comma, cueLines*subtitle.DefaultStyle.MaxChars); cut != 4 {
 		t.Errorf("forced cut should fall back to the comma after 4 words, got %d", cut)
 	}
 }
 
+// TestBuilderWidth pins that a cue follows the lines it is drawn on: the
+// same run of words, one cue at the default width, is cut to two lines of a
+// narrow one.
+func TestBuilderWidth(t *testing.T) {
+	var words []Word
+	for i, w := range strings.Fields("the quick brown fox jumps over the lazy dog again") {
+		words = append(words, Word{Start: float64(i) * 0.4, End: float64(i)*0.4 + 0.3, Text: w})
+	}
+	for _, tt := range []struct {
+		width, cues int
+	}{{0, 1}, {16, 2}} {
+		b := NewBuilder(tt.width)
+		b.Commit(words, 0)
+		b.Close()
+		got := b.Cues()
+		if len(got) != tt.cues {
+			t.Fatalf("width %d: %d cues %v, want %d", tt.width, len(got), got, tt.cues)
+		}
+		for _, c := range got {
+			if limit := cueLines * cmp.Or(tt.width, subtitle.DefaultStyle.MaxChars); len(c.Text) > limit {
+				t.Errorf("width %d: cue %q over %d chars", tt.width, c.Text, limit)
+			}
+		}
+	}
+}
+
 func TestBuilderClosesAndOrders(t *testing.T) {
-	b := NewBuilder()
+	b := NewBuilder(0)
 	words := []Word{
 		{Start: 0.0, End: 0.7, Text: "First"},
 		{Start: 0.8, End: 1.4, Text: "line."}, // span 1.4s ≥ cueMinSeconds
@@ -94,7 +127,7 @@ func TestBuilderClosesAndOrders(t *testing.T) {
 }
 
 func TestBuilderSilentTailClosesParagraphFinalCue(t *testing.T) {
-	b := NewBuilder()
+	b := NewBuilder(0)
 	sentence := []Word{
 		{Start: 0.0, End: 0.7, Text: "The"},
 		{Start: 0.8, End: 1.6, Text: "end"}, // no sentence punctuation
@@ -124,3 +157,110 @@ func TestWrap(t *testing.T) {
 		t.Errorf("Wrap = %q", got)
 	}
 }
+
+func TestWriteSRT(t *testing.T) {
+	var b strings.Builder
+	err := WriteSRT(&b, []Cue{
+		{Start: 1.5, End: 3.25, Text: "Hello there."},
+		{Start: 3661.0004, End: 3662, Text: "An hour in."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1\n00:00:01,500 --> 00:00:03,250\nHello there.\n\n" +
+		"2\n01:01:01,000 --> 01:01:02,000\nAn hour in.\n\n"
+	if b.String() != want {
+		t.Errorf("WriteSRT =\n%q\nwant\n%q", b.String(), want)
+	}
+}
+
+// TestFormatWrite pins a file written a run of cues at a time: SubRip numbers
+// on from the cues before, and WebVTT escapes its markup characters, which
+// ReadSRT reads back as they were.
+func TestFormatWrite(t *testing.T) {
+	cues := []Cue{{Start: 3723.5, End: 3725, Text: "Fish & chips\n<now>"}}
+
+	var b strings.Builder
+	if err := SRT.Write(&b, cues, 41); err != nil {
+		t.Fatal(err)
+	}
+	if want := "42\n01:02:03,500 --> 01:02:05,000\nFish & chips\n<now>\n\n"; b.String() != want {
+		t.Errorf("SRT =\n%q\nwant\n%q", b.String(), want)
+	}
+
+	b.Reset()
+	b.WriteString(VTT.Header())
+	if err := VTT.Write(&b, cues, 41); err != nil {
+		t.Fatal(err)
+	}
+	if want := "WEBVTT\n\n01:02:03.500 --> 01:02:05.000\nFish &amp; chips\n&lt;now&gt;\n\n"; b.String() != want {
+		t.Errorf("VTT =\n%q\nwant\n%q", b.String(), want)
+	}
+	var got []Cue
+	if err := ReadSRT(strings.NewReader(b.String()), func(c Cue) { got = append(got, c) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Text != cues[0].Text {
+		t.Errorf("read back %+v, want %+v", got, cues)
+	}
+
+	for path, want := range map[string]Format{"film.SRT": SRT, "/tmp/film.en.vtt": VTT, "film.ass": ""} {
+		if f, _ := FormatOf(path); f != want {
+			t.Errorf("FormatOf(%q) = %q, want %q", path, f, want)
+		}
+	}
+}
+
+func TestReadSRT(t *testing.T) {
+	in := "\ufeff1\r\n00:00:01,500 --> 00:00:03,250\r\n<i>Hello</i> there.\r\n\r\n" +
+		"2\n00:00:04.000 --> 00:00:05.000 X1:10 X2:20\n{\\an8}Up top,\nand two lines.\n\n" +
+		"3\nnot a timing line\nDropped.\n\n" +
+		"4\n00:00:07,000 --> 00:00:06,000\nEnds before it starts.\n\n" +
+		"5\n01:01:01,000 --> 01:01:02,000\nAn hour in."
+	var got []Cue
+	if err := ReadSRT(strings.NewReader(in), func(c Cue) { got = append(got, c) }); err != nil {
+		t.Fatal(err)
+	}
+	want := []Cue{
+		{Start: 1.5, End: 3.25, Text: "Hello there."},
+		{Start: 4, End: 5, Text: "Up top,\nand two lines."},
+		{Start: 3661, End: 3662, Text: "An hour in."},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ReadSRT =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestReadSRTWebVTT(t *testing.T) {
+	in := "WEBVTT - a film\n\n" +
+		"NOTE written by hand\n\n" +
+		"STYLE\n::cue { color: yellow }\n\n" +
+		"intro\n00:01.000 --> 00:02.500 align:start position:10%\n<v Sam>Tom &amp; Jerry</v>\n\n" +
+		"00:00:03.000 --> 00:00:04.000\n<c.loud>Run!</c>\n"
+	var got []Cue
+	if err := ReadSRT(strings.NewReader(in), func(c Cue) { got = append(got, c) }); err != nil {
+		t.Fatal(err)
+	}
+	want := []Cue{
+		{Start: 1, End: 2.5, Text: "Tom & Jerry"},
+		{Start: 3, End: 4, Text: "Run!"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ReadSRT(WebVTT) =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestBuilderAppendKeepsStartOrder(t *testing.T) {
+	b := NewBuilder(0)
+	b.Append(Cue{Start: 5, End: 7, Text: "second"})
+	b.Append(Cue{Start: 1, End: 3, Text: "first"})
+	if got := b.CueAt(2); got != "first" {
+		t.Errorf("CueAt(2) = %q, want %q", got, "first")
+	}
+	if got := b.CueAt(6); got != "second" {
+		t.Errorf("CueAt(6) = %q, want %q", got, "second")
+	}
+	if got := b.CueAt(4); got != "" {
+		t.Errorf("CueAt(4) = %q, want none", got)
+	}
+}
@@ -0,0 +1,330 @@
+// Package models manages the whisper and VAD models the transcriber loads: a
+// built-in catalog of the ggml conversions whisper.cpp publishes, downloaded on
+// demand into the user cache, resumed where an interrupted download stopped,
+// and checked against a SHA-256 digest before every load. It is free of the
+// transcriber's cgo, so the `castor models` command and the config can name a
+// model without linking whisper.cpp.
+//
+// A model's digest is the one the catalog pins for it, and only that: a digest
+// read off the host that serves the file, or taken from the file as it first
+// arrived, vouches for nothing the file does not already say. A model the
+// catalog pins none for is not downloaded, and one that does not match its pin
+// is not installed or loaded. The digest of the installed file is recorded
+// beside it, as sha256sum writes it, for `sha256sum -c`;
+// scripts/model-digests.sh lists the pins from Hugging Face's own LFS records.
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	whisperBaseURL = "https://huggingface.co/ggerganov/whisper.cpp/resolve/main"
+	vadBaseURL     = "https://huggingface.co/ggml-org/whisper-vad/resolve/main"
+
+	// DefaultWhisper is the model a transcriber loads unless the config names
+	// another: the smallest, which keeps up with a film on any CPU.
+	DefaultWhisper = "tiny"
+	// VAD is the Silero VAD v5.1.2 model whisper.cpp's built-in voice activity
+	// detection runs. It is not configurable: VAD is an implementation detail
+	// of the streaming pipeline, not a knob.
+	VAD = "silero-v5.1.2"
+
+	downloadTimeout = 30 * time.Minute
+)
+
+// Model is one catalog entry: a model file and where it is published.
+type Model struct {
+	// Name is what the config and `castor models` call it: "small",
+	// "small.en".
+	Name string
+	// File is its name on disk and at BaseURL.
+	File    string
+	BaseURL string
+	// Size is roughly how large the file is, for listing; a download is not
+	// checked against it.
+	Size int64
+	// English is set for an English-only whisper model.
+	English bool
+	// SHA256 pins the file's digest, in lowercase hex. A model without one
+	// is refused.
+	SHA256 string
+}
+
+const mib = 1 << 20
+
+// Catalog is every model castor knows by name: whisper.cpp's multilingual
+// models with their English-only counterparts, and the VAD model. Sizes are
+// the published ones, rounded. Every entry must pin its SHA-256 (see
+// scripts/model-digests.sh): one that does not cannot be pulled or loaded.
+var Catalog = []Model{
+	{Name: "tiny", File: "ggml-tiny.bin", BaseURL: whisperBaseURL, Size: 75 * mib},
+	{Name: "tiny.en", File: "ggml-tiny.en.bin", BaseURL: whisperBaseURL, Size: 75 * mib, English: true},
+	{Name: "base", File: "ggml-base.bin", BaseURL: whisperBaseURL, Size: 142 * mib},
+	{Name: "base.en", File: "ggml-base.en.bin", BaseURL: whisperBaseURL, Size: 142 * mib, English: true},
+	{Name: "small", File: "ggml-small.bin", BaseURL: whisperBaseURL, Size: 466 * mib},
+	{Name: "small.en", File: "ggml-small.en.bin", BaseURL: whisperBaseURL, Size: 466 * mib, English: true},
+	{Name: "medium", File: "ggml-medium.bin", BaseURL: whisperBaseURL, Size: 1500 * mib},
+	{Name: "medium.en", File: "ggml-medium.en.bin", BaseURL: whisperBaseURL, Size: 1500 * mib, English: true},
+	{Name: "large-v3-turbo", File: "ggml-large-v3-turbo.bin", BaseURL: whisperBaseURL, Size: 1500 * mib},
+	{Name: "large-v3", File: "ggml-large-v3.bin", BaseURL: whisperBaseURL, Size: 2900 * mib},
+	{Name: VAD, File: "ggml-silero-v5.1.2.bin", BaseURL: vadBaseURL, Size: 1 * mib},
+}
+
+// Lookup returns the catalog entry called name.
+func Lookup(name string) (Model, error) {
+	i := slices.IndexFunc(Catalog, func(m Model) bool { return m.Name == name })
+	if i < 0 {
+		return Model{}, fmt.Errorf("no model %q: `castor models list` shows the catalog", name)
+	}
+	return Catalog[i], nil
+}
+
+// Whisper returns the whisper model the config's name stands for, empty for
+// DefaultWhisper. A multilingual name is taken as its English-only
+// counterpart where there is one and multilingual is unset: the English-only
+// models are more accurate for English at the same size, and only for English.
+func Whisper(name string, multilingual bool) (Model, error) {
+	if name == "" {
+		name = DefaultWhisper
+	}
+	if !multilingual && !strings.HasSuffix(name, ".en") {
+		if m, err := Lookup(name + ".en"); err == nil {
+			return m, nil
+		}
+	}
+	m, err := Lookup(name)
+	if err == nil && m.Name == VAD {
+		return Model{}, fmt.Errorf("%q is the VAD model, not a whisper one", name)
+	}
+	return m, err
+}
+
+// Dir is the per-user cache directory models are kept in, created if needed.
+func Dir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating user cache dir: %w", err)
+	}
+	dir := filepath.Join(base, "castor", "whisper")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating cache dir %q: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// Path is where m is kept, whether or not it is there.
+func (m Model) Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, m.File), nil
+}
+
+// Installed reports whether m has been downloaded, and where to.
+func (m Model) Installed() (path string, ok bool, err error) {
+	if path, err = m.Path(); err != nil {
+		return "", false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return path, false, nil
+		}
+		return "", false, fmt.Errorf("stat model: %w", err)
+	}
+	return path, true, nil
+}
+
+// Ensure returns m's path for loading: verified when it is there, downloaded
+// (once, then verified) when it is not.
+func Ensure(ctx context.Context, m Model) (string, error) {
+	path, ok, err := m.Installed()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return Pull(ctx, m)
+	}
+	if err := m.Verify(ctx); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Pull downloads m into the cache, carrying on from what an interrupted
+// download left, and verifies it against its pinned digest before installing
+// it. A model already there is downloaded again.
+func Pull(ctx context.Context, m Model) (string, error) {
+	want, err := m.pinned()
+	if err != nil {
+		return "", err
+	}
+	path, err := m.Path()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	url := m.BaseURL + "/" + m.File
+	slog.InfoContext(ctx, "downloading model (one-time)", "name", m.Name, "url", url, "dest", path)
+	part := path + ".part"
+	if err := download(ctx, url, part); err != nil {
+		return "", fmt.Errorf("downloading %s: %w", m.Name, err)
+	}
+	got, err := digest(part)
+	if err != nil {
+		return "", err
+	}
+	if got != want {
+		// Resumed onto a corrupt part, or corrupted on the way: start over
+		// next time rather than resume onto it again.
+		_ = os.Remove(part)
+		return "", fmt.Errorf("downloading %s: sha256 %s, want %s", m.Name, got, want)
+	}
+	if err := os.Rename(part, path); err != nil {
+		return "", fmt.Errorf("installing %s: %w", m.Name, err)
+	}
+	if err := writeDigest(path, got); err != nil {
+		return "", err
+	}
+	slog.InfoContext(ctx, "model ready", "name", m.Name, "path", path, "sha256", got)
+	return path, nil
+}
+
+// Verify checks the downloaded m against its pinned digest.
+func (m Model) Verify(ctx context.Context) error {
+	want, err := m.pinned()
+	if err != nil {
+		return err
+	}
+	path, ok, err := m.Installed()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("model %s is not downloaded: `castor models pull %s` fetches it", m.Name, m.Name)
+	}
+	got, err := digest(path)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("model %s is corrupt (sha256 %s, want %s): `castor models pull %s` fetches it again", m.Name, got, want, m.Name)
+	}
+	slog.DebugContext(ctx, "model verified", "name", m.Name, "sha256", got)
+	return nil
+}
+
+// pinned is the digest m must match: its SHA256, when that is one.
+func (m Model) pinned() (string, error) {
+	sum := strings.ToLower(m.SHA256)
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("model %s has no SHA-256 pinned in the catalog to check it against, so it is not used", m.Name)
+	}
+	return sum, nil
+}
+
+// Remove deletes the downloaded m, its recorded digest and any part of a
+// download of it.
+func (m Model) Remove() error {
+	path, err := m.Path()
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{path, digestPath(path), path + ".part"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// download fetches url into part, appending to what an earlier attempt left
+// there when the server takes a range request, and starting over when it
+// does not.
+func download(ctx context.Context, url, part string) error {
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	have, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if have > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", have))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && have > 0:
+		// The part is already whole: the attempt before was cut off after
+		// its last byte, before the rename.
+		return nil
+	case resp.StatusCode == http.StatusPartialContent && have > 0:
+		slog.InfoContext(ctx, "resuming download", "url", url, "have_bytes", have)
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// digest is the hex SHA-256 of the file at path.
+func digest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("hashing model: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing model: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// digestPath is where the digest of the model at path is recorded.
+func digestPath(path string) string { return path + ".sha256" }
+
+// writeDigest records sum as the digest of the model at path, in sha256sum's
+// format, so `sha256sum -c` checks it too.
+func writeDigest(path, sum string) error {
+	line := sum + "  " + filepath.Base(path) + "\n"
+	if err := os.WriteFile(digestPath(path), []byte(line), 0o644); err != nil {
+		return fmt.Errorf("recording model digest: %w", err)
+	}
+	return nil
+}
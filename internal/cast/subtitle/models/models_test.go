@@ -0,0 +1,151 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWhisper pins which catalog model a whisper config's name loads.
+func TestWhisper(t *testing.T) {
+	tests := []struct {
+		name         string
+		multilingual bool
+		want         string
+		wantErr      bool
+	}{
+		{"", false, "tiny.en", false},
+		{"", true, "tiny", false},
+		{"small", false, "small.en", false},
+		{"small", true, "small", false},
+		{"small.en", true, "small.en", false},
+		{"large-v3", false, "large-v3", false},
+		{"huge", false, "", true},
+		{VAD, true, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Whisper(tt.name, tt.multilingual)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Whisper(%q, %v) error = %v, want error %v", tt.name, tt.multilingual, err, tt.wantErr)
+			}
+			if m.Name != tt.want {
+				t.Errorf("Whisper(%q, %v) = %q, want %q", tt.name, tt.multilingual, m.Name, tt.want)
+			}
+		})
+	}
+}
+
+// TestCatalogPinned checks every catalog model pins a SHA-256 to be checked
+// against: one that does not is refused, whisper (through its VAD model) with
+// it. scripts/model-digests.sh prints the pins.
+func TestCatalogPinned(t *testing.T) {
+	for _, m := range Catalog {
+		if _, err := m.pinned(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// TestPull pins a download against the catalog's digest: resumed from the
+// part an earlier attempt left, refused when it does not match the pin, checked
+// against it once installed, and never fetched at all without one.
+func TestPull(t *testing.T) {
+	body := bytes.Repeat([]byte("ggml"), 4096)
+	sum := sha256.Sum256(body)
+	pin := hex.EncodeToString(sum[:])
+
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "model.bin", time.Time{}, bytes.NewReader(body))
+	}))
+	defer srv.Close()
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	m := Model{Name: "test", File: "ggml-test.bin", BaseURL: srv.URL, SHA256: strings.ToUpper(pin)}
+	path, err := m.Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An earlier attempt got the first half.
+	if err := os.WriteFile(path+".part", body[:len(body)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Pull(t.Context(), m); err != nil || got != path {
+		t.Fatalf("Pull = %q, %v, want %q", got, err, path)
+	}
+	if want := []string{"bytes=8192-"}; !slices.Equal(ranges, want) {
+		t.Errorf("requested ranges %q, want %q", ranges, want)
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, body) {
+		t.Fatalf("installed model differs from the served one (%v)", err)
+	}
+	if rec, _ := os.ReadFile(path + ".sha256"); string(rec) != pin+"  ggml-test.bin\n" {
+		t.Errorf("recorded digest %q", rec)
+	}
+	if err := m.Verify(t.Context()); err != nil {
+		t.Errorf("Verify after Pull = %v", err)
+	}
+
+	// A model changed on disk is not loaded.
+	if err := os.WriteFile(path, append(body, '!'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(t.Context()); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("Verify of a changed model = %v, want it corrupt", err)
+	}
+	if _, err := Ensure(t.Context(), m); err == nil {
+		t.Error("Ensure loaded a changed model")
+	}
+
+	// A download the pin disowns is not installed, nor resumed onto.
+	if err := m.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	other := m
+	other.SHA256 = strings.Repeat("0", 64)
+	if _, err := Pull(t.Context(), other); err == nil {
+		t.Fatal("Pull installed a model that does not match its pin")
+	}
+	for _, p := range []string{path, path + ".part"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s left behind after a mismatch (%v)", filepath.Base(p), err)
+		}
+	}
+
+	// Without a pin a model is neither fetched nor loaded, however it got
+	// there.
+	ranges = nil
+	unpinned := m
+	unpinned.SHA256 = ""
+	if _, err := Ensure(t.Context(), unpinned); err == nil {
+		t.Error("Ensure fetched a model with no pinned digest")
+	}
+	if len(ranges) != 0 {
+		t.Errorf("fetched a model with no pinned digest: %q", ranges)
+	}
+	if _, err := Ensure(t.Context(), m); err != nil {
+		t.Fatal(err)
+	}
+	if err := unpinned.Verify(t.Context()); err == nil {
+		t.Error("Verify passed a model with no pinned digest")
+	}
+
+	if err := m.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := m.Installed(); ok || err != nil {
+		t.Errorf("Installed after Remove = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,122 @@
+package subtitle
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Settings is the config file's subtitles section: how the cues a cast burns
+// in are drawn, whichever of the mechanisms they come from.
+type Settings struct {
+	Style Style `yaml:"style"`
+}
+
+// Style is how burned-in cues look: the drawtext line a network cast draws
+// frame by frame, and the SubRip or WebVTT file libass draws for a local one.
+// An ASS script keeps its author's styling; Style is for text that has none.
+//
+// Sizes are fractions of the output's height rather than pixels, so a cue
+// reads the same on a 720p encode as on a 4K one. The zero value means
+// DefaultStyle, so a cast assembled without the config file (a test, a
+// download) draws the same line the defaults do.
+type Style struct {
+	// Font is a font file's path, or a family name fontconfig resolves
+	// (e.g. "DejaVu Sans"). Empty leaves the choice to fontconfig's default.
+	// libass, which a local file's cast draws with, takes only a family: it
+	// draws in its default font when Font is a file.
+	Font string `yaml:"font"`
+	// Size is the text height as a fraction of the output's height.
+	Size float64 `yaml:"size" validate:"gt=0,lte=0.25"`
+	// Color is the text colour, "#RRGGBB" or "#RRGGBBAA" with AA its opacity.
+	Color Color `yaml:"color" validate:"hexcolor"`
+	// Outline is the width in pixels of the border drawn round each glyph,
+	// in OutlineColor. Zero draws none.
+	Outline      int   `yaml:"outline" validate:"gte=0,lte=20"`
+	OutlineColor Color `yaml:"outline_color" validate:"hexcolor"`
+	// Box draws a background box behind the text in BoxColor, which keeps a
+	// cue legible over a bright scene; a translucent colour lets the picture
+	// show through.
+	Box      bool  `yaml:"box"`
+	BoxColor Color `yaml:"box_color" validate:"hexcolor"`
+	// Margin is the gap between the text and the frame's edge, as a fraction
+	// of the output's height.
+	Margin float64 `yaml:"margin" validate:"gte=0,lte=0.5"`
+	// Position is the edge the text sits against.
+	Position Position `yaml:"position" validate:"oneof=bottom top"`
+	// MaxChars is where a line wraps. It also bounds a transcribed cue, which
+	// is cut to at most two lines of it.
+	MaxChars int `yaml:"max_chars" validate:"gte=16,lte=120"`
+}
+
+// Position is the frame edge burned-in cues sit against.
+type Position string
+
+const (
+	PositionBottom Position = "bottom"
+	PositionTop    Position = "top"
+)
+
+// DefaultStyle is the broadcast look cues are drawn in unless the config says
+// otherwise: white text with a thin black outline on a translucent box,
+// centred a twentieth of the height above the bottom edge, wrapping at 42
+// columns, which keeps two lines inside the title-safe area at this size.
+var DefaultStyle = Style{
+	Size:         1.0 / 24,
+	Color:        "#ffffff",
+	Outline:      2,
+	OutlineColor: "#000000",
+	Box:          true,
+	BoxColor:     "#00000073",
+	Margin:       1.0 / 20,
+	Position:     PositionBottom,
+	MaxChars:     42,
+}
+
+// OrDefault returns s, or DefaultStyle when s is the zero value.
+func (s Style) OrDefault() Style {
+	if s == (Style{}) {
+		return DefaultStyle
+	}
+	return s
+}
+
+// FontFile reports whether Font names a file rather than a family: a path
+// with a directory in it, or a TrueType or OpenType file's name.
+func (s Style) FontFile() bool {
+	if strings.ContainsRune(s.Font, os.PathSeparator) || strings.ContainsRune(s.Font, '/') {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(s.Font)) {
+	case ".ttf", ".otf", ".ttc":
+		return true
+	}
+	return false
+}
+
+// Color is a hex colour: "#RGB", "#RGBA", "#RRGGBB" or "#RRGGBBAA", the alpha
+// digits being its opacity (ff opaque). The config validates the form; a
+// malformed value reads as opaque black.
+type Color string
+
+// RGBA returns the colour's channels.
+func (c Color) RGBA() (r, g, b, a uint8) {
+	hex := strings.TrimPrefix(string(c), "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		var long strings.Builder
+		for _, d := range hex {
+			long.WriteRune(d)
+			long.WriteRune(d)
+		}
+		hex = long.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return 0, 0, 0, 0xff
+	}
+	return uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)
+}
@@ -14,6 +14,7 @@
 package whisper
 
 import (
+	"cmp"
 	"context"
 	"encoding/binary"
 	"errors"
@@ -73,9 +74,10 @@ type Transcriber struct {
 }
 
 // New returns a configured Transcriber, resolving the transcription and VAD
-// model paths (auto-downloading the defaults into the user cache when unset).
+// model paths (auto-downloading the catalog's into the user cache when unset,
+// and verifying them when they are there).
 func New(ctx context.Context, cfg subtitle.Whisper) (*Transcriber, error) {
-	modelPath, err := ensureModel(ctx, cfg.ModelPath)
+	modelPath, err := ensureModel(ctx, cfg.ModelPath, cfg.Model, cfg.Multilingual())
 	if err != nil {
 		return nil, err
 	}
@@ -84,6 +86,7 @@ func New(ctx context.Context, cfg subtitle.Whisper) (*Transcriber, error) {
 		return nil, err
 	}
 
+	slog.InfoContext(ctx, "whisper configured", "task", cmp.Or(cfg.Task, subtitle.TaskTranscribe), "language", cmp.Or(cfg.Spoken(), subtitle.LanguageAuto))
 	return &Transcriber{
 		cfg:          cfg,
 		modelPath:    modelPath,
@@ -134,6 +137,10 @@ func (t *Transcriber) Run(ctx context.Context, pcm io.Reader, sink *cue.Builder)
 		return fmt.Errorf("loading whisper model: %w", err)
 	}
 	defer model.Close()
+	if t.cfg.Multilingual() && !model.IsMultilingual() {
+		slog.WarnContext(ctx, "whisper model is English-only: it hears English and translates nothing",
+			"path", t.modelPath, "task", t.cfg.Task, "language", t.cfg.Language)
+	}
 
 	step := make([]byte, stepSeconds*bytesPerSec)
 	var (
@@ -225,12 +232,14 @@ func (t *Transcriber) transcribeBuffer(ctx context.Context, model wcpp.Model, sa
 	}
 
 	// Pin the language when one is configured; per-buffer auto-detection misfires
-	// on music and quiet stretches. English-only models need no pinning.
-	if !t.cfg.Language.AutoDetect() && wctx.IsMultilingual() {
-		if err := wctx.SetLanguage(string(t.cfg.Language)); err != nil {
-			slog.WarnContext(ctx, "whisper SetLanguage failed", "language", t.cfg.Language, "error", err)
+	// on music and quiet stretches. English-only models need no pinning, and
+	// cannot translate either (Run warns of it).
+	if spoken := t.cfg.Spoken(); !spoken.AutoDetect() && wctx.IsMultilingual() {
+		if err := wctx.SetLanguage(string(spoken)); err != nil {
+			slog.WarnContext(ctx, "whisper SetLanguage failed", "language", spoken, "error", err)
 		}
 	}
+	wctx.SetTranslate(t.cfg.Translates() && wctx.IsMultilingual())
 
 	// Silero VAD gates the decoder; whisper.cpp maps the resulting segment
 	// timestamps back onto the unfiltered timeline, so offsets stay valid.
@@ -101,7 +101,7 @@ func TestStreamingSmoke(t *testing.T) {
 	if err != nil {
 		t.Skip("no user cache dir")
 	}
-	if _, err := os.Stat(filepath.Join(cache, "castor", "whisper", defaultModelName)); err != nil {
+	if _, err := os.Stat(filepath.Join(cache, "castor", "whisper", "ggml-tiny.en.bin")); err != nil {
 		t.Skip("whisper model not cached; run a cast once first")
 	}
 	wav, err := os.ReadFile("../../../third_party/whisper.cpp/samples/jfk.wav")
@@ -114,7 +114,7 @@ func TestStreamingSmoke(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	builder := cue.NewBuilder()
+	builder := cue.NewBuilder(0)
 	if err := tr.Run(ctx, bytes.NewReader(wav[44:]), builder); err != nil { // 44-byte canonical WAV header
 		t.Fatal(err)
 	}
@@ -5,12 +5,19 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/stupside/castor/internal/cast"
 	"github.com/stupside/castor/internal/cast/core"
 	"github.com/stupside/castor/internal/device"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/mediaserver"
+	"github.com/stupside/castor/internal/metrics"
 	"github.com/stupside/castor/internal/source/extract"
 	"github.com/stupside/castor/internal/source/resolve"
 )
@@ -26,6 +33,13 @@ type Config struct {
 	Resolver  resolve.Config        `yaml:"resolver" validate:"required"`
 	Transcode cast.TranscodeConfig  `yaml:"transcode" validate:"required"`
 	Whisper   cast.WhisperConfig    `yaml:"whisper"`
+	Subtitles cast.SubtitlesConfig  `yaml:"subtitles"`
+	Spool     cast.SpoolConfig      `yaml:"spool"`
+	Cache     cast.CacheConfig      `yaml:"cache"`
+	Control   cast.ControlConfig    `yaml:"control"`
+	Daemon    DaemonConfig          `yaml:"daemon"`
+	Metrics   metrics.Config        `yaml:"metrics"`
+	Media     mediaserver.Config    `yaml:"media_server"`
 	TMDB      TMDB                  `yaml:"tmdb"`
 }
 
@@ -36,11 +50,40 @@ type TMDB struct {
 	APIKey string `yaml:"api_key"`
 }
 
+// DaemonConfig is the daemon section: where `castor daemon` listens and how
+// often it refreshes its view of the network. The cast commands read Socket too,
+// to find a running daemon to hand their job to.
+type DaemonConfig struct {
+	// Socket is the Unix socket the daemon serves its API on, and the cast
+	// commands look for. Empty means castor/daemon.sock under the user cache
+	// directory.
+	Socket string `yaml:"socket"`
+	// Address additionally serves the API over TCP (host:port). The control
+	// API's rule applies: a non-loopback address requires Token.
+	Address string `yaml:"address"`
+	Token   string `yaml:"token"`
+	// RescanInterval is how often the daemon re-runs device discovery, so a
+	// job naming a device connects to a known address instead of discovering
+	// it first.
+	RescanInterval time.Duration `yaml:"rescan_interval" validate:"min=0"`
+}
+
+// SocketPath resolves Socket, falling back to the per-user default.
+func (d DaemonConfig) SocketPath() (string, error) {
+	if d.Socket != "" {
+		return d.Socket, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating daemon socket: %w", err)
+	}
+	return filepath.Join(dir, "castor", "daemon.sock"), nil
+}
+
 // CastConfig is the cast-behaviour section: the decisions castor cannot infer
-// and so leaves to the operator. It holds exactly one axis today, and the bar for
-// a second is high — every other decision the pipeline makes is derived from a
-// probe or from advertised capabilities, where a knob would bury a bug rather
-// than fix it.
+// and so leaves to the operator. The bar for one is high — every other decision
+// the pipeline makes is derived from a probe or from advertised capabilities,
+// where a knob would bury a bug rather than fix it.
 type CastConfig struct {
 	// Delivery forces castor to relay the stream ("serve") instead of deciding
 	// per source ("auto", the default). Set it for a source that a renderer
@@ -48,6 +91,15 @@ type CastConfig struct {
 	// playlist whose segments are served under a disguised extension. It costs
 	// this machine's bandwidth and CPU on every cast, which is why it is opt-in.
 	Delivery core.DeliveryPreference `yaml:"delivery" validate:"omitempty,oneof=auto serve"`
+
+	// MaxRenditions is how many renditions a cast served as HLS offers its
+	// client to switch between: the stream at its own quality, and up to two
+	// lower ones each encoded in realtime beside it. Unset offers two, the
+	// stream and one step down; 1 serves the one rendition, a stream copy
+	// where the source allows. More keeps a renderer on a weak link playing,
+	// at the cost of an encode per extra rendition on this machine, which no
+	// probe can weigh for the operator.
+	MaxRenditions int `yaml:"max_renditions" validate:"gte=0,lte=3"`
 }
 
 // DeviceConfig is the composition-root device section: the generic cast target
@@ -66,13 +118,23 @@ type DeviceConfig struct {
 	// discovers the device by Name over SSDP/mDNS.
 	Host string `yaml:"host"`
 
+	// HDR lists the dynamic ranges the TV shows right (hdr10, hlg,
+	// dolby_vision), for an HDR source to be copied to it instead of
+	// tone-mapped to SDR (see device.Config.HDR). Empty treats it as SDR-only.
+	HDR []media.DynamicRange `yaml:"hdr" validate:"dive,oneof=hdr10 hlg dolby_vision"`
+
+	// Codecs lists video codecs the device decodes that it does not advertise
+	// (hevc, av1, vp9), so a source in one is copied to it and an encode may
+	// target it (see device.Config.Codecs).
+	Codecs []media.Codec `yaml:"codecs" validate:"dive,oneof=h264 hevc av1 vp9"`
+
 	Roku device.RokuConfig `yaml:"roku"`
 }
 
 // resolve builds the agnostic device.Config, attaching the selected family's
 // connect settings as the opaque Family payload the device layer interprets.
 func (d DeviceConfig) resolve() device.Config {
-	cfg := device.Config{Name: d.Name, Type: d.Type, Address: d.Host}
+	cfg := device.Config{Name: d.Name, Type: d.Type, Address: d.Host, HDR: d.HDR, Codecs: d.Codecs}
 	switch d.Type {
 	case device.TypeRoku:
 		cfg.Family = d.Roku
@@ -85,13 +147,18 @@ func (d DeviceConfig) resolve() device.Config {
 func (c *Config) Playback() cast.Config {
 	return cast.Config{
 		Config: core.Config{
-			Device:    c.Device.resolve(),
-			Network:   c.Network,
-			Transcode: c.Transcode,
-			Resolver:  c.Resolver,
-			Whisper:   c.Whisper,
-			Delivery:  c.Cast.Delivery,
+			Device:        c.Device.resolve(),
+			Network:       c.Network,
+			Transcode:     c.Transcode,
+			Resolver:      c.Resolver,
+			Whisper:       c.Whisper,
+			SubtitleStyle: c.Subtitles.Style,
+			Delivery:      c.Cast.Delivery,
+			MaxRenditions: c.Cast.MaxRenditions,
+			Spool:         c.Spool,
+			Cache:         c.Cache,
 		},
+		Control: c.Control,
 	}
 }
 
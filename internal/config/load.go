@@ -15,6 +15,8 @@ import (
 	"github.com/knadh/koanf/v2"
 
 	"github.com/stupside/castor/internal/cast"
+	"github.com/stupside/castor/internal/cast/subtitle"
+	"github.com/stupside/castor/internal/metrics"
 	"github.com/stupside/castor/internal/source/extract"
 	"github.com/stupside/castor/internal/source/resolve"
 )
@@ -52,7 +54,13 @@ func defaults() *Config {
 		Transcode: cast.TranscodeConfig{FFmpegPath: "ffmpeg", RWTimeout: 30 * time.Second},
 		// Pinned rather than "auto": the streaming transcriber re-detects on
 		// every buffer with auto, which misfires on music and quiet stretches.
-		Whisper: cast.WhisperConfig{Language: "en"},
+		Whisper:   cast.WhisperConfig{Language: "en"},
+		Subtitles: cast.SubtitlesConfig{Style: subtitle.DefaultStyle},
+		// Loopback so enabling the API exposes nothing to the network until the
+		// operator also picks a reachable address and a token.
+		Control: cast.ControlConfig{Address: "127.0.0.1:8675"},
+		Daemon:  DaemonConfig{RescanInterval: 5 * time.Minute},
+		Metrics: metrics.Config{Address: "127.0.0.1:9464"},
 	}
 }
 
@@ -3,10 +3,14 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/stupside/castor/internal/cast"
 	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/cast/subtitle"
+	"github.com/stupside/castor/internal/media"
 )
 
 func TestLoadMissingFileWithEnvVars(t *testing.T) {
@@ -111,6 +115,31 @@ func TestLoadHostPinsDeviceWithoutName(t *testing.T) {
 	}
 }
 
+// TestLoadDeviceHDR covers the HDR ranges a user declares for their TV: they
+// reach device.Config, and an unknown one fails validation.
+func TestLoadDeviceHDR(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(base, []byte("device:\n  name: tv\n  type: dlna\n  hdr: [hdr10, hlg]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Playback().Device.HDR; !slices.Equal(got, []media.DynamicRange{media.RangeHDR10, media.RangeHLG}) {
+		t.Errorf("device.Config.HDR = %v, want [hdr10 hlg]", got)
+	}
+
+	bad := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(bad, []byte("device:\n  name: tv\n  type: dlna\n  hdr: [hdr12]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(bad); err == nil {
+		t.Error("an unknown device.hdr range should fail validation")
+	}
+}
+
 // TestLoadCastDelivery covers the one cast decision the operator owns, from both
 // layers that matter for it: the file, and the environment, which is the reason
 // it is a config key rather than a CLI flag (CASTOR_CAST__DELIVERY=serve makes it
@@ -154,6 +183,70 @@ func TestLoadCastDelivery(t *testing.T) {
 	}
 }
 
+// TestLoadSpool pins that a spool quota reads in the units a person writes
+// one in, from the file and from the environment alike, and reaches the cast.
+func TestLoadSpool(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(base, []byte("device:\n  name: tv\n  type: chromecast\nspool:\n  dir: /var/tmp/castor\n  max_size: 2GiB\n  max_age: 30m\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cast.SpoolConfig{Dir: "/var/tmp/castor", MaxSize: 2 << 30, MaxAge: 30 * time.Minute}
+	if got := cfg.Playback().Spool; got != want {
+		t.Errorf("spool = %+v, want %+v", got, want)
+	}
+
+	t.Setenv("CASTOR_SPOOL__MAX_SIZE", "512MiB")
+	if cfg, err = Load(base); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Spool.MaxSize; got != 512<<20 {
+		t.Errorf("CASTOR_SPOOL__MAX_SIZE = %d, want %d", got, 512<<20)
+	}
+
+	t.Setenv("CASTOR_CACHE__MAX_SIZE", "20GiB")
+	if cfg, err = Load(base); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Playback().Cache; !got.Enabled() || got.MaxSize != 20<<30 {
+		t.Errorf("CASTOR_CACHE__MAX_SIZE = %+v, want the cache on at %d", got, int64(20<<30))
+	}
+}
+
+// TestLoadSubtitleStyle pins that a partial subtitles.style keeps the rest of
+// the defaults, and that a bad colour or position fails at load rather than
+// at the first burn-in.
+func TestLoadSubtitleStyle(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(style string) {
+		t.Helper()
+		if err := os.WriteFile(base, []byte("device:\n  name: tv\n  type: chromecast\nsubtitles:\n  style:\n"+style), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("    position: top\n    color: \"#ffff00\"\n    max_chars: 32\n")
+	cfg, err := Load(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := subtitle.DefaultStyle
+	want.Position, want.Color, want.MaxChars = subtitle.PositionTop, "#ffff00", 32
+	if got := cfg.Playback().SubtitleStyle; got != want {
+		t.Errorf("style = %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{"    position: middle\n", "    color: yellow\n", "    size: 0\n", "    max_chars: 4\n"} {
+		write(bad)
+		if _, err := Load(base); err == nil {
+			t.Errorf("%q should fail validation", bad)
+		}
+	}
+}
+
 // TestLoadCastDeliveryRejectsUnknownMode is what the enum buys over a bool: a
 // typo fails at load with a validation error instead of silently meaning auto.
 func TestLoadCastDeliveryRejectsUnknownMode(t *testing.T) {
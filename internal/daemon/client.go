@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// dialTimeout bounds the probe for a running daemon: the socket is local, so
+// anything slower means nobody is listening.
+const dialTimeout = 200 * time.Millisecond
+
+// pollInterval is how often Wait re-reads a job.
+const pollInterval = time.Second
+
+// Client talks to a daemon over its Unix socket.
+type Client struct {
+	http *http.Client
+}
+
+// Dial connects to the daemon on socket, failing fast when none is running.
+func Dial(ctx context.Context, socket string) (*Client, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("no daemon on %s: %w", socket, err)
+	}
+	conn.Close()
+	return &Client{http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}}}, nil
+}
+
+// Submit queues job on the daemon.
+func (c *Client) Submit(ctx context.Context, job Job) (JobInfo, error) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return JobInfo{}, err
+	}
+	var info JobInfo
+	return info, c.do(ctx, http.MethodPost, "/jobs", bytes.NewReader(body), http.StatusAccepted, &info)
+}
+
+// Job reads one job.
+func (c *Client) Job(ctx context.Context, id string) (JobInfo, error) {
+	var info JobInfo
+	return info, c.do(ctx, http.MethodGet, "/jobs/"+id, nil, http.StatusOK, &info)
+}
+
+// Cancel cancels a queued or running job.
+func (c *Client) Cancel(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/jobs/"+id, nil, http.StatusNoContent, nil)
+}
+
+// Wait polls a job until it finishes, calling changed whenever its state moves.
+// If ctx ends first, the job is cancelled on the daemon, so interrupting a thin
+// client stops its cast just as interrupting a local one does.
+func (c *Client) Wait(ctx context.Context, id string, changed func(JobInfo)) (JobInfo, error) {
+	var last State
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		info, err := c.Job(ctx, id)
+		if ctx.Err() != nil {
+			cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if err := c.Cancel(cctx, id); err != nil {
+				return info, err
+			}
+			return info, ctx.Err()
+		}
+		if err != nil {
+			return info, err
+		}
+		if info.State != last {
+			last = info.State
+			changed(info)
+		}
+		if info.State.Finished() {
+			return info, nil
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, want int, out any) error {
+	// The host is a placeholder: the transport always dials the socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://castor"+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("daemon %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("daemon %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding daemon response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+// Package daemon is castor's long-running mode: one process that keeps the
+// expensive, cast-independent state warm (a Chrome for extraction, the hardware
+// encoder probes, each DLNA renderer's negotiated capabilities, and a periodically
+// refreshed device list) and runs cast jobs submitted over a local API.
+//
+// Jobs queue per device: a device plays one job at a time, in submission order,
+// while jobs for different devices run concurrently. The cast commands act as
+// thin clients of a running daemon (see Client), so the warm state is shared by
+// every cast instead of rebuilt by each.
+package daemon
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stupside/castor/internal/cast"
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/config"
+	"github.com/stupside/castor/internal/device"
+)
+
+// Kind names what a job casts, mirroring the cast subcommands.
+type Kind string
+
+const (
+	KindURL     Kind = "url"     // Target is a direct media URL
+	KindPlayer  Kind = "player"  // Target is a player page to extract from
+	KindMovie   Kind = "movie"   // Target is an item ID expanded through the sources
+	KindEpisode Kind = "episode" // Target is an item ID, plus Season and Episode
+	KindFile    Kind = "file"    // Target is an absolute path on the daemon's machine
+)
+
+// Job is one cast request. The device fields are optional: left empty, the job
+// casts to the daemon's configured device.
+type Job struct {
+	Kind    Kind   `json:"kind"`
+	Target  string `json:"target"`
+	Season  uint   `json:"season,omitempty"`
+	Episode uint   `json:"episode,omitempty"`
+
+	Device     string      `json:"device,omitempty"`
+	DeviceType device.Type `json:"device_type,omitempty"`
+	Host       string      `json:"host,omitempty"`
+
+	// Record is an absolute path to keep the cast at (see cast.WithRecord). It
+	// is written by the daemon, so it names a file on the daemon's machine.
+	Record string `json:"record,omitempty"`
+	// Bitrate caps the served video, in bits per second (see
+	// cast.WithMaxBitrate); 0 leaves it uncapped.
+	Bitrate int64 `json:"bitrate,omitempty"`
+	// AudioLanguages, when set, replace the daemon's resolver.audio_languages
+	// for this job: the languages to play the audio in, most preferred first.
+	AudioLanguages []string `json:"audio_languages,omitempty"`
+	// SubtitleLanguages, when set, replace the daemon's
+	// resolver.subtitle_languages for this job: the languages to show the
+	// source's own subtitles in, most preferred first, and the first the one
+	// whisper writes in when the source has none (see subtitle.Whisper.In).
+	SubtitleLanguages []string `json:"subtitle_languages,omitempty"`
+	// Subtitles is a subtitle file to burn in (see cast.WithSubtitles): an
+	// absolute path on the daemon's machine, or an http(s) URL.
+	// SubtitleOffset moves its cues, in seconds, later when positive.
+	Subtitles      string  `json:"subtitles,omitempty"`
+	SubtitleOffset float64 `json:"subtitle_offset,omitempty"`
+	// SaveSubtitles is an absolute path to keep the cast's subtitles at (see
+	// cast.WithSaveSubtitles), on the daemon's machine like Record.
+	SaveSubtitles string `json:"save_subtitles,omitempty"`
+}
+
+// subtitles is the subtitle file the job brings, zero for none.
+func (j Job) subtitles() cast.Subtitles {
+	return cast.Subtitles{Location: j.Subtitles, Offset: time.Duration(j.SubtitleOffset * float64(time.Second))}
+}
+
+func (j Job) validate() error {
+	if j.Target == "" {
+		return errors.New("job has no target")
+	}
+	if j.Bitrate < 0 {
+		return fmt.Errorf("bitrate %d is negative", j.Bitrate)
+	}
+	if subs := j.subtitles(); subs.Set() && !subs.Remote() && !filepath.IsAbs(subs.Location) {
+		return fmt.Errorf("subtitles path %q is not absolute", subs.Location)
+	}
+	if j.Record != "" {
+		if !filepath.IsAbs(j.Record) {
+			return fmt.Errorf("record path %q is not absolute", j.Record)
+		}
+		if err := cast.CheckRecord(j.Record); err != nil {
+			return err
+		}
+	}
+	if j.SaveSubtitles != "" {
+		if !filepath.IsAbs(j.SaveSubtitles) {
+			return fmt.Errorf("save subtitles path %q is not absolute", j.SaveSubtitles)
+		}
+		if err := cast.CheckSaveSubtitles(j.SaveSubtitles); err != nil {
+			return err
+		}
+	}
+	switch j.Kind {
+	case KindURL, KindPlayer, KindMovie:
+		return nil
+	case KindFile:
+		if !filepath.IsAbs(j.Target) {
+			return fmt.Errorf("file path %q is not absolute", j.Target)
+		}
+		return nil
+	case KindEpisode:
+		if j.Season == 0 || j.Episode == 0 {
+			return errors.New("episode job needs a season and an episode")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown job kind %q", j.Kind)
+	}
+}
+
+// State is a job's place in its lifecycle.
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateDone      State = "done"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Finished reports whether the job has reached a terminal state.
+func (s State) Finished() bool {
+	return s == StateDone || s == StateFailed || s == StateCancelled
+}
+
+// JobInfo is a job as the API reports it. Status is the live cast's snapshot,
+// present while the job runs.
+type JobInfo struct {
+	ID       string       `json:"id"`
+	Job      Job          `json:"job"`
+	State    State        `json:"state"`
+	Error    string       `json:"error,omitempty"`
+	Queued   time.Time    `json:"queued"`
+	Started  time.Time    `json:"started,omitzero"`
+	Finished time.Time    `json:"finished,omitzero"`
+	Status   *core.Status `json:"status,omitempty"`
+}
+
+// Runner casts one job. cfg is the daemon's configuration with the job's device
+// already applied, and sess is the session the job's controls drive.
+type Runner func(ctx context.Context, cfg *config.Config, job Job, sess *core.Session) error
+
+// keepFinished bounds how many finished jobs the daemon remembers for
+// GET /jobs. A long-running daemon sees jobs without end; past this many, the
+// oldest finished one is forgotten as the next one finishes.
+const keepFinished = 100
+
+// errCancelled is the cancellation cause of a job cancelled through the API.
+var errCancelled = errors.New("job cancelled")
+
+// ErrUnknownJob reports a job ID the daemon has no record of.
+var ErrUnknownJob = errors.New("unknown job")
+
+// Daemon holds the job queue and the device cache.
+type Daemon struct {
+	cfg *config.Config
+	run Runner
+	ctx context.Context // jobs run under it; cancelling it cancels them all
+
+	mu      sync.Mutex
+	seq     int
+	jobs    map[string]*job
+	order   []*job
+	lanes   map[string][]*job // queued jobs per device, in order
+	busy    map[string]bool   // devices with a job running
+	devices []device.Info
+	running sync.WaitGroup
+}
+
+type job struct {
+	info   JobInfo
+	lane   string
+	cfg    *config.Config
+	sess   *core.Session
+	cancel context.CancelCauseFunc
+}
+
+// New builds a daemon that runs jobs with run under ctx.
+func New(ctx context.Context, cfg *config.Config, run Runner) *Daemon {
+	return &Daemon{
+		cfg:   cfg,
+		run:   run,
+		ctx:   ctx,
+		jobs:  map[string]*job{},
+		lanes: map[string][]*job{},
+		busy:  map[string]bool{},
+	}
+}
+
+// Submit queues job on its device's lane and starts the lane if it is idle.
+func (d *Daemon) Submit(j Job) (JobInfo, error) {
+	if err := j.validate(); err != nil {
+		return JobInfo{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cfg := *d.cfg
+	cfg.Device = d.target(j)
+	d.seq++
+	q := &job{
+		info: JobInfo{ID: strconv.Itoa(d.seq), Job: j, State: StateQueued, Queued: time.Now()},
+		lane: laneKey(cfg.Device),
+		cfg:  &cfg,
+	}
+	d.jobs[q.info.ID] = q
+	d.order = append(d.order, q)
+	d.lanes[q.lane] = append(d.lanes[q.lane], q)
+	slog.InfoContext(d.ctx, "job queued", "job", q.info.ID, "kind", j.Kind, "device", q.lane)
+	if !d.busy[q.lane] {
+		d.busy[q.lane] = true
+		d.running.Go(func() { d.drain(q.lane) })
+	}
+	return q.info, nil
+}
+
+// drain runs a lane's jobs one after another until it is empty.
+func (d *Daemon) drain(lane string) {
+	for {
+		d.mu.Lock()
+		queue := d.lanes[lane]
+		if len(queue) == 0 {
+			delete(d.lanes, lane)
+			delete(d.busy, lane)
+			d.mu.Unlock()
+			return
+		}
+		q := queue[0]
+		d.lanes[lane] = queue[1:]
+		ctx, cancel := context.WithCancelCause(d.ctx)
+		q.cancel = cancel
+		q.sess = core.NewSession(q.cfg.Playback().Device, cancel)
+		q.info.State = StateRunning
+		q.info.Started = time.Now()
+		d.mu.Unlock()
+
+		slog.InfoContext(ctx, "job started", "job", q.info.ID, "device", lane)
+		err := d.run(ctx, q.cfg, q.info.Job, q.sess)
+		cause := context.Cause(ctx)
+		cancel(nil)
+
+		d.mu.Lock()
+		q.info.Finished = time.Now()
+		switch {
+		case errors.Is(cause, errCancelled), errors.Is(cause, core.ErrStopped):
+			q.info.State = StateCancelled
+		case err != nil:
+			q.info.State = StateFailed
+			q.info.Error = err.Error()
+		default:
+			q.info.State = StateDone
+		}
+		d.prune()
+		d.mu.Unlock()
+		slog.InfoContext(d.ctx, "job finished", "job", q.info.ID, "state", q.info.State, "error", err)
+	}
+}
+
+// Cancel drops a queued job or stops a running one. Cancelling a finished job
+// is a no-op.
+func (d *Daemon) Cancel(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q, ok := d.jobs[id]
+	if !ok {
+		return ErrUnknownJob
+	}
+	switch q.info.State {
+	case StateQueued:
+		d.lanes[q.lane] = slices.DeleteFunc(d.lanes[q.lane], func(o *job) bool { return o == q })
+		q.info.State = StateCancelled
+		q.info.Finished = time.Now()
+		d.prune()
+	case StateRunning:
+		q.cancel(errCancelled)
+	}
+	return nil
+}
+
+// prune forgets the oldest finished jobs past keepFinished. d.mu must be held.
+func (d *Daemon) prune() {
+	finished := 0
+	for _, q := range d.order {
+		if q.info.State.Finished() {
+			finished++
+		}
+	}
+	d.order = slices.DeleteFunc(d.order, func(q *job) bool {
+		if finished <= keepFinished || !q.info.State.Finished() {
+			return false
+		}
+		finished--
+		delete(d.jobs, q.info.ID)
+		return true
+	})
+}
+
+// Job reports one job, with its live status while it runs.
+func (d *Daemon) Job(ctx context.Context, id string) (JobInfo, error) {
+	d.mu.Lock()
+	q, ok := d.jobs[id]
+	if !ok {
+		d.mu.Unlock()
+		return JobInfo{}, ErrUnknownJob
+	}
+	info, sess := q.info, q.sess
+	d.mu.Unlock()
+
+	if info.State == StateRunning {
+		st := sess.Status(ctx)
+		info.Status = &st
+	}
+	return info, nil
+}
+
+// Jobs lists the jobs the daemon holds, oldest first, without live status:
+// every one queued or running, and the last keepFinished to finish.
+func (d *Daemon) Jobs() []JobInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	infos := make([]JobInfo, len(d.order))
+	for i, q := range d.order {
+		infos[i] = q.info
+	}
+	return infos
+}
+
+// session returns a running job's session, for the per-job control API.
+func (d *Daemon) session(id string) (*core.Session, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q, ok := d.jobs[id]
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+	if q.info.State != StateRunning {
+		return nil, fmt.Errorf("job %s is %s, not running", id, q.info.State)
+	}
+	return q.sess, nil
+}
+
+// Wait blocks until every running job has returned. Cancel the daemon's
+// context first to make them return.
+func (d *Daemon) Wait() { d.running.Wait() }
+
+// target resolves the device a job casts to: the job's own device when it
+// names one, else the configured device, pinned to the address the last scan
+// found it at so connecting skips discovery.
+func (d *Daemon) target(j Job) config.DeviceConfig {
+	t := d.cfg.Device
+	if j.Device != "" || j.Host != "" {
+		t.Name, t.Host = j.Device, j.Host
+		t.Type = cmp.Or(j.DeviceType, t.Type)
+	}
+	if t.Host != "" {
+		return t
+	}
+	for _, info := range d.devices {
+		if info.Type == t.Type && strings.EqualFold(info.Name, t.Name) {
+			t.Host = info.Address
+			break
+		}
+	}
+	return t
+}
+
+// laneKey identifies a device for queueing, so two spellings of the same
+// device share a lane.
+func laneKey(t config.DeviceConfig) string {
+	return string(t.Type) + "/" + strings.ToLower(cmp.Or(t.Name, t.Host))
+}
+
+// Devices returns the last scan's devices.
+func (d *Daemon) Devices() []device.Info {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.devices)
+}
+
+// Rescan refreshes the device cache every interval until ctx is done, starting
+// immediately. A scan that finds nothing keeps the previous list, so a
+// momentary network hiccup does not unpin every device.
+func (d *Daemon) Rescan(ctx context.Context, interval time.Duration) {
+	for {
+		found, err := device.Discover(ctx, d.cfg.Network.Timeout)
+		if err != nil {
+			slog.WarnContext(ctx, "device scan failed", "error", err)
+		} else if len(found) > 0 {
+			d.mu.Lock()
+			d.devices = found
+			d.mu.Unlock()
+			slog.DebugContext(ctx, "device scan", "devices", len(found))
+		}
+		if interval <= 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/config"
+	"github.com/stupside/castor/internal/device"
+)
+
+// gatedRunner runs every job until the test releases it (or it is cancelled),
+// reporting each start on started.
+type gatedRunner struct {
+	started chan string
+	release chan struct{}
+}
+
+func newGatedRunner() *gatedRunner {
+	return &gatedRunner{started: make(chan string, 8), release: make(chan struct{})}
+}
+
+func (g *gatedRunner) run(ctx context.Context, cfg *config.Config, job Job, _ *core.Session) error {
+	g.started <- job.Target + "@" + cfg.Device.Name
+	select {
+	case <-g.release:
+		if job.Target == "broken" {
+			return errors.New("no stream")
+		}
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+func testConfig() *config.Config {
+	return &config.Config{Device: config.DeviceConfig{Name: "tv", Type: device.TypeDLNA}}
+}
+
+func expectStart(t *testing.T, g *gatedRunner, want string) {
+	t.Helper()
+	select {
+	case got := <-g.started:
+		if got != want {
+			t.Fatalf("started %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%q never started", want)
+	}
+}
+
+func expectIdle(t *testing.T, g *gatedRunner) {
+	t.Helper()
+	select {
+	case got := <-g.started:
+		t.Fatalf("%q started while its device was busy", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func waitState(t *testing.T, d *Daemon, id string, want State) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, err := d.Job(t.Context(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.State == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %s", id, info.State, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueSerialPerDeviceConcurrentAcross(t *testing.T) {
+	g := newGatedRunner()
+	d := New(t.Context(), testConfig(), g.run)
+
+	first, _ := d.Submit(Job{Kind: KindURL, Target: "a"})
+	second, _ := d.Submit(Job{Kind: KindURL, Target: "b", Device: "TV", DeviceType: device.TypeDLNA})
+	other, _ := d.Submit(Job{Kind: KindURL, Target: "c", Device: "kitchen", DeviceType: device.TypeDLNA})
+
+	// a and c run at once on their own devices; b waits behind a, since "TV"
+	// is the configured "tv".
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case s := <-g.started:
+			got[s] = true
+		case <-time.After(2 * time.Second):
+			t.Fatal("jobs on different devices should run concurrently")
+		}
+	}
+	if !got["a@tv"] || !got["c@kitchen"] {
+		t.Fatalf("started %v, want a@tv and c@kitchen", got)
+	}
+	expectIdle(t, g)
+	if info, _ := d.Job(t.Context(), second.ID); info.State != StateQueued {
+		t.Fatalf("second job on a busy device is %s, want queued", info.State)
+	}
+
+	g.release <- struct{}{}
+	g.release <- struct{}{}
+	expectStart(t, g, "b@TV")
+	g.release <- struct{}{}
+
+	for _, id := range []string{first.ID, second.ID, other.ID} {
+		waitState(t, d, id, StateDone)
+	}
+	d.Wait()
+}
+
+func TestCancel(t *testing.T) {
+	g := newGatedRunner()
+	d := New(t.Context(), testConfig(), g.run)
+
+	running, _ := d.Submit(Job{Kind: KindURL, Target: "a"})
+	queued, _ := d.Submit(Job{Kind: KindURL, Target: "b"})
+	expectStart(t, g, "a@tv")
+
+	if err := d.Cancel(queued.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, queued.ID, StateCancelled)
+
+	if err := d.Cancel(running.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, d, running.ID, StateCancelled)
+	// The cancelled queued job must never run.
+	expectIdle(t, g)
+
+	if err := d.Cancel("nope"); !errors.Is(err, ErrUnknownJob) {
+		t.Fatalf("Cancel(unknown) = %v, want ErrUnknownJob", err)
+	}
+	d.Wait()
+}
+
+func TestFailedJobReportsError(t *testing.T) {
+	g := newGatedRunner()
+	d := New(t.Context(), testConfig(), g.run)
+
+	info, _ := d.Submit(Job{Kind: KindPlayer, Target: "broken"})
+	expectStart(t, g, "broken@tv")
+	g.release <- struct{}{}
+	waitState(t, d, info.ID, StateFailed)
+	if got, _ := d.Job(t.Context(), info.ID); got.Error != "no stream" {
+		t.Fatalf("error = %q, want %q", got.Error, "no stream")
+	}
+	d.Wait()
+}
+
+// TestFinishedJobsPruned pins that a daemon forgets the oldest finished jobs
+// past keepFinished, keeping the latest and every one still to finish.
+func TestFinishedJobsPruned(t *testing.T) {
+	g := newGatedRunner()
+	d := New(t.Context(), testConfig(), g.run)
+
+	var ids []string
+	for range keepFinished + 5 {
+		info, _ := d.Submit(Job{Kind: KindURL, Target: "a"})
+		expectStart(t, g, "a@tv")
+		g.release <- struct{}{}
+		waitState(t, d, info.ID, StateDone)
+		ids = append(ids, info.ID)
+	}
+	queued, _ := d.Submit(Job{Kind: KindURL, Target: "b"})
+	expectStart(t, g, "b@tv")
+
+	jobs := d.Jobs()
+	if len(jobs) != keepFinished+1 {
+		t.Fatalf("holding %d jobs, want %d finished and the running one", len(jobs), keepFinished)
+	}
+	if jobs[0].ID != ids[5] || jobs[len(jobs)-1].ID != queued.ID {
+		t.Errorf("holding jobs %s..%s, want %s..%s", jobs[0].ID, jobs[len(jobs)-1].ID, ids[5], queued.ID)
+	}
+	if _, err := d.Job(t.Context(), ids[0]); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Job(oldest) = %v, want ErrUnknownJob", err)
+	}
+	g.release <- struct{}{}
+	d.Wait()
+}
+
+func TestSubmitValidates(t *testing.T) {
+	d := New(t.Context(), testConfig(), newGatedRunner().run)
+	tests := []struct {
+		name string
+		job  Job
+	}{
+		{"no target", Job{Kind: KindURL}},
+		{"unknown kind", Job{Kind: "show", Target: "x"}},
+		{"episode without numbers", Job{Kind: KindEpisode, Target: "x"}},
+		{"relative record path", Job{Kind: KindURL, Target: "x", Record: "out.mkv"}},
+		{"unrecordable format", Job{Kind: KindURL, Target: "x", Record: "/tmp/out.avi"}},
+		{"relative save subtitles path", Job{Kind: KindURL, Target: "x", SaveSubtitles: "film.srt"}},
+		{"unsavable subtitle format", Job{Kind: KindURL, Target: "x", SaveSubtitles: "/tmp/film.ass"}},
+		{"negative bitrate", Job{Kind: KindURL, Target: "x", Bitrate: -1}},
+		{"relative file path", Job{Kind: KindFile, Target: "movie.mkv"}},
+		{"relative subtitles path", Job{Kind: KindURL, Target: "x", Subtitles: "film.srt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := d.Submit(tt.job); err == nil {
+				t.Fatal("expected the job to be rejected")
+			}
+		})
+	}
+}
+
+func TestTargetPinsScannedAddress(t *testing.T) {
+	d := New(t.Context(), testConfig(), nil)
+	d.devices = []device.Info{{Name: "TV", Type: device.TypeDLNA, Address: "http://10.0.0.5:1400/desc.xml"}}
+
+	if got := d.target(Job{}).Host; got != "http://10.0.0.5:1400/desc.xml" {
+		t.Errorf("configured device host = %q, want the scanned address", got)
+	}
+	if got := d.target(Job{Device: "TV", DeviceType: device.TypeRoku}).Host; got != "" {
+		t.Errorf("a device of another type must not be pinned, got %q", got)
+	}
+	if got := d.target(Job{Host: "10.0.0.9"}).Host; got != "10.0.0.9" {
+		t.Errorf("an explicit host must win, got %q", got)
+	}
+}
+
+func TestClientOverSocket(t *testing.T) {
+	g := newGatedRunner()
+	d := New(t.Context(), testConfig(), g.run)
+	socket := filepath.Join(t.TempDir(), "d.sock")
+	ln, err := listenUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: d.Handler()}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+
+	if _, err := listenUnix(socket); err == nil {
+		t.Fatal("a second daemon must not take over a live socket")
+	}
+
+	c, err := Dial(t.Context(), socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := c.Submit(t.Context(), Job{Kind: KindURL, Target: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStart(t, g, "a@tv")
+	g.release <- struct{}{}
+
+	var seen []State
+	final, err := c.Wait(t.Context(), info.ID, func(i JobInfo) { seen = append(seen, i.State) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.State != StateDone || seen[len(seen)-1] != StateDone {
+		t.Fatalf("final state %s (seen %v), want done", final.State, seen)
+	}
+
+	if _, err := c.Submit(t.Context(), Job{Kind: KindURL}); err == nil {
+		t.Fatal("an invalid job must be refused")
+	}
+	d.Wait()
+}
+
+func TestDialWithoutDaemon(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "none.sock")
+	var opErr *net.OpError
+	if _, err := Dial(t.Context(), socket); !errors.As(err, &opErr) {
+		t.Fatalf("Dial should fail with the dial error when nothing listens, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/stupside/castor/internal/cast"
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/config"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/source/extract"
+	"github.com/stupside/castor/internal/source/resolve"
+)
+
+// Cast is the Runner the daemon serves with: it does what the matching cast
+// subcommand does, but extracts through ext, whose browser the daemon keeps
+// warm across jobs.
+func Cast(ext *extract.Extractor) Runner {
+	return func(ctx context.Context, cfg *config.Config, job Job, sess *core.Session) error {
+		// The job's session is the daemon's to serve; a per-cast control API
+		// would contend for one address across concurrent jobs.
+		playback := cfg.Playback()
+		playback.Control.Enable = false
+		if len(job.AudioLanguages) > 0 {
+			playback.Resolver.AudioLanguages = job.AudioLanguages
+		}
+		if len(job.SubtitleLanguages) > 0 {
+			playback.Resolver.SubtitleLanguages = job.SubtitleLanguages
+			playback.Whisper = playback.Whisper.In(job.SubtitleLanguages)
+		}
+		opts := []cast.Option{cast.WithSession(sess), cast.WithRecord(job.Record), cast.WithMaxBitrate(job.Bitrate), cast.WithSubtitles(job.subtitles()), cast.WithSaveSubtitles(job.SaveSubtitles)}
+		if job.Kind == KindFile {
+			return cast.PlayFile(ctx, playback, job.Target, opts...)
+		}
+
+		// A source that fails before playback falls over to the next
+		// candidate; a pull that breaks partway is resumed from the job's
+		// sources found again, through the same warm extractor.
+		rerank := func(ctx context.Context) ([]*media.Stream, error) {
+			return source(ctx, ext, cfg, job)
+		}
+		if key := cacheKey(job); key != "" {
+			opts = append(opts, cast.WithCacheKey(key))
+			if ok, err := cast.PlayCached(ctx, playback, key, rerank, opts...); ok {
+				return err
+			}
+		}
+
+		candidates, err := source(ctx, ext, cfg, job)
+		if err != nil {
+			return err
+		}
+		return cast.PlayRanked(ctx, playback, candidates, rerank, opts...)
+	}
+}
+
+// cacheKey is the spool cache key of the title job casts, empty for a job
+// naming no title.
+func cacheKey(job Job) string {
+	switch job.Kind {
+	case KindMovie:
+		return cast.MovieKey(job.Target)
+	case KindEpisode:
+		return cast.EpisodeKey(job.Target, job.Season, job.Episode)
+	}
+	return ""
+}
+
+// source turns a job into the streams to cast, best first: a direct URL as
+// is, anything else by extracting every candidate page and ranking what they
+// yield.
+func source(ctx context.Context, ext *extract.Extractor, cfg *config.Config, job Job) ([]*media.Stream, error) {
+	var pages []string
+	switch job.Kind {
+	case KindURL:
+		u, err := url.Parse(job.Target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL %q: %w", job.Target, err)
+		}
+		return []*media.Stream{{URL: u, ContentType: media.DetectFromExtension(u)}}, nil
+	case KindPlayer:
+		pages = []string{job.Target}
+	case KindMovie:
+		pages = cfg.AllMovieURLs(job.Target)
+	case KindEpisode:
+		pages = cfg.AllEpisodeURLs(job.Target, job.Season, job.Episode)
+	}
+
+	streams, err := ext.ExtractAll(ctx, pages)
+	if err != nil {
+		return nil, fmt.Errorf("extracting streams: %w", err)
+	}
+	ranked, err := resolve.RankStreams(ctx, cfg.Resolver, streams)
+	if err != nil {
+		return nil, fmt.Errorf("ranking streams: %w", err)
+	}
+	return ranked, nil
+}
@@ -0,0 +1,187 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/control"
+	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/config"
+	"github.com/stupside/castor/internal/metrics"
+	"github.com/stupside/castor/internal/source/extract"
+)
+
+// Serve runs the daemon until ctx is done: it warms what it can, serves the API
+// on the Unix socket (and on the TCP address when configured), and on shutdown
+// cancels the running jobs and waits for them to unwind.
+//
+// The socket is created owner-only and needs no token: reaching it already
+// takes this user's file permissions. The TCP listener follows the control
+// API's rule and requires a token anywhere but loopback.
+func Serve(ctx context.Context, cfg *config.Config) error {
+	socket, err := cfg.Daemon.SocketPath()
+	if err != nil {
+		return err
+	}
+	if cfg.Daemon.Address != "" {
+		if err := control.CheckExposure(cfg.Daemon.Address, cfg.Daemon.Token); err != nil {
+			return fmt.Errorf("daemon API: %w", err)
+		}
+	}
+
+	ext, err := extract.New(cfg.Extractor())
+	if err != nil {
+		return fmt.Errorf("creating extractor: %w", err)
+	}
+	// A browser that fails to start is not fatal: extraction falls back to
+	// launching one per attempt, exactly as the one-shot commands do.
+	if err := ext.Warm(ctx); err != nil {
+		slog.WarnContext(ctx, "browser not warmed; extracting cold", "error", err)
+	}
+	defer ext.Close()
+	go ffmpeg.WarmEncoders(ctx, cfg.Transcode.FFmpegPath)
+
+	if cfg.Metrics.Enable {
+		srv, err := metrics.New(cfg.Metrics)
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+		slog.InfoContext(ctx, "metrics endpoint listening", "address", srv.Addr().String())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d := New(ctx, cfg, Cast(ext))
+	go d.Rescan(ctx, cfg.Daemon.RescanInterval)
+
+	ln, err := listenUnix(socket)
+	if err != nil {
+		return err
+	}
+	servers := []*http.Server{serve(ln, d.Handler())}
+	slog.InfoContext(ctx, "daemon listening", "socket", socket)
+	if cfg.Daemon.Address != "" {
+		tcp, err := net.Listen("tcp", cfg.Daemon.Address)
+		if err != nil {
+			servers[0].Close()
+			return fmt.Errorf("binding daemon API: %w", err)
+		}
+		servers = append(servers, serve(tcp, control.RequireToken(cfg.Daemon.Token, d.Handler())))
+		slog.InfoContext(ctx, "daemon listening", "address", tcp.Addr().String())
+	}
+
+	<-ctx.Done()
+	slog.InfoContext(ctx, "daemon shutting down")
+	for _, s := range servers {
+		s.Close()
+	}
+	d.Wait()
+	return nil
+}
+
+func serve(ln net.Listener, h http.Handler) *http.Server {
+	s := &http.Server{Handler: h, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = s.Serve(ln) }()
+	return s
+}
+
+// listenUnix binds the socket owner-only. A socket file left by a daemon that
+// died without cleaning up is replaced; one a live daemon still answers on is
+// not, so two daemons never fight over it.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("creating socket directory: %w", err)
+	}
+	if conn, err := net.DialTimeout("unix", path, dialTimeout); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("removing stale socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("binding daemon socket: %w", err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("restricting daemon socket: %w", err)
+	}
+	return ln, nil
+}
+
+// Handler routes the daemon API.
+//
+//	POST   /jobs                       submit a Job (JSON); 202 with its JobInfo
+//	GET    /jobs                       every job, oldest first
+//	GET    /jobs/{id}                  one job, with live status while it runs
+//	DELETE /jobs/{id}                  cancel a queued or running job
+//	       /jobs/{id}/control/...      the control API (see control.Handler) of a running job
+//	GET    /devices                    the last device scan
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		var j Job
+		if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
+			http.Error(w, fmt.Sprintf("decoding job: %v", err), http.StatusBadRequest)
+			return
+		}
+		info, err := d.Submit(j)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+info.ID)
+		respond(w, http.StatusAccepted, info)
+	})
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, d.Jobs())
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		info, err := d.Job(r.Context(), r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		respond(w, http.StatusOK, info)
+	})
+	mux.HandleFunc("DELETE /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := d.Cancel(r.PathValue("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/jobs/{id}/control/", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		sess, err := d.session(id)
+		switch {
+		case errors.Is(err, ErrUnknownJob):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.StripPrefix("/jobs/"+id+"/control", control.Handler(sess, "")).ServeHTTP(w, r)
+	})
+	mux.HandleFunc("GET /devices", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, d.Devices())
+	})
+	return mux
+}
+
+func respond(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
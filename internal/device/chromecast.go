@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/vishen/go-chromecast/application"
 	castdns "github.com/vishen/go-chromecast/dns"
@@ -21,7 +22,10 @@ type chromecastDevice struct {
 	app *application.Application
 }
 
-var _ Device = (*chromecastDevice)(nil)
+var (
+	_ Device     = (*chromecastDevice)(nil)
+	_ Controller = (*chromecastDevice)(nil)
+)
 
 // chromecast is the Google Cast strategy. Cast is a smart client: handed a URL it
 // fetches the media itself, so it self-fetches.
@@ -137,24 +141,35 @@ func (c *chromecastDevice) Close() error {
 }
 
 // chromecastCapabilities: Chromecast decides pass-through purely on the
-// container (it never re-encodes video, so it carries no video envelope),
-// accepting these MIME types directly. SelfFetch is true: handed a URL, Cast
-// pulls it over the network itself, so an accepted container casts straight
-// through with no castor-served stream. The audio envelope drives the remux
-// path only (a non-accepted container remuxed to mp4): Cast decodes AAC, AC-3,
-// and E-AC-3, so a 5.1 track in an MKV is stream-copied intact instead of
-// downmixed. There is no runtime query as there is for DLNA, so this is the
-// documented Cast media profile. AAC is capped at 5.1 (6 channels): Cast decodes
-// multichannel AAC only up to 5.1, so a 7.1 AAC track is re-encoded (to a Dolby
-// codec, else stereo) rather than copied to a receiver that can't play it.
+// container, accepting these MIME types directly. SelfFetch is true: handed a
+// URL, Cast pulls it over the network itself, so an accepted container casts
+// straight through with no castor-served stream. The video envelope only
+// decides whether a local file plays as it is or is re-encoded (a pass-through
+// or remux hands Cast the source's own video): it is H.264, which every Cast
+// device decodes. HEVC, VP9 and AV1 vary by model (an Ultra or a Google TV
+// decodes some, the older dongles none), and Cast reports neither its model nor
+// its decoders to a sender, so a user names them in device.Config.Codecs for
+// the device they have. The audio envelope drives the remux path only (a
+// non-accepted container remuxed to mp4): Cast decodes AAC, AC-3, and E-AC-3,
+// so a 5.1 track in an MKV is stream-copied intact instead of downmixed, and
+// MP3, Opus and FLAC in stereo. DTS and TrueHD are absent: Cast neither decodes
+// nor passes them through, so they fold to a Dolby codec. There is no runtime
+// query as there is for DLNA, so this is the documented Cast media profile. AAC
+// is capped at 5.1 (6 channels): Cast decodes multichannel AAC only up to 5.1,
+// so a 7.1 AAC track is re-encoded (to a Dolby codec, else stereo) rather than
+// copied to a receiver that can't play it.
 var chromecastCapabilities = media.Renderer{
 	SelfFetch:       chromecast{}.selfFetches(),
 	Containers:      []string{media.HLS, media.MP4, media.MKV, media.WebM},
 	ServedContainer: media.MP4,
+	Video:           []media.VideoSupport{videoSupportFor(media.CodecH264)},
 	Audio: []media.AudioSupport{
 		{Codec: media.CodecAAC, MaxChannels: 6},
 		{Codec: media.CodecAC3},
 		{Codec: media.CodecEAC3},
+		{Codec: media.CodecMP3, MaxChannels: 2},
+		{Codec: media.CodecOpus, MaxChannels: 2},
+		{Codec: media.CodecFLAC, MaxChannels: 2},
 	},
 }
 
@@ -165,6 +180,35 @@ func (c *chromecastDevice) Capabilities() media.Renderer { return chromecastCapa
 
 // StreamHeaders returns nil: Chromecast needs no protocol-specific headers on
 // the local stream server's responses.
-func (c *chromecastDevice) StreamHeaders(string) map[string]string {
+func (c *chromecastDevice) StreamHeaders(string, bool) map[string]string {
 	return nil
 }
+
+// The transport controls drive the default media receiver over the open cast
+// channel. Like Start, the library's calls take no context, so ctx is unused.
+
+func (c *chromecastDevice) Pause(context.Context) error  { return c.app.Pause() }
+func (c *chromecastDevice) Resume(context.Context) error { return c.app.Unpause() }
+func (c *chromecastDevice) Stop(context.Context) error   { return c.app.StopMedia() }
+
+func (c *chromecastDevice) Seek(_ context.Context, position time.Duration) error {
+	return c.app.SeekToTime(float32(position.Seconds()))
+}
+
+// SetVolume maps percent onto Cast's 0..1 receiver volume.
+func (c *chromecastDevice) SetVolume(_ context.Context, percent int) error {
+	return c.app.SetVolume(float32(percent) / 100)
+}
+
+// Position refreshes the receiver status (the library caches it otherwise) and
+// reads the media session's current time.
+func (c *chromecastDevice) Position(context.Context) (time.Duration, error) {
+	if err := c.app.Update(); err != nil {
+		return 0, fmt.Errorf("refreshing chromecast status: %w", err)
+	}
+	_, m, _ := c.app.Status()
+	if m == nil {
+		return 0, fmt.Errorf("chromecast has no active media session")
+	}
+	return time.Duration(float64(m.CurrentTime) * float64(time.Second)), nil
+}
@@ -1,7 +1,8 @@
 // Package device discovers media renderers on the local network and speaks
 // their control protocols (DLNA/UPnP AVTransport, Chromecast). The Device
 // interface is deliberately small: the cast pipeline decides what to send
-// (subtitles are burned in upstream), a Device only needs to fetch and play.
+// (subtitles are burned in upstream, or served as a file beside the stream to
+// a renderer that takes one), a Device only needs to fetch and play.
 package device
 
 import (
@@ -41,9 +42,9 @@ func SelfFetches(t Type) bool {
 }
 
 type Info struct {
-	Name    string
-	Type    Type
-	Address string
+	Name    string `json:"name"`
+	Type    Type   `json:"type"`
+	Address string `json:"address"`
 }
 
 // Config is the resolved device target the agnostic layers carry and forward:
@@ -63,6 +64,21 @@ type Config struct {
 	// Name over discovery".
 	Address string
 
+	// HDR are the dynamic ranges the user declares the renderer shows, on top
+	// of the SDR it is assumed to: no casting protocol advertises HDR, so a TV
+	// that does it right is only known to by its owner. Connect adds them to
+	// every 10-bit envelope the renderer advertises (see
+	// media.Renderer.WithRanges), and a source in one of them is then copied
+	// through rather than tone-mapped.
+	HDR []media.DynamicRange
+
+	// Codecs are video codecs the user declares the renderer decodes beyond
+	// what it advertises: a Chromecast reports nothing (see
+	// chromecastCapabilities), and a TV's DLNA Sink often omits the newer
+	// codecs it plays. Connect adds each with its family-agnostic copy
+	// envelope (see videoSupportFor).
+	Codecs []media.Codec
+
 	Family any
 }
 
@@ -80,13 +96,45 @@ type Device interface {
 	Capabilities() media.Renderer
 
 	// StreamHeaders returns protocol-specific HTTP headers the local stream
-	// server must send when this renderer fetches contentType. Nil when the
-	// protocol needs none.
-	StreamHeaders(contentType string) map[string]string
+	// server must send when this renderer fetches contentType. seekable is true
+	// when the server answers seeks: a finished file, or a VOD it produces as it
+	// goes (see core.OpenParams.Duration), rather than a live stream. Nil when
+	// the protocol needs none.
+	StreamHeaders(contentType string, seekable bool) map[string]string
 
 	Close() error
 }
 
+// Controller is the transport control a renderer offers once it is playing:
+// pause, resume, seek, stop, volume, and the playhead. It is a separate,
+// optional interface rather than part of Device because the families differ in
+// what they can do (Roku's ECP has no absolute seek or volume), so callers
+// type-assert for it and a family returns errors.ErrUnsupported for an action
+// its protocol lacks instead of faking one. Every family implements it today.
+type Controller interface {
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+	// Seek moves the playhead to position, measured from the start of the
+	// stream the renderer was handed.
+	Seek(ctx context.Context, position time.Duration) error
+	Stop(ctx context.Context) error
+	// SetVolume sets the renderer's output volume, percent in 0..100.
+	SetVolume(ctx context.Context, percent int) error
+	// Position reports the renderer's playhead.
+	Position(ctx context.Context) (time.Duration, error)
+}
+
+// Captioner is a renderer that can be handed a caption file along with the
+// stream, one that declares media.Renderer.Captions. It is optional, like
+// Controller, because only DLNA has a way to say "and show these subtitles":
+// Cast's sender library loads media with no text tracks, and Roku's ECP takes a
+// single URL.
+type Captioner interface {
+	// PlayCaptioned is Play with captions, an SRT file the renderer fetches
+	// and shows over the stream.
+	PlayCaptioned(ctx context.Context, streamURL *url.URL, contentType string, captions *url.URL) error
+}
+
 // renderer is one device family's strategy: everything protocol-specific about
 // reaching a renderer of that family, behind a single interface. Discovering a
 // device, locating a pinned one, and connecting are all family-specific, so they
@@ -143,7 +191,58 @@ func Connect(ctx context.Context, info Info, cfg Config) (Device, error) {
 	if !ok {
 		return nil, fmt.Errorf("unknown device type: %q", info.Type)
 	}
-	return r.connect(ctx, info, cfg)
+	dev, err := r.connect(ctx, info, cfg)
+	if err != nil || (len(cfg.HDR) == 0 && len(cfg.Codecs) == 0) {
+		return dev, err
+	}
+	return declare(dev, cfg), nil
+}
+
+// declared is a connected device with the codecs and HDR ranges its Config
+// declares added to what it advertises.
+type declared struct {
+	Device
+	caps media.Renderer
+}
+
+func (d declared) Capabilities() media.Renderer { return d.caps }
+
+// declaredController is a declared device that keeps the transport control of
+// the one it wraps, so wrapping hides no Controller.
+type declaredController struct {
+	declared
+	Controller
+}
+
+// declaredCaptioner is a declared controller that keeps the caption hand-off
+// of the one it wraps too: a declared DLNA renderer still advertises Captions,
+// so a cast can plan it a sidecar that core hands over through Captioner.
+type declaredCaptioner struct {
+	declaredController
+	Captioner
+}
+
+// declare wraps dev to advertise what cfg declares as well as its own
+// capabilities, keeping the optional interfaces (Controller, Captioner) it
+// implements. The codecs go first, so a declared range reaches a declared
+// codec's envelope too.
+func declare(dev Device, cfg Config) Device {
+	caps := dev.Capabilities()
+	caps.Video = slices.Clone(caps.Video)
+	for _, c := range cfg.Codecs {
+		if !caps.SupportsCodec(c) {
+			caps.Video = append(caps.Video, videoSupportFor(c))
+		}
+	}
+	d := declared{Device: dev, caps: caps.WithRanges(cfg.HDR)}
+	ctrl, ok := dev.(Controller)
+	if !ok {
+		return d
+	}
+	if c, ok := dev.(Captioner); ok {
+		return declaredCaptioner{declaredController{d, ctrl}, c}
+	}
+	return declaredController{d, ctrl}
 }
 
 func FindInfo(ctx context.Context, timeout time.Duration, dtype Type, name string) (Info, error) {
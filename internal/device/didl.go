@@ -4,6 +4,8 @@ import (
 	"encoding/xml"
 	"fmt"
 	"net/url"
+
+	"github.com/stupside/castor/internal/media"
 )
 
 type didlLite struct {
@@ -11,16 +13,18 @@ type didlLite struct {
 	XMLNS   string   `xml:"xmlns,attr"`
 	DC      string   `xml:"xmlns:dc,attr"`
 	UPnP    string   `xml:"xmlns:upnp,attr"`
+	Sec     string   `xml:"xmlns:sec,attr,omitempty"`
 	Item    didlItem `xml:"item"`
 }
 
 type didlItem struct {
-	ID         string  `xml:"id,attr"`
-	ParentID   string  `xml:"parentID,attr"`
-	Restricted string  `xml:"restricted,attr"`
-	Title      string  `xml:"dc:title"`
-	Class      string  `xml:"upnp:class"`
-	Res        didlRes `xml:"res"`
+	ID         string        `xml:"id,attr"`
+	ParentID   string        `xml:"parentID,attr"`
+	Restricted string        `xml:"restricted,attr"`
+	Title      string        `xml:"dc:title"`
+	Class      string        `xml:"upnp:class"`
+	Captions   []didlCaption `xml:"sec:CaptionInfoEx"`
+	Res        []didlRes     `xml:"res"`
 }
 
 type didlRes struct {
@@ -28,11 +32,24 @@ type didlRes struct {
 	Value        string `xml:",chardata"`
 }
 
+type didlCaption struct {
+	Type  string `xml:"sec:type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// secNamespace is Samsung's DIDL-Lite extension namespace, which the
+// CaptionInfoEx element naming an item's subtitle file lives in. It is the one
+// caption convention DLNA renderers share: Samsung defined it, and LG, Sony
+// and most software renderers read it too.
+const secNamespace = "http://www.sec.co.kr/"
+
 // buildDIDLMetadata returns the DIDL-Lite XML the renderer needs to play
-// streamURL. Subtitles are not advertised here: the cast pipeline hardsubs
-// them into the video before this point, so the renderer plays a single
-// video resource with no caption track.
-func buildDIDLMetadata(streamURL *url.URL, contentType string) (string, error) {
+// streamURL. Subtitles the cast pipeline burned in are part of the video and
+// need no mention. captions, when non-nil, is an SRT file served beside the
+// stream, advertised twice over because renderers disagree on where to look:
+// as a sec:CaptionInfoEx element, and as a second text/srt resource of the
+// item.
+func buildDIDLMetadata(streamURL *url.URL, contentType string, seekable bool, captions *url.URL) (string, error) {
 	item := didlLite{
 		XMLNS: "urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/",
 		DC:    "http://purl.org/dc/elements/1.1/",
@@ -43,12 +60,20 @@ func buildDIDLMetadata(streamURL *url.URL, contentType string) (string, error) {
 			Restricted: "1",
 			Title:      "Castor Stream",
 			Class:      "object.item.videoItem",
-			Res: didlRes{
-				ProtocolInfo: fmt.Sprintf("http-get:*:%s:%s", contentType, contentFeatures(contentType)),
+			Res: []didlRes{{
+				ProtocolInfo: fmt.Sprintf("http-get:*:%s:%s", contentType, contentFeatures(contentType, seekable)),
 				Value:        streamURL.String(),
-			},
+			}},
 		},
 	}
+	if captions != nil {
+		item.Sec = secNamespace
+		item.Item.Captions = []didlCaption{{Type: "srt", Value: captions.String()}}
+		item.Item.Res = append(item.Item.Res, didlRes{
+			ProtocolInfo: "http-get:*:" + media.SRT + ":*",
+			Value:        captions.String(),
+		})
+	}
 
 	data, err := xml.Marshal(item)
 	if err != nil {
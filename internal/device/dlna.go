@@ -8,7 +8,9 @@ import (
 	"log/slog"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/huin/goupnp"
@@ -37,8 +39,8 @@ const (
 // and Sony sets commonly advertise :3) and service lookup is an exact URN
 // match, so asking only for :1 misses them. UPnP requires a higher service
 // version to stay backward compatible with the actions of lower ones, and
-// castor calls only SetAVTransportURI, Play and GetProtocolInfo — all unchanged
-// since v1.
+// every action castor calls (SetAVTransportURI and the transport controls,
+// GetProtocolInfo, SetVolume) is unchanged since v1.
 var serviceVersions = []int{3, 2, 1}
 
 // dlnaDevice is a connected UPnP AVTransport renderer. caps is negotiated once
@@ -48,14 +50,26 @@ var serviceVersions = []int{3, 2, 1}
 // wrapper: the SOAP action namespace must match the service version the device
 // published, and goupnp's av1 clients hardcode the :1 URN, which a :3 service
 // can reject as an invalid action.
+//
+// rendering is the RenderingControl service, read only for volume. It is nil
+// when the renderer publishes none, which SetVolume reports as unsupported
+// rather than failing the connect over a knob playback does not need.
 type dlnaDevice struct {
 	transport goupnp.ServiceClient
+	rendering *goupnp.ServiceClient
 	caps      media.Renderer
+	// seekable is what the last StreamHeaders call was told, so Play's DIDL
+	// advertises the same operations as the stream server's headers do.
+	seekable bool
 }
 
 func (d *dlnaDevice) Capabilities() media.Renderer { return d.caps }
 
-var _ Device = (*dlnaDevice)(nil)
+var (
+	_ Device     = (*dlnaDevice)(nil)
+	_ Controller = (*dlnaDevice)(nil)
+	_ Captioner  = (*dlnaDevice)(nil)
+)
 
 // dlna is the DLNA/UPnP AVTransport strategy. A DLNA renderer only plays bytes
 // castor serves it (it never fetches a source URL), so it does not self-fetch.
@@ -211,7 +225,11 @@ func (dlna) connect(ctx context.Context, info Info, _ Config) (Device, error) {
 	if err != nil {
 		return nil, fmt.Errorf("creating AVTransport client: %w", err)
 	}
-	return &dlnaDevice{transport: transport, caps: negotiateCaps(ctx, loc, u)}, nil
+	dev := &dlnaDevice{transport: transport, caps: cachedCaps(ctx, loc, u)}
+	if rendering, err := findService(loc, u, "RenderingControl"); err == nil {
+		dev.rendering = &rendering
+	}
+	return dev, nil
 }
 
 // findService returns a client for the newest version of the named service the
@@ -230,15 +248,45 @@ func findService(root *goupnp.RootDevice, loc *url.URL, service string) (goupnp.
 		service, root.Device.FriendlyName, root.Device.UDN)
 }
 
+// capsCache holds each renderer's negotiated capabilities for the process,
+// keyed by its description URL, so a long-running process (the daemon) asks a
+// renderer once rather than on every cast. Only a real negotiation is cached: a
+// degraded fallback is retried on the next connect.
+var (
+	capsMu    sync.Mutex
+	capsCache = map[string]media.Renderer{}
+)
+
+// cachedCaps returns the renderer's negotiated capabilities, negotiating on
+// first use.
+func cachedCaps(ctx context.Context, loc *goupnp.RootDevice, u *url.URL) media.Renderer {
+	key := u.String()
+	capsMu.Lock()
+	caps, ok := capsCache[key]
+	capsMu.Unlock()
+	if ok {
+		slog.DebugContext(ctx, "reusing negotiated renderer capabilities", "location", key)
+		return caps
+	}
+	caps, ok = negotiateCaps(ctx, loc, u)
+	if ok {
+		capsMu.Lock()
+		capsCache[key] = caps
+		capsMu.Unlock()
+	}
+	return caps
+}
+
 // negotiateCaps asks the renderer what it accepts, over ConnectionManager
 // GetProtocolInfo, and maps its advertised Sink into a media.Renderer. It is
 // best-effort: any failure, or a renderer that advertises no codec we know,
-// degrades to fallbackCaps so playback still works (just conservatively).
-func negotiateCaps(ctx context.Context, loc *goupnp.RootDevice, u *url.URL) media.Renderer {
+// degrades to fallbackCaps so playback still works (just conservatively), and
+// reports false so the fallback is not cached.
+func negotiateCaps(ctx context.Context, loc *goupnp.RootDevice, u *url.URL) (media.Renderer, bool) {
 	manager, err := findService(loc, u, "ConnectionManager")
 	if err != nil {
 		slog.WarnContext(ctx, "no ConnectionManager service; using conservative capabilities", "error", err)
-		return fallbackCaps()
+		return fallbackCaps(), false
 	}
 	ctx, cancel := context.WithTimeout(ctx, capsTimeout)
 	defer cancel()
@@ -247,16 +295,16 @@ func negotiateCaps(ctx context.Context, loc *goupnp.RootDevice, u *url.URL) medi
 	if err := manager.SOAPClient.PerformActionCtx(
 		ctx, manager.Service.ServiceType, "GetProtocolInfo", nil, response); err != nil {
 		slog.WarnContext(ctx, "GetProtocolInfo failed; using conservative capabilities", "error", err)
-		return fallbackCaps()
+		return fallbackCaps(), false
 	}
 	sink := response.Sink
 	caps := parseSinkProtocolInfo(sink)
 	if len(caps.Video) == 0 {
 		slog.WarnContext(ctx, "renderer advertised no known video codec; using conservative capabilities")
-		return fallbackCaps()
+		return fallbackCaps(), false
 	}
 	slog.InfoContext(ctx, "negotiated renderer capabilities", "codecs", codecNames(caps.Video), "containers", caps.Containers)
-	return caps
+	return caps, true
 }
 
 // codecEnvelope is the codec-fixed part of a stream-copy envelope: the profiles
@@ -271,6 +319,9 @@ type codecEnvelope struct {
 var codecEnvelopes = map[media.Codec]codecEnvelope{
 	media.CodecH264: {profiles: []string{"Constrained Baseline", "Baseline", "Main", "High"}},
 	media.CodecHEVC: {profiles: []string{"Main", "Main 10"}, bitDepths: []int{8, 10}},
+	media.CodecAV1:  {profiles: []string{"Main"}, bitDepths: []int{8, 10}},
+	// VP9 profile 2 is its 10-bit 4:2:0; 1 and 3 are 4:4:4, which no TV decodes.
+	media.CodecVP9: {profiles: []string{"Profile 0", "Profile 2"}, bitDepths: []int{8, 10}},
 }
 
 // videoSupportFor builds the copy envelope for a codec: its decode-safety
@@ -288,10 +339,14 @@ func videoSupportFor(codec media.Codec) media.VideoSupport {
 // no channel count, so AAC (which a renderer commonly decodes stereo-only, its
 // multichannel form being a separate profile most sets don't list) is capped at
 // stereo: an advertised AAC is trusted to copy a stereo track but a 5.1 AAC
-// source re-encodes to a Dolby codec instead. AC-3/E-AC-3 are inherently
-// surround, so their advertised support is trusted at full channel count.
+// source re-encodes to a Dolby codec instead. MP3 is stereo at most, and FLAC
+// and Opus, which a set lists for music far more often than it decodes them in
+// surround, get the same cap. AC-3/E-AC-3, DTS and TrueHD are inherently
+// surround (a TV lists the last two only when it passes them to a receiver), so
+// their advertised support is trusted at full channel count.
 func audioSupportFor(codec media.Codec) media.AudioSupport {
-	if codec == media.CodecAAC {
+	switch codec {
+	case media.CodecAAC, media.CodecMP3, media.CodecFLAC, media.CodecOpus:
 		return media.AudioSupport{Codec: codec, MaxChannels: 2}
 	}
 	return media.AudioSupport{Codec: codec}
@@ -300,8 +355,11 @@ func audioSupportFor(codec media.Codec) media.AudioSupport {
 // discoverableCodecs is the fixed order capabilities are reported in, so a given
 // Sink always yields the same Renderer (and the same is testable).
 var (
-	discoverableCodecs      = []media.Codec{media.CodecH264, media.CodecHEVC}
-	discoverableAudioCodecs = []media.Codec{media.CodecAAC, media.CodecAC3, media.CodecEAC3}
+	discoverableCodecs      = []media.Codec{media.CodecH264, media.CodecHEVC, media.CodecAV1, media.CodecVP9}
+	discoverableAudioCodecs = []media.Codec{
+		media.CodecAAC, media.CodecAC3, media.CodecEAC3, media.CodecDTS,
+		media.CodecTrueHD, media.CodecFLAC, media.CodecOpus, media.CodecMP3,
+	}
 )
 
 // fallbackCaps is the conservative envelope used when negotiation yields nothing
@@ -324,6 +382,7 @@ func parseSinkProtocolInfo(sink string) media.Renderer {
 	present := map[media.Codec]bool{}
 	audioPresent := map[media.Codec]bool{}
 	containers := map[string]bool{}
+	captions := false
 	for entry := range strings.SplitSeq(sink, ",") {
 		fields := strings.SplitN(strings.TrimSpace(entry), ":", 4)
 		if len(fields) < 3 || !strings.EqualFold(fields[0], "http-get") {
@@ -343,6 +402,9 @@ func parseSinkProtocolInfo(sink string) media.Renderer {
 		if ct, ok := containerFromMIME(mime); ok {
 			containers[ct] = true
 		}
+		if captionMIMEs[mime] {
+			captions = true
+		}
 	}
 
 	// A DLNA renderer only plays a resource we push to it via SetAVTransportURI;
@@ -350,7 +412,7 @@ func parseSinkProtocolInfo(sink string) media.Renderer {
 	// false (derived from dlna.selfFetches(), the single source of truth for
 	// this family's static self-fetch bit) and the planner always serves the
 	// stream from castor.
-	r := media.Renderer{SelfFetch: dlna{}.selfFetches()}
+	r := media.Renderer{SelfFetch: dlna{}.selfFetches(), Captions: captions}
 	for _, c := range discoverableCodecs {
 		if present[c] {
 			r.Video = append(r.Video, videoSupportFor(c))
@@ -369,10 +431,25 @@ func parseSinkProtocolInfo(sink string) media.Renderer {
 	return r
 }
 
+// captionMIMEs are the Sink MIME types that say a renderer loads a subtitle
+// file beside the video: SRT under its registered and its legacy name, and the
+// SAMI type Samsung sets list alongside it.
+var captionMIMEs = map[string]bool{
+	media.SRT:              true,
+	"application/x-subrip": true,
+	"smi/caption":          true,
+}
+
 // codecFromProfile identifies the video codec of a Sink entry from its DLNA.ORG_PN
-// token (already upper-cased) or, failing that, its MIME type.
+// token (already upper-cased) or, failing that, its MIME type. DLNA defines no
+// profile for AV1 or VP9, so a renderer that decodes them names them in a
+// vendor token or a codecs-qualified MIME (video/mp4;codecs=av01, video/x-vp9).
 func codecFromProfile(mime, pn string) (media.Codec, bool) {
 	switch {
+	case strings.Contains(pn, "AV1") || strings.Contains(mime, "av1") || strings.Contains(mime, "av01"):
+		return media.CodecAV1, true
+	case strings.Contains(pn, "VP9") || strings.Contains(mime, "vp9") || strings.Contains(mime, "vp09"):
+		return media.CodecVP9, true
 	case strings.Contains(pn, "HEVC") || strings.Contains(pn, "H265") || strings.Contains(mime, "hevc") || strings.Contains(mime, "h265"):
 		return media.CodecHEVC, true
 	case strings.Contains(pn, "AVC") || strings.Contains(pn, "H264") || strings.Contains(mime, "avc") || strings.Contains(mime, "h264"):
@@ -385,14 +462,27 @@ func codecFromProfile(mime, pn string) (media.Codec, bool) {
 // audio MIME type or the audio token in a combined AV DLNA.ORG_PN (already
 // upper-cased) such as AVC_TS_HD_50_AC3_ISO or AVC_MP4_MP_HD_AAC. E-AC-3 is
 // checked before AC-3 because its tokens ("EAC3", "DD+") contain the AC-3 ones.
+// DLNA names no profile for FLAC or Opus, so those are read from the MIME
+// alone (audio/flac, audio/ogg;codecs=opus); MP3 is its MP3/MP3X profile or
+// audio/mpeg.
 func audioFromProfile(mime, pn string) (media.Codec, bool) {
 	switch {
 	case strings.Contains(pn, "EAC3") || strings.Contains(mime, "eac3") || strings.Contains(mime, "dd+"):
 		return media.CodecEAC3, true
 	case strings.Contains(pn, "AC3") || strings.Contains(mime, "ac3") || strings.Contains(mime, "dolby.dd"):
 		return media.CodecAC3, true
+	case strings.Contains(pn, "DTS") || strings.Contains(mime, "dts"):
+		return media.CodecDTS, true
+	case strings.Contains(pn, "TRUEHD") || strings.Contains(mime, "truehd") || strings.Contains(mime, "mlp"):
+		return media.CodecTrueHD, true
 	case strings.Contains(pn, "AAC") || strings.Contains(mime, "aac") || mime == "audio/mp4":
 		return media.CodecAAC, true
+	case strings.Contains(mime, "flac"):
+		return media.CodecFLAC, true
+	case strings.Contains(mime, "opus"):
+		return media.CodecOpus, true
+	case strings.Contains(pn, "PN=MP3") || mime == "audio/mpeg" || mime == "audio/mp3":
+		return media.CodecMP3, true
 	}
 	return "", false
 }
@@ -432,11 +522,18 @@ const (
 	transportLockedDelay   = 300 * time.Millisecond
 )
 
-// Play sets the AV transport URI and tells the renderer to begin playback.
-// The pipeline burns subtitles directly into the video upstream of this call,
-// so the renderer plays a single video resource with no separate caption track.
+// Play sets the AV transport URI and tells the renderer to begin playback of
+// the one video resource, with no caption file beside it: subtitles a cast
+// burns in are already in the video. A cast serving them as a file instead
+// goes through PlayCaptioned.
 func (d *dlnaDevice) Play(ctx context.Context, streamURL *url.URL, contentType string) error {
-	metadata, err := buildDIDLMetadata(streamURL, contentType)
+	return d.PlayCaptioned(ctx, streamURL, contentType, nil)
+}
+
+// PlayCaptioned is Play with an SRT caption file, advertised in the DIDL-Lite
+// metadata beside the video (see buildDIDLMetadata). nil captions is Play.
+func (d *dlnaDevice) PlayCaptioned(ctx context.Context, streamURL *url.URL, contentType string, captions *url.URL) error {
+	metadata, err := buildDIDLMetadata(streamURL, contentType, d.seekable, captions)
 	if err != nil {
 		return fmt.Errorf("building DIDL-Lite metadata: %w", err)
 	}
@@ -493,11 +590,113 @@ func isTransportLocked(err error) bool {
 }
 
 // action performs a SOAP action against the renderer's AVTransport service,
-// namespaced to the service version the device actually published. None of the
-// actions castor calls return out arguments, so no response is unmarshalled.
+// namespaced to the service version the device actually published, discarding
+// any out arguments.
 func (d *dlnaDevice) action(ctx context.Context, name string, request any) error {
+	return d.query(ctx, name, request, nil)
+}
+
+// query is action for the one call that reads out arguments back
+// (GetPositionInfo), unmarshalled into response.
+func (d *dlnaDevice) query(ctx context.Context, name string, request, response any) error {
 	return d.transport.SOAPClient.PerformActionCtx(
-		ctx, d.transport.Service.ServiceType, name, request, nil)
+		ctx, d.transport.Service.ServiceType, name, request, response)
+}
+
+// instance is the argument list of the transport controls that take nothing
+// but the (always zero) AVTransport instance.
+type instance struct{ InstanceID string }
+
+func (d *dlnaDevice) Pause(ctx context.Context) error {
+	if err := d.action(ctx, "Pause", &instance{"0"}); err != nil {
+		return fmt.Errorf("pausing playback: %w", err)
+	}
+	return nil
+}
+
+func (d *dlnaDevice) Resume(ctx context.Context) error {
+	play := &struct {
+		InstanceID string
+		Speed      string
+	}{"0", "1"}
+	if err := d.action(ctx, "Play", play); err != nil {
+		return fmt.Errorf("resuming playback: %w", err)
+	}
+	return nil
+}
+
+func (d *dlnaDevice) Stop(ctx context.Context) error {
+	if err := d.action(ctx, "Stop", &instance{"0"}); err != nil {
+		return fmt.Errorf("stopping playback: %w", err)
+	}
+	return nil
+}
+
+// Seek issues a REL_TIME seek, the unit DLNA renderers implement most widely
+// for a video item. Whether the renderer can honour it on a live-flagged stream
+// is its own call: many answer UPnP error 710 ("seek mode not supported"),
+// which surfaces to the caller unchanged.
+func (d *dlnaDevice) Seek(ctx context.Context, position time.Duration) error {
+	seek := &struct {
+		InstanceID string
+		Unit       string
+		Target     string
+	}{"0", "REL_TIME", formatUPnPTime(position)}
+	if err := d.action(ctx, "Seek", seek); err != nil {
+		return fmt.Errorf("seeking to %s: %w", position, err)
+	}
+	return nil
+}
+
+func (d *dlnaDevice) Position(ctx context.Context) (time.Duration, error) {
+	response := &struct{ RelTime string }{}
+	if err := d.query(ctx, "GetPositionInfo", &instance{"0"}, response); err != nil {
+		return 0, fmt.Errorf("reading position: %w", err)
+	}
+	return parseUPnPTime(response.RelTime)
+}
+
+// SetVolume sets the Master channel over RenderingControl. UPnP volume is
+// device-scaled (0..MaxVolume per the service description); every renderer
+// castor targets publishes 0..100, so percent is passed through as-is.
+func (d *dlnaDevice) SetVolume(ctx context.Context, percent int) error {
+	if d.rendering == nil {
+		return fmt.Errorf("renderer publishes no RenderingControl service: %w", errors.ErrUnsupported)
+	}
+	volume := &struct {
+		InstanceID    string
+		Channel       string
+		DesiredVolume string
+	}{"0", "Master", strconv.Itoa(percent)}
+	if err := d.rendering.SOAPClient.PerformActionCtx(
+		ctx, d.rendering.Service.ServiceType, "SetVolume", volume, nil); err != nil {
+		return fmt.Errorf("setting volume: %w", err)
+	}
+	return nil
+}
+
+// formatUPnPTime renders d as the H+:MM:SS the AVTransport time arguments use.
+func formatUPnPTime(d time.Duration) string {
+	secs := int64(max(d, 0) / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
+
+// parseUPnPTime parses an AVTransport time value, H+:MM:SS with optional
+// fractional seconds. Renderers that cannot tell report NOT_IMPLEMENTED (or an
+// empty value), which is an error rather than a position of zero.
+func parseUPnPTime(v string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(v), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("renderer reported no usable position %q", v)
+	}
+	h, errH := strconv.Atoi(parts[0])
+	m, errM := strconv.Atoi(parts[1])
+	sec, errS := strconv.ParseFloat(parts[2], 64)
+	if err := errors.Join(errH, errM, errS); err != nil {
+		return 0, fmt.Errorf("parsing position %q: %w", v, err)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(sec*float64(time.Second)), nil
 }
 
 func (d *dlnaDevice) Close() error {
@@ -505,15 +704,14 @@ func (d *dlnaDevice) Close() error {
 }
 
 // StreamHeaders returns the HTTP headers a DLNA renderer expects on a stream
-// response. No Content-Length is set: the stream length is unknown and Samsung
-// firmwares have been observed to mis-parse very large 64-bit values.
-func (d *dlnaDevice) StreamHeaders(contentType string) map[string]string {
-	return map[string]string{
-		"Connection":               "close",
-		"Accept-Ranges":            "none",
-		"transferMode.dlna.org":    "Streaming",
-		"contentFeatures.dlna.org": contentFeatures(contentType),
-	}
+// response. A produced stream sets no Content-Length: its length is unknown and
+// Samsung firmwares have been observed to mis-parse very large 64-bit values. A
+// seekable one is a finished file, or a VOD being produced, whose server answers
+// byte ranges (and, for MPEG-TS, time-seek), which is what the DLNA.ORG_OP bits
+// advertise.
+func (d *dlnaDevice) StreamHeaders(contentType string, seekable bool) map[string]string {
+	d.seekable = seekable
+	return ResourceHeaders(contentFeatures(contentType, seekable), seekable)
 }
 
 // DLNA.ORG_FLAGS values (see DLNA Guidelines, Vol. 1, Table 4-129).
@@ -527,19 +725,44 @@ const (
 // dlnaProfileFor returns the DLNA PN and FLAGS for a content type.
 // MPEG_TS_HD_NA_ISO is for ffmpeg's 188-byte TS; the bare MPEG_TS_HD_NA
 // profile is for 192-byte timestamped packets and Samsung rejects the mismatch.
-func dlnaProfileFor(contentType string) (name, flags string) {
+// A seekable TS has a fixed timeline, even a VOD still being produced, so it
+// drops the live flags: with them a renderer treats it as a broadcast it can
+// only join, not seek in.
+func dlnaProfileFor(contentType string, seekable bool) (name, flags string) {
 	switch contentType {
 	case media.MPEGTS:
+		if seekable {
+			return "MPEG_TS_HD_NA_ISO", dlnaFlagsFile
+		}
 		return "MPEG_TS_HD_NA_ISO", dlnaFlagsLive
 	case "video/mp4":
 		return "AVC_MP4_HP_HD_AAC", dlnaFlagsFile
 	}
+	if seekable {
+		return "", dlnaFlagsFile
+	}
 	return "", dlnaFlagsLive
 }
 
+// dlnaOperations returns the DLNA.ORG_OP bits: time-seek then range. A live
+// stream seeks by neither. A seekable one always takes byte ranges, and takes
+// time-seek only as MPEG-TS, whose constant-size packets and clock (PCR) let
+// the server map a time to a byte offset without an index.
+func dlnaOperations(contentType string, seekable bool) string {
+	switch {
+	case !seekable:
+		return "00"
+	case contentType == media.MPEGTS:
+		return "11"
+	default:
+		return "01"
+	}
+}
+
 // contentFeatures returns a DLNA content features string for use in HTTP
 // headers and DIDL metadata.
-func contentFeatures(contentType string) string {
-	name, flags := dlnaProfileFor(contentType)
-	return fmt.Sprintf("DLNA.ORG_PN=%s;DLNA.ORG_OP=00;DLNA.ORG_CI=1;DLNA.ORG_FLAGS=%s", name, flags)
+func contentFeatures(contentType string, seekable bool) string {
+	name, flags := dlnaProfileFor(contentType, seekable)
+	return fmt.Sprintf("DLNA.ORG_PN=%s;DLNA.ORG_OP=%s;DLNA.ORG_CI=1;DLNA.ORG_FLAGS=%s",
+		name, dlnaOperations(contentType, seekable), flags)
 }
@@ -3,8 +3,13 @@ package device
 import (
 	"context"
 	"errors"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -228,12 +233,50 @@ func TestParseSinkProtocolInfo(t *testing.T) {
 		t.Error("HEVC_TS sink should advertise HEVC")
 	}
 
+	// DLNA has no AV1 or VP9 profile; a vendor token or codecs MIME names them.
+	newSink := avcSink + ",http-get:*:video/mp4:DLNA.ORG_PN=AV1_MP4_HD,http-get:*:video/x-vp9:*"
+	if got := parseSinkProtocolInfo(newSink); !got.SupportsCodec(media.CodecAV1) || !got.SupportsCodec(media.CodecVP9) {
+		t.Errorf("AV1 and VP9 entries yielded %v, want both", codecNames(got.Video))
+	}
+	if parseSinkProtocolInfo(avcSink).SupportsCodec(media.CodecAV1) {
+		t.Error("an AVC token must not read as AV1")
+	}
+
 	// An explicit E-AC-3 audio entry is detected and not misread as AC-3.
 	eac3Sink := avcSink + ",http-get:*:audio/eac3:DLNA.ORG_PN=EAC3"
 	if !parseSinkProtocolInfo(eac3Sink).SupportsAudioCodec(media.CodecEAC3) {
 		t.Error("an EAC3 entry should advertise E-AC-3")
 	}
 
+	// The disc codecs are trusted in surround; MP3, FLAC and Opus, read from
+	// their MIME, only in stereo.
+	extSink := avcSink + ",http-get:*:audio/vnd.dts:*,http-get:*:audio/vnd.dolby.mlp:*" +
+		",http-get:*:audio/mpeg:DLNA.ORG_PN=MP3,http-get:*:audio/x-flac:*,http-get:*:audio/ogg;codecs=opus:*"
+	ext := parseSinkProtocolInfo(extSink)
+	for _, c := range []media.Codec{media.CodecDTS, media.CodecTrueHD, media.CodecMP3, media.CodecFLAC, media.CodecOpus} {
+		if !ext.SupportsAudioCodec(c) {
+			t.Errorf("sink should advertise %s audio", c)
+		}
+	}
+	if !ext.CanCopyAudio(media.ProbeInfo{AudioCodec: media.CodecDTS, AudioChannels: 6}) {
+		t.Error("5.1 DTS should be copy-eligible on a DTS renderer")
+	}
+	if ext.CanCopyAudio(media.ProbeInfo{AudioCodec: media.CodecFLAC, AudioChannels: 6}) {
+		t.Error("5.1 FLAC must not copy to a renderer trusted with stereo FLAC")
+	}
+	if caps.SupportsAudioCodec(media.CodecDTS) {
+		t.Error("an AC3 profile must not read as DTS")
+	}
+
+	// A text/srt entry says the renderer loads sidecar captions; a plain sink
+	// does not.
+	if caps.Captions {
+		t.Error("a sink without a subtitle MIME must not advertise captions")
+	}
+	if !parseSinkProtocolInfo(avcSink + ",http-get:*:text/srt:*").Captions {
+		t.Error("a text/srt entry should advertise captions")
+	}
+
 	// Nothing usable yields no video codecs; the caller substitutes fallbackCaps.
 	if got := parseSinkProtocolInfo("garbage,http-get:*:audio/mpeg:*"); len(got.Video) != 0 {
 		t.Errorf("unusable sink should yield no video, got %v", got.Video)
@@ -345,3 +388,220 @@ func TestRetryTransportLocked(t *testing.T) {
 		}
 	})
 }
+
+func TestUPnPTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "0:00:00", want: 0},
+		{in: "1:02:03", want: time.Hour + 2*time.Minute + 3*time.Second},
+		{in: "0:00:07.250", want: 7250 * time.Millisecond},
+		{in: "12:00:00", want: 12 * time.Hour},
+		{in: "NOT_IMPLEMENTED", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseUPnPTime(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUPnPTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseUPnPTime(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	if got := formatUPnPTime(time.Hour + 2*time.Minute + 3500*time.Millisecond); got != "1:02:03" {
+		t.Errorf("formatUPnPTime = %q, want 1:02:03", got)
+	}
+	if got := formatUPnPTime(-time.Second); got != "0:00:00" {
+		t.Errorf("formatUPnPTime(negative) = %q, want 0:00:00", got)
+	}
+}
+
+func TestStreamHeadersSeekable(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		seekable    bool
+		ranges      string
+		features    string
+	}{
+		{
+			name: "live TS", contentType: media.MPEGTS, ranges: "none",
+			features: "DLNA.ORG_PN=MPEG_TS_HD_NA_ISO;DLNA.ORG_OP=00;DLNA.ORG_CI=1;DLNA.ORG_FLAGS=" + dlnaFlagsLive,
+		},
+		{
+			name: "TS file", contentType: media.MPEGTS, seekable: true, ranges: "bytes",
+			features: "DLNA.ORG_PN=MPEG_TS_HD_NA_ISO;DLNA.ORG_OP=11;DLNA.ORG_CI=1;DLNA.ORG_FLAGS=" + dlnaFlagsFile,
+		},
+		{
+			// No time-seek: an mp4's bytes do not map linearly to its timeline.
+			name: "mp4 file", contentType: media.MP4, seekable: true, ranges: "bytes",
+			features: "DLNA.ORG_PN=AVC_MP4_HP_HD_AAC;DLNA.ORG_OP=01;DLNA.ORG_CI=1;DLNA.ORG_FLAGS=" + dlnaFlagsFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &dlnaDevice{}
+			h := d.StreamHeaders(tt.contentType, tt.seekable)
+			if got := h["Accept-Ranges"]; got != tt.ranges {
+				t.Errorf("Accept-Ranges = %q, want %q", got, tt.ranges)
+			}
+			if got := h["contentFeatures.dlna.org"]; got != tt.features {
+				t.Errorf("contentFeatures = %q, want %q", got, tt.features)
+			}
+			if d.seekable != tt.seekable {
+				t.Error("Play's DIDL must advertise what the headers do")
+			}
+		})
+	}
+}
+
+func TestBuildDIDLMetadataCaptions(t *testing.T) {
+	stream, _ := url.Parse("http://192.168.1.2:8080/stream.ts")
+	captions, _ := url.Parse("http://192.168.1.2:8081/captions.srt")
+
+	plain, err := buildDIDLMetadata(stream, media.MPEGTS, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain, "CaptionInfoEx") || strings.Contains(plain, "xmlns:sec") {
+		t.Errorf("an item without captions must not mention them: %s", plain)
+	}
+
+	got, err := buildDIDLMetadata(stream, media.MPEGTS, false, captions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`xmlns:sec="http://www.sec.co.kr/"`,
+		`<sec:CaptionInfoEx sec:type="srt">http://192.168.1.2:8081/captions.srt</sec:CaptionInfoEx>`,
+		`<res protocolInfo="http-get:*:text/srt:*">http://192.168.1.2:8081/captions.srt</res>`,
+		`>http://192.168.1.2:8080/stream.ts</res>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("DIDL missing %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestFileFeatures(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		info        media.ProbeInfo
+		want        string
+	}{
+		{
+			name: "H.264 and AAC in TS", contentType: media.MPEGTS,
+			info: media.ProbeInfo{VideoCodec: media.CodecH264, AudioCodec: media.CodecAAC},
+			want: "DLNA.ORG_PN=AVC_TS_MP_HD_AAC_MULT5_ISO;DLNA.ORG_OP=11;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=" + dlnaFlagsFile,
+		},
+		{
+			name: "H.264 and AAC in mp4", contentType: media.MP4,
+			info: media.ProbeInfo{VideoCodec: media.CodecH264, AudioCodec: media.CodecAAC},
+			want: "DLNA.ORG_PN=AVC_MP4_HP_HD_AAC;DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=" + dlnaFlagsFile,
+		},
+		{
+			// An mp4 with AC-3 fits no profile castor names: the MIME type alone.
+			name: "no matching profile", contentType: media.MP4,
+			info: media.ProbeInfo{VideoCodec: media.CodecHEVC, AudioCodec: media.CodecAC3},
+			want: "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=" + dlnaFlagsFile,
+		},
+		{
+			name: "unprobed matroska", contentType: media.MKV,
+			want: "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=" + dlnaFlagsFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FileFeatures(tt.contentType, tt.info); got != tt.want {
+				t.Errorf("FileFeatures() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDeclare pins that what a user declares of their renderer (HDR ranges,
+// codecs) reaches its capabilities without hiding its transport control.
+func TestDeclare(t *testing.T) {
+	caps := parseSinkProtocolInfo("http-get:*:video/mp2t:DLNA.ORG_PN=HEVC_TS_HD,http-get:*:video/mp2t:DLNA.ORG_PN=AVC_TS_HD_50_AC3")
+	dev := declare(&dlnaDevice{caps: caps}, Config{HDR: []media.DynamicRange{media.RangeHDR10}})
+	if _, ok := dev.(Controller); !ok {
+		t.Error("a declared DLNA device lost its Controller")
+	}
+	hdr := media.ProbeInfo{VideoCodec: media.CodecHEVC, VideoProfile: "Main 10", VideoBitDepth: 10, VideoRange: media.RangeHDR10}
+	if caps.CanCopyVideo(hdr) {
+		t.Fatal("an undeclared renderer copies HDR10")
+	}
+	if !dev.Capabilities().CanCopyVideo(hdr) {
+		t.Error("a renderer declared to show HDR10 does not copy it")
+	}
+
+	// A declared codec gains its envelope, and a declared range reaches it.
+	cast := declare(&chromecastDevice{}, Config{Codecs: []media.Codec{media.CodecAV1}, HDR: []media.DynamicRange{media.RangeHDR10}})
+	av1 := media.ProbeInfo{VideoCodec: media.CodecAV1, VideoProfile: "Main", VideoBitDepth: 10, VideoRange: media.RangeHDR10}
+	if !cast.Capabilities().CanCopyVideo(av1) {
+		t.Errorf("a Chromecast declared to decode AV1 in HDR10 does not copy it: %+v", cast.Capabilities().Video)
+	}
+	if chromecastCapabilities.SupportsCodec(media.CodecAV1) {
+		t.Error("declaring AV1 changed the Chromecast profile every device shares")
+	}
+}
+
+// TestDeclareCaptioner casts through a declared DLNA renderer with a caption
+// file planned beside the stream, as core hands one over: the wrapper keeps
+// Captioner, and the caption URL reaches the renderer's transport URI.
+func TestDeclareCaptioner(t *testing.T) {
+	var actions []string
+	var metadata string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.Header.Get("SOAPACTION")
+		actions = append(actions, action)
+		if strings.Contains(action, "#SetAVTransportURI") {
+			body, _ := io.ReadAll(r.Body)
+			metadata = html.UnescapeString(string(body))
+		}
+		w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+		io.WriteString(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body></s:Body></s:Envelope>`)
+	}))
+	defer srv.Close()
+	endpoint, _ := url.Parse(srv.URL)
+
+	caps := parseSinkProtocolInfo("http-get:*:video/mp2t:DLNA.ORG_PN=AVC_TS_HD_50_AC3")
+	caps.Captions = true
+	dlna := &dlnaDevice{
+		transport: goupnp.ServiceClient{
+			SOAPClient: soap.NewSOAPClient(*endpoint),
+			Service:    &goupnp.Service{ServiceType: "urn:schemas-upnp-org:service:AVTransport:1"},
+		},
+		caps: caps,
+	}
+	dev := declare(dlna, Config{HDR: []media.DynamicRange{media.RangeHDR10}})
+	if !dev.Capabilities().Captions {
+		t.Fatal("a declared DLNA device stopped advertising Captions")
+	}
+	c, ok := dev.(Captioner)
+	if !ok {
+		t.Fatal("a declared DLNA device lost its Captioner: a planned sidecar cannot be handed over")
+	}
+	if _, ok := dev.(Controller); !ok {
+		t.Error("a declared DLNA device lost its Controller")
+	}
+
+	stream, _ := url.Parse("http://192.168.1.2:8080/stream.ts")
+	captions, _ := url.Parse("http://192.168.1.2:8081/captions.srt")
+	if err := c.PlayCaptioned(t.Context(), stream, media.MPEGTS, captions); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || !strings.HasSuffix(actions[1], `#Play"`) {
+		t.Errorf("actions = %q, want SetAVTransportURI then Play", actions)
+	}
+	if !strings.Contains(metadata, "<sec:CaptionInfoEx sec:type=\"srt\">"+captions.String()) {
+		t.Errorf("transport URI metadata does not name the caption file:\n%s", metadata)
+	}
+}
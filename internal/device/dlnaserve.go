@@ -0,0 +1,90 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/huin/goupnp"
+
+	"github.com/stupside/castor/internal/media"
+)
+
+// This file is DLNA seen from the other side: what castor's own media server
+// (see internal/mediaserver) needs to describe its resources to a renderer that
+// browses and fetches them, rather than one castor pushes a URL to.
+
+// SinkCapabilities negotiates the capabilities of the DLNA renderer at host, an
+// address as a media server sees the renderer fetching from it. It finds the
+// renderer's description with the same unicast M-SEARCH the direct-connect path
+// uses, then reads its Sink exactly as a cast would (and from the same cache).
+// When no renderer answers at host (a phone app browsing on a TV's behalf), it
+// returns the conservative fallback along with the error, so the caller can log
+// it and still serve.
+func SinkCapabilities(ctx context.Context, host string) (media.Renderer, error) {
+	location, err := searchDLNADescription(ctx, host)
+	if err != nil {
+		return fallbackCaps(), fmt.Errorf("locating a renderer at %s: %w", host, err)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return fallbackCaps(), fmt.Errorf("parsing device location URL: %w", err)
+	}
+	root, err := goupnp.DeviceByURLCtx(ctx, u)
+	if err != nil {
+		return fallbackCaps(), fmt.Errorf("fetching device description: %w", err)
+	}
+	return cachedCaps(ctx, root, u), nil
+}
+
+// fileProfile is what a finished file's DLNA profile is named by: its container
+// and the codecs of the two tracks castor plays from it.
+type fileProfile struct {
+	container string
+	video     media.Codec
+	audio     media.Codec
+}
+
+// dlnaFileProfiles names the DLNA.ORG_PN of the files whose tracks fit exactly
+// one profile. Anything else is described by its MIME type alone: a PN the file
+// does not really match gets it refused by a renderer that checks, while no PN
+// leaves the renderer to try it.
+var dlnaFileProfiles = map[fileProfile]string{
+	{media.MPEGTS, media.CodecH264, media.CodecAAC}: "AVC_TS_MP_HD_AAC_MULT5_ISO",
+	{media.MP4, media.CodecH264, media.CodecAAC}:    "AVC_MP4_HP_HD_AAC",
+}
+
+// FileFeatures returns the DLNA content features of a finished file served as
+// it is, from its content type and probed tracks: seekable by byte range (and
+// by time as MPEG-TS, see dlnaOperations), and not converted (CI=0).
+func FileFeatures(contentType string, info media.ProbeInfo) string {
+	features := fmt.Sprintf("DLNA.ORG_OP=%s;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=%s",
+		dlnaOperations(contentType, true), dlnaFlagsFile)
+	if pn, ok := dlnaFileProfiles[fileProfile{contentType, info.VideoCodec, info.AudioCodec}]; ok {
+		return "DLNA.ORG_PN=" + pn + ";" + features
+	}
+	return features
+}
+
+// StreamFeatures returns the DLNA content features of a stream castor produces
+// on demand: the same a cast advertises for its served output. seekable is
+// whether it is served as a seekable VOD (see core.OpenParams.Duration).
+func StreamFeatures(contentType string, seekable bool) string {
+	return contentFeatures(contentType, seekable)
+}
+
+// ResourceHeaders returns the HTTP headers a DLNA renderer expects on a resource
+// response carrying features. See dlnaDevice.StreamHeaders, which is this for
+// the stream a cast serves.
+func ResourceHeaders(features string, seekable bool) map[string]string {
+	ranges := "none"
+	if seekable {
+		ranges = "bytes"
+	}
+	return map[string]string{
+		"Connection":               "close",
+		"Accept-Ranges":            ranges,
+		"transferMode.dlna.org":    "Streaming",
+		"contentFeatures.dlna.org": features,
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"cmp"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -45,7 +47,10 @@ type rokuDevice struct {
 	hc    *http.Client
 }
 
-var _ Device = (*rokuDevice)(nil)
+var (
+	_ Device     = (*rokuDevice)(nil)
+	_ Controller = (*rokuDevice)(nil)
+)
 
 // roku is the Roku ECP strategy. Castor's sideloaded channel pulls the stream URL
 // it is launched with, so Roku self-fetches.
@@ -321,21 +326,123 @@ func streamFormatFor(contentType string) string {
 // URL it is handed (its Video node pulls the stream over the network), so an
 // accepted source container casts straight through; anything else is served as a
 // live remux (see ServedContainer, set to HLS: Roku has no supported way to play
-// a growing single-file URL). It carries no video envelope on purpose: the served
-// path stream-copies video unconditionally (Roku decodes H.264/HEVC), so no
-// copy-vs-encode gate reads one. The audio envelope lets a 5.1/7.1 AC-3/E-AC-3 or
-// AAC track pass the remux through intact instead of being downmixed to stereo.
+// a growing single-file URL). The remux stream-copies the source's video into
+// the top rendition of its HLS ladder unconditionally (Roku decodes the codecs
+// an accepted source carries); the video envelope is H.264 alone, every Roku's
+// codec, for the lower renditions it encodes beside it and any file it
+// re-encodes. The audio envelope lets a 5.1/7.1 AC-3/E-AC-3 or AAC track pass
+// the remux through intact instead of being downmixed to stereo, and a stereo
+// MP3 or FLAC track where the served container carries it. DTS is left out:
+// Roku only passes it through, which is silence without a receiver behind it,
+// so a DTS track folds to a Dolby codec the set decodes itself.
 var rokuCapabilities = media.Renderer{
 	SelfFetch:       roku{}.selfFetches(),
 	Containers:      []string{media.HLS, media.MP4, media.MKV},
 	ServedContainer: media.HLS,
+	Video:           []media.VideoSupport{{Codec: media.CodecH264}},
 	Audio: []media.AudioSupport{
 		{Codec: media.CodecAAC, MaxChannels: 6},
 		{Codec: media.CodecAC3},
 		{Codec: media.CodecEAC3},
+		{Codec: media.CodecMP3, MaxChannels: 2},
+		{Codec: media.CodecFLAC, MaxChannels: 2},
 	},
 }
 
-func (r *rokuDevice) Capabilities() media.Renderer           { return rokuCapabilities }
-func (r *rokuDevice) StreamHeaders(string) map[string]string { return nil }
-func (r *rokuDevice) Close() error                           { return nil }
+func (r *rokuDevice) Capabilities() media.Renderer                 { return rokuCapabilities }
+func (r *rokuDevice) StreamHeaders(string, bool) map[string]string { return nil }
+func (r *rokuDevice) Close() error                                 { return nil }
+
+// ECP is a remote control, not a transport API: there is one Play key that
+// toggles, no absolute seek, and only relative volume keys. Pause and Resume
+// read the player state first so they are idempotent rather than toggles, Stop
+// backs out of the channel, and Seek/SetVolume are unsupported.
+
+func (r *rokuDevice) Pause(ctx context.Context) error  { return r.playIf(ctx, "play") }
+func (r *rokuDevice) Resume(ctx context.Context) error { return r.playIf(ctx, "pause") }
+func (r *rokuDevice) Stop(ctx context.Context) error   { return r.keypress(ctx, "Back") }
+
+func (r *rokuDevice) Seek(context.Context, time.Duration) error {
+	return fmt.Errorf("roku ECP has no absolute seek: %w", errors.ErrUnsupported)
+}
+
+func (r *rokuDevice) SetVolume(context.Context, int) error {
+	return fmt.Errorf("roku ECP has no absolute volume: %w", errors.ErrUnsupported)
+}
+
+func (r *rokuDevice) Position(ctx context.Context) (time.Duration, error) {
+	p, err := r.mediaPlayer(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return p.position()
+}
+
+// playIf presses the Play toggle only when the player is in state, so pausing a
+// paused channel (or resuming a playing one) is a no-op.
+func (r *rokuDevice) playIf(ctx context.Context, state string) error {
+	p, err := r.mediaPlayer(ctx)
+	if err != nil {
+		return err
+	}
+	if p.State != state {
+		return nil
+	}
+	return r.keypress(ctx, "Play")
+}
+
+// rokuPlayer is the /query/media-player document: the player state
+// (play, pause, buffer, close, ...) and the position as "<n> ms".
+type rokuPlayer struct {
+	State    string `xml:"state,attr"`
+	Position string `xml:"position"`
+}
+
+func (p rokuPlayer) position() (time.Duration, error) {
+	ms, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(p.Position), " ms"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("roku reported no usable position %q", p.Position)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (r *rokuDevice) mediaPlayer(ctx context.Context) (rokuPlayer, error) {
+	u := *r.ecp
+	u.Path = "/query/media-player"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return rokuPlayer{}, err
+	}
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return rokuPlayer{}, fmt.Errorf("querying roku media player: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rokuPlayer{}, fmt.Errorf("query/media-player: %s", resp.Status)
+	}
+	var p rokuPlayer
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&p); err != nil {
+		return rokuPlayer{}, fmt.Errorf("parsing roku media player: %w", err)
+	}
+	return p, nil
+}
+
+// keypress sends one ECP remote key.
+func (r *rokuDevice) keypress(ctx context.Context, key string) error {
+	u := *r.ecp
+	u.Path = "/keypress/" + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("roku keypress %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("roku keypress %s: %s", key, resp.Status)
+	}
+	return nil
+}
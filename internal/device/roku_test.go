@@ -2,14 +2,18 @@ package device
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stupside/castor/internal/device/rokuchannel"
 	"github.com/stupside/castor/internal/media"
@@ -356,3 +360,46 @@ func mustParseURL(t *testing.T, s string) *url.URL {
 	}
 	return u
 }
+
+// TestRokuPauseIdempotent pins that Pause/Resume consult the player state and
+// press the Play toggle only when it would move the player the right way.
+func TestRokuPauseIdempotent(t *testing.T) {
+	state := "play"
+	var presses []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/query/media-player":
+			fmt.Fprintf(w, `<player error="false" state=%q><position>20455 ms</position></player>`, state)
+		case strings.HasPrefix(r.URL.Path, "/keypress/"):
+			presses = append(presses, strings.TrimPrefix(r.URL.Path, "/keypress/"))
+		}
+	}))
+	defer ts.Close()
+
+	dev := &rokuDevice{ecp: mustParseURL(t, ts.URL), appID: "dev", hc: ts.Client()}
+	ctx := context.Background()
+
+	if err := dev.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(presses) != 0 {
+		t.Fatalf("Resume while playing pressed %v, want nothing", presses)
+	}
+	if err := dev.Pause(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(presses, []string{"Play"}) {
+		t.Fatalf("Pause while playing pressed %v, want [Play]", presses)
+	}
+
+	pos, err := dev.Position(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != 20455*time.Millisecond {
+		t.Errorf("Position = %s, want 20.455s", pos)
+	}
+	if err := dev.Seek(ctx, time.Minute); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Seek error = %v, want ErrUnsupported", err)
+	}
+}
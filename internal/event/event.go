@@ -0,0 +1,166 @@
+// Package event is castor's machine-readable lifecycle stream (--output json):
+// one JSON object per line on stdout for each step of a cast, so a script can
+// follow extraction, ranking, the plan, the renderer, and progress without
+// scraping the human-oriented logs.
+//
+// The schema is versioned by Version and stable within it: every line carries
+// "v", "time", "type", and a "data" object whose shape is fixed per type (the
+// *Data structs below). Fields are only ever added within a version; renaming
+// or removing one, or changing its meaning, bumps Version.
+//
+// The emitter rides the context, like the logger's attributes do, so the
+// packages that produce events need no extra parameter, and a context without
+// one (the default, text output) makes Emit a no-op.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Version is the schema version stamped on every event.
+const Version = 1
+
+// Type names an event. The values are part of the schema.
+type Type string
+
+const (
+	ExtractStarted   Type = "extract.started"   // ExtractData, without Streams
+	ExtractFinished  Type = "extract.finished"  // ExtractData
+	CandidatesRanked Type = "candidates.ranked" // CandidatesData
+	CandidatesListed Type = "candidates.listed" // CandidatesData, from --dry-run; nothing is chosen
+	DeviceConnected  Type = "device.connected"  // DeviceData
+	PlanDecided      Type = "plan.decided"      // PlanData
+	PlaybackStarted  Type = "playback.started"  // PlaybackData
+	Progress         Type = "progress"          // ProgressData
+	DownloadProgress Type = "download.progress" // DownloadProgressData
+	Error            Type = "error"             // ErrorData
+	Finished         Type = "finished"          // FinishedData
+)
+
+// Event is one line of the stream.
+type Event struct {
+	Version int       `json:"v"`
+	Time    time.Time `json:"time"`
+	Type    Type      `json:"type"`
+	Data    any       `json:"data"`
+}
+
+type ExtractData struct {
+	URL     string `json:"url"`
+	Streams int    `json:"streams"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Candidate is one probed stream. Rejected names why it cannot win, empty for
+// a stream in the running: "decoy" (no castable video and audio) or "ad" (too
+// short to be the title). A stream whose probe failed is kept as a fallback
+// and carries ProbeError instead.
+type Candidate struct {
+	URL             string  `json:"url"`
+	ContentType     string  `json:"content_type"`
+	BitRate         int64   `json:"bitrate"`
+	Height          int     `json:"height,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	Live            bool    `json:"live"`
+	Rejected        string  `json:"rejected,omitempty"`
+	ProbeError      string  `json:"probe_error,omitempty"`
+	// AudioLanguages are the languages the candidate's audio can be played
+	// in, listed by --dry-run.
+	AudioLanguages []string `json:"audio_languages,omitempty"`
+	// SubtitleLanguages are the languages the candidate's own subtitles can
+	// be shown in, listed by --dry-run.
+	SubtitleLanguages []string `json:"subtitle_languages,omitempty"`
+}
+
+type CandidatesData struct {
+	Candidates []Candidate `json:"candidates"`
+	// Chosen is the URL of the stream that will be cast, empty when none was.
+	Chosen string `json:"chosen,omitempty"`
+}
+
+type DeviceData struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// PlanData is how the cast will be delivered. VideoCodec and AudioCodec are
+// the encode decision: "copy", an encoder name, or empty on a passthrough,
+// where castor touches no media.
+type PlanData struct {
+	Delivery          string `json:"delivery"`
+	Subtitles         bool   `json:"subtitles"`
+	OutputContentType string `json:"output_content_type"`
+	VideoCodec        string `json:"video_codec,omitempty"`
+	AudioCodec        string `json:"audio_codec,omitempty"`
+}
+
+type PlaybackData struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+}
+
+type ProgressData struct {
+	EncodedSeconds float64 `json:"encoded_seconds"`
+	Speed          float64 `json:"speed"`
+}
+
+// DownloadProgressData is how much of the source castor download has saved.
+type DownloadProgressData struct {
+	Bytes              int64 `json:"bytes"`
+	RateBytesPerSecond int64 `json:"rate_bytes_per_second"`
+}
+
+// ErrorData is a stage failure (see metrics.Fail for the stage names). It may
+// precede a Finished event with Result "failed", or, for "transcribe", be all
+// that happens: the cast continues without subtitles.
+type ErrorData struct {
+	Stage   string `json:"stage"`
+	Message string `json:"message"`
+}
+
+// FinishedData ends the stream: Result is "done" (played out, or stopped through
+// the control API), "interrupted", or "failed", with Error set.
+type FinishedData struct {
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Emitter writes events as JSON lines. It is safe for concurrent use.
+type Emitter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewEmitter(w io.Writer) *Emitter {
+	return &Emitter{enc: json.NewEncoder(w)}
+}
+
+type emitterKey struct{}
+
+// WithEmitter returns ctx carrying e.
+func WithEmitter(ctx context.Context, e *Emitter) context.Context {
+	return context.WithValue(ctx, emitterKey{}, e)
+}
+
+// Enabled reports whether ctx carries an emitter, for a caller whose event
+// takes work to build.
+func Enabled(ctx context.Context) bool {
+	_, ok := ctx.Value(emitterKey{}).(*Emitter)
+	return ok
+}
+
+// Emit writes one event to ctx's emitter, if it has one.
+func Emit(ctx context.Context, typ Type, data any) {
+	e, ok := ctx.Value(emitterKey{}).(*Emitter)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_ = e.enc.Encode(Event{Version: Version, Time: time.Now().UTC(), Type: typ, Data: data})
+}
@@ -0,0 +1,46 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestEmit(t *testing.T) {
+	// Without an emitter, Emit is a no-op rather than a panic.
+	Emit(t.Context(), Finished, FinishedData{Result: "done"})
+
+	var buf bytes.Buffer
+	ctx := WithEmitter(t.Context(), NewEmitter(&buf))
+	if !Enabled(ctx) {
+		t.Fatal("Enabled should report the attached emitter")
+	}
+	Emit(ctx, PlanDecided, PlanData{Delivery: "spool", OutputContentType: "video/mp2t", VideoCodec: "copy"})
+	Emit(ctx, Finished, FinishedData{Result: "failed", Error: "boom"})
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want one per event:\n%s", len(lines), buf.String())
+	}
+	var got struct {
+		V    int            `json:"v"`
+		Type Type           `json:"type"`
+		Time string         `json:"time"`
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(lines[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.V != Version || got.Type != PlanDecided || got.Time == "" {
+		t.Errorf("envelope = %+v", got)
+	}
+	want := map[string]any{"delivery": "spool", "subtitles": false, "output_content_type": "video/mp2t", "video_codec": "copy"}
+	if len(got.Data) != len(want) {
+		t.Fatalf("data = %v, want %v", got.Data, want)
+	}
+	for k, v := range want {
+		if got.Data[k] != v {
+			t.Errorf("data[%s] = %v, want %v", k, got.Data[k], v)
+		}
+	}
+}
@@ -9,17 +9,29 @@ package media
 // value belongs to.
 type Codec string
 
-// Video codecs.
+// Video codecs. AV1 and VP9 are the royalty-free ones web sources increasingly
+// ship; a renderer decodes them far less widely than H.264, and MPEG-TS does
+// not carry them (see FormatInfo.Video).
 const (
 	CodecH264 Codec = "h264"
 	CodecHEVC Codec = "hevc"
+	CodecAV1  Codec = "av1"
+	CodecVP9  Codec = "vp9"
 )
 
 // Audio codecs. AC-3 and E-AC-3 are the Dolby surround codecs: unlike AAC (which
 // a renderer commonly decodes stereo-only), advertised support for either means
-// the renderer decodes multichannel, so a 5.1 source can reach it intact.
+// the renderer decodes multichannel, so a 5.1 source can reach it intact. DTS
+// and TrueHD are the disc surround codecs, which a TV mostly passes through to
+// a receiver rather than decodes; FLAC and TrueHD are lossless. MP3 is stereo
+// at most, and Opus is the web's stereo or surround codec.
 const (
-	CodecAAC  Codec = "aac"
-	CodecAC3  Codec = "ac3"
-	CodecEAC3 Codec = "eac3"
+	CodecAAC    Codec = "aac"
+	CodecAC3    Codec = "ac3"
+	CodecEAC3   Codec = "eac3"
+	CodecDTS    Codec = "dts"
+	CodecTrueHD Codec = "truehd"
+	CodecFLAC   Codec = "flac"
+	CodecOpus   Codec = "opus"
+	CodecMP3    Codec = "mp3"
 )
@@ -0,0 +1,79 @@
+package media
+
+import (
+	"slices"
+	"strings"
+)
+
+// iso6392 maps the three-letter ISO 639-2 codes of the languages sources
+// commonly tag their tracks with to the two-letter ISO 639-1 code of the same
+// language. Containers tag tracks in 639-2 (MKV's "eng", "fre", "ger", in
+// both the bibliographic and the terminology spelling), HLS masters in BCP 47
+// ("en", "fr-CA"), and users write whichever they think of, so both sides are
+// reduced to 639-1 before they are compared. A code not listed here is compared
+// as it is.
+var iso6392 = map[string]string{
+	"ara": "ar", "chi": "zh", "zho": "zh", "cze": "cs", "ces": "cs",
+	"dan": "da", "dut": "nl", "nld": "nl", "eng": "en", "fin": "fi",
+	"fre": "fr", "fra": "fr", "ger": "de", "deu": "de", "gre": "el",
+	"ell": "el", "heb": "he", "hin": "hi", "hun": "hu", "ind": "id",
+	"ita": "it", "jpn": "ja", "kor": "ko", "nor": "no", "nob": "nb",
+	"pol": "pl", "por": "pt", "rum": "ro", "ron": "ro", "rus": "ru",
+	"spa": "es", "swe": "sv", "tha": "th", "tur": "tr", "ukr": "uk",
+	"vie": "vi",
+}
+
+// normalizeLanguage lower-cases a language tag, writes its subtags with "-"
+// and reduces a three-letter primary subtag to its two-letter code.
+func normalizeLanguage(tag string) string {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	primary, rest, found := strings.Cut(tag, "-")
+	if short, ok := iso6392[primary]; ok {
+		primary = short
+	}
+	if found {
+		return primary + "-" + rest
+	}
+	return primary
+}
+
+// primaryLanguage is a normalised tag's primary subtag: "pt" for "pt-br".
+func primaryLanguage(tag string) string {
+	primary, _, _ := strings.Cut(tag, "-")
+	return primary
+}
+
+// LanguageCode is tag's language alone, as a two-letter ISO 639-1 code where
+// it has one: "fr" for "fre", "pt" for "pt-BR". It is "" for an empty tag.
+func LanguageCode(tag string) string {
+	return primaryLanguage(normalizeLanguage(tag))
+}
+
+// PreferredLanguage returns the index in available of the track a viewer who
+// prefers the languages in prefs, most preferred first, wants: the first track
+// of the earliest preference any track is in. A preference matches a track
+// tagged exactly as it is (case, 639-1/639-2 and "_" aside), else one in the
+// same language ("pt" matches "pt-BR", and "pt-BR" matches "pt-PT" when no
+// track is in Brazilian Portuguese). Untagged tracks ("") match nothing. ok is
+// false when no track matches any preference.
+func PreferredLanguage(prefs, available []string) (i int, ok bool) {
+	tags := make([]string, len(available))
+	for j, a := range available {
+		tags[j] = normalizeLanguage(a)
+	}
+	for _, pref := range prefs {
+		want := normalizeLanguage(pref)
+		if want == "" {
+			continue
+		}
+		if i := slices.Index(tags, want); i >= 0 {
+			return i, true
+		}
+		if i := slices.IndexFunc(tags, func(t string) bool {
+			return t != "" && primaryLanguage(t) == primaryLanguage(want)
+		}); i >= 0 {
+			return i, true
+		}
+	}
+	return 0, false
+}
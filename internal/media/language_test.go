@@ -0,0 +1,40 @@
+package media
+
+import "testing"
+
+func TestPreferredLanguage(t *testing.T) {
+	cases := []struct {
+		name      string
+		prefs     []string
+		available []string
+		want      int
+		ok        bool
+	}{
+		{"exact tag", []string{"fr"}, []string{"en", "fr"}, 1, true},
+		{"639-2 track, 639-1 preference", []string{"en"}, []string{"fre", "eng"}, 1, true},
+		{"639-1 track, bibliographic preference", []string{"ger"}, []string{"en", "de"}, 1, true},
+		{"earlier preference wins over track order", []string{"ja", "en"}, []string{"en", "ja"}, 1, true},
+		{"later preference when the first is absent", []string{"it", "en"}, []string{"fr", "en"}, 1, true},
+		{"region preferred when present", []string{"pt-BR"}, []string{"pt-PT", "pt-br"}, 1, true},
+		{"same language in another region", []string{"pt-BR"}, []string{"en", "pt_PT"}, 1, true},
+		{"bare language matches a regional track", []string{"es"}, []string{"en", "es-419"}, 1, true},
+		{"untagged tracks match nothing", []string{"en"}, []string{"", "und"}, 0, false},
+		{"no preference", nil, []string{"en", "fr"}, 0, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := PreferredLanguage(c.prefs, c.available)
+			if got != c.want || ok != c.ok {
+				t.Errorf("PreferredLanguage(%q, %q) = (%d, %v), want (%d, %v)", c.prefs, c.available, got, ok, c.want, c.ok)
+			}
+		})
+	}
+}
+
+func TestLanguageCode(t *testing.T) {
+	for tag, want := range map[string]string{"fr": "fr", "fre": "fr", "pt-BR": "pt", "ENG": "en", "zh_Hant": "zh", "": ""} {
+		if got := LanguageCode(tag); got != want {
+			t.Errorf("LanguageCode(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
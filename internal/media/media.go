@@ -1,10 +1,14 @@
 package media
 
 import (
+	"cmp"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -25,8 +29,20 @@ const (
 	HLSPlaylistName   = "stream.m3u8"
 	HLSInitName       = "init.mp4"
 	HLSSegmentPattern = "seg_%05d.m4s"
+
+	// HLSMasterName is the multi-variant playlist over a rendition ladder, and
+	// HLSVariantDir the directory each rendition's own playlist and segments are
+	// written into, %v standing for its index (ffmpeg's var_stream_map syntax).
+	HLSMasterName = "master.m3u8"
+	HLSVariantDir = "v%v"
 )
 
+// HLSVariantPath is name (a playlist or segment) within rendition i's
+// directory, relative to the output directory.
+func HLSVariantPath(i int, name string) string {
+	return path.Join(strings.ReplaceAll(HLSVariantDir, "%v", strconv.Itoa(i)), name)
+}
+
 // HLSInputArgs contains ffmpeg/ffprobe flags that relax extension checks
 // for HLS playlists and DASH manifests.
 var HLSInputArgs = []string{
@@ -52,6 +68,30 @@ type Stream struct {
 	Bandwidth   int64
 	ContentType string
 	Live        bool
+
+	// AudioTrack is which of URL's audio tracks to play, counted from 0 among
+	// its audio tracks alone (ffmpeg's a:N), for a multi-track file whose
+	// first track is not the language wanted (see resolve.Config.AudioLanguages).
+	// A demuxed program's audio is AudioURL's first track whatever it is.
+	AudioTrack int
+
+	// Subtitle is the source's own subtitle track the viewer asked for (see
+	// resolve.Config.SubtitleLanguages), nil when they asked for none or the
+	// source carries none in their languages. A cast that has one shows it in
+	// place of a whisper transcript.
+	Subtitle *SubtitleTrack
+
+	// Variant is the HLS variant resolution narrowed a master playlist to, zero
+	// for any other source. A master extracted afresh mid-cast is narrowed to
+	// the same one, so a resumed read carries on with the same encode.
+	Variant Variant
+}
+
+// Variant identifies one variant of an HLS master by what the master says of
+// it: a refreshed master keeps these while its URLs' tokens change.
+type Variant struct {
+	Bandwidth int64
+	Height    int
 }
 
 // Demuxed reports whether the program's tracks live at separate URLs, so a
@@ -60,7 +100,7 @@ func (s *Stream) Demuxed() bool { return s.AudioURL != nil }
 
 // SelfFetchable reports whether a renderer handed nothing but this stream's URL
 // can pull the whole program itself. A pass-through gives the device that URL
-// and nothing else, which rules out two shapes:
+// and nothing else, which rules out three shapes:
 //
 //   - a header-gated source. None of the request headers castor captured while
 //     extracting (Referer, Origin, Cookie, User-Agent) travel with the URL, and
@@ -68,13 +108,18 @@ func (s *Stream) Demuxed() bool { return s.AudioURL != nil }
 //     fetched with headers is not proven fetchable without them.
 //   - a demuxed program. One URL is one rendition, so the renderer would play
 //     the video and none of the audio.
+//   - a multi-track file whose wanted audio is not its first track. The
+//     renderer plays the default track, which is the language the viewer asked
+//     not to hear.
 //
-// Either way the device fails where castor succeeds, and silently: it accepts the
-// load and then sits idle, or plays in silence. Such a source is served locally
-// instead, castor reading what it needs and giving the renderer a single LAN URL.
-// A header-free, self-contained source (the direct URL a user casts by hand)
-// passes through.
-func (s *Stream) SelfFetchable() bool { return len(s.Headers) == 0 && !s.Demuxed() }
+// Each way the device fails where castor succeeds, and silently: it accepts the
+// load and then sits idle, or plays in silence or the wrong language. Such a
+// source is served locally instead, castor reading what it needs and giving
+// the renderer a single LAN URL. A header-free, self-contained source (the
+// direct URL a user casts by hand) passes through.
+func (s *Stream) SelfFetchable() bool {
+	return len(s.Headers) == 0 && !s.Demuxed() && s.AudioTrack == 0
+}
 
 // StreamInfo holds metadata returned by ffprobe for a stream.
 type StreamInfo struct {
@@ -87,6 +132,14 @@ type StreamInfo struct {
 	// For an HLS master this is only whichever variant ffprobe chose, not the
 	// master's full range, so it is not a reliable ceiling for a master.
 	VideoHeight int
+	// AudioLanguages is the language tag of each audio track, in stream order,
+	// "" for an untagged one.
+	AudioLanguages []string
+	// SubtitleLanguages is the language tag of each subtitle track, in stream
+	// order, "" for an untagged one and for a picture-based one (PGS, DVD),
+	// which castor cannot draw: listing it untagged keeps the indexes ffmpeg's
+	// s:N counts by while no language preference can pick it.
+	SubtitleLanguages []string
 }
 
 // Playable reports whether the stream carries castable media — a real video
@@ -113,16 +166,36 @@ const (
 	// DeliverSegmented is a live playlist plus rolling segments in a directory the
 	// HLS server fronts.
 	DeliverSegmented
+	// DeliverFile is a finished file on disk the file server fronts as it is,
+	// with byte ranges and DLNA time-seek, so the renderer can seek in it. No
+	// producible format carries it: only a local file cast the renderer plays
+	// unchanged reaches it.
+	DeliverFile
 )
 
 // FormatInfo describes a container castor can produce: the MIME type the device
 // is told it is fetching, the file extension it carries, the ffmpeg muxer (-f)
-// that writes it, and how it is delivered.
+// that writes it, how it is delivered, and the codecs it carries.
 type FormatInfo struct {
 	ContentType string
 	Extension   string
 	Muxer       string
 	Delivery    DeliveryKind
+
+	// Video are the video codecs a renderer can demux from the container.
+	// MPEG-TS has stream types for H.264 and HEVC alone: ffmpeg muxes anything
+	// else into it as private data, which a TV sees as no video at all.
+	Video []Codec
+	// Audio are the audio codecs it carries. MPEG-TS has no mapping for FLAC
+	// or (in what a TV demuxes) Opus, and ffmpeg writes DTS and TrueHD to MP4
+	// only as an experiment.
+	Audio []Codec
+}
+
+// Carries reports whether codec c, video or audio, can be served in the
+// container.
+func (f FormatInfo) Carries(c Codec) bool {
+	return slices.Contains(f.Video, c) || slices.Contains(f.Audio, c)
 }
 
 // formatRegistry is the vocabulary of containers castor can produce, keyed by
@@ -130,9 +203,23 @@ type FormatInfo struct {
 // delivery driver read; adding a producible format is one row here (no code path
 // enumerates formats or deliveries elsewhere).
 var formatRegistry = map[string]FormatInfo{
-	MPEGTS: {ContentType: MPEGTS, Extension: ".ts", Muxer: "mpegts", Delivery: DeliverStream},
-	MP4:    {ContentType: MP4, Extension: ".mp4", Muxer: "mp4", Delivery: DeliverStream},
-	HLS:    {ContentType: HLS, Extension: ".m3u8", Muxer: "hls", Delivery: DeliverSegmented},
+	MPEGTS: {
+		ContentType: MPEGTS, Extension: ".ts", Muxer: "mpegts", Delivery: DeliverStream,
+		Video: []Codec{CodecH264, CodecHEVC},
+		Audio: []Codec{CodecAAC, CodecAC3, CodecEAC3, CodecDTS, CodecTrueHD, CodecMP3},
+	},
+	MP4: {
+		ContentType: MP4, Extension: ".mp4", Muxer: "mp4", Delivery: DeliverStream,
+		Video: []Codec{CodecH264, CodecHEVC, CodecAV1, CodecVP9},
+		Audio: []Codec{CodecAAC, CodecAC3, CodecEAC3, CodecFLAC, CodecOpus, CodecMP3},
+	},
+	// HLS segments are fMP4, but VP9 is not among the codecs HLS clients take
+	// from them, and of the audio only what the HLS spec names.
+	HLS: {
+		ContentType: HLS, Extension: ".m3u8", Muxer: "hls", Delivery: DeliverSegmented,
+		Video: []Codec{CodecH264, CodecHEVC, CodecAV1},
+		Audio: []Codec{CodecAAC, CodecAC3, CodecEAC3, CodecMP3},
+	},
 }
 
 // FormatForContentType returns the FormatInfo for a content type, or ok=false if
@@ -143,6 +230,18 @@ func FormatForContentType(ct string) (FormatInfo, bool) {
 	return f, ok
 }
 
+// FormatForMuxer returns the FormatInfo of the container an ffmpeg muxer
+// writes, for a caller holding an encode's output format rather than its
+// content type.
+func FormatForMuxer(muxer string) (FormatInfo, bool) {
+	for _, f := range formatRegistry {
+		if f.Muxer == muxer {
+			return f, true
+		}
+	}
+	return FormatInfo{}, false
+}
+
 var extensionMap = map[string]string{
 	".mp4":  MP4,
 	".mkv":  MKV,
@@ -158,6 +257,23 @@ func DetectFromExtension(u *url.URL) string {
 	return extensionMap[strings.ToLower(path.Ext(u.Path))]
 }
 
+// fileExtensionMap adds the containers a local file may carry that a URL's
+// extension does not vouch for: a URL path ending in .ts is as often one HLS
+// segment as a whole stream, but a .ts file on disk is the whole title.
+var fileExtensionMap = map[string]string{
+	".ts":   MPEGTS,
+	".m2ts": MPEGTS,
+	".mts":  MPEGTS,
+	".m4v":  MP4,
+}
+
+// DetectFromFileName returns a content type based on a local file's extension,
+// or empty string if unrecognized.
+func DetectFromFileName(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	return cmp.Or(extensionMap[ext], fileExtensionMap[ext])
+}
+
 var mimeContentTypes = map[string]string{
 	"video/mp4":                     MP4,
 	"video/webm":                    WebM,
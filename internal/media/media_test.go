@@ -31,6 +31,23 @@ func TestFormatForContentType(t *testing.T) {
 	}
 }
 
+func TestDetectFromFileName(t *testing.T) {
+	cases := map[string]string{
+		"/media/Movie.MKV":  MKV,
+		"movie.mp4":         MP4,
+		"/media/movie.ts":   MPEGTS,
+		"/media/movie.m2ts": MPEGTS,
+		"clip.m4v":          MP4,
+		"notes.txt":         "",
+		"no-extension":      "",
+	}
+	for name, want := range cases {
+		if got := DetectFromFileName(name); got != want {
+			t.Errorf("DetectFromFileName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
 func TestStreamInfoPlayable(t *testing.T) {
 	cases := []struct {
 		name string
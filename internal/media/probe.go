@@ -1,5 +1,7 @@
 package media
 
+import "time"
+
 // ProbeInfo is a structured description of a source stream, the subset an
 // ffprobe pass yields that the planner needs to decide whether the source can
 // be stream-copied to a renderer or must be re-encoded. Zero values mean
@@ -16,9 +18,46 @@ type ProbeInfo struct {
 	VideoCodec    Codec  // e.g. CodecH264, CodecHEVC
 	VideoProfile  string // e.g. "High", "Main", "High 10"
 	VideoHeight   int
-	VideoBitDepth int  // derived from pix_fmt (8, 10, 12)
-	VideoHDR      bool // PQ (smpte2084) or HLG (arib-std-b67) transfer
+	VideoBitDepth int          // derived from pix_fmt (8, 10, 12)
+	VideoRange    DynamicRange // from the transfer curve and Dolby Vision side data, "" if unknown
+	// VideoDVProfile is the Dolby Vision profile (5, 7, 8) of a source that
+	// carries a Dolby Vision configuration record, 0 for none. VideoRange is
+	// then the range of its base layer: HDR10 or HLG for a profile 7 or 8
+	// stream an HDR10 or HLG TV plays without the enhancement, or
+	// RangeDolbyVision for a profile 5 one, whose base layer nothing but a
+	// Dolby Vision decoder shows right.
+	VideoDVProfile int
 
 	AudioCodec    Codec // e.g. CodecAAC, CodecAC3
 	AudioChannels int   // channel count (2 = stereo, 6 = 5.1, 8 = 7.1), 0 if unknown
+	// AudioTrack is which of the source's audio tracks AudioCodec and
+	// AudioChannels describe, counted among its audio tracks alone: the first
+	// (0) unless an audio language preference picked another.
+	AudioTrack int
+
+	Duration time.Duration // container duration, 0 if unknown (live, or a still-growing spool)
+	BitRate  int64         // container bitrate in bits/s, all tracks together, 0 if unknown
+}
+
+// DynamicRange is the dynamic range a video is mastered in, named by what a
+// renderer has to decode to show it right.
+type DynamicRange string
+
+const (
+	// RangeSDR is standard dynamic range, the BT.709 gamma every renderer
+	// shows.
+	RangeSDR DynamicRange = "sdr"
+	// RangeHDR10 is the PQ (SMPTE ST 2084) transfer with static metadata.
+	RangeHDR10 DynamicRange = "hdr10"
+	// RangeHLG is Hybrid Log-Gamma (ARIB STD-B67), broadcast HDR.
+	RangeHLG DynamicRange = "hlg"
+	// RangeDolbyVision is Dolby Vision with dynamic metadata.
+	RangeDolbyVision DynamicRange = "dolby_vision"
+)
+
+// HDR reports whether r is a high dynamic range: one an SDR renderer shows
+// washed out, and an SDR encode has to tone-map. The zero value (unknown) is
+// taken as SDR, as a source with no transfer tag almost always is.
+func (r DynamicRange) HDR() bool {
+	return r != "" && r != RangeSDR
 }
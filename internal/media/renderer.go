@@ -30,21 +30,34 @@ type Renderer struct {
 	// the read-once spool path serves its own append-only container. Inert on a
 	// pass-through cast, which reads the source's own content type.
 	ServedContainer string
+
+	// Captions reports whether the renderer shows a subtitle track served
+	// beside the stream as an SRT file, so a source's own subtitles can reach
+	// it as text instead of being drawn into the video. DLNA renderers that take
+	// one say so in their Sink; no other family has a way to be handed one.
+	Captions bool
 }
 
 // VideoSupport is one video envelope a renderer decodes natively. A probed
 // source is copy-eligible when it matches at least one on the things that
 // black-screen a TV outright: codec, profile, bit depth, and dynamic range. An
-// HDR source is never copy-eligible: correct HDR playback cannot be assumed to
-// engage on an arbitrary renderer, so it is re-encoded to an SDR-safe output
-// rather than passed through (this is a generic conservative policy, not tied to
-// any device family). Resolution is deliberately absent: it is the user's
-// cast-quality preference (config max_height), applied at source selection and
-// the copy gate, not something guessed from the renderer.
+// HDR source is copy-eligible only to an envelope that lists its range: correct
+// HDR playback cannot be assumed to engage on an arbitrary renderer, and no
+// casting protocol advertises it, so an envelope is SDR-only until whatever
+// describes the renderer (or the user, for a TV they know) declares more, and
+// an HDR source is otherwise re-encoded and tone-mapped to SDR (a generic
+// conservative policy, not tied to any device family). Resolution is
+// deliberately absent: it is the user's cast-quality preference (config
+// max_height), applied at source selection and the copy gate, not something
+// guessed from the renderer.
 type VideoSupport struct {
 	Codec     Codec
-	Profiles  []string // nil or empty = any profile
-	BitDepths []int    // nil or empty = {8}
+	Profiles  []string       // nil or empty = any profile
+	BitDepths []int          // nil or empty = {8}
+	Ranges    []DynamicRange // nil or empty = {RangeSDR}
+	// DVProfiles are the Dolby Vision profiles decoded when Ranges lists
+	// RangeDolbyVision. nil or empty = any.
+	DVProfiles []int
 }
 
 // AudioSupport is one audio codec a renderer decodes natively, up to MaxChannels
@@ -116,5 +129,64 @@ func (s VideoSupport) accepts(v ProbeInfo) bool {
 	if !slices.Contains(depths, v.VideoBitDepth) {
 		return false
 	}
-	return !v.VideoHDR
+	ranges := s.Ranges
+	if len(ranges) == 0 {
+		ranges = []DynamicRange{RangeSDR}
+	}
+	// A Dolby Vision stream plays as such where Dolby Vision of its profile
+	// is decoded, and otherwise as its base layer, when it has one the
+	// renderer shows.
+	if v.VideoDVProfile > 0 && slices.Contains(ranges, RangeDolbyVision) &&
+		(len(s.DVProfiles) == 0 || slices.Contains(s.DVProfiles, v.VideoDVProfile)) {
+		return true
+	}
+	switch v.VideoRange {
+	case "":
+		return slices.Contains(ranges, RangeSDR)
+	case RangeDolbyVision:
+		return false
+	}
+	return slices.Contains(ranges, v.VideoRange)
+}
+
+// ServedIn returns r as it decodes media served to it in format f: only the
+// envelopes of codecs f carries, so a codec the renderer decodes but cannot be
+// handed in f is neither copied nor encoded to.
+func (r Renderer) ServedIn(f FormatInfo) Renderer {
+	r.Video = slices.DeleteFunc(slices.Clone(r.Video), func(s VideoSupport) bool { return !f.Carries(s.Codec) })
+	r.Audio = slices.DeleteFunc(slices.Clone(r.Audio), func(s AudioSupport) bool { return !f.Carries(s.Codec) })
+	return r
+}
+
+// AudioChannels reports the most channels the renderer decodes audio codec c
+// in, 0 for no ceiling, and whether it decodes c at all.
+func (r Renderer) AudioChannels(c Codec) (ceiling int, ok bool) {
+	i := slices.IndexFunc(r.Audio, func(s AudioSupport) bool { return s.Codec == c })
+	if i < 0 {
+		return 0, false
+	}
+	return r.Audio[i].MaxChannels, true
+}
+
+// WithRanges returns r with ranges added to every video envelope decoding
+// 10-bit, the depth HDR is mastered in: a renderer declared to show an HDR
+// range shows it in each codec it decodes at that depth.
+func (r Renderer) WithRanges(ranges []DynamicRange) Renderer {
+	r.Video = slices.Clone(r.Video)
+	for i, s := range r.Video {
+		if !slices.Contains(s.BitDepths, 10) {
+			continue
+		}
+		all := slices.Clone(s.Ranges)
+		if len(all) == 0 {
+			all = []DynamicRange{RangeSDR}
+		}
+		for _, rg := range ranges {
+			if !slices.Contains(all, rg) {
+				all = append(all, rg)
+			}
+		}
+		r.Video[i].Ranges = all
+	}
+	return r
 }
@@ -60,6 +60,67 @@ func TestRendererCanCopyVideo(t *testing.T) {
 	}
 }
 
+// hdrTV is a 10-bit HEVC envelope declared to show HDR10 and Dolby Vision
+// profile 8, the way WithRanges and a DVProfiles list would leave it.
+var hdrTV = Renderer{
+	Video: []VideoSupport{{
+		Codec:      CodecHEVC,
+		BitDepths:  []int{8, 10},
+		Ranges:     []DynamicRange{RangeSDR, RangeHDR10, RangeDolbyVision},
+		DVProfiles: []int{8},
+	}},
+}
+
+func TestRendererCanCopyVideoRanges(t *testing.T) {
+	hevc := ProbeInfo{VideoCodec: CodecHEVC, VideoBitDepth: 10}
+	dv := func(profile int, base DynamicRange) ProbeInfo {
+		v := hevc
+		v.VideoDVProfile, v.VideoRange = profile, base
+		return v
+	}
+	tests := []struct {
+		name string
+		info ProbeInfo
+		want bool
+	}{
+		{"sdr", hevc, true},
+		{"unknown range taken as sdr", withRange(hevc, ""), true},
+		{"declared hdr10", withRange(hevc, RangeHDR10), true},
+		{"undeclared hlg", withRange(hevc, RangeHLG), false},
+		{"declared dv profile", dv(8, RangeHLG), true},
+		{"dv profile 5 is not a declared one", dv(5, RangeDolbyVision), false},
+		{"dv profile 7 plays as its hdr10 base layer", dv(7, RangeHDR10), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hdrTV.CanCopyVideo(tt.info); got != tt.want {
+				t.Errorf("CanCopyVideo = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRendererWithRanges(t *testing.T) {
+	r := Renderer{Video: []VideoSupport{
+		{Codec: CodecH264},
+		{Codec: CodecHEVC, BitDepths: []int{8, 10}},
+	}}
+	got := r.WithRanges([]DynamicRange{RangeHLG})
+	hlg := ProbeInfo{VideoCodec: CodecHEVC, VideoBitDepth: 10, VideoRange: RangeHLG}
+	if !got.CanCopyVideo(hlg) {
+		t.Error("a 10-bit envelope declared to show HLG should copy an HLG source")
+	}
+	if !got.CanCopyVideo(withRange(hlg, RangeSDR)) {
+		t.Error("declaring HLG should keep the envelope's SDR")
+	}
+	if got.Video[0].Ranges != nil {
+		t.Errorf("an 8-bit envelope gained ranges %v, want none", got.Video[0].Ranges)
+	}
+	if r.Video[1].Ranges != nil {
+		t.Error("WithRanges changed the renderer it was called on")
+	}
+}
+
 // TestRendererCanCopyVideoEmptyBitDepths pins BitDepths' nil-and-empty-both-
 // default-to-8-bit convention against the asymmetric bug where a non-nil
 // empty slice (e.g. from a decoded JSON "[]") silently rejected every probe,
@@ -133,8 +194,9 @@ func TestRendererCanCopyAudio(t *testing.T) {
 	}
 }
 
-func withProfile(v ProbeInfo, p string) ProbeInfo { v.VideoProfile = p; return v }
-func withHeight(v ProbeInfo, h int) ProbeInfo     { v.VideoHeight = h; return v }
-func withBitDepth(v ProbeInfo, d int) ProbeInfo   { v.VideoBitDepth = d; return v }
-func withCodec(v ProbeInfo, c Codec) ProbeInfo    { v.VideoCodec = c; return v }
-func withHDR(v ProbeInfo) ProbeInfo               { v.VideoHDR = true; return v }
+func withProfile(v ProbeInfo, p string) ProbeInfo     { v.VideoProfile = p; return v }
+func withHeight(v ProbeInfo, h int) ProbeInfo         { v.VideoHeight = h; return v }
+func withBitDepth(v ProbeInfo, d int) ProbeInfo       { v.VideoBitDepth = d; return v }
+func withCodec(v ProbeInfo, c Codec) ProbeInfo        { v.VideoCodec = c; return v }
+func withHDR(v ProbeInfo) ProbeInfo                   { v.VideoRange = RangeHDR10; return v }
+func withRange(v ProbeInfo, r DynamicRange) ProbeInfo { v.VideoRange = r; return v }
@@ -0,0 +1,42 @@
+package media
+
+import "net/url"
+
+// SRT is the content type a SubRip caption file is served as, the MIME type a
+// DLNA renderer that takes one lists in its Sink.
+const SRT = "text/srt"
+
+// SubtitleTrack is a subtitle track a source carries itself, as opposed to one
+// whisper transcribes from its audio. It is one of two shapes:
+//
+//   - a rendition an HLS master publishes beside its variants (EXT-X-MEDIA
+//     TYPE=SUBTITLES), a playlist of WebVTT segments read from URL.
+//   - a text track muxed into the stream's own URL (an MKV's SubRip or ASS, an
+//     MP4's mov_text), read as its Index'th subtitle track.
+type SubtitleTrack struct {
+	// URL is the rendition's playlist, nil for a track muxed into the stream.
+	URL *url.URL
+
+	// Index is which of the stream's subtitle tracks this is, counted from 0
+	// among its subtitle tracks alone (ffmpeg's s:N). Unused for a rendition.
+	Index int
+
+	// Language is the track's language tag, "" when the source names none.
+	Language string
+}
+
+// Rendition reports whether the track is read from a playlist of its own
+// rather than out of the stream.
+func (t SubtitleTrack) Rendition() bool { return t.URL != nil }
+
+// textSubtitleCodecs are the ffmpeg subtitle codecs that carry text. The rest
+// (hdmv_pgs_subtitle, dvd_subtitle, dvb_subtitle) carry pictures, which
+// neither the drawtext burn-in nor an SRT sidecar can show.
+var textSubtitleCodecs = map[string]bool{
+	"subrip": true, "srt": true, "ass": true, "ssa": true, "webvtt": true,
+	"mov_text": true, "text": true, "microdvd": true, "subviewer": true,
+}
+
+// TextSubtitle reports whether codec, an ffmpeg codec name, is a subtitle
+// codec that carries text.
+func TextSubtitle(codec string) bool { return textSubtitleCodecs[codec] }
@@ -0,0 +1,88 @@
+package mediaserver
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// didlLite is a Browse result: the containers and items of one page.
+type didlLite struct {
+	XMLName    xml.Name        `xml:"DIDL-Lite"`
+	XMLNS      string          `xml:"xmlns,attr"`
+	DC         string          `xml:"xmlns:dc,attr"`
+	UPnP       string          `xml:"xmlns:upnp,attr"`
+	Containers []didlContainer `xml:"container"`
+	Items      []didlItem      `xml:"item"`
+}
+
+type didlContainer struct {
+	ID         string `xml:"id,attr"`
+	ParentID   string `xml:"parentID,attr"`
+	Restricted string `xml:"restricted,attr"`
+	Searchable string `xml:"searchable,attr"`
+	Title      string `xml:"dc:title"`
+	Class      string `xml:"upnp:class"`
+}
+
+type didlItem struct {
+	ID         string    `xml:"id,attr"`
+	ParentID   string    `xml:"parentID,attr"`
+	Restricted string    `xml:"restricted,attr"`
+	Title      string    `xml:"dc:title"`
+	Class      string    `xml:"upnp:class"`
+	Res        []didlRes `xml:"res"`
+}
+
+// didlRes is one way to fetch an item. A renderer plays the first resource it
+// can, so an item lists the one meant for the browsing TV first.
+type didlRes struct {
+	ProtocolInfo string `xml:"protocolInfo,attr"`
+	Size         int64  `xml:"size,attr,omitempty"`
+	Duration     string `xml:"duration,attr,omitempty"`
+	Value        string `xml:",chardata"`
+}
+
+func newDIDL() didlLite {
+	return didlLite{
+		XMLNS: "urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/",
+		DC:    "http://purl.org/dc/elements/1.1/",
+		UPnP:  "urn:schemas-upnp-org:metadata-1-0/upnp/",
+	}
+}
+
+func (d *didlLite) addContainer(o object) {
+	d.Containers = append(d.Containers, didlContainer{
+		ID:         o.id,
+		ParentID:   o.parentID,
+		Restricted: "1",
+		Searchable: "0",
+		Title:      o.title,
+		Class:      "object.container.storageFolder",
+	})
+}
+
+func (d *didlLite) addItem(o object, res []didlRes) {
+	d.Items = append(d.Items, didlItem{
+		ID:         o.id,
+		ParentID:   o.parentID,
+		Restricted: "1",
+		Title:      o.title,
+		Class:      "object.item.videoItem",
+		Res:        res,
+	})
+}
+
+func (d didlLite) marshal() (string, error) {
+	data, err := xml.Marshal(d)
+	if err != nil {
+		return "", fmt.Errorf("marshaling DIDL-Lite: %w", err)
+	}
+	return string(data), nil
+}
+
+// formatDuration renders d as a DIDL res duration, H+:MM:SS.FFF.
+func formatDuration(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
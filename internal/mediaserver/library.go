@@ -0,0 +1,179 @@
+package mediaserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stupside/castor/internal/media"
+)
+
+// rootID is the ContentDirectory's root container, which UPnP fixes as "0".
+// Its parent, "-1", names nothing.
+const (
+	rootID       = "0"
+	rootParentID = "-1"
+)
+
+// errNoSuchObject is an object ID that names nothing the library publishes.
+var errNoSuchObject = errors.New("no such object")
+
+// object is one entry of the library: a folder (a container) or a media file
+// (an item). Its ID is its slash-separated path under the library root, so IDs
+// survive a restart and a TV's bookmarks keep working.
+type object struct {
+	id       string
+	parentID string
+	title    string
+	path     string
+	dir      bool
+
+	// size and modTime are the file's, keying its probe; contentType is what
+	// its extension names. All three are unset on a folder.
+	size        int64
+	modTime     time.Time
+	contentType string
+}
+
+// library publishes the media files under root as ContentDirectory objects. It
+// reads the disk on every request rather than indexing it, so a file dropped
+// into the folder shows on the TV's next Browse.
+type library struct {
+	root string
+}
+
+// lookup resolves an object ID to the object it names. An ID that climbs out of
+// the root, names a hidden entry or is not a media file names nothing: a TV is
+// only ever served what a Browse would have listed.
+func (l library) lookup(id string) (object, error) {
+	if id == rootID {
+		return object{id: rootID, parentID: rootParentID, title: filepath.Base(l.root), path: l.root, dir: true}, nil
+	}
+	if !filepath.IsLocal(id) || path.Clean(id) != id {
+		return object{}, errNoSuchObject
+	}
+	if slices.ContainsFunc(strings.Split(id, "/"), hidden) {
+		return object{}, errNoSuchObject
+	}
+	p := filepath.Join(l.root, filepath.FromSlash(id))
+	fi, err := os.Stat(p)
+	if err != nil {
+		return object{}, errNoSuchObject
+	}
+	o, ok := newObject(id, p, fi)
+	if !ok {
+		return object{}, errNoSuchObject
+	}
+	return o, nil
+}
+
+// children lists a folder's subfolders then its media files, each sorted by
+// name so a series lists in episode order. An entry that cannot be read is
+// skipped rather than failing the listing.
+func (l library) children(parent object) ([]object, error) {
+	entries, err := os.ReadDir(parent.path)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", parent.path, err)
+	}
+	var dirs, files []object
+	for _, e := range entries {
+		if hidden(e.Name()) {
+			continue
+		}
+		id := e.Name()
+		if parent.id != rootID {
+			id = parent.id + "/" + id
+		}
+		p := filepath.Join(parent.path, e.Name())
+		// Stat rather than e.Info(): a symlinked folder or file is published as
+		// what it points at.
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		o, ok := newObject(id, p, fi)
+		switch {
+		case !ok:
+		case o.dir:
+			dirs = append(dirs, o)
+		default:
+			files = append(files, o)
+		}
+	}
+	return append(dirs, files...), nil
+}
+
+// newObject builds the object for the entry at p, or reports false for one the
+// library does not publish: anything but a folder or a media file, which a
+// playlist is not since it names other files rather than holding media itself.
+func newObject(id, p string, fi fs.FileInfo) (object, bool) {
+	parentID := path.Dir(id)
+	if parentID == "." {
+		parentID = rootID
+	}
+	o := object{id: id, parentID: parentID, title: fi.Name(), path: p}
+	if fi.IsDir() {
+		o.dir = true
+		return o, true
+	}
+	o.contentType = media.DetectFromFileName(p)
+	if !fi.Mode().IsRegular() || o.contentType == "" || o.contentType == media.HLS {
+		return object{}, false
+	}
+	o.title = strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name()))
+	o.size = fi.Size()
+	o.modTime = fi.ModTime()
+	return o, true
+}
+
+// hidden reports a dotfile or dot-folder, which the library never publishes.
+func hidden(name string) bool { return strings.HasPrefix(name, ".") }
+
+// probeKey identifies one version of a file: a file replaced in place probes
+// anew.
+type probeKey struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// probeCache remembers each file's probe for the process, so paging through a
+// folder on the TV does not run ffprobe over it again. A failed probe is not
+// cached and is retried on the next listing.
+type probeCache struct {
+	probe func(ctx context.Context, path string) (media.ProbeInfo, error)
+
+	mu      sync.Mutex
+	results map[probeKey]media.ProbeInfo
+}
+
+func newProbeCache(probe func(ctx context.Context, path string) (media.ProbeInfo, error)) *probeCache {
+	return &probeCache{probe: probe, results: map[probeKey]media.ProbeInfo{}}
+}
+
+// info returns o's probe, and whether there is one.
+func (c *probeCache) info(ctx context.Context, o object) (media.ProbeInfo, bool) {
+	key := probeKey{o.path, o.size, o.modTime}
+	c.mu.Lock()
+	info, ok := c.results[key]
+	c.mu.Unlock()
+	if ok {
+		return info, true
+	}
+	info, err := c.probe(ctx, o.path)
+	if err != nil {
+		return media.ProbeInfo{}, false
+	}
+	c.mu.Lock()
+	c.results[key] = info
+	c.mu.Unlock()
+	return info, true
+}
@@ -0,0 +1,108 @@
+package mediaserver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeLibrary lays out files (slash paths, relative to a fresh root) and
+// returns the root.
+func writeLibrary(t *testing.T, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("media"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestLookup(t *testing.T) {
+	root := writeLibrary(t, "Show/S01E01.mkv", "movie.mp4", "notes.txt", ".hidden/secret.mp4", "live.m3u8")
+	lib := library{root: root}
+
+	tests := []struct {
+		id       string
+		parentID string
+		dir      bool
+		err      bool
+	}{
+		{id: "0", parentID: "-1", dir: true},
+		{id: "Show", parentID: "0", dir: true},
+		{id: "Show/S01E01.mkv", parentID: "Show"},
+		{id: "movie.mp4", parentID: "0"},
+		{id: "notes.txt", err: true},
+		{id: "live.m3u8", err: true},
+		{id: ".hidden/secret.mp4", err: true},
+		{id: "../movie.mp4", err: true},
+		{id: "Show/../movie.mp4", err: true},
+		{id: "/etc/passwd", err: true},
+		{id: "missing.mp4", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			o, err := lib.lookup(tt.id)
+			if tt.err {
+				if !errors.Is(err, errNoSuchObject) {
+					t.Fatalf("lookup(%q) error = %v, want errNoSuchObject", tt.id, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lookup(%q) error = %v", tt.id, err)
+			}
+			if o.parentID != tt.parentID || o.dir != tt.dir {
+				t.Errorf("lookup(%q) = parent %q dir %v, want parent %q dir %v", tt.id, o.parentID, o.dir, tt.parentID, tt.dir)
+			}
+		})
+	}
+}
+
+func TestChildren(t *testing.T) {
+	root := writeLibrary(t, "b.mp4", "a.mkv", "Show/S01E02.ts", "Show/S01E01.ts", "Show/cover.jpg", ".trash/old.mp4", "list.m3u8")
+	lib := library{root: root}
+
+	top, err := lib.children(object{id: rootID, path: root, dir: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(top), []string{"Show", "a.mkv", "b.mp4"}; !slices.Equal(got, want) {
+		t.Errorf("root children = %v, want folders then files, by name: %v", got, want)
+	}
+	if top[1].title != "a" {
+		t.Errorf("item title = %q, want the file name without its extension", top[1].title)
+	}
+
+	show, err := lib.lookup("Show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eps, err := lib.children(show)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(eps), []string{"Show/S01E01.ts", "Show/S01E02.ts"}; !slices.Equal(got, want) {
+		t.Errorf("Show children = %v, want %v", got, want)
+	}
+	for _, o := range eps {
+		if o.parentID != "Show" {
+			t.Errorf("%s parent = %q, want Show", o.id, o.parentID)
+		}
+	}
+}
+
+func ids(objs []object) []string {
+	out := make([]string, len(objs))
+	for i, o := range objs {
+		out[i] = o.id
+	}
+	return out
+}
@@ -0,0 +1,565 @@
+// Package mediaserver is castor's DLNA media server mode: it publishes a folder
+// of videos as a UPnP MediaServer, so a TV browses and plays it from its own
+// UI instead of being cast to.
+//
+// The server advertises itself over SSDP and answers the ContentDirectory
+// (Browse) and ConnectionManager services. Each item describes the file as it
+// is, with a protocolInfo derived from its probe, and, when the browsing TV's
+// Sink cannot take it unchanged, lists an on-demand MPEG-TS transcode ahead of
+// it, so the TV picks what it can play. The file is served with byte ranges and
+// DLNA time-seek, like a local file cast; the transcode runs through the same
+// encode decision and replay server a cast's served output does.
+package mediaserver
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/cast/deliver/fileserve"
+	"github.com/stupside/castor/internal/cast/deliver/replay"
+	"github.com/stupside/castor/internal/cast/ffmpeg"
+	"github.com/stupside/castor/internal/cast/pipeline"
+	"github.com/stupside/castor/internal/device"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/metrics"
+	"github.com/stupside/castor/internal/version"
+)
+
+const (
+	// probeWorkers bounds the ffprobes one Browse runs at once: a page of a
+	// large folder probes in parallel, but not all at once.
+	probeWorkers = 4
+
+	// capsTimeout bounds finding and asking a TV for its Sink. A Browse waits on
+	// it, and a TV gives up on a slow server.
+	capsTimeout = 5 * time.Second
+
+	// capsRetry is how long a host no renderer answered on is described as the
+	// conservative fallback before it is asked again.
+	capsRetry = time.Minute
+)
+
+// Config is the media_server section: the folder castor publishes and how it
+// names itself on the network.
+type Config struct {
+	// Dir is the folder of videos TVs browse. The media-server command's
+	// argument overrides it.
+	Dir string `yaml:"dir"`
+	// Name is the friendly name TVs list the server under. Empty means
+	// "castor on <hostname>".
+	Name string `yaml:"name"`
+	// Port is the HTTP port the description, control and media are served on.
+	// Zero picks a free one; pinning it keeps the address a TV remembers valid
+	// across restarts.
+	Port int `yaml:"port" validate:"min=0,max=65535"`
+}
+
+// Server is the media server's HTTP side: the description, the two services'
+// control, and the media.
+type Server struct {
+	ctx  context.Context // transcodes run under it; cancelling it ends them all
+	cfg  core.Config
+	name string
+	udn  string
+	lib  library
+
+	probes   *probeCache
+	sinkCaps func(ctx context.Context, host string) (media.Renderer, error)
+
+	// updateID is the ContentDirectory's SystemUpdateID. The library is read
+	// from disk on every Browse, so it changes only between runs, which tells a
+	// TV that cached a listing to read it again.
+	updateID string
+
+	capsMu     sync.Mutex
+	capsByHost map[string]capsEntry
+
+	streamsMu sync.Mutex
+	streams   map[string]*transcode
+	running   sync.WaitGroup
+}
+
+// capsEntry is a host's renderer capabilities. A negotiated entry is kept for
+// the process; a fallback expires, so a TV that was off is asked again.
+type capsEntry struct {
+	caps    media.Renderer
+	expires time.Time
+}
+
+// newServer builds the server for the library at root. Transcodes run under
+// ctx.
+func newServer(ctx context.Context, cfg core.Config, name, root string) *Server {
+	return &Server{
+		ctx:  ctx,
+		cfg:  cfg,
+		name: name,
+		udn:  deviceUDN(name, root),
+		lib:  library{root: root},
+		probes: newProbeCache(func(ctx context.Context, path string) (media.ProbeInfo, error) {
+			return ffmpeg.ProbeFile(ctx, cfg.Resolver.FFprobePath, path)
+		}),
+		sinkCaps:   device.SinkCapabilities,
+		updateID:   strconv.FormatInt(time.Now().Unix()%(1<<32), 10),
+		capsByHost: map[string]capsEntry{},
+		streams:    map[string]*transcode{},
+	}
+}
+
+// Serve publishes ms.Dir until ctx is done: it serves HTTP on this machine's
+// LAN address, advertises over SSDP, and on shutdown says byebye and stops the
+// transcodes still running.
+func Serve(ctx context.Context, cfg core.Config, ms Config) error {
+	if ms.Dir == "" {
+		return errors.New("no folder to serve: set media_server.dir or pass one")
+	}
+	root, err := filepath.Abs(ms.Dir)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", ms.Dir, err)
+	}
+	if fi, err := os.Stat(root); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a folder", root)
+	}
+	localIP, err := core.LocalIP(cfg)
+	if err != nil {
+		return err
+	}
+	name := ms.Name
+	if name == "" {
+		host, _ := os.Hostname()
+		name = "castor on " + cmp.Or(host, localIP)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := newServer(ctx, cfg, name, root)
+	defer s.running.Wait()
+	go ffmpeg.WarmEncoders(ctx, cfg.Transcode.FFmpegPath)
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(localIP, strconv.Itoa(ms.Port)))
+	if err != nil {
+		return fmt.Errorf("binding media server: %w", err)
+	}
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Close()
+
+	location := "http://" + ln.Addr().String() + descriptionPath
+	slog.InfoContext(ctx, "media server listening", "name", name, "folder", root, "location", location)
+	return newAdvertiser(s.udn, location, version.Version).run(ctx, cfg.Network.Interface, localIP)
+}
+
+// Handler routes the media server.
+//
+//	GET  /description.xml              the device description
+//	GET  /ContentDirectory.xml         the service descriptions
+//	GET  /ConnectionManager.xml
+//	POST /control/ContentDirectory     SOAP control
+//	POST /control/ConnectionManager
+//	     /event/...                    eventing, accepted and never sent
+//	GET  /media/{id}                   an item's file, as it is
+//	GET  /transcode/{id}.ts            an item transcoded for the fetching TV
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+descriptionPath, s.handleDescription)
+	mux.HandleFunc("GET "+contentDirectorySCPD, serveXML(contentDirectoryXML))
+	mux.HandleFunc("GET "+connectionMgrSCPD, serveXML(connectionManagerXML))
+	mux.Handle(contentDirectoryCtl, controlHandler(contentDirectoryType, map[string]action{
+		"Browse":                s.browse,
+		"GetSearchCapabilities": constant("SearchCaps", ""),
+		"GetSortCapabilities":   constant("SortCaps", ""),
+		"GetSystemUpdateID":     constant("Id", s.updateID),
+	}))
+	mux.Handle(connectionMgrCtl, controlHandler(connectionManagerType, map[string]action{
+		"GetProtocolInfo":         s.protocolInfo,
+		"GetCurrentConnectionIDs": constant("ConnectionIDs", "0"),
+		"GetCurrentConnectionInfo": func(*http.Request, map[string]string) ([]soapArg, error) {
+			return []soapArg{
+				{"RcsID", "-1"}, {"AVTransportID", "-1"}, {"ProtocolInfo", ""},
+				{"PeerConnectionManager", ""}, {"PeerConnectionID", "-1"},
+				{"Direction", "Output"}, {"Status", "OK"},
+			}, nil
+		},
+	}))
+	mux.HandleFunc(contentDirectoryEvt, handleEvent)
+	mux.HandleFunc(connectionMgrEvt, handleEvent)
+	mux.HandleFunc("/media/{id...}", s.handleMedia)
+	mux.HandleFunc("/transcode/{id...}", s.handleTranscode)
+	return mux
+}
+
+func (s *Server) handleDescription(w http.ResponseWriter, r *http.Request) {
+	data, err := description(s.name, s.udn, version.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveXML(string(data))(w, r)
+}
+
+func serveXML(doc string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+		_, _ = w.Write([]byte(doc))
+	}
+}
+
+// constant answers an action whose one out argument never changes.
+func constant(name, value string) action {
+	return func(*http.Request, map[string]string) ([]soapArg, error) {
+		return []soapArg{{name, value}}, nil
+	}
+}
+
+// handleEvent accepts a subscription so a TV that insists on one carries on,
+// and never sends an event: no state castor publishes changes while it runs.
+func handleEvent(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "SUBSCRIBE":
+		w.Header().Set("SID", cmp.Or(r.Header.Get("SID"), deviceUDN(r.RemoteAddr, r.URL.Path)))
+		w.Header().Set("TIMEOUT", "Second-1800")
+	case "UNSUBSCRIBE":
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// protocolInfo answers GetProtocolInfo with what castor serves: any container
+// it publishes, and the MPEG-TS it transcodes to.
+func (s *Server) protocolInfo(*http.Request, map[string]string) ([]soapArg, error) {
+	var source []string
+	for _, ct := range []string{media.MPEGTS, media.MP4, media.MKV, media.WebM, media.AVI, media.MOV} {
+		source = append(source, "http-get:*:"+ct+":*")
+	}
+	return []soapArg{{"Source", strings.Join(source, ",")}, {"Sink", ""}}, nil
+}
+
+// browse answers a ContentDirectory Browse: one object's metadata, or a page of
+// a folder's children.
+func (s *Server) browse(r *http.Request, args map[string]string) ([]soapArg, error) {
+	start, err := strconv.Atoi(cmp.Or(args["StartingIndex"], "0"))
+	if err != nil || start < 0 {
+		return nil, errInvalidArgs
+	}
+	count, err := strconv.Atoi(cmp.Or(args["RequestedCount"], "0"))
+	if err != nil || count < 0 {
+		return nil, errInvalidArgs
+	}
+	o, err := s.lib.lookup(args["ObjectID"])
+	if err != nil {
+		return nil, errNoSuchObjectID
+	}
+
+	var page []object
+	total := 1
+	switch args["BrowseFlag"] {
+	case "BrowseMetadata":
+		page = []object{o}
+	case "BrowseDirectChildren":
+		if !o.dir {
+			return nil, errNoSuchContainer
+		}
+		all, err := s.lib.children(o)
+		if err != nil {
+			return nil, err
+		}
+		total = len(all)
+		start = min(start, total)
+		end := total
+		if count > 0 {
+			end = min(start+count, total)
+		}
+		page = all[start:end]
+	default:
+		return nil, errInvalidArgs
+	}
+
+	result, err := s.didl(r, page)
+	if err != nil {
+		return nil, err
+	}
+	slog.DebugContext(r.Context(), "browse", "from", r.RemoteAddr, "object", o.id, "returned", len(page), "total", total)
+	return []soapArg{
+		{"Result", result},
+		{"NumberReturned", strconv.Itoa(len(page))},
+		{"TotalMatches", strconv.Itoa(total)},
+		{"UpdateID", s.updateID},
+	}, nil
+}
+
+// didl renders a page of objects for the TV that asked. Items are probed in
+// parallel, and described against the TV's Sink, which is only looked up when
+// the page holds an item.
+func (s *Server) didl(r *http.Request, page []object) (string, error) {
+	ctx := r.Context()
+	infos := make([]media.ProbeInfo, len(page))
+	probed := make([]bool, len(page))
+	var caps media.Renderer
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, probeWorkers)
+	hasItem := false
+	for i, o := range page {
+		if o.dir {
+			continue
+		}
+		hasItem = true
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			infos[i], probed[i] = s.probes.info(ctx, o)
+		})
+	}
+	if hasItem {
+		caps = s.rendererCaps(ctx, remoteHost(r))
+	}
+	wg.Wait()
+
+	base := "http://" + r.Host
+	d := newDIDL()
+	for i, o := range page {
+		if o.dir {
+			d.addContainer(o)
+			continue
+		}
+		d.addItem(o, s.resources(base, o, infos[i], probed[i], caps))
+	}
+	return d.marshal()
+}
+
+// resources are the ways an item can be fetched, the one meant for a TV with
+// caps first: the file as it is when the TV takes it unchanged, otherwise the
+// on-demand transcode ahead of it. An item that would not probe cannot be
+// judged, so it offers the transcode first too.
+func (s *Server) resources(base string, o object, info media.ProbeInfo, probed bool, caps media.Renderer) []didlRes {
+	file := didlRes{
+		ProtocolInfo: "http-get:*:" + o.contentType + ":" + device.FileFeatures(o.contentType, info),
+		Size:         o.size,
+		Value:        base + mediaPath(o.id),
+	}
+	if info.Duration > 0 {
+		file.Duration = formatDuration(info.Duration)
+	}
+	if probed && pipeline.PlaysAsIs(s.cfg, caps, o.path, info) {
+		return []didlRes{file}
+	}
+	stream := didlRes{
+		ProtocolInfo: "http-get:*:" + media.MPEGTS + ":" + device.StreamFeatures(media.MPEGTS, info.Duration > 0),
+		Duration:     file.Duration,
+		Value:        base + transcodePath(o.id),
+	}
+	return []didlRes{stream, file}
+}
+
+// rendererCaps returns the capabilities of the renderer at host, asking it on
+// first use.
+func (s *Server) rendererCaps(ctx context.Context, host string) media.Renderer {
+	s.capsMu.Lock()
+	e, ok := s.capsByHost[host]
+	s.capsMu.Unlock()
+	if ok && (e.expires.IsZero() || time.Now().Before(e.expires)) {
+		return e.caps
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, capsTimeout)
+	defer cancel()
+	caps, err := s.sinkCaps(ctx, host)
+	e = capsEntry{caps: caps}
+	if err != nil {
+		slog.InfoContext(ctx, "no renderer answered at the browsing address; describing items for a conservative one",
+			"host", host, "error", err)
+		e.expires = time.Now().Add(capsRetry)
+	}
+	s.capsMu.Lock()
+	s.capsByHost[host] = e
+	s.capsMu.Unlock()
+	return caps
+}
+
+// handleMedia serves an item's file as it is, with byte ranges and, for
+// MPEG-TS, time-seek.
+func (s *Server) handleMedia(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	o, err := s.lib.lookup(r.PathValue("id"))
+	if err != nil || o.dir {
+		http.NotFound(w, r)
+		return
+	}
+	metrics.Requests.Inc("file")
+	slog.InfoContext(ctx, "media "+r.Method,
+		"from", r.RemoteAddr,
+		"item", o.id,
+		"range", r.Header.Get("Range"),
+		"time_seek", r.Header.Get(fileserve.TimeSeekHeader),
+	)
+
+	info, _ := s.probes.info(ctx, o)
+	f := fileserve.File{
+		Path:        o.path,
+		ContentType: o.contentType,
+		Headers:     device.ResourceHeaders(device.FileFeatures(o.contentType, info), true),
+		Duration:    info.Duration,
+	}
+	if o.contentType == media.MPEGTS {
+		f.PacketSize = fileserve.TSPacketSize
+	}
+	metrics.Clients.Add("file", 1)
+	defer metrics.Clients.Add("file", -1)
+	sent, end := fileserve.ServeFile(w, r, f)
+	slog.InfoContext(ctx, "media response ended", "from", r.RemoteAddr, "item", o.id, "bytes_sent", sent, "reached_end", end)
+}
+
+// handleTranscode serves an item transcoded for the renderer fetching it. A HEAD
+// is answered without starting an encode for it.
+func (s *Server) handleTranscode(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(r.PathValue("id"), ".ts")
+	o, err := s.lib.lookup(id)
+	if !ok || err != nil || o.dir {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodHead {
+		info, _ := s.probes.info(r.Context(), o)
+		w.Header().Set("Content-Type", media.MPEGTS)
+		for k, v := range transcodeHeaders(info.Duration) {
+			w.Header().Set(k, v)
+		}
+		return
+	}
+	t, err := s.transcode(o, remoteHost(r))
+	if err != nil {
+		slog.WarnContext(r.Context(), "transcode failed to start", "item", o.id, "error", err)
+		http.Error(w, "transcode unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	t.proxy.ServeHTTP(w, r)
+}
+
+// transcodeHeaders are the headers of a transcode of an item running duration.
+// One of a known length is a VOD the replay server seeks in.
+func transcodeHeaders(duration time.Duration) map[string]string {
+	seekable := duration > 0
+	return device.ResourceHeaders(device.StreamFeatures(media.MPEGTS, seekable), seekable)
+}
+
+// transcode is one running on-demand encode: an item encoded for one renderer,
+// spooled and replayed by a loopback replay server the item's requests are
+// proxied to, so the probe-then-play requests a TV makes, and its seeks, share
+// a single encode.
+type transcode struct {
+	proxy *httputil.ReverseProxy
+}
+
+// transcode returns the running encode of o for the renderer at host, starting
+// it on first request. It runs until the replay server has delivered it, then
+// tears itself down.
+func (s *Server) transcode(o object, host string) (*transcode, error) {
+	key := o.id + "\x00" + host
+	s.streamsMu.Lock()
+	defer s.streamsMu.Unlock()
+	if t, ok := s.streams[key]; ok {
+		return t, nil
+	}
+
+	// A failed probe leaves the zero ProbeInfo, which the resolvers meet with a
+	// full re-encode: the conservative answer to a file nothing is known about.
+	info, _ := s.probes.info(s.ctx, o)
+	caps := s.rendererCaps(s.ctx, host)
+	enc, _ := pipeline.FileEncode(s.ctx, s.cfg, caps, o.path, info, "")
+	format, _ := media.FormatForContentType(media.MPEGTS)
+	enc.OutputFormat = format.Muxer
+	args, err := ffmpeg.EncodeArgs(enc)
+	if err != nil {
+		return nil, fmt.Errorf("building encode args: %w", err)
+	}
+
+	workDir, err := s.cfg.Spool.WorkDir()
+	if err != nil {
+		return nil, err
+	}
+	proc, err := ffmpeg.Start(s.ctx, s.cfg.Transcode.FFmpegPath, args)
+	if err != nil {
+		_ = os.RemoveAll(workDir)
+		return nil, fmt.Errorf("starting transcode: %w", err)
+	}
+	srv, err := replay.New(replay.Config{
+		LocalIP:     "127.0.0.1",
+		ContentType: format.ContentType,
+		Extension:   format.Extension,
+		Headers:     transcodeHeaders(info.Duration),
+		SpoolPath:   core.StreamSpool(workDir, format),
+		Quota:       s.cfg.Spool.Quota(),
+		Duration:    info.Duration,
+		PacketSize:  fileserve.TSPacketSize,
+	}, proc.Stdout)
+	if err != nil {
+		_ = proc.Stdout.Close()
+		_ = proc.Wait()
+		_ = os.RemoveAll(workDir)
+		return nil, fmt.Errorf("starting stream server: %w", err)
+	}
+	slog.InfoContext(s.ctx, "transcode started", "item", o.id, "for", host,
+		"source_codec", string(info.VideoCodec), "audio_codec", enc.AudioCodec, "reencode_video", enc.VideoEncoder != nil)
+
+	target := srv.URL()
+	t := &transcode{proxy: &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL = &url.URL{Scheme: target.Scheme, Host: target.Host, Path: target.Path}
+		},
+		// Pass every chunk on as it arrives: the renderer is reading a live
+		// encode, and a buffered proxy would starve its prebuffer.
+		FlushInterval: -1,
+	}}
+	s.streams[key] = t
+
+	s.running.Go(func() {
+		_ = srv.Wait(s.ctx)
+		// Forget the encode before tearing it down, so a request arriving now
+		// starts a fresh one rather than reaching a closed server.
+		s.streamsMu.Lock()
+		delete(s.streams, key)
+		s.streamsMu.Unlock()
+		_ = srv.Close()
+		_ = proc.Stdout.Close()
+		if err := proc.Wait(); err != nil && s.ctx.Err() == nil {
+			proc.LogStderrTail(s.ctx, "ffmpeg stderr")
+			slog.WarnContext(s.ctx, "ffmpeg exited with error", "item", o.id, "error", err)
+		}
+		_ = os.RemoveAll(workDir)
+		slog.InfoContext(s.ctx, "transcode ended", "item", o.id, "for", host)
+	})
+	return t, nil
+}
+
+// remoteHost is the address a request came from, without its port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// mediaPath and transcodePath are an item's two resource paths, escaped for a
+// URL: IDs are file paths and may hold anything a file name does.
+func mediaPath(id string) string {
+	return (&url.URL{Path: "/media/" + id}).EscapedPath()
+}
+
+func transcodePath(id string) string {
+	return (&url.URL{Path: "/transcode/" + id + ".ts"}).EscapedPath()
+}
@@ -0,0 +1,165 @@
+package mediaserver
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huin/goupnp/soap"
+
+	"github.com/stupside/castor/internal/cast/core"
+	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/source/resolve"
+)
+
+// newTestServer serves a library through the real handler, with the probe and
+// the renderer lookup faked: probes come from infos by file name, and every
+// host is a renderer with caps.
+func newTestServer(t *testing.T, caps media.Renderer, infos map[string]media.ProbeInfo, files ...string) *httptest.Server {
+	t.Helper()
+	root := writeLibrary(t, files...)
+	s := newServer(t.Context(), core.Config{Resolver: resolve.Config{MaxHeight: 2160}}, "test", root)
+	s.probes = newProbeCache(func(_ context.Context, path string) (media.ProbeInfo, error) {
+		info, ok := infos[filepath.Base(path)]
+		if !ok {
+			return media.ProbeInfo{}, errors.New("unprobeable")
+		}
+		return info, nil
+	})
+	s.sinkCaps = func(context.Context, string) (media.Renderer, error) { return caps, nil }
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type browseResponse struct {
+	Result         string
+	NumberReturned string
+	TotalMatches   string
+	UpdateID       string
+}
+
+func browse(t *testing.T, srv *httptest.Server, id, flag string, start, count int) (didlLite, browseResponse, error) {
+	t.Helper()
+	u, err := url.Parse(srv.URL + contentDirectoryCtl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &struct {
+		ObjectID, BrowseFlag, Filter, StartingIndex, RequestedCount, SortCriteria string
+	}{id, flag, "*", strconv.Itoa(start), strconv.Itoa(count), ""}
+	var resp browseResponse
+	if err := soap.NewSOAPClient(*u).PerformActionCtx(t.Context(), contentDirectoryType, "Browse", req, &resp); err != nil {
+		return didlLite{}, resp, err
+	}
+	var d didlLite
+	if err := xml.Unmarshal([]byte(resp.Result), &d); err != nil {
+		t.Fatalf("Result is not DIDL-Lite: %v\n%s", err, resp.Result)
+	}
+	return d, resp, nil
+}
+
+func TestBrowse(t *testing.T) {
+	h264AAC := media.ProbeInfo{VideoCodec: media.CodecH264, VideoProfile: "High", VideoHeight: 1080, VideoBitDepth: 8,
+		AudioCodec: media.CodecAAC, AudioChannels: 2, Duration: 90 * time.Minute}
+	hevc := media.ProbeInfo{VideoCodec: media.CodecHEVC, VideoProfile: "Main", VideoHeight: 2160, VideoBitDepth: 8,
+		AudioCodec: media.CodecAAC, AudioChannels: 2, Duration: time.Hour}
+	// An H.264/AAC set that takes mp4 but not matroska.
+	caps := media.Renderer{
+		Containers: []string{media.MPEGTS, media.MP4},
+		Video:      []media.VideoSupport{{Codec: media.CodecH264, Profiles: []string{"Main", "High"}}},
+		Audio:      []media.AudioSupport{{Codec: media.CodecAAC, MaxChannels: 2}},
+	}
+	srv := newTestServer(t, caps,
+		map[string]media.ProbeInfo{"film.mp4": h264AAC, "show one.mkv": hevc},
+		"film.mp4", "show one.mkv", "broken.mp4", "Extras/clip.ts")
+
+	d, resp, err := browse(t, srv, rootID, "BrowseDirectChildren", 0, 0)
+	if err != nil {
+		t.Fatalf("Browse() error = %v", err)
+	}
+	if resp.NumberReturned != "4" || resp.TotalMatches != "4" {
+		t.Fatalf("returned %s of %s, want 4 of 4", resp.NumberReturned, resp.TotalMatches)
+	}
+	if len(d.Containers) != 1 || d.Containers[0].ID != "Extras" {
+		t.Fatalf("containers = %+v, want the Extras folder", d.Containers)
+	}
+	items := map[string]didlItem{}
+	for _, it := range d.Items {
+		items[it.ID] = it
+	}
+
+	// Playable unchanged: the file alone, described from its probe.
+	film := items["film.mp4"].Res
+	if len(film) != 1 || film[0].Value != srv.URL+"/media/film.mp4" {
+		t.Fatalf("film.mp4 resources = %+v, want the file alone", film)
+	}
+	if !strings.Contains(film[0].ProtocolInfo, "video/mp4:DLNA.ORG_PN=AVC_MP4_HP_HD_AAC;") || film[0].Duration != "1:30:00.000" {
+		t.Errorf("film.mp4 res = %+v, want its probed profile and duration", film[0])
+	}
+
+	// The set takes neither matroska nor HEVC: the transcode first, then the file.
+	show := items["show one.mkv"].Res
+	if len(show) != 2 || show[0].Value != srv.URL+"/transcode/show%20one.mkv.ts" || show[1].Value != srv.URL+"/media/show%20one.mkv" {
+		t.Fatalf("show one.mkv resources = %+v, want the transcode then the file", show)
+	}
+	if !strings.HasPrefix(show[0].ProtocolInfo, "http-get:*:video/mp2t:") {
+		t.Errorf("transcode protocolInfo = %q, want MPEG-TS", show[0].ProtocolInfo)
+	}
+
+	// A file that will not probe cannot be judged: it offers the transcode too.
+	if broken := items["broken.mp4"].Res; len(broken) != 2 {
+		t.Errorf("broken.mp4 resources = %+v, want the transcode offered first", broken)
+	}
+
+	page, resp, err := browse(t, srv, rootID, "BrowseDirectChildren", 1, 2)
+	if err != nil {
+		t.Fatalf("Browse() page error = %v", err)
+	}
+	if resp.NumberReturned != "2" || resp.TotalMatches != "4" || len(page.Containers) != 0 || len(page.Items) != 2 {
+		t.Errorf("page = %s of %s (%d containers, %d items), want 2 items of 4", resp.NumberReturned, resp.TotalMatches, len(page.Containers), len(page.Items))
+	}
+
+	meta, _, err := browse(t, srv, "Extras", "BrowseMetadata", 0, 0)
+	if err != nil {
+		t.Fatalf("Browse() metadata error = %v", err)
+	}
+	if len(meta.Containers) != 1 || meta.Containers[0].ParentID != rootID {
+		t.Errorf("Extras metadata = %+v, want the folder under the root", meta.Containers)
+	}
+
+	var fault *soap.SOAPFaultError
+	if _, _, err := browse(t, srv, "../etc", "BrowseDirectChildren", 0, 0); !errors.As(err, &fault) || !strings.Contains(string(fault.Detail.Raw), "<errorCode>701</errorCode>") {
+		t.Errorf("Browse() of an unknown object error = %v, want UPnP error 701", err)
+	}
+}
+
+func TestServeMedia(t *testing.T) {
+	srv := newTestServer(t, media.Renderer{}, nil, "film.mp4", "notes.txt")
+
+	resp, err := http.Get(srv.URL + "/media/film.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "bytes" || resp.Header.Get("contentFeatures.dlna.org") == "" {
+		t.Errorf("GET file = %d with headers %v, want 200 with DLNA headers and ranges", resp.StatusCode, resp.Header)
+	}
+
+	resp, err = http.Get(srv.URL + "/media/notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET non-media file = %d, want 404: only what Browse lists is served", resp.StatusCode)
+	}
+}
@@ -0,0 +1,120 @@
+package mediaserver
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// maxSOAPBody bounds a control request. Every action castor answers takes a
+// handful of short arguments.
+const maxSOAPBody = 64 << 10
+
+// soapArg is one named argument of an action response. Responses are written in
+// the order the service description declares them, which strict control points
+// check, so they are a list rather than a map.
+type soapArg struct{ name, value string }
+
+// action answers one SOAP action from its in arguments.
+type action func(r *http.Request, args map[string]string) ([]soapArg, error)
+
+// upnpError is a UPnP control error, reported to the control point as a SOAP
+// fault carrying the code.
+type upnpError struct {
+	code int
+	desc string
+}
+
+func (e *upnpError) Error() string { return fmt.Sprintf("UPnP error %d: %s", e.code, e.desc) }
+
+var (
+	errInvalidAction   = &upnpError{401, "Invalid Action"}
+	errInvalidArgs     = &upnpError{402, "Invalid Args"}
+	errActionFailed    = &upnpError{501, "Action Failed"}
+	errNoSuchObjectID  = &upnpError{701, "No such object"}
+	errNoSuchContainer = &upnpError{710, "No such container"}
+)
+
+// soapRequest is the part of a control request an action reads: its name, from
+// the Body's single child element, and its arguments, that element's children.
+type soapRequest struct {
+	Body struct {
+		Action struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// controlHandler serves a service's control URL, dispatching each SOAP request
+// to the action it names.
+func controlHandler(serviceType string, actions map[string]action) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req soapRequest
+		if err := xml.NewDecoder(io.LimitReader(r.Body, maxSOAPBody)).Decode(&req); err != nil {
+			writeFault(w, errInvalidArgs)
+			return
+		}
+		name := req.Body.Action.XMLName.Local
+		act, ok := actions[name]
+		if !ok {
+			slog.DebugContext(r.Context(), "unsupported UPnP action", "service", serviceType, "action", name, "from", r.RemoteAddr)
+			writeFault(w, errInvalidAction)
+			return
+		}
+		args := make(map[string]string, len(req.Body.Action.Args))
+		for _, a := range req.Body.Action.Args {
+			args[a.XMLName.Local] = a.Value
+		}
+
+		out, err := act(r, args)
+		if err != nil {
+			var ue *upnpError
+			if !errors.As(err, &ue) {
+				slog.WarnContext(r.Context(), "UPnP action failed", "action", name, "from", r.RemoteAddr, "error", err)
+				ue = errActionFailed
+			}
+			writeFault(w, ue)
+			return
+		}
+		writeEnvelope(w, http.StatusOK, fmt.Sprintf("<u:%[1]sResponse xmlns:u=%[2]q>%[3]s</u:%[1]sResponse>",
+			name, serviceType, encodeArgs(out)))
+	}
+}
+
+func encodeArgs(args []soapArg) string {
+	var b strings.Builder
+	for _, a := range args {
+		b.WriteString("<" + a.name + ">")
+		_ = xml.EscapeText(&b, []byte(a.value))
+		b.WriteString("</" + a.name + ">")
+	}
+	return b.String()
+}
+
+func writeFault(w http.ResponseWriter, e *upnpError) {
+	writeEnvelope(w, http.StatusInternalServerError, fmt.Sprintf(
+		"<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>"+
+			`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode><errorDescription>%s</errorDescription></UPnPError>`+
+			"</detail></s:Fault>", e.code, e.desc))
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.Header().Set("EXT", "")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`+
+		body+"</s:Body></s:Envelope>")
+}
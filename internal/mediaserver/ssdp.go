@@ -0,0 +1,203 @@
+package mediaserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ssdpGroup is the SSDP multicast group and port every UPnP device and
+	// control point listens on.
+	ssdpGroup = "239.255.255.250:1900"
+
+	// ssdpMaxAge is how long a TV may trust an announcement. castor re-announces
+	// at half of it, so a TV that heard one never expires it while castor runs.
+	ssdpMaxAge = 30 * time.Minute
+
+	// maxSearchDelay caps how long castor waits before answering an M-SEARCH.
+	// UPnP has a device spread its answer over the search's MX seconds to spare
+	// the asker a burst; one device answering five times is no burst, and a TV's
+	// source menu is waiting on it.
+	maxSearchDelay = time.Second
+)
+
+// advertiser announces the media server over SSDP: NOTIFY alive on start and
+// periodically, byebye on shutdown, and an answer to every M-SEARCH it matches.
+type advertiser struct {
+	udn      string
+	location string
+	server   string
+}
+
+func newAdvertiser(udn, location, version string) advertiser {
+	return advertiser{
+		udn:      udn,
+		location: location,
+		server:   fmt.Sprintf("%s/%s UPnP/1.0 castor/%s", runtime.GOOS, runtime.GOARCH, version),
+	}
+}
+
+// targets are the notification types castor advertises: the root device, the
+// device itself by UDN and by type, and each of its services.
+func (a advertiser) targets() []string {
+	return []string{"upnp:rootdevice", a.udn, deviceType, contentDirectoryType, connectionManagerType}
+}
+
+// usn is the unique service name castor advertises target under.
+func (a advertiser) usn(target string) string {
+	if target == a.udn {
+		return a.udn
+	}
+	return a.udn + "::" + target
+}
+
+// notify renders a NOTIFY of kind ("ssdp:alive" or "ssdp:byebye") for target.
+func (a advertiser) notify(target, kind string) []byte {
+	lines := []string{"NOTIFY * HTTP/1.1", "HOST: " + ssdpGroup, "NT: " + target, "NTS: " + kind, "USN: " + a.usn(target)}
+	if kind == "ssdp:alive" {
+		lines = append(lines,
+			"CACHE-CONTROL: max-age="+strconv.Itoa(int(ssdpMaxAge.Seconds())),
+			"LOCATION: "+a.location,
+			"SERVER: "+a.server,
+		)
+	}
+	return []byte(strings.Join(append(lines, "", ""), "\r\n"))
+}
+
+// searchResponses renders castor's answers to an M-SEARCH for st: one per
+// matching target, every target for ssdp:all, none when castor is not what was
+// searched for.
+func (a advertiser) searchResponses(st string) [][]byte {
+	var matched []string
+	if st == "ssdp:all" {
+		matched = a.targets()
+	} else {
+		for _, t := range a.targets() {
+			if t == st {
+				matched = append(matched, t)
+			}
+		}
+	}
+	responses := make([][]byte, len(matched))
+	for i, t := range matched {
+		responses[i] = []byte(strings.Join([]string{
+			"HTTP/1.1 200 OK",
+			"CACHE-CONTROL: max-age=" + strconv.Itoa(int(ssdpMaxAge.Seconds())),
+			"EXT:",
+			"LOCATION: " + a.location,
+			"SERVER: " + a.server,
+			"ST: " + t,
+			"USN: " + a.usn(t),
+			"", "",
+		}, "\r\n"))
+	}
+	return responses
+}
+
+// run advertises until ctx is done, then says byebye. It listens for searches
+// on the SSDP group, on iface when one is named, and sends from localIP, the
+// address the LOCATION names, so a multi-homed host announces on the network
+// TVs reach it on.
+func (a advertiser) run(ctx context.Context, iface, localIP string) error {
+	group, err := net.ResolveUDPAddr("udp4", ssdpGroup)
+	if err != nil {
+		return err
+	}
+	var ifi *net.Interface
+	if iface != "" {
+		if ifi, err = net.InterfaceByName(iface); err != nil {
+			return fmt.Errorf("finding interface %s: %w", iface, err)
+		}
+	}
+	listen, err := net.ListenMulticastUDP("udp4", ifi, group)
+	if err != nil {
+		return fmt.Errorf("joining the SSDP group: %w", err)
+	}
+	defer listen.Close()
+	send, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP(localIP)})
+	if err != nil {
+		return fmt.Errorf("opening the SSDP send socket: %w", err)
+	}
+	defer send.Close()
+
+	announce := func(kind string) {
+		for _, t := range a.targets() {
+			if _, err := send.WriteTo(a.notify(t, kind), group); err != nil {
+				slog.DebugContext(ctx, "SSDP notify failed", "nts", kind, "error", err)
+			}
+		}
+	}
+
+	go a.answer(ctx, listen, send)
+	// Announce twice: SSDP is UDP, and one lost datagram would keep a TV
+	// from seeing castor until its next search.
+	announce("ssdp:alive")
+	announce("ssdp:alive")
+	tick := time.NewTicker(ssdpMaxAge / 2)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			announce("ssdp:byebye")
+			return nil
+		case <-tick.C:
+			announce("ssdp:alive")
+		}
+	}
+}
+
+// answer reads M-SEARCH requests off the group until listen is closed, replying
+// to each from send after a short random delay.
+func (a advertiser) answer(ctx context.Context, listen, send *net.UDPConn) {
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := listen.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		st, mx, ok := parseSearch(buf[:n])
+		if !ok {
+			continue
+		}
+		responses := a.searchResponses(st)
+		if len(responses) == 0 {
+			continue
+		}
+		slog.DebugContext(ctx, "answering SSDP search", "from", from.String(), "st", st)
+		delay := rand.N(min(time.Duration(mx)*time.Second, maxSearchDelay) + 1)
+		time.AfterFunc(delay, func() {
+			for _, r := range responses {
+				_, _ = send.WriteToUDP(r, from)
+			}
+		})
+	}
+}
+
+// parseSearch reads an SSDP datagram as an M-SEARCH, returning its search
+// target and MX. ok is false for anything else, including the NOTIFYs every
+// device on the network multicasts.
+func parseSearch(datagram []byte) (st string, mx int, ok bool) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(datagram)))
+	if err != nil || req.Method != "M-SEARCH" || req.Header.Get("MAN") != `"ssdp:discover"` {
+		return "", 0, false
+	}
+	st = req.Header.Get("ST")
+	if st == "" {
+		return "", 0, false
+	}
+	mx, err = strconv.Atoi(req.Header.Get("MX"))
+	if err != nil || mx < 0 {
+		mx = 1
+	}
+	return st, mx, true
+}
@@ -0,0 +1,80 @@
+package mediaserver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearchResponses(t *testing.T) {
+	a := newAdvertiser("uuid:1234", "http://192.168.1.2:8200/description.xml", "test")
+
+	tests := []struct {
+		st   string
+		usns []string
+	}{
+		{st: "ssdp:all", usns: []string{
+			"uuid:1234::upnp:rootdevice", "uuid:1234", "uuid:1234::" + deviceType,
+			"uuid:1234::" + contentDirectoryType, "uuid:1234::" + connectionManagerType,
+		}},
+		{st: deviceType, usns: []string{"uuid:1234::" + deviceType}},
+		{st: "uuid:1234", usns: []string{"uuid:1234"}},
+		{st: "urn:schemas-upnp-org:device:MediaRenderer:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.st, func(t *testing.T) {
+			got := a.searchResponses(tt.st)
+			if len(got) != len(tt.usns) {
+				t.Fatalf("%d responses, want %d", len(got), len(tt.usns))
+			}
+			for i, r := range got {
+				s := string(r)
+				if !strings.HasPrefix(s, "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(s, "\r\n\r\n") {
+					t.Errorf("response %d is not a complete SSDP response:\n%s", i, s)
+				}
+				if !strings.Contains(s, "\r\nUSN: "+tt.usns[i]+"\r\n") {
+					t.Errorf("response %d lacks USN %s:\n%s", i, tt.usns[i], s)
+				}
+				if !strings.Contains(s, "\r\nLOCATION: http://192.168.1.2:8200/description.xml\r\n") {
+					t.Errorf("response %d lacks the LOCATION:\n%s", i, s)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		datagram string
+		st       string
+		mx       int
+		ok       bool
+	}{
+		{
+			name:     "search",
+			datagram: "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 3\r\nST: ssdp:all\r\n\r\n",
+			st:       "ssdp:all", mx: 3, ok: true,
+		},
+		{
+			name:     "no MX",
+			datagram: "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nST: upnp:rootdevice\r\n\r\n",
+			st:       "upnp:rootdevice", mx: 1, ok: true,
+		},
+		{
+			name:     "another device's notify",
+			datagram: "NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nNT: upnp:rootdevice\r\nNTS: ssdp:alive\r\n\r\n",
+		},
+		{
+			name:     "no MAN",
+			datagram: "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nST: ssdp:all\r\n\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, mx, ok := parseSearch([]byte(tt.datagram))
+			if st != tt.st || mx != tt.mx || ok != tt.ok {
+				t.Errorf("parseSearch() = %q, %d, %v; want %q, %d, %v", st, mx, ok, tt.st, tt.mx, tt.ok)
+			}
+		})
+	}
+}
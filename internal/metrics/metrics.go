@@ -0,0 +1,214 @@
+// Package metrics exposes castor's runtime counters in the Prometheus text
+// format: upstream pull throughput and reconnects, the spool, the encoder's
+// speed, the transcriber's lead, delivery clients, and per-stage failures.
+//
+// The metrics are process-wide values the pipeline updates unconditionally, so
+// a cast nobody scrapes pays a few atomic adds. The handful castor needs do not
+// justify the Prometheus client library: the exposition format is a few lines
+// of text, written here.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/stupside/castor/internal/event"
+)
+
+var (
+	PullBytes = newCounter("castor_pull_bytes_total",
+		"Bytes the upstream pull has written to the spool.")
+	PullRate = newGauge("castor_pull_rate_bytes_per_second",
+		"Upstream pull rate over the last sampling interval; 0 while a CDN stalls.")
+	Reconnects = newCounter("castor_upstream_reconnects_total",
+		"Times an upstream read was reconnected by ffmpeg after a drop, timeout, or 429.")
+	SpoolBytes = newGauge("castor_spool_bytes",
+		"Bytes held in the input spools of running casts.")
+	EncoderSpeed = newGauge("castor_encoder_speed",
+		"The encoder's speed as a multiple of realtime, from its latest -progress report.")
+	WhisperLead = newGauge("castor_whisper_lead_seconds",
+		"How far the transcriber is ahead of the encoder, in media seconds.")
+	Clients = newGaugeVec("castor_delivery_clients",
+		"Renderer requests being served, per delivery server.", "server", "replay", "hls", "file")
+	Requests = newCounterVec("castor_delivery_requests_total",
+		"Renderer requests received, per delivery server.", "server", "replay", "hls", "file")
+	StageFailures = newCounterVec("castor_stage_failures_total",
+		"Stage failures. Every stage but transcribe and subtitles ends the cast; a failed transcription or subtitle read only stops the subtitles.", "stage",
+		"extract", "resolve", "connect", "pull", "gate", "transcribe", "subtitles", "serve")
+)
+
+// Fail records a failure of stage, counting it and reporting it on the event
+// stream, and returns err unchanged, so a stage's error return can be wrapped in
+// place. A nil error, or one that is only the fallout of ctx ending (an
+// interrupt, or another stage having failed first), is not a failure of this
+// stage and is not recorded.
+func Fail(ctx context.Context, stage string, err error) error {
+	if err != nil && ctx.Err() == nil {
+		StageFailures.Inc(stage)
+		event.Emit(ctx, event.Error, event.ErrorData{Stage: stage, Message: err.Error()})
+	}
+	return err
+}
+
+// metric is one registered family, written in registration order.
+type metric interface {
+	write(w io.Writer)
+}
+
+var registry []metric
+
+func header(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	name, help string
+	v          atomic.Uint64
+}
+
+func newCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	registry = append(registry, c)
+	return c
+}
+
+func (c *Counter) Add(n int64) {
+	if n > 0 {
+		c.v.Add(uint64(n))
+	}
+}
+
+func (c *Counter) Inc() { c.v.Add(1) }
+
+func (c *Counter) write(w io.Writer) {
+	header(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.v.Load())
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	name, help string
+	bits       atomic.Uint64
+}
+
+func newGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	registry = append(registry, g)
+	return g
+}
+
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (g *Gauge) value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+func (g *Gauge) write(w io.Writer) {
+	header(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.value()))
+}
+
+// vec holds one series per value of a single label. The values named at
+// construction are exported from the start at zero, so a rate or increase over
+// them is defined before the first event.
+type vec[T any] struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	series map[string]*T
+}
+
+func (v *vec[T]) get(value string) *T {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[value]
+	if !ok {
+		s = new(T)
+		v.series[value] = s
+	}
+	return s
+}
+
+func (v *vec[T]) each(fn func(value string, s *T)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, value := range slices.Sorted(maps.Keys(v.series)) {
+		fn(value, v.series[value])
+	}
+}
+
+func (v *vec[T]) init(name, help, label string, values []string) {
+	v.name, v.help, v.label = name, help, label
+	v.series = make(map[string]*T, len(values))
+	for _, value := range values {
+		v.series[value] = new(T)
+	}
+}
+
+// CounterVec is a Counter per label value.
+type CounterVec struct {
+	vec[atomic.Uint64]
+}
+
+func newCounterVec(name, help, label string, values ...string) *CounterVec {
+	c := &CounterVec{}
+	c.init(name, help, label, values)
+	registry = append(registry, c)
+	return c
+}
+
+func (c *CounterVec) Inc(value string) { c.get(value).Add(1) }
+
+func (c *CounterVec) write(w io.Writer) {
+	header(w, c.name, c.help, "counter")
+	c.each(func(value string, s *atomic.Uint64) {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", c.name, c.label, value, s.Load())
+	})
+}
+
+// GaugeVec is a Gauge per label value.
+type GaugeVec struct {
+	vec[Gauge]
+}
+
+func newGaugeVec(name, help, label string, values ...string) *GaugeVec {
+	g := &GaugeVec{}
+	g.init(name, help, label, values)
+	registry = append(registry, g)
+	return g
+}
+
+func (g *GaugeVec) Add(value string, delta float64) { g.get(value).Add(delta) }
+
+func (g *GaugeVec) write(w io.Writer) {
+	header(w, g.name, g.help, "gauge")
+	g.each(func(value string, s *Gauge) {
+		fmt.Fprintf(w, "%s{%s=%q} %s\n", g.name, g.label, value, formatFloat(s.value()))
+	})
+}
+
+// Write renders every metric in the Prometheus text exposition format.
+func Write(w io.Writer) {
+	for _, m := range registry {
+		m.write(w)
+	}
+}
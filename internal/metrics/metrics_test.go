@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	c := &Counter{name: "t_total", help: "A test counter."}
+	c.Add(3)
+	c.Add(-1) // a counter never goes down
+	c.Inc()
+
+	g := &Gauge{name: "t_gauge", help: "A test gauge."}
+	g.Set(1.5)
+	g.Add(-2)
+
+	v := &GaugeVec{}
+	v.init("t_clients", "Per server.", "server", []string{"replay", "hls"})
+	v.Add("replay", 1)
+
+	var b strings.Builder
+	for _, m := range []metric{c, g, v} {
+		m.write(&b)
+	}
+	want := `# HELP t_total A test counter.
+# TYPE t_total counter
+t_total 4
+# HELP t_gauge A test gauge.
+# TYPE t_gauge gauge
+t_gauge -0.5
+# HELP t_clients Per server.
+# TYPE t_clients gauge
+t_clients{server="hls"} 0
+t_clients{server="replay"} 1
+`
+	if b.String() != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestFailSkipsCancellation(t *testing.T) {
+	before := StageFailures.get("connect").Load()
+
+	_ = Fail(t.Context(), "connect", nil)
+	_ = Fail(t.Context(), "connect", errors.New("refused"))
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_ = Fail(ctx, "connect", context.Canceled)
+
+	if got := StageFailures.get("connect").Load() - before; got != 1 {
+		t.Errorf("counted %d failures, want 1: nil and cancellation fallout are not failures", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, name := range []string{"castor_pull_bytes_total", "castor_stage_failures_total{stage=\"pull\"}", "castor_stage_failures_total{stage=\"subtitles\"}", "castor_encoder_speed"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("exposition lacks %s", name)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Config is the metrics section.
+type Config struct {
+	Enable bool `yaml:"enable"`
+	// Address is the host:port /metrics is served on. Metrics are read-only and
+	// carry no media URLs, so unlike the control API any address is allowed:
+	// a Prometheus on another machine needs a reachable one.
+	Address string `yaml:"address"`
+}
+
+// Server is the running /metrics endpoint.
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// New starts serving /metrics on cfg.Address.
+func New(cfg Config) (*Server, error) {
+	ln, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("binding metrics endpoint: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler())
+	s := &Server{
+		listener: ln,
+		server:   &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second},
+	}
+	go func() { _ = s.server.Serve(ln) }()
+	return s, nil
+}
+
+// Addr is the address the endpoint is listening on.
+func (s *Server) Addr() net.Addr { return s.listener.Addr() }
+
+// Close stops the endpoint.
+func (s *Server) Close() error { return s.server.Close() }
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
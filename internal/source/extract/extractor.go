@@ -9,6 +9,7 @@ package extract
 import (
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -16,7 +17,9 @@ import (
 	"slices"
 	"sync"
 
+	"github.com/stupside/castor/internal/event"
 	"github.com/stupside/castor/internal/media"
+	"github.com/stupside/castor/internal/metrics"
 )
 
 // Extractor captures video stream URLs from a page using headless Chrome.
@@ -26,6 +29,9 @@ type Extractor struct {
 	capture  CaptureConfig
 	actions  ActionConfig
 	patterns []*regexp.Regexp
+
+	// warm, when set by Warm, is the shared browser extractions open tabs in.
+	warm *warmBrowser
 }
 
 func New(cfg Config) (*Extractor, error) {
@@ -85,6 +91,8 @@ func (e *Extractor) extract(ctx context.Context, targetURL string) ([]*media.Str
 	return streams, nil
 }
 
+var errNoStreams = errors.New("no streams extracted")
+
 // ExtractAll runs Extract concurrently on all given URLs (bounded by the
 // extractor's MaxConcurrency) and returns deduplicated streams.
 func (e *Extractor) ExtractAll(ctx context.Context, urls []string) ([]*media.Stream, error) {
@@ -100,12 +108,15 @@ func (e *Extractor) ExtractAll(ctx context.Context, urls []string) ([]*media.Str
 			defer func() { <-sem }()
 
 			slog.DebugContext(ctx, "extracting", "url", targetURL, "index", i+1, "total", len(urls))
+			event.Emit(ctx, event.ExtractStarted, event.ExtractData{URL: targetURL})
 
 			streams, err := e.extract(ctx, targetURL)
 			if err != nil {
 				slog.WarnContext(ctx, "extraction failed", "url", targetURL, "error", err)
+				event.Emit(ctx, event.ExtractFinished, event.ExtractData{URL: targetURL, Error: err.Error()})
 				return
 			}
+			event.Emit(ctx, event.ExtractFinished, event.ExtractData{URL: targetURL, Streams: len(streams)})
 
 			results[i] = streams
 			slog.DebugContext(ctx, "extracted", "url", targetURL, "count", len(streams))
@@ -120,6 +131,11 @@ func (e *Extractor) ExtractAll(ctx context.Context, urls []string) ([]*media.Str
 
 	deduped := deduplicateStreams(allStreams)
 	slog.InfoContext(ctx, "extraction complete", "urls", len(urls), "streams", len(deduped))
+	// Every page failing or yielding nothing is what fails a cast here; the
+	// error itself surfaces later, when there is nothing to rank.
+	if len(deduped) == 0 {
+		_ = metrics.Fail(ctx, "extract", errNoStreams)
+	}
 	return deduped, nil
 }
 
@@ -28,18 +28,35 @@ type session struct {
 	centerX     float64
 	centerY     float64
 	snapshotDir string
+	// warm marks a tab in the Extractor's shared browser: closing it must not
+	// wait for a Chrome that is meant to outlive it.
+	warm bool
 }
 
 // newSession creates a browser session: allocator, stealth injection,
 // navigation, and event listeners. It returns a ready-to-use Session.
 func newSession(ctx context.Context, e *Extractor, targetURL string) (*session, error) {
-	profile := NewProfile()
-
-	opts := allocatorOpts(e.browser, profile)
-
-	allocCtx, allocCancel := chromedp.NewExecAllocator(ctx, opts...)
-
-	taskCtx, taskCancel := chromedp.NewContext(allocCtx)
+	var (
+		profile     *Profile
+		taskCtx     context.Context
+		taskCancel  context.CancelFunc
+		allocCancel context.CancelFunc
+	)
+	if e.warm != nil {
+		// A tab in its own incognito browser context on the shared browser. The
+		// tab hangs off the browser, not ctx, so ctx's cancellation is forwarded
+		// to it explicitly.
+		profile = e.warm.profile
+		tabCtx, tabCancel := chromedp.NewContext(e.warm.ctx, chromedp.WithNewBrowserContext())
+		stop := context.AfterFunc(ctx, tabCancel)
+		taskCtx, taskCancel = tabCtx, func() { stop(); tabCancel() }
+		allocCancel = func() {}
+	} else {
+		profile = NewProfile()
+		var allocCtx context.Context
+		allocCtx, allocCancel = chromedp.NewExecAllocator(ctx, allocatorOpts(e.browser, profile)...)
+		taskCtx, taskCancel = chromedp.NewContext(allocCtx)
+	}
 
 	collector := newCollector(taskCtx, e.patterns, e.capture.MaxCandidates)
 
@@ -87,6 +104,7 @@ func newSession(ctx context.Context, e *Extractor, targetURL string) (*session,
 		centerX:     profile.CenterX,
 		centerY:     profile.CenterY,
 		snapshotDir: snapDir,
+		warm:        e.warm != nil,
 	}, nil
 }
 
@@ -126,6 +144,9 @@ func (s *session) Close() {
 	// process and reaps it in a background goroutine (see ExecAllocator).
 	s.cancel()
 	s.allocCancel()
+	if s.warm {
+		return
+	}
 
 	// Block until that goroutine has actually reaped the process. Without this
 	// wait, an abrupt exit — e.g. Ctrl-C mid-extraction, when main returns as
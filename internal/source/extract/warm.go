@@ -0,0 +1,60 @@
+// Castor is a proof of concept provided for lawful, personal, and educational
+// use. This file is part of its stream-extraction pipeline and is intended only
+// for accessing content you are authorized to view. Do not use it to infringe
+// copyright or to circumvent access controls. The author does not endorse or
+// condone piracy. See the "Purpose and disclaimer" section of the README.
+
+package extract
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/chromedp/chromedp"
+)
+
+// warmBrowser is one long-lived Chrome every extraction opens a tab in. Its
+// fingerprint profile is fixed for the browser's lifetime: the user agent and
+// window size are process flags, and the per-tab stealth script must agree with
+// them.
+type warmBrowser struct {
+	ctx         context.Context // the browser's first tab; extraction tabs are its children
+	cancel      context.CancelFunc
+	allocCancel context.CancelFunc
+	profile     *Profile
+}
+
+// Warm starts a browser that later extractions reuse instead of launching (and
+// tearing down) one Chrome per attempt, which is most of an extraction's fixed
+// cost. Each extraction still gets a fresh incognito browser context, so no
+// cookies or storage carry from one page to the next. It is meant for a
+// long-running process; release the browser with Close. The browser outlives
+// ctx's cancellation but keeps its values.
+func (e *Extractor) Warm(ctx context.Context) error {
+	profile := NewProfile()
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.WithoutCancel(ctx), allocatorOpts(e.browser, profile)...)
+	browserCtx, cancel := chromedp.NewContext(allocCtx)
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancel()
+		allocCancel()
+		return fmt.Errorf("starting browser: %w", err)
+	}
+	e.warm = &warmBrowser{ctx: browserCtx, cancel: cancel, allocCancel: allocCancel, profile: profile}
+	slog.InfoContext(ctx, "browser warm", "user_agent", profile.UserAgent)
+	return nil
+}
+
+// Close releases the warm browser, if any, and waits for Chrome to be reaped
+// (see session.Close for why the wait matters).
+func (e *Extractor) Close() {
+	if e.warm == nil {
+		return
+	}
+	e.warm.cancel()
+	e.warm.allocCancel()
+	if c := chromedp.FromContext(e.warm.ctx); c != nil && c.Allocator != nil {
+		c.Allocator.Wait()
+	}
+	e.warm = nil
+}
@@ -13,4 +13,19 @@ type Config struct {
 	// scales its output down to it. Set it to your renderer's native height
 	// (e.g. 2160 for a 4K TV). Required, so it is always an explicit ceiling.
 	MaxHeight int `yaml:"max_height" validate:"required,min=1"`
+
+	// AudioLanguages are the languages to play a source's audio in, most
+	// preferred first, as ISO 639 codes or BCP 47 tags ("en", "fre", "pt-BR").
+	// Resolution picks the HLS audio rendition, or the audio track of a
+	// multi-track file, in the earliest of them the source has, and keeps the
+	// source's default (with a warning) when it has none. Empty plays the
+	// default, which for many sources is a dub rather than the original.
+	AudioLanguages []string `yaml:"audio_languages" validate:"dive,required"`
+
+	// SubtitleLanguages are the languages to show a source's own subtitles in,
+	// most preferred first, written as AudioLanguages are. Resolution picks the
+	// HLS subtitle rendition, or the text subtitle track of a multi-track file,
+	// in the earliest of them the source has; a cast that has one shows it in
+	// place of a whisper transcript. Empty shows none of the source's own.
+	SubtitleLanguages []string `yaml:"subtitle_languages" validate:"dive,required"`
 }
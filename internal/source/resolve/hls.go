@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/grafov/m3u8"
+
+	"github.com/stupside/castor/internal/media"
 )
 
 // hlsVariant is a single variant stream listed in an HLS master playlist.
@@ -27,6 +29,10 @@ type hlsVariant struct {
 	// so the variant alone is video and silence.
 	AudioGroup string
 
+	// SubtitleGroup is the GROUP-ID of the subtitle renditions the variant can
+	// be shown with (see hlsMaster.Subtitles), empty when it names none.
+	SubtitleGroup string
+
 	// HasVideo reports whether the variant carries video. A master may list an
 	// audio-only rendition as a variant of its own, which must never be picked
 	// as the thing to cast.
@@ -34,16 +40,20 @@ type hlsVariant struct {
 }
 
 // hlsMaster is a parsed HLS document reduced to what selection needs: the
-// variants to choose between and the audio renditions they reference. A media
+// variants to choose between and the audio and subtitle renditions they
+// reference. A media
 // playlist reduces to a single synthetic variant, so callers treat both shapes
 // uniformly.
 type hlsMaster struct {
 	Variants []hlsVariant
 
-	// Audio maps an audio GROUP-ID to the rendition to play from it. Only groups
-	// whose rendition has its own URI appear: a rendition without one is carried
-	// inside the variant's segments and needs no separate read.
-	Audio map[string]*url.URL
+	// Audio maps an audio GROUP-ID to the renditions it offers, in the order
+	// the master lists them: one per language or mix (a dub, a commentary).
+	Audio map[string][]hlsRendition
+
+	// Subtitles maps a subtitle GROUP-ID to the renditions it offers, in the
+	// order the master lists them: one per language, WebVTT playlists each.
+	Subtitles map[string][]hlsRendition
 
 	// Live reports that the document is a media playlist with no
 	// #EXT-X-ENDLIST, i.e. a live edge. It is always false for a master
@@ -52,9 +62,73 @@ type hlsMaster struct {
 	Live bool
 }
 
-// AudioFor returns the rendition URL a variant reads its audio from, or nil when
-// the variant's own segments carry it.
-func (m hlsMaster) AudioFor(v hlsVariant) *url.URL { return m.Audio[v.AudioGroup] }
+// hlsRendition is one audio or subtitle rendition of a group.
+type hlsRendition struct {
+	// URL is where the rendition is read from, nil when it has no URI of its
+	// own: it is then carried inside the variant's segments and needs no
+	// separate read. A subtitle rendition always has one.
+	URL *url.URL
+
+	Language string // the LANGUAGE attribute, a BCP 47 tag; "" when the master omits it
+	Name     string // the NAME attribute, what a player's track menu shows
+	Default  bool
+}
+
+// AudioFor returns the rendition a variant plays its audio from, the zero
+// rendition when the variant names no group. Of its group, that is the first
+// rendition in the language of langs a viewer prefers most (see
+// media.PreferredLanguage), and matched reports one was; failing that, it is
+// the DEFAULT=YES rendition, the one a player picks with no preference of its
+// own, else the first listed. A source commonly lists a dub before the
+// original, so the default is not simply the first.
+func (m hlsMaster) AudioFor(v hlsVariant, langs []string) (r hlsRendition, matched bool) {
+	group := m.Audio[v.AudioGroup]
+	if len(group) == 0 {
+		return hlsRendition{}, false
+	}
+	if i, ok := media.PreferredLanguage(langs, m.AudioLanguages(v)); ok {
+		return group[i], true
+	}
+	if i := slices.IndexFunc(group, func(r hlsRendition) bool { return r.Default }); i >= 0 {
+		return group[i], false
+	}
+	return group[0], false
+}
+
+// AudioLanguages lists the LANGUAGE of each audio rendition a variant can play,
+// in the master's order, "" for one that names none.
+func (m hlsMaster) AudioLanguages(v hlsVariant) []string {
+	return renditionLanguages(m.Audio[v.AudioGroup])
+}
+
+// SubtitlesFor returns the subtitle rendition a variant is shown with: the
+// first of its group in the language of langs a viewer prefers most. ok is
+// false when the group has none in any of them. Unlike audio there is no
+// fallback to the DEFAULT rendition: a variant plays fine with no subtitles,
+// and ones in a language the viewer did not ask for are no better.
+func (m hlsMaster) SubtitlesFor(v hlsVariant, langs []string) (r hlsRendition, ok bool) {
+	group := m.Subtitles[v.SubtitleGroup]
+	i, ok := media.PreferredLanguage(langs, renditionLanguages(group))
+	if !ok {
+		return hlsRendition{}, false
+	}
+	return group[i], true
+}
+
+// SubtitleLanguages lists the LANGUAGE of each subtitle rendition a variant
+// can be shown with, in the master's order, "" for one that names none.
+func (m hlsMaster) SubtitleLanguages(v hlsVariant) []string {
+	return renditionLanguages(m.Subtitles[v.SubtitleGroup])
+}
+
+// renditionLanguages lists the LANGUAGE of each rendition of a group.
+func renditionLanguages(group []hlsRendition) []string {
+	langs := make([]string, len(group))
+	for i, r := range group {
+		langs[i] = r.Language
+	}
+	return langs
+}
 
 // fetchPlaylist fetches an HLS playlist and returns its body.
 func fetchPlaylist(ctx context.Context, hlsTimeout time.Duration, url *url.URL, headers http.Header) (string, error) {
@@ -83,7 +157,8 @@ func fetchPlaylist(ctx context.Context, hlsTimeout time.Duration, url *url.URL,
 }
 
 // parsePlaylist decodes an HLS document into the variants it offers and the
-// audio renditions they reference, resolving every URI against baseURL.
+// audio and subtitle renditions they reference, resolving every URI against
+// baseURL.
 //
 // The document is decoded by m3u8, not by us: the tag grammar is a spec surface
 // (quoted attribute values carrying the same comma that separates attributes,
@@ -92,7 +167,8 @@ func fetchPlaylist(ctx context.Context, hlsTimeout time.Duration, url *url.URL,
 // subtly wrong in ways that surface as a cast with no sound. Decoding is
 // non-strict so a real-world playlist with an unknown tag still parses. What
 // stays here is only the part that is castor's policy rather than the format's:
-// which variants are castable, and which rendition their audio comes from.
+// which variants are castable, and which renditions their audio and subtitles
+// come from.
 func parsePlaylist(body string, baseURL *url.URL) (hlsMaster, error) {
 	playlist, _, err := m3u8.DecodeFrom(strings.NewReader(body), false)
 	if err != nil {
@@ -112,7 +188,7 @@ func parsePlaylist(body string, baseURL *url.URL) (hlsMaster, error) {
 }
 
 // masterFrom reduces a decoded master to the variants castor can cast and the
-// audio renditions they reference.
+// audio and subtitle renditions they reference.
 func masterFrom(playlist *m3u8.MasterPlaylist, baseURL *url.URL) hlsMaster {
 	var out hlsMaster
 	for _, variant := range playlist.Variants {
@@ -130,11 +206,12 @@ func masterFrom(playlist *m3u8.MasterPlaylist, baseURL *url.URL) hlsMaster {
 		}
 
 		out.Variants = append(out.Variants, hlsVariant{
-			URL:        variantURL,
-			Bandwidth:  int64(variant.Bandwidth),
-			Height:     resolutionHeight(variant.Resolution),
-			AudioGroup: variant.Audio,
-			HasVideo:   carriesVideo(variant),
+			URL:           variantURL,
+			Bandwidth:     int64(variant.Bandwidth),
+			Height:        resolutionHeight(variant.Resolution),
+			AudioGroup:    variant.Audio,
+			SubtitleGroup: variant.Subtitles,
+			HasVideo:      carriesVideo(variant),
 		})
 
 		// Renditions are attached to the variant that follows them, so a master
@@ -148,25 +225,54 @@ func masterFrom(playlist *m3u8.MasterPlaylist, baseURL *url.URL) hlsMaster {
 	return out
 }
 
-// addRendition records an audio rendition that has a URI of its own. One without
-// a URI is muxed into the variants that reference it, so there is nothing extra
-// to read. Within a group, DEFAULT=YES wins over the first seen, which is the
-// rendition a player picks with no preference of its own.
+// addRendition records an audio or subtitle rendition in its group. An audio
+// rendition without a URI is muxed into the variants that reference it, so
+// choosing it means there is nothing extra to read; a subtitle rendition
+// without one has nothing to read at all (closed captions ride in the video
+// and are a type of their own, which castor does not read). A rendition the
+// decoder hung off more than one variant is recorded once.
 func (m *hlsMaster) addRendition(alternative *m3u8.Alternative, baseURL *url.URL) {
-	if alternative == nil || alternative.Type != "AUDIO" || alternative.GroupId == "" || alternative.URI == "" {
+	if alternative == nil || alternative.GroupId == "" {
 		return
 	}
-	renditionURL, err := baseURL.Parse(alternative.URI)
-	if err != nil {
+	var groups *map[string][]hlsRendition
+	switch alternative.Type {
+	case "AUDIO":
+		groups = &m.Audio
+	case "SUBTITLES":
+		if alternative.URI == "" {
+			return
+		}
+		groups = &m.Subtitles
+	default:
 		return
 	}
-	if _, seen := m.Audio[alternative.GroupId]; seen && !alternative.Default {
+	r := hlsRendition{Language: alternative.Language, Name: alternative.Name, Default: alternative.Default}
+	if alternative.URI != "" {
+		renditionURL, err := baseURL.Parse(alternative.URI)
+		if err != nil {
+			return
+		}
+		r.URL = renditionURL
+	}
+	group := (*groups)[alternative.GroupId]
+	if slices.ContainsFunc(group, func(seen hlsRendition) bool {
+		return seen.Name == r.Name && seen.Language == r.Language && urlString(seen.URL) == urlString(r.URL)
+	}) {
 		return
 	}
-	if m.Audio == nil {
-		m.Audio = make(map[string]*url.URL)
+	if *groups == nil {
+		*groups = make(map[string][]hlsRendition)
+	}
+	(*groups)[alternative.GroupId] = append(group, r)
+}
+
+// urlString is u as a string, "" for nil.
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
 	}
-	m.Audio[alternative.GroupId] = renditionURL
+	return u.String()
 }
 
 // carriesVideo reports whether a variant has video to cast. Positive evidence is
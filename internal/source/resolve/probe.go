@@ -30,8 +30,9 @@ func probeStream(ctx context.Context, ffprobePath string, probeTimeout time.Dura
 		// duration separates a feature title from a spliced-in pre-roll ad;
 		// the per-stream codec/type/dimensions let us reject decoy playlists
 		// (image-only "video", no audio) that would crash the puller's
-		// stream mapping.
-		"-show_entries", "format=format_name,bit_rate,duration:stream=codec_type,codec_name,width,height",
+		// stream mapping; the audio and subtitle tracks' language tags are what
+		// a language preference picks between.
+		"-show_entries", "format=format_name,bit_rate,duration:stream=codec_type,codec_name,width,height:stream_tags=language",
 	}
 
 	// Forward any HTTP headers (e.g. Referer, User-Agent) to the stream server
@@ -58,6 +59,9 @@ func probeStream(ctx context.Context, ffprobePath string, probeTimeout time.Dura
 			Height    int    `json:"height"`
 			CodecName string `json:"codec_name"`
 			CodecType string `json:"codec_type"`
+			Tags      struct {
+				Language string `json:"language"`
+			} `json:"tags"`
 		} `json:"streams"`
 		Format struct {
 			BitRate    string `json:"bit_rate"`
@@ -107,6 +111,13 @@ func probeStream(ctx context.Context, ffprobePath string, probeTimeout time.Dura
 			}
 		case "audio":
 			info.HasAudio = true
+			info.AudioLanguages = append(info.AudioLanguages, s.Tags.Language)
+		case "subtitle":
+			lang := ""
+			if media.TextSubtitle(s.CodecName) {
+				lang = s.Tags.Language
+			}
+			info.SubtitleLanguages = append(info.SubtitleLanguages, lang)
 		}
 	}
 	return info, nil
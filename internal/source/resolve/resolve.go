@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/stupside/castor/internal/event"
 	"github.com/stupside/castor/internal/media"
 )
 
@@ -17,6 +18,31 @@ import (
 // bandwidth one no taller than cfg.MaxHeight. Only the fields resolution
 // establishes are rewritten; everything else is preserved.
 func Resolve(ctx context.Context, cfg Config, stream *media.Stream) (*media.Stream, error) {
+	return resolveVariant(ctx, cfg, stream, func(variants []hlsVariant) hlsVariant {
+		return pickVariant(variants, cfg.MaxHeight)
+	})
+}
+
+// Refresh resolves stream, extracted afresh for a cast already under way, to
+// the variant prev was resolved to: the one with the same bandwidth and height
+// in the new master. A master that no longer lists it is resolved as Resolve
+// would.
+func Refresh(ctx context.Context, cfg Config, stream, prev *media.Stream) (*media.Stream, error) {
+	return resolveVariant(ctx, cfg, stream, func(variants []hlsVariant) hlsVariant {
+		for _, v := range variants {
+			if v.Bandwidth == prev.Variant.Bandwidth && v.Height == prev.Variant.Height {
+				return v
+			}
+		}
+		slog.WarnContext(ctx, "refreshed playlist no longer lists the variant being cast, picking afresh",
+			"bandwidth", prev.Variant.Bandwidth, "height", prev.Variant.Height)
+		return pickVariant(variants, cfg.MaxHeight)
+	})
+}
+
+// resolveVariant is Resolve with the variant selection injected.
+func resolveVariant(ctx context.Context, cfg Config, stream *media.Stream, pick func([]hlsVariant) hlsVariant) (*media.Stream, error) {
+	var probed *media.StreamInfo
 	if stream.ContentType == "" {
 		info, err := probeStream(ctx, cfg.FFprobePath, cfg.ProbeTimeout, stream.URL, stream.Headers)
 		if err != nil {
@@ -24,31 +50,121 @@ func Resolve(ctx context.Context, cfg Config, stream *media.Stream) (*media.Stre
 		}
 		stream.ContentType = info.ContentType
 		stream.Live = info.Live()
+		probed = info
 	}
 
-	if stream.ContentType == media.HLS {
-		master, err := readPlaylist(ctx, cfg, stream)
-		if err != nil {
-			slog.WarnContext(ctx, "HLS playlist resolution failed, using original", "error", err)
+	if stream.ContentType != media.HLS {
+		pickTracks(ctx, cfg, stream, probed)
+		return stream, nil
+	}
+
+	master, err := readPlaylist(ctx, cfg, stream)
+	if err != nil {
+		slog.WarnContext(ctx, "HLS playlist resolution failed, using original", "error", err)
+		return stream, nil
+	}
+	variant := pick(master.Variants)
+	stream.URL = variant.URL
+	stream.Variant = media.Variant{Bandwidth: variant.Bandwidth, Height: variant.Height}
+	// A master that publishes audio as its own rendition leaves the chosen
+	// variant carrying video only. Narrowing to that variant and stopping
+	// there is how a cast ends up silent, or dies mapping an audio track
+	// that isn't there, so the rendition travels with it.
+	rendition, matched := master.AudioFor(variant, cfg.AudioLanguages)
+	stream.AudioURL = rendition.URL
+	if len(cfg.AudioLanguages) > 0 {
+		if matched {
+			slog.InfoContext(ctx, "playing the audio rendition in a preferred language",
+				"language", rendition.Language, "name", rendition.Name)
 		} else {
-			variant := pickVariant(master.Variants, cfg.MaxHeight)
-			stream.URL = variant.URL
-			// A master that publishes audio as its own rendition leaves the chosen
-			// variant carrying video only. Narrowing to that variant and stopping
-			// there is how a cast ends up silent, or dies mapping an audio track
-			// that isn't there, so the rendition travels with it.
-			stream.AudioURL = master.AudioFor(variant)
-			stream.Live = stream.Live || master.Live
-			if stream.AudioURL != nil {
-				slog.InfoContext(ctx, "source publishes audio separately; both renditions will be read",
-					"video", stream.URL.String(), "audio", stream.AudioURL.String())
-			}
+			warnNoPreferredAudio(ctx, cfg.AudioLanguages, master.AudioLanguages(variant))
 		}
 	}
-
+	if len(cfg.SubtitleLanguages) > 0 {
+		if r, ok := master.SubtitlesFor(variant, cfg.SubtitleLanguages); ok {
+			stream.Subtitle = &media.SubtitleTrack{URL: r.URL, Language: r.Language}
+			slog.InfoContext(ctx, "showing the subtitle rendition in a preferred language",
+				"language", r.Language, "name", r.Name)
+		} else {
+			warnNoPreferredSubtitles(ctx, cfg.SubtitleLanguages, master.SubtitleLanguages(variant))
+		}
+	}
+	stream.Live = stream.Live || master.Live
+	if stream.AudioURL != nil {
+		slog.InfoContext(ctx, "source publishes audio separately; both renditions will be read",
+			"video", stream.URL.String(), "audio", stream.AudioURL.String())
+	}
 	return stream, nil
 }
 
+// pickTracks narrows a single-URL source to the audio and subtitle tracks in
+// the languages of cfg the viewer prefers most, listed from probed when the
+// source was already probed and otherwise from a probe of its own. With no
+// preference there is nothing to list, and a source whose tracks the probe
+// cannot read plays its defaults.
+func pickTracks(ctx context.Context, cfg Config, stream *media.Stream, probed *media.StreamInfo) {
+	if len(cfg.AudioLanguages) == 0 && len(cfg.SubtitleLanguages) == 0 {
+		return
+	}
+	if probed == nil {
+		info, err := probeStream(ctx, cfg.FFprobePath, cfg.ProbeTimeout, stream.URL, stream.Headers)
+		if err != nil {
+			slog.WarnContext(ctx, "could not list the source's tracks, playing its defaults", "error", err)
+			return
+		}
+		probed = info
+	}
+	if len(cfg.AudioLanguages) > 0 {
+		stream.AudioTrack = pickAudioTrack(ctx, cfg, probed)
+	}
+	if len(cfg.SubtitleLanguages) > 0 {
+		stream.Subtitle = pickSubtitleTrack(ctx, cfg, probed)
+	}
+}
+
+// pickAudioTrack returns which of a single-URL source's audio tracks is in the
+// language of cfg.AudioLanguages the viewer prefers most. A source with no
+// track in any of them plays its first.
+func pickAudioTrack(ctx context.Context, cfg Config, probed *media.StreamInfo) int {
+	i, ok := media.PreferredLanguage(cfg.AudioLanguages, probed.AudioLanguages)
+	if !ok {
+		warnNoPreferredAudio(ctx, cfg.AudioLanguages, probed.AudioLanguages)
+		return 0
+	}
+	slog.InfoContext(ctx, "playing the audio track in a preferred language",
+		"language", probed.AudioLanguages[i], "track", i)
+	return i
+}
+
+// pickSubtitleTrack returns the text subtitle track of a single-URL source in
+// the language of cfg.SubtitleLanguages the viewer prefers most, nil when it
+// has none in any of them. A picture-based track is listed untagged by the
+// probe, so it is never the one picked.
+func pickSubtitleTrack(ctx context.Context, cfg Config, probed *media.StreamInfo) *media.SubtitleTrack {
+	i, ok := media.PreferredLanguage(cfg.SubtitleLanguages, probed.SubtitleLanguages)
+	if !ok {
+		warnNoPreferredSubtitles(ctx, cfg.SubtitleLanguages, probed.SubtitleLanguages)
+		return nil
+	}
+	slog.InfoContext(ctx, "showing the subtitle track in a preferred language",
+		"language", probed.SubtitleLanguages[i], "track", i)
+	return &media.SubtitleTrack{Index: i, Language: probed.SubtitleLanguages[i]}
+}
+
+// warnNoPreferredSubtitles reports a source with no text subtitles in any of
+// the preferred languages, and what it has instead, before it is cast without.
+func warnNoPreferredSubtitles(ctx context.Context, prefs, available []string) {
+	slog.WarnContext(ctx, "source has no subtitles in a preferred language, showing none of its own",
+		"preferred", prefs, "available", available)
+}
+
+// warnNoPreferredAudio reports a source with no audio in any of the preferred
+// languages, and what it has instead, before it is cast with its default.
+func warnNoPreferredAudio(ctx context.Context, prefs, available []string) {
+	slog.WarnContext(ctx, "source has no audio in a preferred language, playing its default",
+		"preferred", prefs, "available", available)
+}
+
 // readPlaylist fetches an HLS document and reduces it to the variants and audio
 // renditions selection works on.
 func readPlaylist(ctx context.Context, cfg Config, stream *media.Stream) (hlsMaster, error) {
@@ -131,6 +247,8 @@ type candidate struct {
 	stream *media.Stream
 	height int  // probed video height; 0 if unknown or the probe failed
 	decoy  bool // probed cleanly but unplayable (no video+audio) or an ad
+
+	report event.Candidate // the probe as the event stream reports it
 }
 
 // exceedsCap reports whether a candidate's own resolution is a hard limit above
@@ -140,37 +258,41 @@ func (c candidate) exceedsCap(maxHeight int) bool {
 	return c.stream.ContentType != media.HLS && c.height > 0 && c.height > maxHeight
 }
 
-// bestCandidate picks the stream to cast: one within the height cap is always
-// preferred over one that exceeds it (so a direct 1080p beats a direct 4K when
-// capped at 1080, even at a lower bitrate); ties, and the all-over-cap case,
-// fall back to highest bandwidth, then tallest probed height. The height
-// tiebreak matters because ffprobe frequently can't report a top-level
-// bit_rate for an HLS master, which floors every such candidate's bandwidth to
-// the same value (see RankStreams) and would otherwise leave the pick to
-// whichever candidate happened to be probed first.
-func bestCandidate(pool []candidate, maxHeight int) candidate {
-	return slices.MaxFunc(pool, func(a, b candidate) int {
+// rankCandidates orders the pool best first, in place: one within the height
+// cap is always preferred over one that exceeds it (so a direct 1080p beats a
+// direct 4K when capped at 1080, even at a lower bitrate); ties, and the
+// all-over-cap case, fall back to highest bandwidth, then tallest probed
+// height. The height tiebreak matters because ffprobe frequently can't report a
+// top-level bit_rate for an HLS master, which floors every such candidate's
+// bandwidth to the same value (see RankStreams) and would otherwise leave the
+// order to whichever candidate happened to be probed first. Full ties keep the
+// extraction order.
+func rankCandidates(pool []candidate, maxHeight int) []candidate {
+	slices.SortStableFunc(pool, func(a, b candidate) int {
 		if ao, bo := a.exceedsCap(maxHeight), b.exceedsCap(maxHeight); ao != bo {
-			if bo {
-				return 1 // a is within the cap, b exceeds it: a wins
+			if ao {
+				return 1 // a exceeds the cap, b is within it: b first
 			}
 			return -1
 		}
 		return cmp.Or(
-			cmp.Compare(a.stream.Bandwidth, b.stream.Bandwidth),
-			cmp.Compare(a.height, b.height),
+			cmp.Compare(b.stream.Bandwidth, a.stream.Bandwidth),
+			cmp.Compare(b.height, a.height),
 		)
 	})
+	return pool
 }
 
-// RankStreams probes every candidate in parallel and returns the highest-
-// bandwidth playable one. A stream that probes cleanly but carries no castable
-// video+audio, or is too short to be anything but a spliced-in ad, is dropped
-// hard so it can't win when the real sources are unreachable. A stream whose
-// probe fails (403/timeout/reset) is kept at zero bandwidth as a last resort,
-// since the puller reconnects differently and may still succeed. If every
-// candidate is a decoy, ranking fails cleanly.
-func RankStreams(ctx context.Context, cfg Config, streams []*media.Stream) (*media.Stream, error) {
+// RankStreams probes every candidate in parallel and returns the playable ones
+// best first (see rankCandidates), the best being the one to cast and the rest
+// what a cast whose source fails before playback falls back to. A stream that
+// probes cleanly but carries no castable video+audio, or is too short to be
+// anything but a spliced-in ad, is dropped hard so it can't win when the real
+// sources are unreachable. A stream whose probe fails (403/timeout/reset) is
+// kept at zero bandwidth as a last resort, since the puller reconnects
+// differently and may still succeed. If every candidate is a decoy, ranking
+// fails cleanly.
+func RankStreams(ctx context.Context, cfg Config, streams []*media.Stream) ([]*media.Stream, error) {
 	slog.InfoContext(ctx, "ranking streams", "count", len(streams))
 	if len(streams) == 0 {
 		return nil, fmt.Errorf("no streams to rank")
@@ -188,6 +310,13 @@ func RankStreams(ctx context.Context, cfg Config, streams []*media.Stream) (*med
 
 			slog.DebugContext(ctx, "probing stream", "url", s.URL, "index", i+1, "total", len(streams))
 			info, err := probeStream(ctx, cfg.FFprobePath, cfg.ProbeTimeout, s.URL, s.Headers)
+			report := event.Candidate{URL: s.URL.String(), ContentType: s.ContentType}
+			if info != nil {
+				report.BitRate = info.BitRate
+				report.Height = info.VideoHeight
+				report.DurationSeconds = info.Duration.Seconds()
+				report.Live = info.Live()
+			}
 			out := &media.Stream{
 				URL:         s.URL,
 				AudioURL:    s.AudioURL,
@@ -200,25 +329,28 @@ func RankStreams(ctx context.Context, cfg Config, streams []*media.Stream) (*med
 			case err != nil:
 				// Transient failure (403/timeout/reset): keep as a zero-bandwidth fallback.
 				slog.WarnContext(ctx, "probe failed", "url", s.URL, "error", err)
+				report.ProbeError = err.Error()
 			case !info.Playable():
 				// Probed cleanly but no castable video+audio → decoy, drop hard.
 				slog.WarnContext(ctx, "stream rejected: no castable video+audio",
 					"url", s.URL, "has_video", info.HasVideo, "has_audio", info.HasAudio)
-				cands[i] = candidate{stream: out, decoy: true}
+				report.Rejected = "decoy"
+				cands[i] = candidate{stream: out, decoy: true, report: report}
 				return
 			case info.Duration > 0 && info.Duration < minContentDuration:
 				// Too short to be a feature/episode → spliced-in ad, drop hard so it
 				// can't win over the real title on bandwidth.
 				slog.WarnContext(ctx, "stream rejected: too short to be feature content, treating as ad",
 					"url", s.URL, "duration", info.Duration)
-				cands[i] = candidate{stream: out, decoy: true}
+				report.Rejected = "ad"
+				cands[i] = candidate{stream: out, decoy: true, report: report}
 				return
 			default:
 				out.Bandwidth = max(info.BitRate, 1)
 				out.Live = info.Live()
 				slog.DebugContext(ctx, "probed stream", "url", s.URL, "bitrate", info.BitRate, "height", info.VideoHeight, "live", out.Live)
 			}
-			cands[i] = candidate{stream: out}
+			cands[i] = candidate{stream: out, report: report}
 			if info != nil {
 				cands[i].height = info.VideoHeight
 			}
@@ -236,25 +368,45 @@ func RankStreams(ctx context.Context, cfg Config, streams []*media.Stream) (*med
 		pool = append(pool, c)
 	}
 	if len(pool) == 0 {
+		emitRanked(ctx, cands, "")
 		return nil, fmt.Errorf("no castable stream: all %d candidates were unreachable, carried no video+audio, or were ads", len(streams))
 	}
 
-	best := bestCandidate(pool, cfg.MaxHeight)
+	ranked := rankCandidates(pool, cfg.MaxHeight)
 	if decoys > 0 {
 		slog.InfoContext(ctx, "rejected decoy streams", "count", decoys, "kept", len(pool))
 	}
-	slog.InfoContext(ctx, "best stream selected", "url", best.stream.URL.String(), "bitrate", best.stream.Bandwidth, "height", best.height)
-	return best.stream, nil
+	best := ranked[0]
+	slog.InfoContext(ctx, "best stream selected", "url", best.stream.URL.String(), "bitrate", best.stream.Bandwidth, "height", best.height, "fallbacks", len(ranked)-1)
+	emitRanked(ctx, cands, best.stream.URL.String())
+	streams = make([]*media.Stream, len(ranked))
+	for i, c := range ranked {
+		streams[i] = c.stream
+	}
+	return streams, nil
 }
 
-// StreamDetail holds a stream URL and its probed bit rate, for display.
+func emitRanked(ctx context.Context, cands []candidate, chosen string) {
+	reports := make([]event.Candidate, len(cands))
+	for i, c := range cands {
+		reports[i] = c.report
+	}
+	event.Emit(ctx, event.CandidatesRanked, event.CandidatesData{Candidates: reports, Chosen: chosen})
+}
+
+// StreamDetail holds a stream URL, its probed bit rate and the languages its
+// audio can be played in and its own subtitles shown in, for display.
 type StreamDetail struct {
-	URL     string
-	BitRate int64
+	URL               string
+	BitRate           int64
+	AudioLanguages    []string
+	SubtitleLanguages []string
 }
 
 // ListStreams expands HLS variants and probes each, returning details for
-// display. Failures are logged and skipped.
+// display. A variant's audio languages are those of its audio renditions, or
+// of the tracks muxed into it when it names none; its subtitle languages are
+// those of its subtitle renditions. Failures are logged and skipped.
 func ListStreams(ctx context.Context, cfg Config, streams []*media.Stream) []StreamDetail {
 	var details []StreamDetail
 	for _, s := range streams {
@@ -270,7 +422,16 @@ func ListStreams(ctx context.Context, cfg Config, streams []*media.Stream) []Str
 					slog.WarnContext(ctx, "probe failed", "url", v.URL, "error", err)
 					continue
 				}
-				details = append(details, StreamDetail{URL: v.URL.String(), BitRate: info.BitRate})
+				langs := master.AudioLanguages(v)
+				if len(langs) == 0 {
+					langs = info.AudioLanguages
+				}
+				details = append(details, StreamDetail{
+					URL:               v.URL.String(),
+					BitRate:           info.BitRate,
+					AudioLanguages:    langs,
+					SubtitleLanguages: master.SubtitleLanguages(v),
+				})
 			}
 			continue
 		}
@@ -279,7 +440,12 @@ func ListStreams(ctx context.Context, cfg Config, streams []*media.Stream) []Str
 			slog.WarnContext(ctx, "probe failed", "url", s.URL, "error", err)
 			continue
 		}
-		details = append(details, StreamDetail{URL: s.URL.String(), BitRate: info.BitRate})
+		details = append(details, StreamDetail{
+			URL:               s.URL.String(),
+			BitRate:           info.BitRate,
+			AudioLanguages:    info.AudioLanguages,
+			SubtitleLanguages: slices.DeleteFunc(slices.Clone(info.SubtitleLanguages), func(l string) bool { return l == "" }),
+		})
 	}
 	return details
 }
@@ -1,8 +1,13 @@
 package resolve
 
 import (
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stupside/castor/internal/media"
 )
@@ -104,19 +109,101 @@ func TestParsePlaylistDemuxedMaster(t *testing.T) {
 	if got := variant.URL.Path; got != "/1080.m3u8" {
 		t.Errorf("pickVariant = %q, want /1080.m3u8", got)
 	}
-	audio := master.AudioFor(variant)
+	rendition, _ := master.AudioFor(variant, nil)
+	audio := rendition.URL
 	if audio == nil {
 		t.Fatal("the chosen variant's audio rendition was dropped: the cast would have no sound")
 	}
 	if got := audio.Path; got != "/audio/eng.m3u8" {
 		t.Errorf("audio rendition = %q, want /audio/eng.m3u8", got)
 	}
-	// Only audio is read as a second input today; a subtitle rendition is not.
+	// A subtitle rendition is kept apart from the audio the pull reads.
 	if _, ok := master.Audio["subs"]; ok {
 		t.Error("a SUBTITLES rendition must not register as an audio group")
 	}
 }
 
+// TestAudioForLanguage covers a master offering its audio in several
+// languages, listed dub first: the viewer's preferred language wins, and with
+// none of theirs on offer the DEFAULT=YES rendition does, not the first listed.
+func TestAudioForLanguage(t *testing.T) {
+	body := "#EXTM3U\n" +
+		`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="Español",LANGUAGE="es",URI="audio/spa.m3u8"` + "\n" +
+		`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="English",LANGUAGE="en",DEFAULT=YES,URI="audio/eng.m3u8"` + "\n" +
+		`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="Français",LANGUAGE="fr-FR",URI="audio/fre.m3u8"` + "\n" +
+		`#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,AUDIO="aud"` + "\n1080.m3u8\n"
+	u, _ := url.Parse("http://example.com/master.m3u8")
+
+	master, err := parsePlaylist(body, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant := pickVariant(master.Variants, 1080)
+	if got := master.AudioLanguages(variant); !slices.Equal(got, []string{"es", "en", "fr-FR"}) {
+		t.Errorf("audio languages = %q, want [es en fr-FR]", got)
+	}
+
+	cases := []struct {
+		prefs   []string
+		want    string
+		matched bool
+	}{
+		{nil, "/audio/eng.m3u8", false},
+		{[]string{"fre"}, "/audio/fre.m3u8", true},
+		{[]string{"de", "es"}, "/audio/spa.m3u8", true},
+		{[]string{"de"}, "/audio/eng.m3u8", false},
+	}
+	for _, c := range cases {
+		r, matched := master.AudioFor(variant, c.prefs)
+		if r.URL == nil || r.URL.Path != c.want || matched != c.matched {
+			t.Errorf("AudioFor(%q) = (%v, %v), want (%s, %v)", c.prefs, r.URL, matched, c.want, c.matched)
+		}
+	}
+}
+
+// TestSubtitlesForLanguage covers a master's subtitle renditions: unlike
+// audio, there is no falling back to DEFAULT=YES, since a viewer who asked for
+// no language, or for one not on offer, wants no subtitles drawn over the film.
+// A rendition with no URI is closed captions inside the video, not a track
+// castor can read, so it is not offered.
+func TestSubtitlesForLanguage(t *testing.T) {
+	body := "#EXTM3U\n" +
+		`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",DEFAULT=YES,URI="subs/eng.m3u8"` + "\n" +
+		`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Français",LANGUAGE="fr",URI="subs/fre.m3u8"` + "\n" +
+		`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Deutsch",LANGUAGE="de"` + "\n" +
+		`#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,SUBTITLES="subs"` + "\n1080.m3u8\n"
+	u, _ := url.Parse("http://example.com/master.m3u8")
+
+	master, err := parsePlaylist(body, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant := pickVariant(master.Variants, 1080)
+	if got := master.SubtitleLanguages(variant); !slices.Equal(got, []string{"en", "fr"}) {
+		t.Errorf("subtitle languages = %q, want [en fr]", got)
+	}
+
+	cases := []struct {
+		prefs []string
+		want  string // empty: no subtitles
+	}{
+		{nil, ""},
+		{[]string{"fre"}, "/subs/fre.m3u8"},
+		{[]string{"de", "en"}, "/subs/eng.m3u8"},
+		{[]string{"ja"}, ""},
+	}
+	for _, c := range cases {
+		r, ok := master.SubtitlesFor(variant, c.prefs)
+		got := ""
+		if ok {
+			got = r.URL.Path
+		}
+		if got != c.want {
+			t.Errorf("SubtitlesFor(%q) = %q, want %q", c.prefs, got, c.want)
+		}
+	}
+}
+
 // TestParsePlaylistMuxedRenditionStaysSingleInput guards the other half: an
 // EXT-X-MEDIA entry with no URI means the audio is inside the variant already,
 // so nothing extra must be read.
@@ -130,8 +217,8 @@ func TestParsePlaylistMuxedRenditionStaysSingleInput(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if got := master.AudioFor(pickVariant(master.Variants, 1080)); got != nil {
-		t.Errorf("a rendition without a URI is muxed into the variant; got a second input %q", got)
+	if got, _ := master.AudioFor(pickVariant(master.Variants, 1080), nil); got.URL != nil {
+		t.Errorf("a rendition without a URI is muxed into the variant; got a second input %q", got.URL)
 	}
 }
 
@@ -149,7 +236,8 @@ func TestParsePlaylistRenditionAfterVariants(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	audio := master.AudioFor(pickVariant(master.Variants, 1080))
+	rendition, _ := master.AudioFor(pickVariant(master.Variants, 1080), nil)
+	audio := rendition.URL
 	if audio == nil {
 		t.Fatal("a rendition declared after its variant was dropped: the cast would have no sound")
 	}
@@ -178,7 +266,7 @@ func TestPickVariantSkipsAudioOnly(t *testing.T) {
 	}
 }
 
-func TestBestCandidate(t *testing.T) {
+func TestRankCandidates(t *testing.T) {
 	direct := func(path string, height int, bw int64) candidate {
 		return candidate{stream: &media.Stream{URL: &url.URL{Path: path}, Bandwidth: bw, ContentType: media.MP4}, height: height}
 	}
@@ -225,8 +313,59 @@ func TestBestCandidate(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := bestCandidate(tt.pool, tt.maxHeight).stream.URL.Path; got != tt.want {
-				t.Errorf("bestCandidate = %q, want %q", got, tt.want)
+			if got := rankCandidates(tt.pool, tt.maxHeight)[0].stream.URL.Path; got != tt.want {
+				t.Errorf("best candidate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The rest follow in the same order: what a failed cast falls back to.
+	pool := []candidate{direct("/4k", 2160, 20_000_000), direct("/480", 480, 1_000_000), direct("/1080", 1080, 6_000_000)}
+	var got []string
+	for _, c := range rankCandidates(pool, 1080) {
+		got = append(got, c.stream.URL.Path)
+	}
+	if want := []string{"/1080", "/480", "/4k"}; !slices.Equal(got, want) {
+		t.Errorf("ranked = %v, want %v", got, want)
+	}
+}
+
+// TestRefreshKeepsVariant pins a resumed cast's source: a master extracted
+// afresh is narrowed to the variant the cast was reading, even where Resolve
+// would now pick another, and afresh only once that variant is gone.
+func TestRefreshKeepsVariant(t *testing.T) {
+	master := "#EXTM3U\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720\n720.m3u8?token=new\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080\n1080.m3u8?token=new\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, master)
+	}))
+	t.Cleanup(srv.Close)
+	cfg := Config{HLSTimeout: 5 * time.Second, MaxHeight: 1080}
+	fresh := func() *media.Stream {
+		u, err := url.Parse(srv.URL + "/master.m3u8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &media.Stream{URL: u, ContentType: media.HLS}
+	}
+
+	tests := []struct {
+		name    string
+		variant media.Variant
+		want    string
+	}{
+		{"the variant being cast is kept", media.Variant{Bandwidth: 3_000_000, Height: 720}, "/720.m3u8"},
+		{"a variant no longer listed is picked afresh", media.Variant{Bandwidth: 4_000_000, Height: 720}, "/1080.m3u8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Refresh(t.Context(), cfg, fresh(), &media.Stream{Variant: tt.variant})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.URL.Path != tt.want || got.URL.Query().Get("token") != "new" {
+				t.Errorf("Refresh() = %s, want %s under the fresh token", got.URL, tt.want)
 			}
 		})
 	}
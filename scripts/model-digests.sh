@@ -0,0 +1,19 @@
+#!/usr/bin/env bash
+# Print the SHA-256 of every model in the catalog, as Hugging Face records it
+# for the file's LFS object, in the form models.Catalog pins it. Run from the
+# repo root when adding a model or bumping one; needs curl and jq.
+set -euo pipefail
+
+catalog=internal/cast/subtitle/models/models.go
+
+digests() {
+  curl -fsSL "https://huggingface.co/api/models/$1/tree/main" |
+    jq -r '.[] | select(.lfs) | "\(.path) \(.lfs.oid)"'
+}
+
+sums=$( { digests ggerganov/whisper.cpp; digests ggml-org/whisper-vad; } )
+
+grep -o 'File: "[^"]*"' "$catalog" | cut -d'"' -f2 | while read -r file; do
+  sum=$(awk -v f="$file" '$1 == f { print $2 }' <<<"$sums")
+  printf '%-28s SHA256: "%s"\n' "$file" "${sum:?no LFS digest published for $file}"
+done